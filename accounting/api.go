@@ -0,0 +1,164 @@
+package energyaccounting
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Summary periods
+const (
+	Day   = "day"
+	Month = "month"
+)
+
+// Row is the energy of a period, in Wh.
+type Row struct {
+	Start      time.Time `json:"start"`
+	Import     float64   `json:"import"`
+	Export     float64   `json:"export"`
+	Production float64   `json:"production"`
+	// Consumption is the energy consumed by the house, imported or produced.
+	Consumption float64 `json:"consumption"`
+	// SelfConsumption is the production consumed by the house.
+	SelfConsumption float64 `json:"self_consumption"`
+	// SelfConsumptionRatio is the share of the production consumed by the house,
+	// 0 without production.
+	SelfConsumptionRatio float64            `json:"self_consumption_ratio"`
+	EV                   float64            `json:"ev"`
+	Circuits             map[string]float64 `json:"circuits"`
+}
+
+// Summary is the body of the summary endpoint.
+type Summary struct {
+	Period string `json:"period"`
+	Rows   []Row  `json:"rows"`
+}
+
+// summary returns the energy of every day or month starting in [from, to).
+func (s *store) summary(period string, from, to time.Time) Summary {
+	summary := Summary{Period: period, Rows: []Row{}}
+	channels := s.channels()
+	for start := from; start.Before(to); {
+		end := start.AddDate(0, 0, 1)
+		if period == Month {
+			end = start.AddDate(0, 1, 0)
+		}
+		sum := func(role string) float64 {
+			var total float64
+			for _, name := range channels[role] {
+				total += s.sum(name, start, end)
+			}
+			return total
+		}
+		row := Row{
+			Start:      start,
+			Import:     sum(Import),
+			Export:     sum(Export),
+			Production: sum(Production),
+			EV:         sum(EV),
+			Circuits:   map[string]float64{},
+		}
+		if row.Production > row.Export {
+			row.SelfConsumption = row.Production - row.Export
+			row.SelfConsumptionRatio = row.SelfConsumption / row.Production
+		}
+		row.Consumption = row.Import + row.SelfConsumption
+		for _, name := range channels[Circuit] {
+			row.Circuits[name] = s.sum(name, start, end)
+		}
+		summary.Rows = append(summary.Rows, row)
+		start = end
+	}
+	return summary
+}
+
+// parseRange parses the from and to dates of a query, by default the current
+// month by day or the current year by month. to is excluded.
+func parseRange(period, from, to string, now time.Time, location *time.Location) (time.Time, time.Time, error) {
+	y, m, _ := now.In(location).Date()
+	start, end := time.Date(y, m, 1, 0, 0, 0, 0, location), time.Date(y, m+1, 1, 0, 0, 0, 0, location)
+	if period == Month {
+		start, end = time.Date(y, 1, 1, 0, 0, 0, 0, location), time.Date(y+1, 1, 1, 0, 0, 0, 0, location)
+	}
+	var err error
+	if from != "" {
+		if start, err = time.ParseInLocation("2006-01-02", from, location); err != nil {
+			return start, end, fmt.Errorf("invalid from date: %w", err)
+		}
+	}
+	if to != "" {
+		if end, err = time.ParseInLocation("2006-01-02", to, location); err != nil {
+			return start, end, fmt.Errorf("invalid to date: %w", err)
+		}
+	}
+	if period == Month {
+		start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, location)
+	}
+	if !start.Before(end) {
+		return start, end, fmt.Errorf("from must be before to")
+	}
+	return start, end, nil
+}
+
+// handler returns the REST API:
+//
+//	GET /api/channels                                    the channel names by role
+//	GET /api/summary?period=day|month&from=...&to=...    the energy by day or month
+//	GET /api/report?month=2024-01&format=json|csv|html   the report of a month
+func (s *Service) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/channels", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, s.store.channels())
+	})
+	mux.HandleFunc("/api/summary", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		period := q.Get("period")
+		if period == "" {
+			period = Day
+		}
+		if period != Day && period != Month {
+			http.Error(w, "period must be day or month", http.StatusBadRequest)
+			return
+		}
+		from, to, err := parseRange(period, q.Get("from"), q.Get("to"), time.Now(), s.location)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJson(w, s.store.summary(period, from, to))
+	})
+	mux.HandleFunc("/api/report", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		month, err := parseMonth(q.Get("month"), time.Now(), s.location)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report := s.store.report(month, s.settings.Tariff, s.location)
+		switch q.Get("format") {
+		case "", Json:
+			writeJson(w, report)
+		case Csv:
+			w.Header().Set("Content-Type", "text/csv")
+			err = report.writeCsv(w)
+		case Html:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			err = report.writeHtml(w)
+		default:
+			http.Error(w, "format must be json, csv or html", http.StatusBadRequest)
+		}
+		if err != nil {
+			fmt.Printf("%s: error writing a report: %s\n", ProgNameMqtt, err)
+		}
+	})
+	return mux
+}
+
+func writeJson(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		fmt.Printf("%s: error writing a response: %s\n", ProgNameMqtt, err)
+	}
+}
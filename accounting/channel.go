@@ -0,0 +1,117 @@
+package energyaccounting
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Channel roles
+const (
+	Import     = "import"
+	Export     = "export"
+	Production = "production"
+	Circuit    = "circuit"
+	EV         = "ev"
+)
+
+// Channel kinds
+const (
+	// Index is an energy index, in Wh once scaled, the energy is its increase.
+	Index = "index"
+	// Power is a power, in W once scaled, the energy is its integral.
+	Power = "power"
+)
+
+// MaxPowerGap bounds the time a power is integrated over, for the energy not to
+// jump when a sensor comes back after an outage.
+const MaxPowerGap = 1 * time.Minute
+
+// Channel is a topic the energy of a role is accounted from.
+type Channel struct {
+	// Name names the channel in the store and the API. For a topic with wildcards,
+	// it is followed by the levels the wildcards match, e.g. powertag/+/energy
+	// gives 0x42 without name and circuit/0x42 with the name circuit.
+	Name string `yaml:"name"`
+	// Role is import, export, production, circuit or ev.
+	Role  string `yaml:"role"`
+	Topic string `yaml:"topic"`
+	// Kind is index (the default) or power.
+	Kind string `yaml:"kind"`
+	// Scale converts the values to Wh or W, e.g. 1000 for kWh or kW.
+	Scale float64 `yaml:"scale"`
+}
+
+func (c Channel) validate() error {
+	switch c.Role {
+	case Import, Export, Production, Circuit, EV:
+	default:
+		return fmt.Errorf("unsupported role '%s' of %s, expected import, export, production, circuit or ev", c.Role, c.Topic)
+	}
+	switch c.Kind {
+	case "", Index, Power:
+	default:
+		return fmt.Errorf("unsupported kind '%s' of %s, expected index or power", c.Kind, c.Topic)
+	}
+	if c.Topic == "" {
+		return fmt.Errorf("missing topic of a %s channel", c.Role)
+	}
+	if c.Name == "" && !strings.ContainsAny(c.Topic, "+#") {
+		return fmt.Errorf("missing name of %s", c.Topic)
+	}
+	return nil
+}
+
+// name returns the name of the channel for a topic matching it.
+func (c Channel) name(topic string) string {
+	matched := wildcardLevels(c.Topic, topic)
+	if len(matched) == 0 {
+		return c.Name
+	}
+	if c.Name == "" {
+		return strings.Join(matched, "/")
+	}
+	return c.Name + "/" + strings.Join(matched, "/")
+}
+
+func (c Channel) scale() float64 {
+	if c.Scale == 0 {
+		return 1
+	}
+	return c.Scale
+}
+
+// wildcardLevels returns the levels of topic matched by the wildcards of filter.
+func wildcardLevels(filter, topic string) []string {
+	var matched []string
+	levels := strings.Split(topic, "/")
+	for i, f := range strings.Split(filter, "/") {
+		switch {
+		case i >= len(levels):
+			return matched
+		case f == "#":
+			return append(matched, levels[i:]...)
+		case f == "+":
+			matched = append(matched, levels[i])
+		}
+	}
+	return matched
+}
+
+// powerSample is the last power of a power channel.
+type powerSample struct {
+	power float64
+	at    time.Time
+}
+
+// integrate returns the energy, in Wh, of the previous power until at.
+func (p powerSample) integrate(at time.Time) float64 {
+	if p.at.IsZero() || !at.After(p.at) {
+		return 0
+	}
+	elapsed := at.Sub(p.at)
+	if elapsed > MaxPowerGap {
+		elapsed = MaxPowerGap
+	}
+	return p.power * elapsed.Hours()
+}
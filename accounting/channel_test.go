@@ -0,0 +1,37 @@
+package energyaccounting
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChannelName(t *testing.T) {
+	for _, c := range []struct {
+		channel Channel
+		topic   string
+		want    string
+	}{
+		{Channel{Name: "grid_import", Topic: "powerinfo/totalIndex"}, "powerinfo/totalIndex", "grid_import"},
+		{Channel{Topic: "powertag/+/energy"}, "powertag/0x42/energy", "0x42"},
+		{Channel{Name: "garage", Topic: "powertag/garage/+/energy"}, "powertag/garage/0x42/energy", "garage/0x42"},
+		{Channel{Name: "ev", Topic: "ocpp/#"}, "ocpp/cp1/energy", "ev/cp1/energy"},
+	} {
+		if got := c.channel.name(c.topic); got != c.want {
+			t.Errorf("%s on %s: got %s, want %s", c.channel.Topic, c.topic, got, c.want)
+		}
+	}
+}
+
+func TestPowerIntegrate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := powerSample{power: 3600, at: start}
+	if e := p.integrate(start.Add(10 * time.Second)); e != 10 {
+		t.Errorf("10 s at 3600 W: got %v Wh, want 10", e)
+	}
+	if e := p.integrate(start.Add(1 * time.Hour)); e != 60 {
+		t.Errorf("after an outage: got %v Wh, want the energy of MaxPowerGap", e)
+	}
+	if e := (powerSample{}).integrate(start); e != 0 {
+		t.Errorf("first sample: got %v Wh, want 0", e)
+	}
+}
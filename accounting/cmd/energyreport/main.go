@@ -0,0 +1,11 @@
+package main
+
+import (
+	"energyaccounting"
+	// The alpine images have no time zone database
+	_ "time/tzdata"
+)
+
+func main() {
+	energyaccounting.ReportMain()
+}
@@ -0,0 +1,140 @@
+// Package energyaccounting accounts the energy imported, exported, produced and
+// consumed by every circuit from the energy-center topics, and serves the daily
+// and monthly totals, the solar self-consumption and the monthly cost reports
+// over a REST API.
+package energyaccounting
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"energy-center/influx"
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+const ProgNameMqtt string = "energyaccounting"
+
+// Settings are the settings of the accounting, from the configuration file of
+// energyaccounting or the accounting section of the energy-center configuration file.
+type Settings struct {
+	// Mqtt is the broker connection of energyaccounting, ignored by the daemon.
+	Mqtt     mqttclient.Config `yaml:"mqtt"`
+	Channels []Channel         `yaml:"channels"`
+	// StoreFile persists the accounted energy, kept in memory only when empty.
+	StoreFile string `yaml:"store_file"`
+	// Resolution is the duration of the buckets the energy is accounted in.
+	Resolution time.Duration `yaml:"resolution"`
+	// Downsampling merges the older buckets into coarser ones, by increasing age.
+	Downsampling []Tier `yaml:"downsampling"`
+	// Retention drops the energy older than it, kept forever when 0.
+	Retention time.Duration `yaml:"retention"`
+	// SaveInterval is the delay between two writes of the store file.
+	SaveInterval time.Duration `yaml:"save_interval"`
+	// Listen is the address of the REST API.
+	Listen string `yaml:"listen"`
+	// Location is the time zone of the days and months.
+	Location string `yaml:"location"`
+	// Influx configures the optional InfluxDB output of the accounted energy.
+	Influx influx.Config `yaml:"influx"`
+	// Tariff prices the monthly reports.
+	Tariff TariffConfig `yaml:"tariff"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Mqtt: mqttclient.Config{Url: "192.168.0.20:1883", ClientId: ProgNameMqtt},
+		Channels: []Channel{
+			{Name: "grid_import", Role: Import, Topic: "powerinfo/totalIndex"},
+			{Name: "grid_export", Role: Export, Topic: "powerinfo/totalInjIndex"},
+			{Role: Circuit, Topic: "powertag/+/energy"},
+		},
+		StoreFile:  "/data/energyaccounting.json",
+		Resolution: 1 * time.Minute,
+		Downsampling: []Tier{
+			{After: 48 * time.Hour, Resolution: 15 * time.Minute},
+			{After: 30 * 24 * time.Hour, Resolution: 1 * time.Hour},
+		},
+		SaveInterval: 1 * time.Minute,
+		Listen:       ":8090",
+		Location:     "Europe/Paris",
+		Tariff:       TariffConfig{TempoTopic: "teleinfo/STGE_tempo_today"},
+	}
+}
+
+func (s Settings) Validate() error {
+	if len(s.Channels) == 0 {
+		return fmt.Errorf("no channel configured")
+	}
+	for _, c := range s.Channels {
+		if err := c.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Resolution < time.Second || time.Hour%s.Resolution != 0 {
+		return fmt.Errorf("resolution must divide an hour, and be at least a second")
+	}
+	if err := validateTiers(s.Resolution, s.Downsampling, s.Retention); err != nil {
+		return err
+	}
+	if s.SaveInterval <= 0 {
+		return fmt.Errorf("save_interval must be positive")
+	}
+	if err := s.Tariff.validate(); err != nil {
+		return err
+	}
+	return s.Influx.Validate()
+}
+
+// LoadSettings reads the settings from a YAML file, over the defaults.
+func LoadSettings(path string) (Settings, error) {
+	settings := DefaultSettings()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return settings, err
+	}
+	if err = yaml.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Main runs the accounting with its own MQTT connection, configured by a YAML file.
+func Main() {
+	var path string
+	flag.StringVar(&path, "config", "/etc/energyaccounting.yaml", "YAML configuration file")
+	flag.Parse()
+
+	settings, err := LoadSettings(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	mqtt.ERROR = log.New(os.Stdout, "", 0)
+	client, err := mqttclient.New(settings.Mqtt, mqttclient.Options{ConnectRetry: true})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	service, err := NewService(client, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
@@ -0,0 +1,325 @@
+package energyaccounting
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"energy-center/tariff"
+)
+
+// Report formats
+const (
+	Csv  = "csv"
+	Html = "html"
+	Json = "json"
+)
+
+// TariffConfig prices the reports, without costs when Option is empty.
+type TariffConfig struct {
+	tariff.Config `yaml:",inline"`
+	// TempoTopic is the topic the Tempo color or EJP day is read from, as published
+	// by teleinfo2mqtt, recorded for the reports.
+	TempoTopic string `yaml:"tempo_topic"`
+}
+
+func (c TariffConfig) enabled() bool {
+	return c.Option != ""
+}
+
+func (c TariffConfig) validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	return c.Config.Validate()
+}
+
+// hasDays reports whether the prices depend on a day recorded from TempoTopic.
+func (c TariffConfig) hasDays() bool {
+	return c.Option == tariff.OptionTempo || c.Option == tariff.OptionEjp
+}
+
+// PeriodLine is the energy imported during a tariff period, in kWh, and its cost.
+type PeriodLine struct {
+	Period string  `json:"period"`
+	Import float64 `json:"import"`
+	Cost   float64 `json:"cost"`
+}
+
+// CircuitLine is the energy of a circuit, in kWh, and the cost of its share of
+// the imported energy.
+type CircuitLine struct {
+	Name   string  `json:"name"`
+	Energy float64 `json:"energy"`
+	Cost   float64 `json:"cost"`
+}
+
+// Report is the monthly report, the energies in kWh.
+type Report struct {
+	Month                time.Time `json:"month"`
+	Currency             string    `json:"currency,omitempty"`
+	Import               float64   `json:"import"`
+	Export               float64   `json:"export"`
+	Production           float64   `json:"production"`
+	Consumption          float64   `json:"consumption"`
+	SelfConsumption      float64   `json:"self_consumption"`
+	SelfConsumptionRatio float64   `json:"self_consumption_ratio"`
+	ImportCost           float64   `json:"import_cost"`
+	EV                   float64   `json:"ev"`
+	// EVSolar is the solar share of the EV charging, the solar share of the house
+	// consumption during every bucket.
+	EVSolar      float64       `json:"ev_solar"`
+	EVSolarShare float64       `json:"ev_solar_share"`
+	Periods      []PeriodLine  `json:"periods"`
+	Circuits     []CircuitLine `json:"circuits"`
+}
+
+// report computes the report of the month of the given time, bucket by bucket for
+// the prices and the solar shares to follow the time of the consumption, the
+// downsampled buckets being priced at their start.
+func (s *store) report(month time.Time, config TariffConfig, location *time.Location) Report {
+	y, m, _ := month.In(location).Date()
+	start, end := time.Date(y, m, 1, 0, 0, 0, 0, location), time.Date(y, m+1, 1, 0, 0, 0, 0, location)
+	r := Report{Month: start}
+	channels := s.channels()
+	sum := func(role string, at time.Time) float64 {
+		var total float64
+		for _, name := range channels[role] {
+			total += s.bucket(name, at)
+		}
+		return total
+	}
+
+	periods := map[string]*PeriodLine{}
+	circuits := map[string]*CircuitLine{}
+	for _, name := range channels[Circuit] {
+		circuits[name] = &CircuitLine{Name: name}
+	}
+	var prices *tariff.Tariff
+	var date string
+	for _, at := range s.starts(start, end) {
+		local := at.In(location)
+		if config.enabled() && local.Format("2006-01-02") != date {
+			// Unknown days take the default prices of a new tariff
+			date = local.Format("2006-01-02")
+			prices, _ = tariff.New(config.Config)
+			prices.SetDay(s.day(date))
+		}
+		imported, exported, produced, ev := sum(Import, at), sum(Export, at), sum(Production, at), sum(EV, at)
+		selfConsumed := math.Max(produced-exported, 0)
+		gridShare := 1.0
+		if consumed := imported + selfConsumed; consumed > 0 {
+			gridShare = imported / consumed
+		}
+		r.Import += imported
+		r.Export += exported
+		r.Production += produced
+		r.SelfConsumption += selfConsumed
+		r.EV += ev
+		r.EVSolar += ev * (1 - gridShare)
+
+		var price float64
+		if prices != nil {
+			price = prices.Price(local)
+			if period := prices.Period(local); imported > 0 {
+				if periods[period] == nil {
+					periods[period] = &PeriodLine{Period: period}
+				}
+				periods[period].Import += imported / 1000
+				periods[period].Cost += imported / 1000 * price
+				r.ImportCost += imported / 1000 * price
+			}
+		}
+		for name, c := range circuits {
+			energy := s.bucket(name, at)
+			c.Energy += energy / 1000
+			c.Cost += energy / 1000 * gridShare * price
+		}
+	}
+
+	if r.Production > 0 {
+		r.SelfConsumptionRatio = r.SelfConsumption / r.Production
+	}
+	if r.EV > 0 {
+		r.EVSolarShare = r.EVSolar / r.EV
+	}
+	r.Consumption = r.Import + r.SelfConsumption
+	for _, e := range []*float64{&r.Import, &r.Export, &r.Production, &r.Consumption, &r.SelfConsumption, &r.EV, &r.EVSolar} {
+		*e /= 1000
+	}
+	if config.enabled() {
+		r.Currency = config.Currency
+		if r.Currency == "" {
+			r.Currency = tariff.DefaultCurrency
+		}
+	}
+	r.Periods = []PeriodLine{}
+	for _, p := range periods {
+		r.Periods = append(r.Periods, *p)
+	}
+	sort.Slice(r.Periods, func(i, j int) bool { return r.Periods[i].Period < r.Periods[j].Period })
+	r.Circuits = []CircuitLine{}
+	for _, c := range circuits {
+		r.Circuits = append(r.Circuits, *c)
+	}
+	sort.Slice(r.Circuits, func(i, j int) bool { return r.Circuits[i].Name < r.Circuits[j].Name })
+	return r
+}
+
+func kwh(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+func money(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func ratio(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+// writeCsv writes the report as section,name,kwh,cost,ratio lines, for a spreadsheet.
+func (r Report) writeCsv(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"section", "name", "kwh", "cost", "ratio"})
+	out.Write([]string{"summary", "import", kwh(r.Import), money(r.ImportCost), ""})
+	out.Write([]string{"summary", "export", kwh(r.Export), "", ""})
+	out.Write([]string{"summary", "production", kwh(r.Production), "", ""})
+	out.Write([]string{"summary", "consumption", kwh(r.Consumption), "", ""})
+	out.Write([]string{"summary", "self_consumption", kwh(r.SelfConsumption), "", ratio(r.SelfConsumptionRatio)})
+	out.Write([]string{"summary", "ev", kwh(r.EV), "", ""})
+	out.Write([]string{"summary", "ev_solar", kwh(r.EVSolar), "", ratio(r.EVSolarShare)})
+	for _, p := range r.Periods {
+		out.Write([]string{"period", p.Period, kwh(p.Import), money(p.Cost), ""})
+	}
+	for _, c := range r.Circuits {
+		out.Write([]string{"circuit", c.Name, kwh(c.Energy), money(c.Cost), ""})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"kwh":   kwh,
+	"money": money,
+	"percent": func(v float64) string {
+		return strconv.FormatFloat(v*100, 'f', 1, 64) + " %"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Energy report {{.Month.Format "2006-01"}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+td { text-align: right; }
+td:first-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>Energy report {{.Month.Format "January 2006"}}</h1>
+<table>
+<tr><th></th><th>kWh</th><th>{{.Currency}}</th><th></th></tr>
+<tr><td>Import</td><td>{{kwh .Import}}</td><td>{{money .ImportCost}}</td><td></td></tr>
+<tr><td>Export</td><td>{{kwh .Export}}</td><td></td><td></td></tr>
+<tr><td>Production</td><td>{{kwh .Production}}</td><td></td><td></td></tr>
+<tr><td>Consumption</td><td>{{kwh .Consumption}}</td><td></td><td></td></tr>
+<tr><td>Self-consumption</td><td>{{kwh .SelfConsumption}}</td><td></td><td>{{percent .SelfConsumptionRatio}}</td></tr>
+<tr><td>EV charging</td><td>{{kwh .EV}}</td><td></td><td></td></tr>
+<tr><td>EV solar</td><td>{{kwh .EVSolar}}</td><td></td><td>{{percent .EVSolarShare}}</td></tr>
+</table>
+{{if .Periods}}<h2>Tariff periods</h2>
+<table>
+<tr><th>Period</th><th>kWh</th><th>{{.Currency}}</th></tr>
+{{range .Periods}}<tr><td>{{.Period}}</td><td>{{kwh .Import}}</td><td>{{money .Cost}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Circuits}}<h2>Circuits</h2>
+<table>
+<tr><th>Circuit</th><th>kWh</th><th>{{.Currency}}</th></tr>
+{{range .Circuits}}<tr><td>{{.Name}}</td><td>{{kwh .Energy}}</td><td>{{money .Cost}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+func (r Report) writeHtml(w io.Writer) error {
+	return reportTemplate.Execute(w, r)
+}
+
+// parseMonth parses a month formatted as 2006-01, by default the previous one.
+func parseMonth(month string, now time.Time, location *time.Location) (time.Time, error) {
+	if month == "" {
+		y, m, _ := now.In(location).Date()
+		return time.Date(y, m-1, 1, 0, 0, 0, 0, location), nil
+	}
+	t, err := time.ParseInLocation("2006-01", month, location)
+	if err != nil {
+		return t, fmt.Errorf("invalid month '%s', expected e.g. 2024-01", month)
+	}
+	return t, nil
+}
+
+// ReportMain writes the report of a month from the store file of energyaccounting.
+func ReportMain() {
+	var path, month, format, output string
+	flag.StringVar(&path, "config", "/etc/energyaccounting.yaml", "YAML configuration file of energyaccounting")
+	flag.StringVar(&month, "month", "", "month of the report, e.g. 2024-01, the previous one by default")
+	flag.StringVar(&format, "format", Csv, "csv or html")
+	flag.StringVar(&output, "output", "", "output file, the standard output by default")
+	flag.Parse()
+
+	settings, err := LoadSettings(path)
+	if err == nil {
+		err = settings.Validate()
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	location, err := time.LoadLocation(settings.Location)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	start, err := parseMonth(month, time.Now(), location)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	st, err := openStore(settings.StoreFile, settings.Resolution)
+	if err != nil {
+		fmt.Printf("error loading %s: %s\n", settings.StoreFile, err)
+		os.Exit(1)
+	}
+	report := st.report(start, settings.Tariff, location)
+
+	w := os.Stdout
+	if output != "" {
+		if w, err = os.Create(output); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer w.Close()
+	}
+	switch format {
+	case Csv:
+		err = report.writeCsv(w)
+	case Html:
+		err = report.writeHtml(w)
+	default:
+		err = fmt.Errorf("unsupported format '%s', expected csv or html", format)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
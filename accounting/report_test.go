@@ -0,0 +1,89 @@
+package energyaccounting
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"energy-center/tariff"
+)
+
+func TestReport(t *testing.T) {
+	s, _ := openStore("", time.Hour)
+	day := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	// An off-peak night charge from the grid
+	s.addEnergy("grid_import", Import, day.Add(2*time.Hour), 7000)
+	s.addEnergy("wallbox", EV, day.Add(2*time.Hour), 7000)
+	// A sunny noon, half the consumption from the panels
+	s.addEnergy("grid_import", Import, day.Add(12*time.Hour), 2000)
+	s.addEnergy("pv", Production, day.Add(12*time.Hour), 3000)
+	s.addEnergy("grid_export", Export, day.Add(12*time.Hour), 1000)
+	s.addEnergy("wallbox", EV, day.Add(12*time.Hour), 3000)
+	s.addEnergy("0x42", Circuit, day.Add(12*time.Hour), 1000)
+	// Outside of the month
+	s.addEnergy("grid_import", Import, day.AddDate(0, 1, 0), 5000)
+
+	config := TariffConfig{Config: tariff.Config{Option: tariff.OptionHpHc, Peak: 0.3, OffPeak: 0.2}}
+	r := s.report(day, config, time.UTC)
+
+	if r.Import != 9 || r.Export != 1 || r.Production != 3 || r.SelfConsumption != 2 || r.Consumption != 11 {
+		t.Errorf("summary: got %+v", r)
+	}
+	if math.Abs(r.ImportCost-2) > 1e-9 || r.Currency != "EUR" {
+		t.Errorf("import cost: got %v %s, want 2 EUR", r.ImportCost, r.Currency)
+	}
+	if r.EVSolar != 1.5 || math.Abs(r.EVSolarShare-0.15) > 1e-9 {
+		t.Errorf("ev solar: got %v kWh, %v", r.EVSolar, r.EVSolarShare)
+	}
+	if len(r.Periods) != 2 || r.Periods[0].Period != "hc" || r.Periods[0].Import != 7 || r.Periods[1].Import != 2 {
+		t.Errorf("periods: got %+v", r.Periods)
+	}
+	if len(r.Circuits) != 1 || r.Circuits[0].Energy != 1 || math.Abs(r.Circuits[0].Cost-0.15) > 1e-9 {
+		t.Errorf("circuits: got %+v", r.Circuits)
+	}
+
+	var out bytes.Buffer
+	if err := r.writeCsv(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"summary,import,9.000,2.00,", "period,hc,7.000,1.40,", "circuit,0x42,1.000,0.15,"} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("csv: missing %s in\n%s", line, out.String())
+		}
+	}
+	out.Reset()
+	if err := r.writeHtml(&out); err != nil || !strings.Contains(out.String(), "<td>0x42</td>") {
+		t.Errorf("html: %v\n%s", err, out.String())
+	}
+}
+
+func TestReportTempoDays(t *testing.T) {
+	s, _ := openStore("", time.Hour)
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	s.addEnergy("grid_import", Import, day.Add(10*time.Hour), 1000)
+	s.addEnergy("grid_import", Import, day.Add(34*time.Hour), 1000)
+	s.setDay("2024-01-10", tariff.Red)
+
+	config := TariffConfig{Config: tariff.Config{Option: tariff.OptionTempo, Tempo: map[string]tariff.PeakPrices{
+		tariff.Blue:  {Peak: 0.16, OffPeak: 0.13},
+		tariff.White: {Peak: 0.19, OffPeak: 0.15},
+		tariff.Red:   {Peak: 0.76, OffPeak: 0.16},
+	}}}
+	r := s.report(day, config, time.UTC)
+	if len(r.Periods) != 2 || r.Periods[0].Period != "hp_bleu" || r.Periods[1].Period != "hp_rouge" {
+		t.Errorf("periods: got %+v, want the unknown day blue", r.Periods)
+	}
+}
+
+func TestReportWithoutTariff(t *testing.T) {
+	s, _ := openStore("", time.Hour)
+	day := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	s.addEnergy("grid_import", Import, day, 1000)
+	s.addEnergy("0x42", Circuit, day, 1000)
+	r := s.report(day, TariffConfig{}, time.UTC)
+	if r.Import != 1 || r.ImportCost != 0 || len(r.Periods) != 0 || r.Circuits[0].Cost != 0 {
+		t.Errorf("got %+v", r)
+	}
+}
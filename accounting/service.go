@@ -0,0 +1,160 @@
+package energyaccounting
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"energy-center/influx"
+	"energy-center/tariff"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MaxPending bounds the InfluxDB points kept while InfluxDB is unreachable.
+const MaxPending = 10000
+
+// Service is the accounting, fed by a MQTT connection it does not own, either the
+// one of energyaccounting or the one shared by the energy-center daemon.
+type Service struct {
+	settings Settings
+	store    *store
+	location *time.Location
+	// influx is nil when the InfluxDB output is disabled, the points are written
+	// by batches at every save of the store.
+	influx *influx.Client
+	server *http.Server
+
+	mu      sync.Mutex
+	power   map[string]powerSample
+	pending []string
+}
+
+// NewService loads the store, listens for the REST API and subscribes to the
+// channels. The client must restore the subscriptions on reconnection, as a
+// mqttclient.Client does.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(settings.Location)
+	if err != nil {
+		return nil, err
+	}
+	st, err := openStore(settings.StoreFile, settings.Resolution)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", settings.StoreFile, err)
+	}
+	s := &Service{settings: settings, store: st, location: location, power: map[string]powerSample{}}
+	if settings.Influx.Enabled() {
+		s.influx = influx.NewClient(settings.Influx, 30*time.Second)
+	}
+	listener, err := net.Listen("tcp", settings.Listen)
+	if err != nil {
+		return nil, err
+	}
+	s.server = &http.Server{Handler: s.handler()}
+	go func() {
+		if err := s.server.Serve(listener); err != http.ErrServerClosed {
+			fmt.Printf("%s: %s\n", ProgNameMqtt, err)
+		}
+	}()
+	for _, c := range settings.Channels {
+		channel := c
+		client.Subscribe(channel.Topic, 0, func(client mqtt.Client, msg mqtt.Message) {
+			s.handle(channel, msg, time.Now())
+		})
+	}
+	if settings.Tariff.hasDays() {
+		prices, _ := tariff.New(settings.Tariff.Config)
+		client.Subscribe(settings.Tariff.TempoTopic, 0, func(client mqtt.Client, msg mqtt.Message) {
+			day := strings.ToLower(strings.TrimSpace(string(msg.Payload())))
+			if prices.SetDay(day) {
+				s.store.setDay(time.Now().In(location).Format("2006-01-02"), day)
+			}
+		})
+	}
+	return s, nil
+}
+
+// handle accounts the energy of a channel message.
+func (s *Service) handle(channel Channel, msg mqtt.Message, at time.Time) {
+	v, err := strconv.ParseFloat(string(msg.Payload()), 64)
+	if err != nil {
+		fmt.Printf("%s: ignoring %s: %s\n", ProgNameMqtt, msg.Topic(), err)
+		return
+	}
+	v *= channel.scale()
+	name := channel.name(msg.Topic())
+	var energy float64
+	if channel.Kind == Power {
+		s.mu.Lock()
+		energy = s.power[name].integrate(at)
+		s.power[name] = powerSample{power: v, at: at}
+		s.mu.Unlock()
+		s.store.addEnergy(name, channel.Role, at, energy)
+	} else {
+		energy = s.store.addIndex(name, channel.Role, at, v)
+	}
+	if s.influx != nil && energy > 0 {
+		s.mu.Lock()
+		s.pending = append(s.pending, fmt.Sprintf("energy,channel=%s,role=%s value=%s %d",
+			name, channel.Role, strconv.FormatFloat(energy, 'f', -1, 64), at.UnixNano()))
+		s.mu.Unlock()
+	}
+}
+
+// OnConnect has nothing to restore, the client subscribes again to the channels.
+func (s *Service) OnConnect() {
+}
+
+// Run downsamples and saves the store every interval until a signal is received,
+// and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	ticker := time.NewTicker(s.settings.SaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.store.downsample(now, s.settings.Downsampling, s.settings.Retention)
+			s.save()
+		case sig := <-signals:
+			fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+			s.server.Close()
+			s.save()
+			return 0
+		}
+	}
+}
+
+// save writes the store file and the pending InfluxDB points, kept for the next
+// save when InfluxDB is unreachable.
+func (s *Service) save() {
+	if err := s.store.save(); err != nil {
+		fmt.Printf("%s: error saving %s: %s\n", ProgNameMqtt, s.settings.StoreFile, err)
+	}
+	if s.influx == nil {
+		return
+	}
+	s.mu.Lock()
+	lines := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+	if err := s.influx.Post(lines); err != nil {
+		fmt.Printf("%s: error writing to InfluxDB: %s\n", ProgNameMqtt, err)
+		s.mu.Lock()
+		s.pending = append(lines, s.pending...)
+		if len(s.pending) > MaxPending {
+			s.pending = s.pending[len(s.pending)-MaxPending:]
+		}
+		s.mu.Unlock()
+	}
+}
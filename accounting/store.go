@@ -0,0 +1,251 @@
+package energyaccounting
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// series is the energy of a channel, in Wh, by bucket start in Unix seconds.
+type series struct {
+	Role    string            `json:"role"`
+	Buckets map[int64]float64 `json:"buckets"`
+	// LastIndex is the last value of an index channel, for the energy consumed
+	// while the service was stopped to be accounted on restart.
+	LastIndex *float64 `json:"last_index,omitempty"`
+}
+
+// Tier merges the buckets older than After into buckets of Resolution, for years
+// of data to stay small.
+type Tier struct {
+	After      time.Duration `yaml:"after"`
+	Resolution time.Duration `yaml:"resolution"`
+}
+
+// validateTiers checks that the tiers are by increasing age, each resolution a
+// multiple of the previous one and dividing an hour, for the merged buckets to
+// stay within the days and the tariff hours.
+func validateTiers(resolution time.Duration, tiers []Tier, retention time.Duration) error {
+	var after time.Duration
+	for _, t := range tiers {
+		if t.After <= after {
+			return fmt.Errorf("the downsampling tiers must be by increasing age")
+		}
+		if t.Resolution < resolution || t.Resolution%resolution != 0 || time.Hour%t.Resolution != 0 {
+			return fmt.Errorf("the resolution %s of a downsampling tier must be a multiple of the previous one and divide an hour", t.Resolution)
+		}
+		after, resolution = t.After, t.Resolution
+	}
+	if retention < 0 || (retention > 0 && retention <= after) {
+		return fmt.Errorf("retention must be 0, to keep the energy forever, or longer than the downsampling tiers")
+	}
+	return nil
+}
+
+// storeFile is the content of the store file.
+type storeFile struct {
+	Series map[string]*series `json:"series"`
+	// Days holds the Tempo color or EJP day of the past days, by date, for the reports.
+	Days map[string]string `json:"days"`
+}
+
+// store accumulates the energy of every channel in buckets of a fixed duration,
+// persisted as a JSON file. It holds the few channels of a home for years in a
+// few megabytes, without cgo nor database server.
+type store struct {
+	path       string
+	resolution time.Duration
+
+	mu   sync.Mutex
+	file storeFile
+}
+
+// openStore loads the store file, the store starts empty when it does not exist.
+func openStore(path string, resolution time.Duration) (*store, error) {
+	s := &store{path: path, resolution: resolution, file: storeFile{Series: map[string]*series{}, Days: map[string]string{}}}
+	if path == "" {
+		return s, nil
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &s.file); err != nil {
+		return nil, err
+	}
+	if s.file.Series == nil {
+		s.file.Series = map[string]*series{}
+	}
+	if s.file.Days == nil {
+		s.file.Days = map[string]string{}
+	}
+	return s, nil
+}
+
+// save writes the store file, through a temporary file not to lose it on a crash.
+func (s *store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	content, err := json.Marshal(s.file)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *store) get(name, role string) *series {
+	ser, ok := s.file.Series[name]
+	if !ok {
+		ser = &series{Role: role, Buckets: map[int64]float64{}}
+		s.file.Series[name] = ser
+	}
+	return ser
+}
+
+// addEnergy accounts energy Wh in the bucket of at.
+func (s *store) addEnergy(name, role string, at time.Time, energy float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(name, role).Buckets[at.Truncate(s.resolution).Unix()] += energy
+}
+
+// addIndex accounts the increase of an index since its previous value, and
+// returns it. A decreasing index, e.g. a replaced meter, is a new start.
+func (s *store) addIndex(name, role string, at time.Time, index float64) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ser := s.get(name, role)
+	var energy float64
+	if ser.LastIndex != nil && index > *ser.LastIndex {
+		energy = index - *ser.LastIndex
+		ser.Buckets[at.Truncate(s.resolution).Unix()] += energy
+	}
+	ser.LastIndex = &index
+	return energy
+}
+
+// downsample merges the buckets into those of the oldest tier they are older
+// than, and drops the buckets and days older than retention unless 0.
+func (s *store) downsample(now time.Time, tiers []Tier, retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ser := range s.file.Series {
+		// A merged bucket may be visited again, it is then merged further or kept
+		for bucket, energy := range ser.Buckets {
+			start := time.Unix(bucket, 0)
+			age := now.Sub(start)
+			if retention > 0 && age > retention {
+				delete(ser.Buckets, bucket)
+				continue
+			}
+			var resolution time.Duration
+			for _, t := range tiers {
+				if age >= t.After {
+					resolution = t.Resolution
+				}
+			}
+			if merged := start.Truncate(resolution).Unix(); resolution > 0 && merged != bucket {
+				delete(ser.Buckets, bucket)
+				ser.Buckets[merged] += energy
+			}
+		}
+	}
+	if retention > 0 {
+		oldest := now.Add(-retention).UTC().Format("2006-01-02")
+		for date := range s.file.Days {
+			if date < oldest {
+				delete(s.file.Days, date)
+			}
+		}
+	}
+}
+
+// starts returns the starts of the buckets of every channel in [from, to), sorted.
+func (s *store) starts(from, to time.Time) []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start, end := from.Unix(), to.Unix()
+	set := map[int64]bool{}
+	for _, ser := range s.file.Series {
+		for bucket := range ser.Buckets {
+			if bucket >= start && bucket < end {
+				set[bucket] = true
+			}
+		}
+	}
+	starts := make([]time.Time, 0, len(set))
+	for bucket := range set {
+		starts = append(starts, time.Unix(bucket, 0))
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	return starts
+}
+
+// sum returns the energy of a channel in the buckets starting in [from, to).
+func (s *store) sum(name string, from, to time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ser, ok := s.file.Series[name]
+	if !ok {
+		return 0
+	}
+	var total float64
+	start, end := from.Unix(), to.Unix()
+	for bucket, energy := range ser.Buckets {
+		if bucket >= start && bucket < end {
+			total += energy
+		}
+	}
+	return total
+}
+
+// channels returns the names of the channels, by role.
+func (s *store) channels() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byRole := map[string][]string{}
+	for name, ser := range s.file.Series {
+		byRole[ser.Role] = append(byRole[ser.Role], name)
+	}
+	for _, names := range byRole {
+		sort.Strings(names)
+	}
+	return byRole
+}
+
+// bucket returns the energy of a channel in the bucket starting at start.
+func (s *store) bucket(name string, start time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ser, ok := s.file.Series[name]; ok {
+		return ser.Buckets[start.Unix()]
+	}
+	return 0
+}
+
+// setDay records the Tempo color or EJP day of a date, formatted as 2006-01-02.
+func (s *store) setDay(date, day string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.file.Days[date] = day
+}
+
+// day returns the Tempo color or EJP day of a date, empty when unknown.
+func (s *store) day(date string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Days[date]
+}
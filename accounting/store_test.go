@@ -0,0 +1,130 @@
+package energyaccounting
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	s, err := openStore(path, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) time.Time { return day.Add(time.Duration(hour) * time.Hour) }
+
+	s.addIndex("grid_import", Import, at(0), 1000)
+	if e := s.addIndex("grid_import", Import, at(1), 1500); e != 500 {
+		t.Errorf("index increase: got %v, want 500", e)
+	}
+	s.addIndex("grid_import", Import, at(2), 100)
+	s.addIndex("grid_import", Import, at(3), 300)
+	if err = s.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = openStore(path, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The energy consumed while stopped is accounted on restart
+	s.addIndex("grid_import", Import, day.AddDate(0, 0, 1), 400)
+	if e := s.sum("grid_import", day, day.AddDate(0, 0, 1)); e != 700 {
+		t.Errorf("day 1: got %v, want 700 without the meter reset", e)
+	}
+	if e := s.sum("grid_import", day, day.AddDate(0, 0, 2)); e != 800 {
+		t.Errorf("days 1 and 2: got %v, want 800", e)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	s, _ := openStore("", time.Hour)
+	day := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.addEnergy("grid_import", Import, day, 3000)
+	s.addEnergy("grid_export", Export, day, 1000)
+	s.addEnergy("pv", Production, day, 4000)
+	s.addEnergy("wallbox", EV, day, 2000)
+	s.addEnergy("0x42", Circuit, day, 500)
+	s.addEnergy("grid_import", Import, day.AddDate(0, 0, 1), 100)
+
+	from, to, err := parseRange(Day, "2024-06-01", "2024-06-03", day, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := s.summary(Day, from, to)
+	if len(summary.Rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(summary.Rows))
+	}
+	r := summary.Rows[0]
+	if r.SelfConsumption != 3000 || r.SelfConsumptionRatio != 0.75 || r.Consumption != 6000 {
+		t.Errorf("day 1: got %+v", r)
+	}
+	if r.EV != 2000 || r.Circuits["0x42"] != 500 {
+		t.Errorf("day 1 loads: got %+v", r)
+	}
+	if r := summary.Rows[1]; r.Import != 100 || r.SelfConsumptionRatio != 0 {
+		t.Errorf("day 2: got %+v", r)
+	}
+
+	from, to, _ = parseRange(Month, "", "", day, time.UTC)
+	if summary = s.summary(Month, from, to); len(summary.Rows) != 12 || summary.Rows[5].Import != 3100 {
+		t.Errorf("months: got %+v", summary.Rows)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	s, _ := openStore("", time.Second)
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	tiers := []Tier{{After: time.Hour, Resolution: time.Minute}, {After: 48 * time.Hour, Resolution: time.Hour}}
+	// Every 10 seconds, for a minute two hours ago and three days ago
+	for _, start := range []time.Time{now.Add(-2 * time.Hour), now.AddDate(0, 0, -3).Add(30 * time.Minute)} {
+		for i := 0; i < 6; i++ {
+			s.addEnergy("grid_import", Import, start.Add(time.Duration(i)*10*time.Second), 1)
+		}
+	}
+	s.addEnergy("grid_import", Import, now.Add(-time.Minute+5*time.Second), 1)
+	s.addEnergy("grid_import", Import, now.AddDate(-1, 0, 0), 1)
+	s.setDay("2023-06-01", "red")
+
+	s.downsample(now, tiers, 30*24*time.Hour)
+	buckets := s.file.Series["grid_import"].Buckets
+	if len(buckets) != 3 {
+		t.Errorf("got %d buckets, want the minute, the hour and the recent second", len(buckets))
+	}
+	if e := s.bucket("grid_import", now.Add(-2*time.Hour)); e != 6 {
+		t.Errorf("minute bucket: got %v, want 6", e)
+	}
+	if e := s.bucket("grid_import", now.AddDate(0, 0, -3)); e != 6 {
+		t.Errorf("hour bucket: got %v, want 6", e)
+	}
+	if e := s.bucket("grid_import", now.Add(-time.Minute+5*time.Second)); e != 1 {
+		t.Errorf("recent bucket: got %v, want it kept", e)
+	}
+	if s.day("2023-06-01") != "" {
+		t.Error("day older than the retention kept")
+	}
+	if e := s.sum("grid_import", now.AddDate(0, 0, -7), now); e != 13 {
+		t.Errorf("week: got %v, want 13 without the energy of last year", e)
+	}
+}
+
+func TestValidateTiers(t *testing.T) {
+	for _, c := range []struct {
+		tiers     []Tier
+		retention time.Duration
+		valid     bool
+	}{
+		{[]Tier{{48 * time.Hour, 15 * time.Minute}, {720 * time.Hour, time.Hour}}, 0, true},
+		{[]Tier{{48 * time.Hour, 15 * time.Minute}, {720 * time.Hour, time.Hour}}, 87600 * time.Hour, true},
+		{[]Tier{{720 * time.Hour, time.Hour}, {48 * time.Hour, 15 * time.Minute}}, 0, false},
+		{[]Tier{{48 * time.Hour, 7 * time.Minute}}, 0, false},
+		{[]Tier{{48 * time.Hour, 2 * time.Hour}}, 0, false},
+		{[]Tier{{48 * time.Hour, 15 * time.Minute}}, 24 * time.Hour, false},
+	} {
+		if err := validateTiers(time.Minute, c.tiers, c.retention); (err == nil) != c.valid {
+			t.Errorf("%+v, retention %s: got %v", c.tiers, c.retention, err)
+		}
+	}
+}
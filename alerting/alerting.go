@@ -0,0 +1,285 @@
+// Package alerting sends the alerts of the energy-center programs, e.g. stale
+// serial data, broker loss or watchdog trips, to a MQTT topic, ntfy and Telegram,
+// with severity levels and without repeating an active alert.
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Severity is the level of an alert.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	}
+	return "critical"
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseSeverity parses info, warning or critical.
+func ParseSeverity(s string) (Severity, error) {
+	for _, severity := range []Severity{Info, Warning, Critical} {
+		if s == severity.String() {
+			return severity, nil
+		}
+	}
+	return Info, fmt.Errorf("unsupported severity '%s', expected info, warning or critical", s)
+}
+
+const (
+	// DefaultRepeat is the delay before an active alert is sent again.
+	DefaultRepeat = 6 * time.Hour
+	// SendTimeout bounds the delivery of an alert to ntfy or Telegram.
+	SendTimeout = 10 * time.Second
+)
+
+// TelegramApi is the root of the Telegram bot API.
+var TelegramApi = "https://api.telegram.org"
+
+// Alert is the payload of the alert topic.
+type Alert struct {
+	// Source is the program or service raising the alert.
+	Source string `json:"source"`
+	// Name identifies the condition, e.g. stale_frames, an alert being active
+	// until it is resolved.
+	Name     string    `json:"name"`
+	Severity Severity  `json:"severity"`
+	Message  string    `json:"message"`
+	Resolved bool      `json:"resolved"`
+	Time     time.Time `json:"time"`
+}
+
+// title is the status and source of the alert, e.g. [CRITICAL] teleinfo2mqtt.
+func (a Alert) title() string {
+	status := strings.ToUpper(a.Severity.String())
+	if a.Resolved {
+		status = "RESOLVED"
+	}
+	return fmt.Sprintf("[%s] %s", status, a.Source)
+}
+
+func (a Alert) text() string {
+	return a.title() + ": " + a.Message
+}
+
+// NtfyConfig is a ntfy topic, e.g. https://ntfy.sh/my-energy-center.
+type NtfyConfig struct {
+	Url   string `yaml:"url"`
+	Token string `yaml:"token"`
+}
+
+// TelegramConfig is a Telegram bot and the chat it writes to.
+type TelegramConfig struct {
+	Token  string `yaml:"token"`
+	ChatId string `yaml:"chat_id"`
+}
+
+// Config selects where the alerts are sent, nowhere but the logs by default.
+type Config struct {
+	// Topic receives the alerts as JSON, e.g. energy-center/alerts.
+	Topic string `yaml:"topic"`
+	// MinSeverity is the lowest severity sent: info, warning (the default) or critical.
+	MinSeverity string `yaml:"min_severity"`
+	// Repeat is the delay before an active alert is sent again, DefaultRepeat when zero.
+	Repeat   time.Duration  `yaml:"repeat"`
+	Ntfy     NtfyConfig     `yaml:"ntfy"`
+	Telegram TelegramConfig `yaml:"telegram"`
+}
+
+func (c Config) Validate() error {
+	if c.MinSeverity != "" {
+		if _, err := ParseSeverity(c.MinSeverity); err != nil {
+			return err
+		}
+	}
+	if (c.Telegram.Token == "") != (c.Telegram.ChatId == "") {
+		return fmt.Errorf("telegram alerts need a token and a chat id")
+	}
+	return nil
+}
+
+// Alerter sends the alerts of a source.
+type Alerter struct {
+	config      Config
+	client      mqtt.Client
+	source      string
+	minSeverity Severity
+	http        *http.Client
+
+	mu     sync.Mutex
+	active map[string]active
+	sends  sync.WaitGroup
+}
+
+type active struct {
+	severity Severity
+	sent     time.Time
+}
+
+// New creates the alerter of a source. client publishes to the alert topic, and may
+// be nil when the alerts are not sent over MQTT.
+func New(config Config, client mqtt.Client, source string) (*Alerter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	a := &Alerter{
+		config:      config,
+		client:      client,
+		source:      source,
+		minSeverity: Warning,
+		http:        &http.Client{Timeout: SendTimeout},
+		active:      map[string]active{},
+	}
+	if config.MinSeverity != "" {
+		a.minSeverity, _ = ParseSeverity(config.MinSeverity)
+	}
+	if a.config.Repeat <= 0 {
+		a.config.Repeat = DefaultRepeat
+	}
+	return a, nil
+}
+
+// Raise activates an alert, sent unless it is already active with the same or a
+// higher severity since less than the repeat delay.
+func (a *Alerter) Raise(name string, severity Severity, format string, args ...interface{}) {
+	now := time.Now()
+	a.mu.Lock()
+	previous, known := a.active[name]
+	if known && severity <= previous.severity && now.Sub(previous.sent) < a.config.Repeat {
+		a.mu.Unlock()
+		return
+	}
+	a.active[name] = active{severity: severity, sent: now}
+	a.mu.Unlock()
+	a.send(Alert{Source: a.source, Name: name, Severity: severity, Message: fmt.Sprintf(format, args...), Time: now})
+}
+
+// Resolve deactivates an alert, sending its resolution if it was active.
+func (a *Alerter) Resolve(name string, format string, args ...interface{}) {
+	a.mu.Lock()
+	previous, known := a.active[name]
+	delete(a.active, name)
+	a.mu.Unlock()
+	if known {
+		a.send(Alert{Source: a.source, Name: name, Severity: previous.severity, Message: fmt.Sprintf(format, args...), Resolved: true, Time: time.Now()})
+	}
+}
+
+// Flush waits for the alerts being sent, e.g. before the process exits.
+func (a *Alerter) Flush(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		a.sends.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// send logs the alert and sends it in the background, not to block the caller.
+func (a *Alerter) send(alert Alert) {
+	fmt.Println(alert.text())
+	if alert.Severity < a.minSeverity {
+		return
+	}
+	if a.config.Topic != "" && a.client != nil {
+		payload, _ := json.Marshal(alert)
+		a.client.Publish(a.config.Topic, 0, false, payload)
+	}
+	if a.config.Ntfy.Url != "" {
+		a.sends.Add(1)
+		go func() {
+			defer a.sends.Done()
+			a.report(a.sendNtfy(alert), "ntfy")
+		}()
+	}
+	if a.config.Telegram.Token != "" {
+		a.sends.Add(1)
+		go func() {
+			defer a.sends.Done()
+			a.report(a.sendTelegram(alert), "Telegram")
+		}()
+	}
+}
+
+func (a *Alerter) report(err error, sink string) {
+	if err != nil {
+		fmt.Printf("%s: error sending an alert to %s: %s\n", a.source, sink, err)
+	}
+}
+
+var ntfyPriorities = map[Severity]string{Info: "default", Warning: "high", Critical: "urgent"}
+
+func (a *Alerter) sendNtfy(alert Alert) error {
+	req, err := http.NewRequest(http.MethodPost, a.config.Ntfy.Url, strings.NewReader(alert.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", alert.title())
+	req.Header.Set("Priority", ntfyPriorities[alert.Severity])
+	if alert.Resolved {
+		req.Header.Set("Priority", "default")
+		req.Header.Set("Tags", "white_check_mark")
+	} else if alert.Severity == Critical {
+		req.Header.Set("Tags", "rotating_light")
+	} else {
+		req.Header.Set("Tags", "warning")
+	}
+	if a.config.Ntfy.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.config.Ntfy.Token)
+	}
+	return a.do(req)
+}
+
+func (a *Alerter) sendTelegram(alert Alert) error {
+	form := url.Values{"chat_id": {a.config.Telegram.ChatId}, "text": {alert.text()}}
+	req, err := http.NewRequest(http.MethodPost, TelegramApi+"/bot"+a.config.Telegram.Token+"/sendMessage", bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return a.do(req)
+}
+
+func (a *Alerter) do(req *http.Request) error {
+	resp, err := a.http.Do(req)
+	if uerr, ok := err.(*url.Error); ok {
+		// The url of the Telegram API holds the token
+		return uerr.Err
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
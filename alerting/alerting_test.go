@@ -0,0 +1,88 @@
+package alerting
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(body))
+}
+
+func TestAlerter(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+	TelegramApi = server.URL
+
+	a, err := New(Config{
+		Ntfy:     NtfyConfig{Url: server.URL + "/energy", Token: "secret"},
+		Telegram: TelegramConfig{Token: "123:abc", ChatId: "42"},
+	}, nil, "teleinfo2mqtt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Raise("stale_frames", Info, "below the minimum severity")
+	a.Raise("stale_frames", Warning, "no frame for %s", time.Minute)
+	a.Raise("stale_frames", Warning, "repeated")
+	a.Raise("stale_frames", Critical, "escalated")
+	a.Resolve("stale_frames", "frames received")
+	a.Resolve("stale_frames", "not active")
+	a.Flush(5 * time.Second)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var ntfy, telegram []string
+	for i, req := range rec.requests {
+		switch req.URL.Path {
+		case "/energy":
+			if req.Header.Get("Authorization") != "Bearer secret" {
+				t.Errorf("ntfy authorization: got %s", req.Header.Get("Authorization"))
+			}
+			ntfy = append(ntfy, req.Header.Get("Title")+" "+rec.bodies[i])
+		case "/bot123:abc/sendMessage":
+			telegram = append(telegram, rec.bodies[i])
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+		}
+	}
+	want := map[string]bool{
+		"[WARNING] teleinfo2mqtt no frame for 1m0s": true,
+		"[CRITICAL] teleinfo2mqtt escalated":        true,
+		"[RESOLVED] teleinfo2mqtt frames received":  true,
+	}
+	if len(ntfy) != len(want) {
+		t.Errorf("ntfy: got %v", ntfy)
+	}
+	for _, n := range ntfy {
+		if !want[n] {
+			t.Errorf("ntfy: unexpected %s", n)
+		}
+	}
+	if len(telegram) != 3 {
+		t.Errorf("telegram: got %v", telegram)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Config{MinSeverity: "fatal"}).Validate(); err == nil {
+		t.Error("unknown severity accepted")
+	}
+	if err := (Config{Telegram: TelegramConfig{Token: "123:abc"}}).Validate(); err == nil {
+		t.Error("telegram without chat id accepted")
+	}
+}
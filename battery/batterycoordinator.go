@@ -0,0 +1,281 @@
+// Package batterycoordinator shares the solar surplus between a home battery and
+// the EV charging, in a configurable order of priority, through MQTT: the battery
+// measures and limits are those of its bridge (Victron Venus OS, Solar Assistant
+// for Pylontech or Deye...), the EV budget is for the charging manager.
+package batterycoordinator
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"energy-center/alerting"
+	"energy-center/curtailment"
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+const ProgNameMqtt string = "batterycoordinator"
+
+// StaleTimeout is the delay after which the grid power and state of charge are
+// considered lost, and the EV budget withdrawn.
+const StaleTimeout = 1 * time.Minute
+
+// Topics are the MQTT interface of the battery and the EV charging manager.
+type Topics struct {
+	// Grid is the grid power, in W, positive when drawn.
+	Grid string `yaml:"grid"`
+	// Soc is the state of charge of the battery, in %.
+	Soc string `yaml:"soc"`
+	// BatteryPower is the battery power, in W, positive when charging.
+	BatteryPower string `yaml:"battery_power"`
+	// EvPower is the EV charging power, in W, optional.
+	EvPower string `yaml:"ev_power"`
+	// ChargeLimit and DischargeLimit receive the limits of the battery, in W.
+	ChargeLimit    string `yaml:"charge_limit"`
+	DischargeLimit string `yaml:"discharge_limit"`
+	// EvBudget receives the power the EV may charge at, in W.
+	EvBudget string `yaml:"ev_budget"`
+}
+
+func (t Topics) validate() error {
+	if t.Grid == "" || t.Soc == "" || t.BatteryPower == "" {
+		return fmt.Errorf("the grid, soc and battery_power topics are required")
+	}
+	return nil
+}
+
+// Settings are the settings of the coordinator, from the configuration file of
+// batterycoordinator or the battery section of the energy-center configuration file.
+type Settings struct {
+	// Mqtt is the broker connection of batterycoordinator, ignored by the daemon.
+	Mqtt   mqttclient.Config `yaml:"mqtt"`
+	Topics Topics            `yaml:"topics"`
+	Policy Policy            `yaml:"policy"`
+	// Interval is the delay between two allocations.
+	Interval time.Duration `yaml:"interval"`
+	// ImportAlert is the grid power, in W, above which importing while the EV charges
+	// raises an alert, disabled when 0.
+	ImportAlert float64         `yaml:"import_alert"`
+	Alerting    alerting.Config `yaml:"alerting"`
+	// Curtailment caps the EV budget during the demand response events of the
+	// grid operator or an aggregator.
+	Curtailment curtailment.Config `yaml:"curtailment"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Mqtt: mqttclient.Config{Url: "192.168.0.20:1883", ClientId: ProgNameMqtt},
+		Topics: Topics{
+			Grid:     "powerinfo/grid",
+			EvBudget: ProgNameMqtt + "/ev_budget",
+		},
+		Policy: Policy{
+			Priority:     []string{Battery, EV},
+			MinSoc:       20,
+			MaxSoc:       100,
+			MaxCharge:    3000,
+			MaxDischarge: 3000,
+			EvMin:        1380,
+			EvMax:        7400,
+		},
+		Interval: 10 * time.Second,
+	}
+}
+
+func (s Settings) Validate() error {
+	if err := s.Topics.validate(); err != nil {
+		return err
+	}
+	if s.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	return s.Policy.validate()
+}
+
+// LoadSettings reads the settings from a YAML file, over the defaults.
+func LoadSettings(path string) (Settings, error) {
+	settings := DefaultSettings()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return settings, err
+	}
+	if err = yaml.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Main runs the coordinator with its own MQTT connection, configured by a YAML file.
+func Main() {
+	var path string
+	flag.StringVar(&path, "config", "/etc/batterycoordinator.yaml", "YAML configuration file")
+	flag.Parse()
+
+	settings, err := LoadSettings(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	mqtt.ERROR = log.New(os.Stdout, "", 0)
+	var service *Service
+	client, err := mqttclient.New(settings.Mqtt, mqttclient.Options{
+		ConnectRetry: true,
+		OnConnect: func(client mqtt.Client) {
+			service.alerter.Resolve("broker", "connected to %s", settings.Mqtt.Url)
+		},
+		OnConnectionLost: func(client mqtt.Client, err error) {
+			service.alerter.Raise("broker", alerting.Critical, "connection lost to %s: %s", settings.Mqtt.Url, err)
+		},
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	service, err = NewService(client, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
+
+// Service is the coordinator, on a MQTT connection it does not own, either the
+// one of batterycoordinator or the one shared by the energy-center daemon.
+type Service struct {
+	client      mqtt.Client
+	settings    Settings
+	alerter     *alerting.Alerter
+	curtailment *curtailment.Signal
+
+	mu       sync.Mutex
+	measures Measures
+	gridTime time.Time
+	socTime  time.Time
+}
+
+// NewService subscribes to the measures. The client must restore the subscriptions
+// on reconnection, as a mqttclient.Client does.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	alerter, err := alerting.New(settings.Alerting, client, ProgNameMqtt)
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{client: client, settings: settings, alerter: alerter}
+	s.curtailment = curtailment.New(settings.Curtailment, func(format string, args ...interface{}) {
+		fmt.Printf("%s: %s\n", ProgNameMqtt, fmt.Sprintf(format, args...))
+	})
+	if settings.Curtailment.Topic != "" {
+		client.Subscribe(settings.Curtailment.Topic, 1, func(client mqtt.Client, msg mqtt.Message) {
+			if err := s.curtailment.Receive(msg.Payload(), time.Now()); err != nil {
+				fmt.Printf("%s: ignoring %s: %s\n", ProgNameMqtt, msg.Topic(), err)
+			}
+		})
+	}
+	t := settings.Topics
+	client.Subscribe(t.Grid, 0, s.listen(func(m *Measures, v float64) {
+		m.Grid = v
+		s.gridTime = time.Now()
+	}))
+	client.Subscribe(t.Soc, 0, s.listen(func(m *Measures, v float64) {
+		m.Soc = v
+		s.socTime = time.Now()
+	}))
+	client.Subscribe(t.BatteryPower, 0, s.listen(func(m *Measures, v float64) { m.Battery = v }))
+	if t.EvPower != "" {
+		client.Subscribe(t.EvPower, 0, s.listen(func(m *Measures, v float64) { m.EV = v }))
+	}
+	return s, nil
+}
+
+// listen returns a handler updating the measures with the value of a topic.
+func (s *Service) listen(update func(m *Measures, v float64)) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		v, err := strconv.ParseFloat(string(msg.Payload()), 64)
+		if err != nil {
+			fmt.Printf("%s: ignoring %s: %s\n", ProgNameMqtt, msg.Topic(), err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		update(&s.measures, v)
+	}
+}
+
+// OnConnect has nothing to restore, the limits are sent again every interval.
+func (s *Service) OnConnect() {
+}
+
+// Run allocates the surplus every interval until a signal is received, and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	ticker := time.NewTicker(s.settings.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.coordinate(now)
+		case sig := <-signals:
+			fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+			s.publish(s.settings.Topics.EvBudget, 0)
+			return 0
+		}
+	}
+}
+
+// coordinate sends the limits of the loads, or withdraws the EV budget and leaves
+// the battery to its own management when the measures are stale. A curtailment
+// caps the EV budget, the battery taking the rest of the surplus.
+func (s *Service) coordinate(now time.Time) {
+	s.mu.Lock()
+	m := s.measures
+	stale := now.Sub(s.gridTime) > StaleTimeout || now.Sub(s.socTime) > StaleTimeout
+	s.mu.Unlock()
+	policy := s.settings.Policy
+	if limit, ok := s.curtailment.Limit(now); ok {
+		s.alerter.Raise("curtailment", alerting.Info, "EV charging capped at %.0f W by a curtailment", limit)
+		policy.EvMax = math.Min(policy.EvMax, limit)
+	} else {
+		s.alerter.Resolve("curtailment", "EV charging restored")
+	}
+	if stale {
+		s.alerter.Raise("stale_measures", alerting.Warning, "no grid power or state of charge for %s, EV budget withdrawn", StaleTimeout)
+		s.publish(s.settings.Topics.EvBudget, 0)
+		return
+	}
+	s.alerter.Resolve("stale_measures", "grid power and state of charge received again")
+	if s.settings.ImportAlert > 0 && m.EV > 0 && m.Grid > s.settings.ImportAlert {
+		s.alerter.Raise("import_while_charging", alerting.Warning, "importing %.0f W while the EV charges at %.0f W", m.Grid, m.EV)
+	} else {
+		s.alerter.Resolve("import_while_charging", "import back to %.0f W", m.Grid)
+	}
+	a := policy.allocate(m)
+	s.publish(s.settings.Topics.ChargeLimit, a.Charge)
+	s.publish(s.settings.Topics.DischargeLimit, a.Discharge)
+	s.publish(s.settings.Topics.EvBudget, a.EvBudget)
+}
+
+func (s *Service) publish(topic string, power float64) {
+	if topic != "" {
+		s.client.Publish(topic, 0, false, strconv.FormatFloat(power, 'f', 0, 64))
+	}
+}
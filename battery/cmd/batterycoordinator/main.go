@@ -0,0 +1,7 @@
+package main
+
+import "batterycoordinator"
+
+func main() {
+	batterycoordinator.Main()
+}
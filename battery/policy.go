@@ -0,0 +1,100 @@
+package batterycoordinator
+
+import (
+	"fmt"
+	"math"
+)
+
+// Flexible loads sharing the surplus
+const (
+	Battery = "battery"
+	EV      = "ev"
+)
+
+// Policy is how the surplus is shared between the battery and the EV, what is
+// left being exported.
+type Policy struct {
+	// Priority lists the loads served first, battery and ev.
+	Priority []string `yaml:"priority"`
+	// MinSoc is the state of charge, in %, below which the battery is not discharged.
+	MinSoc float64 `yaml:"min_soc"`
+	// MaxSoc is the state of charge, in %, above which the battery is not charged.
+	MaxSoc float64 `yaml:"max_soc"`
+	// MaxCharge and MaxDischarge are the power limits of the battery, in W.
+	MaxCharge    float64 `yaml:"max_charge"`
+	MaxDischarge float64 `yaml:"max_discharge"`
+	// EvMin is the lowest power an EV charges at, in W (6 A single phase is 1380 W),
+	// EvMax its highest.
+	EvMin float64 `yaml:"ev_min"`
+	EvMax float64 `yaml:"ev_max"`
+	// BatteryToEv allows the battery to discharge while the EV charges.
+	BatteryToEv bool `yaml:"battery_to_ev"`
+}
+
+func (p Policy) validate() error {
+	if len(p.Priority) == 0 {
+		return fmt.Errorf("empty priority, expected %s and/or %s", Battery, EV)
+	}
+	for _, load := range p.Priority {
+		if load != Battery && load != EV {
+			return fmt.Errorf("unknown load '%s' in priority, expected %s or %s", load, Battery, EV)
+		}
+	}
+	if p.MinSoc > p.MaxSoc {
+		return fmt.Errorf("min_soc is above max_soc")
+	}
+	if p.EvMin > p.EvMax {
+		return fmt.Errorf("ev_min is above ev_max")
+	}
+	return nil
+}
+
+// Measures is the state of the installation, powers in W.
+type Measures struct {
+	// Grid is positive when drawn.
+	Grid float64
+	// Battery is positive when charging.
+	Battery float64
+	// EV is the charging power of the EV.
+	EV  float64
+	Soc float64
+}
+
+// Allocation holds the limits sent to the battery and the EV charging manager, in W.
+type Allocation struct {
+	Charge    float64
+	Discharge float64
+	EvBudget  float64
+}
+
+// allocate shares the surplus, the power exported if neither the battery nor the
+// EV were charging, between the loads in order of priority.
+func (p Policy) allocate(m Measures) Allocation {
+	var a Allocation
+	surplus := m.Battery + m.EV - m.Grid
+	for _, load := range p.Priority {
+		switch load {
+		case Battery:
+			if m.Soc < p.MaxSoc {
+				a.Charge = math.Max(0, math.Min(surplus, p.MaxCharge))
+				surplus -= a.Charge
+			}
+		case EV:
+			// EvMax is below EvMin when curtailed, the EV cannot charge
+			if surplus >= p.EvMin && p.EvMax >= p.EvMin {
+				a.EvBudget = math.Min(surplus, p.EvMax)
+				surplus -= a.EvBudget
+			}
+		}
+	}
+
+	if m.Soc > p.MinSoc {
+		a.Discharge = p.MaxDischarge
+		if m.EV > 0 && !p.BatteryToEv {
+			// Only cover the house, whose net consumption is the grid power
+			// without the battery and the EV
+			a.Discharge = math.Max(0, math.Min(p.MaxDischarge, m.Grid-m.Battery-m.EV))
+		}
+	}
+	return a
+}
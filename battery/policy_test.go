@@ -0,0 +1,48 @@
+package batterycoordinator
+
+import "testing"
+
+func TestAllocate(t *testing.T) {
+	policy := DefaultSettings().Policy
+	evFirst := policy
+	evFirst.Priority = []string{EV, Battery}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		m      Measures
+		want   Allocation
+	}{
+		{"battery first", policy, Measures{Grid: -5000, Soc: 50},
+			Allocation{Charge: 3000, Discharge: 3000, EvBudget: 2000}},
+		{"ev below its minimum", policy, Measures{Grid: -4000, Soc: 50},
+			Allocation{Charge: 3000, Discharge: 3000}},
+		{"ev first", evFirst, Measures{Grid: -5000, Soc: 50},
+			Allocation{Charge: 0, Discharge: 3000, EvBudget: 5000}},
+		{"ev first with the battery charging", evFirst, Measures{Grid: -1000, Battery: 2000, Soc: 50},
+			Allocation{Charge: 0, Discharge: 3000, EvBudget: 3000}},
+		{"full battery", policy, Measures{Grid: -2000, Soc: 100},
+			Allocation{Discharge: 3000, EvBudget: 2000}},
+		{"empty battery", policy, Measures{Grid: 500, Soc: 20},
+			Allocation{}},
+		{"solar excess while the ev charges", policy, Measures{Grid: 6000, Battery: -1000, EV: 7400, Soc: 80},
+			Allocation{Charge: 400}},
+		{"curtailed ev", curtailed(evFirst, 2000), Measures{Grid: -6000, Soc: 50},
+			Allocation{Charge: 3000, Discharge: 3000, EvBudget: 2000}},
+		{"ev curtailed below its minimum", curtailed(evFirst, 1000), Measures{Grid: -5000, Soc: 50},
+			Allocation{Charge: 3000, Discharge: 3000}},
+		{"house share while the ev charges", policy, Measures{Grid: 7900, Battery: -500, EV: 7400, Soc: 80},
+			Allocation{Discharge: 1000}},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.allocate(tt.m); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// curtailed returns the policy capped by a curtailment, as coordinate does.
+func curtailed(p Policy, limit float64) Policy {
+	p.EvMax = limit
+	return p
+}
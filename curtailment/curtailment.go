@@ -0,0 +1,151 @@
+// Package curtailment follows the demand response requests of a grid operator or
+// an aggregator, capping the charging power for the duration of their events. The
+// events are received as JSON, e.g. on a MQTT topic fed by an OpenADR client:
+//
+//	{"id": "evt-42", "limit": 2000, "start": "2024-01-15T18:00:00+01:00", "duration": 3600}
+//	{"id": "evt-42", "cancel": true}
+//
+// The limit is in W, 0 stopping the charging, the start defaults to the reception
+// and the duration is in seconds. An empty payload cancels every event.
+package curtailment
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMaxDuration bounds the events when the configuration does not.
+const DefaultMaxDuration = 4 * time.Hour
+
+// Config is the curtailment input of a service.
+type Config struct {
+	// Topic receives the events, disabled when empty.
+	Topic string `yaml:"topic"`
+	// MaxDuration bounds the events, for a lost cancellation not to curtail forever.
+	MaxDuration time.Duration `yaml:"max_duration"`
+}
+
+// Event is a request to cap the charging power.
+type Event struct {
+	Id    string    `json:"id"`
+	Limit float64   `json:"limit"`
+	Start time.Time `json:"start"`
+	// Duration is in seconds.
+	Duration float64 `json:"duration"`
+	// Cancel ends the event with the same id.
+	Cancel bool `json:"cancel,omitempty"`
+}
+
+type event struct {
+	Event
+	end    time.Time
+	active bool
+}
+
+// Signal holds the events received, the lowest limit of the active ones applying.
+type Signal struct {
+	maxDuration time.Duration
+	// logf logs the life of the events.
+	logf func(format string, args ...interface{})
+
+	mu     sync.Mutex
+	events map[string]*event
+	// capped is whether an event was active at the last limit.
+	capped bool
+}
+
+// New creates a signal logging its events with logf.
+func New(config Config, logf func(format string, args ...interface{})) *Signal {
+	maxDuration := config.MaxDuration
+	if maxDuration <= 0 {
+		maxDuration = DefaultMaxDuration
+	}
+	return &Signal{maxDuration: maxDuration, logf: logf, events: map[string]*event{}}
+}
+
+// Receive records an event, or cancels one, from its JSON payload.
+func (s *Signal) Receive(payload []byte, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(payload) == 0 {
+		for id := range s.events {
+			s.logf("curtailment %s cancelled", id)
+		}
+		s.events = map[string]*event{}
+		return nil
+	}
+	var e Event
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return fmt.Errorf("invalid curtailment event: %w", err)
+	}
+	if e.Cancel {
+		if _, ok := s.events[e.Id]; ok {
+			s.logf("curtailment %s cancelled", e.Id)
+			delete(s.events, e.Id)
+		}
+		return nil
+	}
+	if e.Limit < 0 || math.IsNaN(e.Limit) || e.Duration <= 0 {
+		return fmt.Errorf("curtailment %s: the limit must be positive or 0 and the duration positive", e.Id)
+	}
+	if e.Start.IsZero() {
+		e.Start = now
+	}
+	duration := time.Duration(e.Duration * float64(time.Second))
+	if duration > s.maxDuration {
+		s.logf("curtailment %s: duration of %s reduced to %s", e.Id, duration, s.maxDuration)
+		duration = s.maxDuration
+	}
+	end := e.Start.Add(duration)
+	if !end.After(now) {
+		return fmt.Errorf("curtailment %s ended at %s", e.Id, end.Format(time.RFC3339))
+	}
+	previous, ok := s.events[e.Id]
+	s.events[e.Id] = &event{Event: e, end: end, active: ok && previous.active}
+	s.logf("curtailment %s received: charging capped at %.0f W from %s to %s", e.Id, e.Limit,
+		e.Start.Format(time.RFC3339), end.Format(time.RFC3339))
+	return nil
+}
+
+// Limit returns the cap of the charging power at now, ok being false without
+// active event. The events starting and ending are logged there.
+func (s *Signal) Limit(now time.Time) (limit float64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// In a fixed order, for the logs to follow the ids
+	ids := make([]string, 0, len(s.events))
+	for id := range s.events {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	limit = math.Inf(1)
+	for _, id := range ids {
+		e := s.events[id]
+		if !now.Before(e.end) {
+			s.logf("curtailment %s ended", id)
+			delete(s.events, id)
+			continue
+		}
+		if now.Before(e.Start) {
+			continue
+		}
+		if !e.active {
+			s.logf("curtailment %s started: charging capped at %.0f W until %s", id, e.Limit, e.end.Format(time.RFC3339))
+			e.active = true
+		}
+		limit, ok = math.Min(limit, e.Limit), true
+	}
+	if !ok {
+		if s.capped {
+			s.logf("no curtailment left, charging restored")
+		}
+		s.capped = false
+		return 0, false
+	}
+	s.capped = true
+	return limit, true
+}
@@ -0,0 +1,62 @@
+package curtailment
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignal(t *testing.T) {
+	var logs []string
+	s := New(Config{MaxDuration: 2 * time.Hour}, func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})
+	now := time.Date(2024, 1, 15, 17, 0, 0, 0, time.UTC)
+	limit := func(at time.Time) string {
+		if l, ok := s.Limit(at); ok {
+			return fmt.Sprint(l)
+		}
+		return "none"
+	}
+
+	if err := s.Receive([]byte(`{"id": "a", "limit": 3000, "start": "2024-01-15T18:00:00Z", "duration": 36000}`), now); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Receive([]byte(`{"id": "b", "limit": 1000, "start": "2024-01-15T18:30:00Z", "duration": 600}`), now); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		at   time.Duration
+		want string
+	}{
+		{0, "none"},
+		{time.Hour, "3000"},
+		{90 * time.Minute, "1000"},
+		{100 * time.Minute, "3000"},
+		// a is cut to the max duration
+		{3 * time.Hour, "none"},
+	} {
+		if got := limit(now.Add(tt.at)); got != tt.want {
+			t.Errorf("limit after %s = %s, want %s", tt.at, got, tt.want)
+		}
+	}
+	if !strings.Contains(strings.Join(logs, "\n"), "curtailment a started") || logs[len(logs)-1] != "no curtailment left, charging restored" {
+		t.Errorf("logs = %q, want the start of a and the restoration", logs)
+	}
+
+	s.Receive([]byte(`{"id": "c", "limit": 0, "duration": 600}`), now)
+	if got := limit(now); got != "0" {
+		t.Errorf("limit of an event starting now = %s, want 0", got)
+	}
+	s.Receive([]byte(`{"id": "c", "cancel": true}`), now)
+	if got := limit(now); got != "none" {
+		t.Errorf("limit once cancelled = %s, want none", got)
+	}
+
+	for _, payload := range []string{`{"limit": -1, "duration": 60}`, `{"limit": 1000}`, `{"limit": 1000, "start": "2024-01-15T16:00:00Z", "duration": 60}`, `2000`} {
+		if err := s.Receive([]byte(payload), now); err == nil {
+			t.Errorf("%s accepted", payload)
+		}
+	}
+}
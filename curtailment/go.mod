@@ -0,0 +1,3 @@
+module energy-center/curtailment
+
+go 1.17
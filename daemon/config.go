@@ -0,0 +1,227 @@
+package main
+
+import (
+	"batterycoordinator"
+	"fmt"
+	"os"
+
+	"ecowatt2mqtt"
+	"enedis2mqtt"
+	"energy-center/alerting"
+	"energy-center/mqttclient"
+	"energyaccounting"
+	"fakeSungrowMeter"
+	"fakeSunspecMeter"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"inverter2mqtt"
+	"mqttmapper"
+	"p1tomqtt"
+	"powertag2mqtt"
+	"semp2mqtt"
+	"solarrouter"
+	"teleinfo2mqtt"
+)
+
+// Config holds the settings of the daemon and of every service it runs.
+// A service is enabled by the presence of its section, its settings default
+// to those of its standalone program.
+type Config struct {
+	Mqtt mqttclient.Config
+	// LogLevel is one of trace, debug, info, warning or error.
+	LogLevel string
+	// Alerting is the default alerting of the services, which their sections override.
+	Alerting alerting.Config
+	// Ui is the configuration UI, disabled without listen address.
+	Ui UiConfig
+	// Services holds a pointer to the settings of every enabled service, by name.
+	Services map[string]interface{}
+}
+
+// serviceKind describes a service the daemon runs, the services being added to
+// serviceKinds only.
+type serviceKind struct {
+	name string
+	// defaults returns a pointer to the default settings of the service, its
+	// section being decoded over them.
+	defaults func(alerting alerting.Config) interface{}
+	// create creates the service from a pointer to its settings.
+	create func(client mqtt.Client, settings interface{}) (service, error)
+}
+
+// serviceKinds are the services of the daemon, in the order they are enabled.
+var serviceKinds = []serviceKind{
+	{Teleinfo, func(a alerting.Config) interface{} {
+		s := teleinfo2mqtt.DefaultSettings()
+		s.Alerting = a
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return teleinfo2mqtt.NewService(client, *s.(*teleinfo2mqtt.Settings))
+	}},
+	{Powertag, func(alerting.Config) interface{} {
+		s := powertag2mqtt.DefaultConfig()
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return powertag2mqtt.NewService(client, *s.(*powertag2mqtt.Config))
+	}},
+	{FakeMeter, func(a alerting.Config) interface{} {
+		s := fakeSungrowMeter.DefaultSettings()
+		s.Alerting = a
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return fakeSungrowMeter.NewService(client, *s.(*fakeSungrowMeter.Settings))
+	}},
+	{Mapper, func(alerting.Config) interface{} {
+		s := mqttmapper.DefaultSettings()
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return mqttmapper.NewService(client, *s.(*mqttmapper.Settings))
+	}},
+	{P1, func(alerting.Config) interface{} {
+		s := p1tomqtt.DefaultSettings()
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return p1tomqtt.NewService(client, *s.(*p1tomqtt.Settings))
+	}},
+	{Enedis, func(alerting.Config) interface{} {
+		s := enedis2mqtt.DefaultSettings()
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return enedis2mqtt.NewService(client, *s.(*enedis2mqtt.Settings))
+	}},
+	{SunspecMeter, func(alerting.Config) interface{} {
+		s := fakeSunspecMeter.DefaultSettings()
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return fakeSunspecMeter.NewService(client, *s.(*fakeSunspecMeter.Settings))
+	}},
+	{SolarRouter, func(alerting.Config) interface{} {
+		s := solarrouter.DefaultSettings()
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return solarrouter.NewService(client, *s.(*solarrouter.Settings))
+	}},
+	{Battery, func(a alerting.Config) interface{} {
+		s := batterycoordinator.DefaultSettings()
+		s.Alerting = a
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return batterycoordinator.NewService(client, *s.(*batterycoordinator.Settings))
+	}},
+	{Accounting, func(alerting.Config) interface{} {
+		s := energyaccounting.DefaultSettings()
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return energyaccounting.NewService(client, *s.(*energyaccounting.Settings))
+	}},
+	{Semp, func(alerting.Config) interface{} {
+		s := semp2mqtt.DefaultSettings()
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return semp2mqtt.NewService(client, *s.(*semp2mqtt.Settings))
+	}},
+	{Inverter, func(alerting.Config) interface{} {
+		s := inverter2mqtt.DefaultSettings()
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return inverter2mqtt.NewService(client, *s.(*inverter2mqtt.Settings))
+	}},
+	{Ecowatt, func(alerting.Config) interface{} {
+		s := ecowatt2mqtt.DefaultSettings()
+		return &s
+	}, func(client mqtt.Client, s interface{}) (service, error) {
+		return ecowatt2mqtt.NewService(client, *s.(*ecowatt2mqtt.Settings))
+	}},
+}
+
+// serviceNames returns the names of the services of the daemon.
+func serviceNames() []string {
+	names := make([]string, len(serviceKinds))
+	for i, kind := range serviceKinds {
+		names[i] = kind.name
+	}
+	return names
+}
+
+// configFile is the content of the configuration file. The sections of the
+// services are decoded once the defaults of the present ones are set.
+type configFile struct {
+	Mqtt     mqttclient.Config    `yaml:"mqtt"`
+	LogLevel string               `yaml:"log_level"`
+	Alerting alerting.Config      `yaml:"alerting"`
+	Ui       UiConfig             `yaml:"ui"`
+	Sections map[string]yaml.Node `yaml:",inline"`
+}
+
+func loadConfig(path string) (Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return parseConfig(content, path)
+}
+
+// parseConfig decodes the content of the configuration file path.
+func parseConfig(content []byte, path string) (Config, error) {
+	file := configFile{
+		Mqtt:     mqttclient.Config{Url: "192.168.0.20:1883", ClientId: ProgName},
+		LogLevel: "info",
+	}
+	err := yaml.Unmarshal(content, &file)
+	if err != nil {
+		return Config{}, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	config := Config{Mqtt: file.Mqtt, LogLevel: file.LogLevel, Alerting: file.Alerting, Ui: file.Ui, Services: map[string]interface{}{}}
+	for _, kind := range serviceKinds {
+		section, ok := file.Sections[kind.name]
+		if !ok || section.Kind == 0 {
+			continue
+		}
+		settings := kind.defaults(file.Alerting)
+		if err = section.Decode(settings); err != nil {
+			return config, fmt.Errorf("error parsing the %s section of %s: %w", kind.name, path, err)
+		}
+		config.Services[kind.name] = settings
+	}
+	return config, nil
+}
+
+// enabled returns the services which have a section in the configuration file.
+func (c Config) enabled() []string {
+	var names []string
+	for _, kind := range serviceKinds {
+		if _, ok := c.Services[kind.name]; ok {
+			names = append(names, kind.name)
+		}
+	}
+	return names
+}
+
+// validate checks the daemon settings and those of the services having a section,
+// as the services do when they are created.
+func (c Config) validate() error {
+	if c.Mqtt.Url == "" {
+		return fmt.Errorf("mqtt: no url")
+	}
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("log_level: %w", err)
+	}
+	if c.Ui.Listen != "" {
+		if err := c.Ui.validate(); err != nil {
+			return fmt.Errorf("ui: %w", err)
+		}
+	}
+	type validator interface {
+		Validate() error
+	}
+	// In a fixed order, to report the same error every time
+	for _, name := range c.enabled() {
+		if s, ok := c.Services[name].(validator); ok {
+			if err := s.Validate(); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
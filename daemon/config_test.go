@@ -0,0 +1,62 @@
+package main
+
+import (
+	"batterycoordinator"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"powertag2mqtt"
+	"teleinfo2mqtt"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "energy-center.yaml")
+	content := `
+mqtt:
+  url: tcp://broker:1883
+teleinfo:
+  mode: standard
+  labels:
+    exclude: [ADSC]
+powertag:
+  input: tcp://:9000
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Mqtt.Url != "tcp://broker:1883" || config.Mqtt.ClientId != ProgName {
+		t.Errorf("mqtt = %+v, want the url and the default client id", config.Mqtt)
+	}
+	if got, want := config.enabled(), []string{Teleinfo, Powertag}; !reflect.DeepEqual(got, want) {
+		t.Errorf("enabled() = %v, want %v", got, want)
+	}
+	teleinfo := config.Services[Teleinfo].(*teleinfo2mqtt.Settings)
+	if teleinfo.Mode != "standard" || teleinfo.ExitAfter != teleinfo2mqtt.DefaultExitAfter ||
+		!reflect.DeepEqual(teleinfo.Labels.Exclude, []string{"ADSC"}) {
+		t.Errorf("teleinfo = %+v, want the configured mode and labels with the defaults", *teleinfo)
+	}
+	powertag := config.Services[Powertag].(*powertag2mqtt.Config)
+	if powertag.Input != "tcp://:9000" || powertag.TopicPrefix != powertag2mqtt.DefaultConfig().TopicPrefix {
+		t.Errorf("powertag = %+v, want the configured input with the defaults", *powertag)
+	}
+}
+
+func TestServiceKinds(t *testing.T) {
+	config, err := parseConfig([]byte("alerting:\n  topic: energy-center/alerts\nbattery: {}\n"), "energy-center.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if battery := config.Services[Battery].(*batterycoordinator.Settings); battery.Alerting.Topic != "energy-center/alerts" {
+		t.Errorf("battery alerting = %+v, want the alerting of the daemon", battery.Alerting)
+	}
+	if _, err = newService("heater", nil, config); err == nil || !strings.HasSuffix(err.Error(), "inverter or ecowatt") {
+		t.Errorf("newService() = %v, want the list of the services", err)
+	}
+}
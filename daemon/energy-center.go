@@ -0,0 +1,237 @@
+// energy-center runs the bridges of the suite in a single process sharing one
+// configuration file and one MQTT connection, e.g.
+//
+//	energy-center -config /etc/energy-center.yaml teleinfo powertag
+//
+// Without service names, the services having a section in the configuration file are run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	// The alpine images have no time zone database, needed by enedis, accounting
+	// and ecowatt
+	_ "time/tzdata"
+
+	"energy-center/alerting"
+	"energy-center/home-assistant"
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+const ProgName = "energy-center"
+
+// AvailabilityTopic reports whether the daemon is running, it holds its Last Will.
+const AvailabilityTopic = ProgName + "/availability"
+
+// Services run by the daemon.
+const (
+	Teleinfo  = "teleinfo"
+	Powertag  = "powertag"
+	FakeMeter = "fakemeter"
+	Mapper    = "mapper"
+	P1        = "p1"
+	Enedis    = "enedis"
+	// SunspecMeter is the SunSpec meter emulator, fakemeter the Sungrow one.
+	SunspecMeter = "sunspecmeter"
+	SolarRouter  = "solarrouter"
+	Battery      = "battery"
+	Accounting   = "accounting"
+	Semp         = "semp"
+	Inverter     = "inverter"
+	Ecowatt      = "ecowatt"
+)
+
+// StopTimeout bounds the shutdown of the other services once one stopped.
+const StopTimeout = 10 * time.Second
+
+// service is a bridge publishing to the MQTT connection of the daemon.
+type service interface {
+	// OnConnect is called after every (re)connection to the broker.
+	OnConnect()
+	// Run blocks until the service stops or a signal is received, and returns the exit code.
+	Run(signals <-chan os.Signal) int
+}
+
+func main() {
+	var configFile string
+	flag.StringVar(&configFile, "config", "/etc/energy-center.yaml", "YAML configuration file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-config file] [%s]...\n", ProgName, strings.Join(serviceNames(), "|"))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	config, err := loadConfig(configFile)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	level, err := log.ParseLevel(config.LogLevel)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	log.SetLevel(level)
+
+	// reload is signalled by the UI once it wrote a new configuration
+	var reload chan struct{}
+	if config.Ui.Listen != "" {
+		reload = make(chan struct{}, 1)
+		if err = serveUi(config.Ui, configFile, reload); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+	}
+
+	names := flag.Args()
+	if len(names) == 0 {
+		names = config.enabled()
+	}
+	if len(names) == 0 {
+		log.Errorf("no service to run, configure one in %s or give its name", configFile)
+		os.Exit(1)
+	}
+
+	var services []service
+	var alerter *alerting.Alerter
+	client, err := mqttclient.New(config.Mqtt, mqttclient.Options{
+		Will:         &mqttclient.Will{Topic: AvailabilityTopic, Payload: homeassistant.PayloadNotAvailable, Retained: true},
+		ConnectRetry: true,
+		OnConnect: func(client mqtt.Client) {
+			client.Publish(AvailabilityTopic, 0, true, homeassistant.PayloadAvailable)
+			alerter.Resolve("broker", "connected to %s", config.Mqtt.Url)
+			for _, s := range services {
+				s.OnConnect()
+			}
+		},
+		// The alert reaches ntfy or Telegram, the alert topic being unreachable
+		OnConnectionLost: func(client mqtt.Client, err error) {
+			alerter.Raise("broker", alerting.Critical, "connection lost to %s: %s", config.Mqtt.Url, err)
+		},
+		Logger: log.StandardLogger(),
+	})
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	if alerter, err = alerting.New(config.Alerting, client, ProgName); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	for _, name := range names {
+		s, err := newService(name, client, config)
+		if err != nil {
+			log.Errorf("%s: %s", name, err)
+			os.Exit(1)
+		}
+		services = append(services, s)
+	}
+
+	// Retries until the broker is reachable
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	code, reloaded := run(client, names, services, alerter, reload)
+	if reloaded {
+		restart()
+	}
+	os.Exit(code)
+}
+
+// restart replaces the process by a new one reading the configuration file again.
+func restart() {
+	executable, err := os.Executable()
+	if err == nil {
+		log.Info("restarting with the new configuration")
+		err = syscall.Exec(executable, os.Args, os.Environ())
+	}
+	log.Errorf("error restarting: %s", err)
+	os.Exit(1)
+}
+
+// newService creates a service from its section of the configuration, or its defaults.
+func newService(name string, client mqtt.Client, config Config) (service, error) {
+	for _, kind := range serviceKinds {
+		if kind.name != name {
+			continue
+		}
+		settings, ok := config.Services[name]
+		if !ok {
+			settings = kind.defaults(config.Alerting)
+		}
+		return kind.create(client, settings)
+	}
+	names := serviceNames()
+	return nil, fmt.Errorf("unknown service, expected %s or %s", strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+}
+
+// stopped is the exit code of a service which stopped.
+type stopped struct {
+	name string
+	code int
+}
+
+// run runs the services until they all stopped, e.g. on a signal, and returns
+// the first non-zero exit code. A service failing on its own, e.g. teleinfo
+// without frames, is alerted and the others keep running. A reload stops them
+// all, and is reported.
+func run(client mqtt.Client, names []string, services []service, alerter *alerting.Alerter, reload <-chan struct{}) (code int, reloaded bool) {
+	done := make(chan stopped, len(services))
+	var stops []chan os.Signal
+	for i, s := range services {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		stops = append(stops, signals)
+		go func(name string, s service) {
+			done <- stopped{name, s.Run(signals)}
+		}(names[i], s)
+	}
+
+	running := len(services)
+	for running > 0 && !reloaded {
+		select {
+		case s := <-done:
+			running--
+			if s.code == 0 {
+				log.Infof("%s stopped", s.name)
+				continue
+			}
+			if code == 0 {
+				code = s.code
+			}
+			alerter.Raise(s.name, alerting.Critical, "%s stopped with code %d, the other services keep running", s.name, s.code)
+		case <-reload:
+			log.Info("configuration changed, stopping the services")
+			reloaded = true
+		}
+	}
+	for _, stop := range stops {
+		select {
+		case stop <- syscall.SIGTERM:
+		default:
+		}
+	}
+	timeout := time.After(StopTimeout)
+wait:
+	for ; running > 0; running-- {
+		select {
+		case <-done:
+		case <-timeout:
+			log.Warn("services did not stop in time")
+			break wait
+		}
+	}
+
+	client.Publish(AvailabilityTopic, 0, true, homeassistant.PayloadNotAvailable).WaitTimeout(StopTimeout)
+	client.Disconnect(250)
+	return code, reloaded
+}
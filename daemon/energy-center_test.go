@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"energy-center/alerting"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"teleinfo2mqtt"
+)
+
+// fakeClient records the publications of the daemon.
+type fakeClient struct {
+	mqtt.Client
+	mu        sync.Mutex
+	published map[string]string
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch p := payload.(type) {
+	case string:
+		c.published[topic] = p
+	case []byte:
+		c.published[topic] = string(p)
+	}
+	return &mqtt.DummyToken{}
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	return &mqtt.DummyToken{}
+}
+
+func (c *fakeClient) Disconnect(quiesce uint) {}
+
+// fakeService returns code once started, or when stopped when running.
+type fakeService struct {
+	code    int
+	running bool
+	stopped chan struct{}
+}
+
+func (s *fakeService) OnConnect() {}
+
+func (s *fakeService) Run(signals <-chan os.Signal) int {
+	if s.running {
+		<-signals
+		close(s.stopped)
+	}
+	return s.code
+}
+
+func TestRunFailingService(t *testing.T) {
+	client := &fakeClient{published: map[string]string{}}
+	alerter, err := alerting.New(alerting.Config{Topic: "energy-center/alerts"}, client, ProgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := &fakeService{code: 4}
+	other := &fakeService{running: true, stopped: make(chan struct{})}
+	reload := make(chan struct{})
+
+	result := make(chan int)
+	go func() {
+		code, _ := run(client, []string{Teleinfo, Powertag}, []service{failing, other}, alerter, reload)
+		result <- code
+	}()
+	// The alert of the failing service, the other one still running
+	waitFor(t, "the alert of the failing service", func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.published["energy-center/alerts"] != ""
+	})
+	select {
+	case <-other.stopped:
+		t.Fatal("the other service stopped with the failing one")
+	default:
+	}
+
+	reload <- struct{}{}
+	if code := <-result; code != 4 {
+		t.Errorf("exit code = %d, want the code of the failing service", code)
+	}
+	<-other.stopped
+}
+
+// waitFor fails the test unless done returns true within a second.
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for !done() {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for %s", what)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestRunFailingTeleinfo(t *testing.T) {
+	// A network bridge accepting the connection, without any frame
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(ioutil.Discard, conn)
+		}
+	}()
+
+	client := &fakeClient{published: map[string]string{}}
+	alerter, err := alerting.New(alerting.Config{}, client, ProgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := teleinfo2mqtt.DefaultSettings()
+	settings.Port, settings.Mode = "tcp://"+listener.Addr().String(), "historic"
+	settings.ExitAfter = 50 * time.Millisecond
+	s, err := newService(Teleinfo, client, Config{Services: map[string]interface{}{Teleinfo: &settings}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := run(client, []string{Teleinfo}, []service{s}, alerter, make(chan struct{}))
+	if code != teleinfo2mqtt.ExitNoFrame {
+		t.Errorf("exit code = %d, want %d", code, teleinfo2mqtt.ExitNoFrame)
+	}
+	// The frame reader stops with the service
+	waitFor(t, "the Teleinfo reader to stop", func() bool {
+		stacks := make([]byte, 1<<20)
+		return !strings.Contains(string(stacks[:runtime.Stack(stacks, true)]), "teleinfo2mqtt.handleFrame")
+	})
+}
@@ -0,0 +1,63 @@
+module energy-center/daemon
+
+go 1.17
+
+require (
+	batterycoordinator v0.0.0
+	ecowatt2mqtt v0.0.0
+	enedis2mqtt v0.0.0
+	energy-center/alerting v0.0.0
+	energy-center/home-assistant v0.0.0
+	energy-center/mqttclient v0.0.0
+	energyaccounting v0.0.0
+	fakeSungrowMeter v0.0.0
+	fakeSunspecMeter v0.0.0
+	github.com/eclipse/paho.mqtt.golang v1.4.2
+	github.com/sirupsen/logrus v1.9.3
+	gopkg.in/yaml.v3 v3.0.1
+	inverter2mqtt v0.0.0
+	mqttmapper v0.0.0
+	p1tomqtt v0.0.0
+	powertag2mqtt v0.0.0
+	semp2mqtt v0.0.0
+	solarrouter v0.0.0
+	teleinfo2mqtt v0.0.0
+)
+
+require (
+	energy-center/curtailment v0.0.0 // indirect
+	energy-center/influx v0.0.0 // indirect
+	energy-center/regulation v0.0.0 // indirect
+	energy-center/tariff v0.0.0 // indirect
+	github.com/goburrow/modbus v0.1.0 // indirect
+	github.com/goburrow/serial v0.1.0 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
+	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07 // indirect
+	github.com/tbrandon/mbserver v0.0.0-20211210035124-daf3c8c4269f // indirect
+	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+)
+
+replace (
+	batterycoordinator => ../battery
+	ecowatt2mqtt => ../ecowatt
+	enedis2mqtt => ../enedis
+	energy-center/alerting => ../alerting
+	energy-center/curtailment => ../curtailment
+	energy-center/home-assistant => ../home-assistant
+	energy-center/influx => ../influx
+	energy-center/mqttclient => ../mqttclient
+	energy-center/regulation => ../regulation
+	energy-center/tariff => ../tariff
+	energyaccounting => ../accounting
+	fakeSungrowMeter => ../fakeSungrowMeter
+	fakeSunspecMeter => ../fakeSunspecMeter
+	inverter2mqtt => ../inverter
+	mqttmapper => ../mqttmapper
+	p1tomqtt => ../p1
+	powertag2mqtt => ../powertag
+	semp2mqtt => ../semp
+	solarrouter => ../solarrouter
+	teleinfo2mqtt => ../teleinfo
+)
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// UiConfig is the configuration UI of the daemon, editing its configuration file.
+type UiConfig struct {
+	// Listen is the address of the UI, e.g. 127.0.0.1:8080, disabled when empty.
+	// Other addresses than the loopback need a password.
+	Listen string `yaml:"listen"`
+	// Username and Password protect the UI with HTTP basic authentication when
+	// a password is set, the file holding the broker and API credentials.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// validate refuses to expose the configuration file to the network without password.
+func (c UiConfig) validate() error {
+	if c.Password == "" && !loopback(c.Listen) {
+		return fmt.Errorf("listening on %s without password, set one or listen on 127.0.0.1", c.Listen)
+	}
+	return nil
+}
+
+// loopback tells whether a listen address only accepts local connections, an
+// empty host listening on every interface.
+func loopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Redacted replaces the secrets of the configuration sent by the UI. A secret
+// received redacted keeps the value of the configuration file.
+const Redacted = "<redacted>"
+
+// secretKeys are the keys of the settings holding credentials.
+var secretKeys = map[string]bool{"password": true, "token": true, "client_secret": true}
+
+// MaxConfigSize bounds the configuration files received by the UI.
+const MaxConfigSize = 1 << 20
+
+//go:embed ui.html
+var uiPage []byte
+
+// ui serves the page of the configuration UI and its API:
+//
+//	GET  /              the page
+//	GET  /api/config    the configuration file, as YAML and as a JSON document
+//	POST /api/validate  checks a configuration
+//	PUT  /api/config    checks a configuration, writes it and reloads the daemon
+//
+// The configurations are sent as {"yaml": "..."} or {"config": {...}}, the latter
+// rewriting the file without its comments. The previous file is kept as .bak.
+type ui struct {
+	config UiConfig
+	path   string
+	// reload receives a value once a new configuration is written.
+	reload chan<- struct{}
+	mu     sync.Mutex
+}
+
+// configRequest is a configuration sent to the API.
+type configRequest struct {
+	Yaml   string                 `json:"yaml"`
+	Config map[string]interface{} `json:"config"`
+}
+
+// configResponse is the result of the API, Services being the enabled ones.
+type configResponse struct {
+	Yaml     string                 `json:"yaml,omitempty"`
+	Config   map[string]interface{} `json:"config,omitempty"`
+	Services []string               `json:"services,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// serveUi serves the configuration UI of the file path in the background.
+func serveUi(config UiConfig, path string, reload chan<- struct{}) error {
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("ui: %w", err)
+	}
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		return fmt.Errorf("ui: %w", err)
+	}
+	u := &ui{config: config, path: path, reload: reload}
+	go func() {
+		log.Error(http.Serve(listener, u.handler()))
+	}()
+	log.Infof("configuration UI on %s", listener.Addr())
+	return nil
+}
+
+func (u *ui) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(uiPage)
+	})
+	mux.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			u.get(w)
+		case http.MethodPut:
+			u.put(w, r)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/validate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// The document is returned even when invalid, for the page to switch
+		// between the forms and the YAML file
+		content, config, err := u.check(r)
+		// Empty when unparsable, its secrets cannot be told apart
+		content, _ = redact(content)
+		response := configResponse{Yaml: string(content)}
+		yaml.Unmarshal(content, &response.Config)
+		if err != nil {
+			response.Error = err.Error()
+			writeJson(w, http.StatusUnprocessableEntity, response)
+			return
+		}
+		response.Services = config.enabled()
+		writeJson(w, http.StatusOK, response)
+	})
+	if u.config.Password == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(username), []byte(u.config.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(u.config.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+ProgName+`"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (u *ui) get(w http.ResponseWriter) {
+	u.mu.Lock()
+	content, err := os.ReadFile(u.path)
+	u.mu.Unlock()
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, configResponse{Error: err.Error()})
+		return
+	}
+	if content, err = redact(content); err != nil {
+		// Its secrets cannot be told apart, it is fixed on the host
+		writeJson(w, http.StatusInternalServerError, configResponse{Error: fmt.Sprintf("error parsing %s: %s", u.path, err)})
+		return
+	}
+	response := configResponse{Yaml: string(content)}
+	yaml.Unmarshal(content, &response.Config)
+	writeJson(w, http.StatusOK, response)
+}
+
+func (u *ui) put(w http.ResponseWriter, r *http.Request) {
+	content, config, err := u.check(r)
+	if err != nil {
+		writeJson(w, http.StatusUnprocessableEntity, configResponse{Error: err.Error()})
+		return
+	}
+	u.mu.Lock()
+	err = writeConfig(u.path, content)
+	u.mu.Unlock()
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, configResponse{Error: err.Error()})
+		return
+	}
+	log.Infof("%s written by %s", u.path, r.RemoteAddr)
+	writeJson(w, http.StatusOK, configResponse{Services: config.enabled()})
+	select {
+	case u.reload <- struct{}{}:
+	default:
+	}
+}
+
+// check reads the configuration of a request, and returns its YAML content, the
+// redacted secrets restored from the file, once the daemon and its services accept it.
+func (u *ui) check(r *http.Request) ([]byte, Config, error) {
+	var request configRequest
+	decoder := json.NewDecoder(io.LimitReader(r.Body, MaxConfigSize))
+	decoder.UseNumber()
+	if err := decoder.Decode(&request); err != nil {
+		return nil, Config{}, fmt.Errorf("invalid request: %w", err)
+	}
+	content := []byte(request.Yaml)
+	if request.Config != nil {
+		var err error
+		if content, err = yaml.Marshal(yamlValue(request.Config)); err != nil {
+			return nil, Config{}, err
+		}
+	}
+	u.mu.Lock()
+	current, err := os.ReadFile(u.path)
+	u.mu.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, Config{}, err
+	}
+	if content, err = restore(content, current); err != nil {
+		return nil, Config{}, err
+	}
+	config, err := parseConfig(content, filepath.Base(u.path))
+	if err == nil {
+		err = config.validate()
+	}
+	return content, config, err
+}
+
+// secrets calls f with the path, e.g. alerting.ntfy.token, and the node of every
+// secret set in a YAML document.
+func secrets(node *yaml.Node, path string, f func(path string, value *yaml.Node)) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			secrets(child, path, f)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := key.Value
+			if path != "" {
+				childPath = path + "." + key.Value
+			}
+			if secretKeys[key.Value] && value.Kind == yaml.ScalarNode {
+				if value.Value != "" {
+					f(childPath, value)
+				}
+				continue
+			}
+			secrets(value, childPath, f)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			secrets(child, fmt.Sprintf("%s[%d]", path, i), f)
+		}
+	}
+}
+
+// redact replaces the secrets of a configuration by Redacted, keeping its comments.
+func redact(content []byte) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	redacted := false
+	secrets(&document, "", func(path string, value *yaml.Node) {
+		value.Value, value.Style, value.Tag = Redacted, 0, "!!str"
+		redacted = true
+	})
+	if !redacted {
+		return content, nil
+	}
+	return encodeYaml(&document)
+}
+
+// restore replaces the redacted secrets of a configuration by the ones at the
+// same place in the current file.
+func restore(content []byte, current []byte) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		// Reported by parseConfig
+		return content, nil
+	}
+	var redacted []string
+	values := map[string]*yaml.Node{}
+	secrets(&document, "", func(path string, value *yaml.Node) {
+		if value.Value == Redacted {
+			redacted = append(redacted, path)
+			values[path] = value
+		}
+	})
+	if len(redacted) == 0 {
+		return content, nil
+	}
+	var file yaml.Node
+	saved := map[string]string{}
+	if yaml.Unmarshal(current, &file) == nil {
+		secrets(&file, "", func(path string, value *yaml.Node) {
+			saved[path] = value.Value
+		})
+	}
+	for _, path := range redacted {
+		secret, ok := saved[path]
+		if !ok || secret == Redacted {
+			return nil, fmt.Errorf("%s: redacted secret missing from the file, enter it again", path)
+		}
+		values[path].Value = secret
+	}
+	return encodeYaml(&document)
+}
+
+func encodeYaml(document *yaml.Node) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// yamlValue converts the numbers of a JSON document to integers when they are,
+// for the YAML file to hold 20000 rather than 2e+04.
+func yamlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = yamlValue(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = yamlValue(value)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil && !math.IsInf(f, 0) {
+			return f
+		}
+		return v.String()
+	}
+	return v
+}
+
+// writeConfig replaces the configuration file, keeping the previous one as .bak.
+// The new file is renamed over the old one, which is never half written, unless
+// it is a mount point.
+func writeConfig(path string, content []byte) error {
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		previous, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(path+".bak", previous, mode); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		// A file bind mounted in a container cannot be replaced, only rewritten
+		log.Warnf("ui: %s, rewriting %s", err, path)
+		return os.WriteFile(path, content, mode)
+	}
+	return nil
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Warnf("ui: error writing a response: %s", err)
+	}
+}
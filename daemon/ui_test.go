@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mqttmapper"
+	"semp2mqtt"
+)
+
+const testConfig = `# broker
+mqtt:
+  url: tcp://broker:1883
+mapper:
+  mappings:
+    - source: shellies/em/emeter/0/power
+      target: grid
+`
+
+func testUi(t *testing.T, config UiConfig) (*httptest.Server, string, chan struct{}) {
+	path := filepath.Join(t.TempDir(), "energy-center.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reload := make(chan struct{}, 1)
+	server := httptest.NewServer((&ui{config: config, path: path, reload: reload}).handler())
+	t.Cleanup(server.Close)
+	return server, path, reload
+}
+
+func request(t *testing.T, method, url, body string) (int, configResponse) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var response configResponse
+	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, response
+}
+
+func TestUiConfig(t *testing.T) {
+	server, path, reload := testUi(t, UiConfig{})
+
+	status, response := request(t, http.MethodGet, server.URL+"/api/config", "")
+	if status != http.StatusOK || response.Yaml != testConfig || response.Config["mqtt"].(map[string]interface{})["url"] != "tcp://broker:1883" {
+		t.Errorf("GET = %d %+v, want the file and its document", status, response)
+	}
+
+	// A station without budget topic
+	invalid := `{"config": {"mqtt": {"url": "tcp://broker:1883"},
+		"semp": {"devices": [{"id": "F-00000001-000000000001-00", "max_power": 7400}]}}}`
+	status, response = request(t, http.MethodPut, server.URL+"/api/config", invalid)
+	if status != http.StatusUnprocessableEntity || !strings.HasPrefix(response.Error, "semp: ") {
+		t.Errorf("PUT of an invalid configuration = %d %+v, want the error of the semp section", status, response)
+	}
+	if content, _ := os.ReadFile(path); string(content) != testConfig {
+		t.Errorf("file after an invalid configuration = %q, want it unchanged", content)
+	}
+
+	valid := `{"config": {"mqtt": {"url": "tcp://broker:1883"},
+		"mapper": {"mappings": [{"source": "meter/power", "target": "grid", "scale": 0.5}]},
+		"semp": {"devices": [{"id": "F-00000001-000000000001-00", "max_power": 7400, "budget_topic": "garage/budget"}]}}}`
+	status, response = request(t, http.MethodPut, server.URL+"/api/config", valid)
+	if status != http.StatusOK || strings.Join(response.Services, ",") != Mapper+","+Semp {
+		t.Fatalf("PUT = %d %+v, want the mapper and semp services", status, response)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	semp, mapper := config.Services[Semp].(*semp2mqtt.Settings), config.Services[Mapper].(*mqttmapper.Settings)
+	if semp.Devices[0].MaxPower != 7400 || mapper.Mappings[0].Scale != 0.5 {
+		t.Errorf("written configuration = %+v %+v", *semp, *mapper)
+	}
+	if content, _ := os.ReadFile(path + ".bak"); string(content) != testConfig {
+		t.Errorf("backup = %q, want the previous file", content)
+	}
+	select {
+	case <-reload:
+	default:
+		t.Error("no reload once written")
+	}
+}
+
+func TestUiValidate(t *testing.T) {
+	server, _, reload := testUi(t, UiConfig{})
+
+	body, _ := json.Marshal(configRequest{Yaml: testConfig + "solarrouter:\n  regulator: pid\n"})
+	status, response := request(t, http.MethodPost, server.URL+"/api/validate", string(body))
+	if status != http.StatusUnprocessableEntity || !strings.HasPrefix(response.Error, "solarrouter: ") || response.Config["solarrouter"] == nil {
+		t.Errorf("validate = %d %+v, want the error and the document", status, response)
+	}
+	body, _ = json.Marshal(configRequest{Yaml: testConfig})
+	if status, response = request(t, http.MethodPost, server.URL+"/api/validate", string(body)); status != http.StatusOK {
+		t.Errorf("validate of a valid configuration = %d %+v", status, response)
+	}
+	select {
+	case <-reload:
+		t.Error("reload without writing")
+	default:
+	}
+}
+
+func TestUiAuthentication(t *testing.T) {
+	server, _, _ := testUi(t, UiConfig{Username: "admin", Password: "secret"})
+	resp, err := http.Get(server.URL + "/api/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status without credentials = %s", resp.Status)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	req.SetBasicAuth("admin", "secret")
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("page = %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestUiSecrets(t *testing.T) {
+	server, path, _ := testUi(t, UiConfig{})
+	secret := `mqtt:
+  url: tcp://broker:1883
+  password: broker-secret
+alerting:
+  telegram:
+    # the bot
+    token: "123456:ABC"
+    chat_id: "42"
+`
+	if err := os.WriteFile(path, []byte(secret), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	status, response := request(t, http.MethodGet, server.URL+"/api/config", "")
+	if status != http.StatusOK || strings.Contains(response.Yaml, "secret") || strings.Contains(response.Yaml, "ABC") ||
+		!strings.Contains(response.Yaml, "# the bot") || response.Config["mqtt"].(map[string]interface{})["password"] != Redacted {
+		t.Errorf("GET = %d %+v, want the secrets redacted", status, response)
+	}
+
+	// The page sends the secrets back redacted, the broker address changed
+	body, _ := json.Marshal(configRequest{Yaml: strings.Replace(response.Yaml, "tcp://broker", "tcp://mosquitto", 1)})
+	if status, response = request(t, http.MethodPost, server.URL+"/api/validate", string(body)); status != http.StatusOK || strings.Contains(response.Yaml, "secret") {
+		t.Errorf("validate = %d %+v, want the secrets redacted", status, response)
+	}
+	if status, response = request(t, http.MethodPut, server.URL+"/api/config", string(body)); status != http.StatusOK {
+		t.Fatalf("PUT = %d %+v", status, response)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Mqtt.Url != "tcp://mosquitto:1883" || config.Mqtt.Password != "broker-secret" || config.Alerting.Telegram.Token != "123456:ABC" {
+		t.Errorf("written configuration = %+v %+v, want the secrets of the file", config.Mqtt, config.Alerting)
+	}
+
+	// A redacted secret which is not in the file cannot be restored
+	invalid := `{"config": {"mqtt": {"url": "tcp://broker:1883"}, "alerting": {"ntfy": {"url": "https://ntfy.sh/home", "token": "` + Redacted + `"}}}}`
+	if status, response = request(t, http.MethodPut, server.URL+"/api/config", invalid); status != http.StatusUnprocessableEntity ||
+		!strings.HasPrefix(response.Error, "alerting.ntfy.token: ") {
+		t.Errorf("PUT of an unknown redacted secret = %d %+v", status, response)
+	}
+}
+
+func TestUiListen(t *testing.T) {
+	for _, test := range []struct {
+		config UiConfig
+		valid  bool
+	}{
+		{UiConfig{Listen: "127.0.0.1:8080"}, true},
+		{UiConfig{Listen: "localhost:8080"}, true},
+		{UiConfig{Listen: "[::1]:8080"}, true},
+		{UiConfig{Listen: ":8080"}, false},
+		{UiConfig{Listen: "192.168.0.10:8080"}, false},
+		{UiConfig{Listen: ":8080", Username: "admin", Password: "secret"}, true},
+	} {
+		if err := test.config.validate(); (err == nil) != test.valid {
+			t.Errorf("validate(%+v) = %v, want valid %t", test.config, err, test.valid)
+		}
+	}
+}
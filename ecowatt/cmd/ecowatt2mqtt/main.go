@@ -0,0 +1,11 @@
+package main
+
+import (
+	"ecowatt2mqtt"
+	// The alpine images have no time zone database
+	_ "time/tzdata"
+)
+
+func main() {
+	ecowatt2mqtt.Main()
+}
@@ -0,0 +1,134 @@
+// Package ecowatt2mqtt publishes the Ecowatt signal of RTE, the stress of the
+// French grid by hour, to MQTT and Home Assistant, and curtails the EV charging
+// during the orange and red hours through the curtailment topic of
+// batterycoordinator and semp2mqtt, unless overridden from Home Assistant.
+package ecowatt2mqtt
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"ecowatt2mqtt/rte"
+	"energy-center/home-assistant"
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+const ProgNameMqtt string = "ecowatt2mqtt"
+
+// Version is set when building, with -ldflags "-X ecowatt2mqtt.Version=..."
+var Version = "dev"
+
+// Location is the time zone of the hours of the signal.
+const Location = "Europe/Paris"
+
+// Curtailment is the demand response of the tense hours.
+type Curtailment struct {
+	// Topic receives the curtailment events, the curtailment topic of
+	// batterycoordinator and semp2mqtt. Disabled when empty.
+	Topic string `yaml:"topic"`
+	// Orange and Red are the charging power allowed during the orange and red
+	// hours, in W, 0 deferring the charging.
+	Orange float64 `yaml:"orange"`
+	Red    float64 `yaml:"red"`
+}
+
+// Settings are the settings of the bridge, from the configuration file of
+// ecowatt2mqtt or the ecowatt section of the energy-center configuration file.
+type Settings struct {
+	// Mqtt is the broker connection of ecowatt2mqtt, ignored by the daemon.
+	Mqtt mqttclient.Config `yaml:"mqtt"`
+	// Api holds the credentials of the application subscribed to the Ecowatt API.
+	Api rte.Config `yaml:"api"`
+	// Interval is the delay between two calls of the API, at least 15 minutes.
+	Interval time.Duration `yaml:"interval"`
+	// TopicPrefix is the root of the topics of the signal and of the override.
+	TopicPrefix string `yaml:"topic_prefix"`
+	// DiscoveryPrefix is the root of the Home Assistant discovery topics.
+	DiscoveryPrefix string      `yaml:"discovery_prefix"`
+	Curtailment     Curtailment `yaml:"curtailment"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Mqtt:            mqttclient.Config{Url: "192.168.0.20:1883", ClientId: ProgNameMqtt},
+		Interval:        time.Hour,
+		TopicPrefix:     "ecowatt",
+		DiscoveryPrefix: homeassistant.DefaultDiscoveryPrefix,
+		Curtailment:     Curtailment{Topic: "curtailment/event", Orange: 1380, Red: 0},
+	}
+}
+
+func (s Settings) Validate() error {
+	if s.Api.ClientId == "" || s.Api.ClientSecret == "" {
+		return fmt.Errorf("the api needs a client id and secret")
+	}
+	if s.Interval < rte.MinInterval {
+		return fmt.Errorf("interval must be at least %s, the API rejects more frequent calls", rte.MinInterval)
+	}
+	if s.TopicPrefix == "" {
+		return fmt.Errorf("no topic_prefix")
+	}
+	if s.Curtailment.Orange < 0 || s.Curtailment.Red < 0 {
+		return fmt.Errorf("the orange and red curtailments must be positive or 0")
+	}
+	return nil
+}
+
+// LoadSettings reads the settings from a YAML file, over the defaults.
+func LoadSettings(path string) (Settings, error) {
+	settings := DefaultSettings()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return settings, err
+	}
+	if err = yaml.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Main runs the bridge with its own MQTT connection, configured by a YAML file.
+func Main() {
+	var path string
+	flag.StringVar(&path, "config", "/etc/ecowatt2mqtt.yaml", "YAML configuration file")
+	flag.Parse()
+
+	settings, err := LoadSettings(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	mqtt.ERROR = log.New(os.Stdout, "", 0)
+	var service *Service
+	client, err := mqttclient.New(settings.Mqtt, mqttclient.Options{
+		ConnectRetry: true,
+		OnConnect: func(client mqtt.Client) {
+			service.OnConnect()
+		},
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if service, err = NewService(client, settings); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
@@ -0,0 +1,185 @@
+// Package rte is a client of the Ecowatt API of RTE, the stress signal of the
+// French grid, see https://data.rte-france.com/catalog/-/api/consumption/Ecowatt/v5.0
+package rte
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ProductionUrl = "https://digital.iservices.rte-france.com"
+
+	tokenPath   = "/token/oauth/"
+	signalsPath = "/open_api/ecowatt/v5/signals"
+	// sandboxPath returns fixed signals, for the applications not yet subscribed.
+	sandboxPath = "/open_api/ecowatt/v5/sandbox/signals"
+)
+
+// MinInterval is the shortest delay between two calls accepted by the API.
+const MinInterval = 15 * time.Minute
+
+// Level is the state of the grid during an hour or a day.
+type Level int
+
+const (
+	// CarbonFree is a green level with a low carbon production.
+	CarbonFree Level = iota
+	Green
+	// Orange is a tense grid, the consumption should be reduced.
+	Orange
+	// Red is a very tense grid, with cuts if the consumption is not reduced.
+	Red
+)
+
+func (l Level) String() string {
+	switch l {
+	case CarbonFree:
+		return "carbon_free"
+	case Green:
+		return "green"
+	case Orange:
+		return "orange"
+	case Red:
+		return "red"
+	}
+	return fmt.Sprintf("unknown(%d)", int(l))
+}
+
+// Day is the signal of a day, for the whole day and for each of its hours.
+type Day struct {
+	// Date is the midnight starting the day, in the French time zone.
+	Date    time.Time
+	Level   Level
+	Message string
+	Hours   [24]Level
+}
+
+// Config holds the credentials of the application, subscribed to the Ecowatt API.
+type Config struct {
+	// Url is the root of the APIs, ProductionUrl when empty.
+	Url          string `yaml:"url"`
+	ClientId     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// Sandbox calls the sandbox of the API, which returns fixed signals.
+	Sandbox bool `yaml:"sandbox"`
+}
+
+// signals is the body of the signals response.
+type signals struct {
+	Signals []struct {
+		Jour    string `json:"jour"`
+		Dvalue  int    `json:"dvalue"`
+		Message string `json:"message"`
+		Values  []struct {
+			Pas    int `json:"pas"`
+			Hvalue int `json:"hvalue"`
+		} `json:"values"`
+	} `json:"signals"`
+}
+
+// Client calls the Ecowatt API, renewing its access token when needed.
+type Client struct {
+	config Config
+	http   *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func New(config Config) *Client {
+	if config.Url == "" {
+		config.Url = ProductionUrl
+	}
+	config.Url = strings.TrimSuffix(config.Url, "/")
+	return &Client{config: config, http: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Signals returns the signals of the next days, today first.
+func (c *Client) Signals() ([]Day, error) {
+	path := signalsPath
+	if c.config.Sandbox {
+		path = sandboxPath
+	}
+	var body signals
+	if err := c.get(path, &body); err != nil {
+		return nil, fmt.Errorf("error getting the Ecowatt signals: %w", err)
+	}
+	days := make([]Day, 0, len(body.Signals))
+	for _, s := range body.Signals {
+		date, err := time.Parse(time.RFC3339, s.Jour)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the Ecowatt day: %w", err)
+		}
+		day := Day{Date: date, Level: Level(s.Dvalue), Message: s.Message}
+		for _, v := range s.Values {
+			if v.Pas >= 0 && v.Pas < len(day.Hours) {
+				day.Hours[v.Pas] = Level(v.Hvalue)
+			}
+		}
+		days = append(days, day)
+	}
+	// The days are not sorted by the API
+	sort.Slice(days, func(i, j int) bool { return days[i].Date.Before(days[j].Date) })
+	return days, nil
+}
+
+func (c *Client) get(path string, body interface{}) error {
+	token, err := c.accessToken()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, c.config.Url+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	return c.do(req, body)
+}
+
+// accessToken returns a token of the client credentials, renewed a minute
+// before it expires.
+func (c *Client) accessToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+	req, err := http.NewRequest(http.MethodPost, c.config.Url+tokenPath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(c.config.ClientId, c.config.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = c.do(req, &body); err != nil {
+		return "", fmt.Errorf("error getting an access token: %w", err)
+	}
+	c.token = body.AccessToken
+	c.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+func (c *Client) do(req *http.Request, body interface{}) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(body)
+}
@@ -0,0 +1,61 @@
+package rte
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSignals = `{"signals":[
+{"GenerationFichier":"2022-12-05T23:00:00+01:00","jour":"2022-12-07T00:00:00+01:00","dvalue":1,"message":"Pas d'alerte.","values":[{"pas":0,"hvalue":1},{"pas":18,"hvalue":1}]},
+{"GenerationFichier":"2022-12-05T23:00:00+01:00","jour":"2022-12-06T00:00:00+01:00","dvalue":3,"message":"Coupures d'électricité programmées","values":[{"pas":0,"hvalue":0},{"pas":8,"hvalue":2},{"pas":18,"hvalue":3}]}
+]}`
+
+func TestSignals(t *testing.T) {
+	var tokens int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case tokenPath:
+			if id, secret, _ := r.BasicAuth(); id != "id" || secret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tokens++
+			fmt.Fprint(w, `{"access_token":"abc","token_type":"Bearer","expires_in":7200}`)
+		case signalsPath:
+			if r.Header.Get("Authorization") != "Bearer abc" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, testSignals)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := New(Config{Url: server.URL, ClientId: "id", ClientSecret: "secret"})
+	for i := 0; i < 2; i++ {
+		days, err := c.Signals()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(days) != 2 || days[0].Date.Day() != 6 || days[0].Level != Red || days[0].Hours[8] != Orange ||
+			days[0].Hours[18] != Red || days[0].Hours[1] != CarbonFree || days[1].Level != Green {
+			t.Errorf("days = %+v, want the red day first", days)
+		}
+		if _, offset := days[0].Date.Zone(); offset != 3600 || !days[0].Date.Equal(time.Date(2022, 12, 5, 23, 0, 0, 0, time.UTC)) {
+			t.Errorf("date = %s, want the French midnight", days[0].Date)
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("got %d tokens, want the first one to be reused", tokens)
+	}
+
+	c = New(Config{Url: server.URL, ClientId: "id", ClientSecret: "wrong"})
+	if _, err := c.Signals(); err == nil {
+		t.Error("expected an error with wrong credentials")
+	}
+}
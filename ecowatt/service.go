@@ -0,0 +1,291 @@
+package ecowatt2mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"ecowatt2mqtt/rte"
+	"energy-center/curtailment"
+	"energy-center/home-assistant"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// EventId is the id of the curtailment events of the bridge, each one replacing
+// the previous one.
+const EventId = "ecowatt"
+
+// cancel ends the curtailment of the bridge.
+const cancel = `{"id":"` + EventId + `","cancel":true}`
+
+// Unknown is the level published when the signal of the hour is not known.
+const Unknown = "unknown"
+
+// Service is the bridge, on a MQTT connection it does not own, either the one of
+// ecowatt2mqtt or the one shared by the energy-center daemon.
+type Service struct {
+	client    mqtt.Client
+	api       *rte.Client
+	settings  Settings
+	location  *time.Location
+	discovery homeassistant.Options
+	commands  *homeassistant.Commands
+
+	mu       sync.Mutex
+	days     []rte.Day
+	override bool
+	// published holds the last payload of every topic, published on changes only.
+	published map[string]string
+}
+
+// NewService subscribes to the override switch, the signal is fetched by Run.
+// The client must restore the subscriptions on reconnection, as a
+// mqttclient.Client does.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(Location)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newService(client, settings, location)
+	if err != nil {
+		return nil, err
+	}
+	homeassistant.OnHaOnline(client, s.discovery, func() {
+		fmt.Printf("%s: Home Assistant is online, republishing discovery\n", ProgNameMqtt)
+		s.sendDiscovery()
+	})
+	return s, nil
+}
+
+// newService creates the bridge and subscribes to the override switch, whose
+// retained state restores the override after a restart.
+func newService(client mqtt.Client, settings Settings, location *time.Location) (*Service, error) {
+	s := &Service{
+		client:    client,
+		api:       rte.New(settings.Api),
+		settings:  settings,
+		location:  location,
+		discovery: homeassistant.Options{Prefix: settings.DiscoveryPrefix, Origin: homeassistant.NewOrigin(ProgNameMqtt, Version)},
+		commands:  homeassistant.NewCommands(),
+		published: map[string]string{},
+	}
+	client.Subscribe(s.topic("override"), 0, func(client mqtt.Client, msg mqtt.Message) {
+		s.setOverride(string(msg.Payload()) == homeassistant.PayloadOn)
+	})
+	err := s.commands.Register(client, s.overrideSwitch(), func(payload string) {
+		override := payload == homeassistant.PayloadOn
+		s.publish(s.topic("override"), onOff(override))
+		s.setOverride(override)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Service) topic(name string) string {
+	return s.settings.TopicPrefix + "/" + name
+}
+
+// setOverride switches the curtailment off or back on. The state of the switch is
+// only published on commands, for its retained state to restore the override.
+func (s *Service) setOverride(override bool) {
+	s.mu.Lock()
+	changed := s.override != override
+	s.override = override
+	s.mu.Unlock()
+	if changed {
+		fmt.Printf("%s: override %s\n", ProgNameMqtt, onOff(override))
+		s.update(time.Now())
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return homeassistant.PayloadOn
+	}
+	return homeassistant.PayloadOff
+}
+
+// device is the device of the entities of the bridge in Home Assistant.
+var device = homeassistant.Device{
+	Identifiers:  []string{ProgNameMqtt},
+	Name:         "Ecowatt",
+	Manufacturer: "RTE",
+	Model:        "Ecowatt v5",
+}
+
+// configurationItems are the entities of the bridge in Home Assistant.
+func (s *Service) configurationItems() []homeassistant.ConfigurationItem {
+	levels := []string{rte.CarbonFree.String(), rte.Green.String(), rte.Orange.String(), rte.Red.String(), Unknown}
+	var items []homeassistant.ConfigurationItem
+	for _, sensor := range []struct{ name, topic string }{
+		{"Ecowatt level", "level"},
+		{"Ecowatt today", "today"},
+		{"Ecowatt tomorrow", "tomorrow"},
+	} {
+		item := homeassistant.NewSensor(sensor.name, "ecowatt_"+sensor.topic, s.topic(sensor.topic), device)
+		item.DeviceClass, item.Options, item.Icon = "enum", levels, "mdi:transmission-tower"
+		items = append(items, item)
+	}
+	return append(items, s.overrideSwitch())
+}
+
+// overrideSwitch is the switch cancelling the curtailment, e.g. to charge before a trip.
+func (s *Service) overrideSwitch() homeassistant.ConfigurationItem {
+	override := homeassistant.NewSwitch("Ecowatt override", "ecowatt_override", s.topic("override"), s.topic("override/set"), device)
+	override.Icon, override.EntityCategory = "mdi:flash-alert", homeassistant.Config
+	return override
+}
+
+func (s *Service) sendDiscovery() {
+	if _, err := homeassistant.SendConfigurationToHa(s.client, s.discovery, s.configurationItems()); err != nil {
+		fmt.Printf("%s: error publishing discovery: %s\n", ProgNameMqtt, err)
+	}
+}
+
+// OnConnect publishes the discovery configuration, the states being retained.
+func (s *Service) OnConnect() {
+	go s.sendDiscovery()
+}
+
+// fetch gets the signal, the previous one being kept on errors.
+func (s *Service) fetch() {
+	days, err := s.api.Signals()
+	if err != nil {
+		fmt.Printf("%s: %s\n", ProgNameMqtt, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.days = days
+}
+
+// level returns the level of the hour at t.
+func (s *Service) level(days []rte.Day, t time.Time) (rte.Level, bool) {
+	day, ok := s.day(days, t)
+	if !ok {
+		return 0, false
+	}
+	return day.Hours[t.In(s.location).Hour()], true
+}
+
+// day returns the signal of the day of t.
+func (s *Service) day(days []rte.Day, t time.Time) (rte.Day, bool) {
+	y, m, d := t.In(s.location).Date()
+	for _, day := range days {
+		if dy, dm, dd := day.Date.In(s.location).Date(); dy == y && dm == m && dd == d {
+			return day, true
+		}
+	}
+	return rte.Day{}, false
+}
+
+// limit returns the charging power allowed at a level, ok being false when the
+// charging is not curtailed.
+func (s *Service) limit(level rte.Level) (limit float64, ok bool) {
+	switch level {
+	case rte.Orange:
+		return s.settings.Curtailment.Orange, true
+	case rte.Red:
+		return s.settings.Curtailment.Red, true
+	}
+	return 0, false
+}
+
+// event returns the curtailment of the tense hours starting with the hour of now,
+// ok being false when the hour is not tense.
+func (s *Service) event(days []rte.Day, now time.Time) (e curtailment.Event, ok bool) {
+	level, known := s.level(days, now)
+	if !known {
+		return e, false
+	}
+	limit, curtailed := s.limit(level)
+	if !curtailed {
+		return e, false
+	}
+	start := now.Truncate(time.Hour)
+	end := start.Add(time.Hour)
+	// The following hours of the same limit, up to the end of the signal
+	for {
+		next, known := s.level(days, end)
+		if l, ok := s.limit(next); !known || !ok || l != limit {
+			break
+		}
+		end = end.Add(time.Hour)
+	}
+	return curtailment.Event{Id: EventId, Limit: limit, Start: start, Duration: end.Sub(start).Seconds()}, true
+}
+
+// update publishes the levels and the curtailment of now, or cancels it.
+func (s *Service) update(now time.Time) {
+	s.mu.Lock()
+	days, override := s.days, s.override
+	s.mu.Unlock()
+
+	level := Unknown
+	if l, ok := s.level(days, now); ok {
+		level = l.String()
+	}
+	s.publish(s.topic("level"), level)
+	for i, name := range []string{"today", "tomorrow"} {
+		level := Unknown
+		if day, ok := s.day(days, now.In(s.location).AddDate(0, 0, i)); ok {
+			level = day.Level.String()
+		}
+		s.publish(s.topic(name), level)
+	}
+
+	if s.settings.Curtailment.Topic == "" {
+		return
+	}
+	payload := cancel
+	if e, ok := s.event(days, now); ok && !override {
+		content, _ := json.Marshal(e)
+		payload = string(content)
+	}
+	s.publish(s.settings.Curtailment.Topic, payload)
+}
+
+// publish publishes a retained payload when it changed.
+func (s *Service) publish(topic, payload string) {
+	s.mu.Lock()
+	changed := s.published[topic] != payload
+	s.published[topic] = payload
+	s.mu.Unlock()
+	if changed {
+		s.client.Publish(topic, 0, true, payload)
+	}
+}
+
+// Run fetches the signal every interval and follows it every minute until a
+// signal is received, and returns the exit code. The curtailment is cancelled
+// when stopping.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	fetch := time.NewTicker(s.settings.Interval)
+	defer fetch.Stop()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	s.fetch()
+	s.update(time.Now())
+	for {
+		select {
+		case now := <-fetch.C:
+			s.fetch()
+			s.update(now)
+		case now := <-ticker.C:
+			s.update(now)
+		case sig := <-signals:
+			fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+			if s.settings.Curtailment.Topic != "" {
+				s.publish(s.settings.Curtailment.Topic, cancel)
+			}
+			return 0
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package ecowatt2mqtt
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"ecowatt2mqtt/rte"
+	"energy-center/curtailment"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeClient records the publications and delivers messages to the subscriptions.
+type fakeClient struct {
+	mqtt.Client
+	mu        sync.Mutex
+	handlers  map[string]mqtt.MessageHandler
+	published map[string]string
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{handlers: map[string]mqtt.MessageHandler{}, published: map[string]string{}}
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, handler mqtt.MessageHandler) mqtt.Token {
+	c.handlers[topic] = handler
+	return &mqtt.DummyToken{}
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published[topic] = payload.(string)
+	return nil
+}
+
+func (c *fakeClient) deliver(topic, payload string) {
+	c.handlers[topic](c, message{topic: topic, payload: payload})
+}
+
+type message struct {
+	mqtt.Message
+	topic, payload string
+}
+
+func (m message) Topic() string   { return m.topic }
+func (m message) Payload() []byte { return []byte(m.payload) }
+
+func testService(t *testing.T) (*Service, *fakeClient, *time.Location) {
+	location, err := time.LoadLocation(Location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := DefaultSettings()
+	settings.Api.ClientId, settings.Api.ClientSecret = "id", "secret"
+	if err := settings.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	client := newFakeClient()
+	s, err := newService(client, settings, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A tense evening today, orange from 17h and red from 19h to 21h
+	today := rte.Day{Date: time.Date(2026, 1, 12, 0, 0, 0, 0, location), Level: rte.Red}
+	tomorrow := rte.Day{Date: today.Date.AddDate(0, 0, 1), Level: rte.Green}
+	for h := range today.Hours {
+		today.Hours[h], tomorrow.Hours[h] = rte.Green, rte.Green
+	}
+	for h := 17; h < 21; h++ {
+		today.Hours[h] = rte.Orange
+	}
+	today.Hours[19], today.Hours[20] = rte.Red, rte.Red
+	s.days = []rte.Day{today, tomorrow}
+	return s, client, location
+}
+
+func event(t *testing.T, client *fakeClient) curtailment.Event {
+	var e curtailment.Event
+	if err := json.Unmarshal([]byte(client.published["curtailment/event"]), &e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestUpdate(t *testing.T) {
+	s, client, location := testService(t)
+
+	s.update(time.Date(2026, 1, 12, 12, 30, 0, 0, location))
+	if client.published["ecowatt/level"] != "green" || client.published["ecowatt/today"] != "red" ||
+		client.published["ecowatt/tomorrow"] != "green" || client.published["curtailment/event"] != cancel {
+		t.Errorf("published at noon = %v, want the levels and no curtailment", client.published)
+	}
+
+	// The orange hours, up to the red ones
+	s.update(time.Date(2026, 1, 12, 17, 30, 0, 0, location))
+	e := event(t, client)
+	if client.published["ecowatt/level"] != "orange" || e.Id != EventId || e.Limit != 1380 ||
+		!e.Start.Equal(time.Date(2026, 1, 12, 17, 0, 0, 0, location)) || e.Duration != 7200 {
+		t.Errorf("event at 17h30 = %+v, want 1380 W for 2 hours", e)
+	}
+
+	s.update(time.Date(2026, 1, 12, 19, 0, 0, 0, location))
+	if e = event(t, client); e.Limit != 0 || e.Duration != 7200 {
+		t.Errorf("event at 19h = %+v, want 0 W for 2 hours", e)
+	}
+
+	s.update(time.Date(2026, 1, 12, 21, 0, 0, 0, location))
+	if client.published["curtailment/event"] != cancel {
+		t.Errorf("event at 21h = %s, want a cancel", client.published["curtailment/event"])
+	}
+
+	// After the end of the signal
+	s.update(time.Date(2026, 1, 14, 12, 0, 0, 0, location))
+	if client.published["ecowatt/level"] != Unknown || client.published["ecowatt/today"] != Unknown {
+		t.Errorf("published without a signal = %v, want unknown levels", client.published)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	s, client, location := testService(t)
+	red := time.Date(2026, 1, 12, 19, 0, 0, 0, location)
+
+	// The retained state restores the override, without republishing it
+	client.deliver("ecowatt/override", "ON")
+	s.update(red)
+	if !s.override || client.published["curtailment/event"] != cancel || client.published["ecowatt/override"] != "" {
+		t.Errorf("restored override = %v, published = %v, want the curtailment cancelled", s.override, client.published)
+	}
+
+	client.deliver("ecowatt/override/set", "OFF")
+	s.update(red)
+	if s.override || client.published["ecowatt/override"] != "OFF" || client.published["curtailment/event"] == cancel {
+		t.Errorf("override switched off = %v, published = %v, want the state and the curtailment", s.override, client.published)
+	}
+}
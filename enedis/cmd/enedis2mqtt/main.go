@@ -0,0 +1,11 @@
+package main
+
+import (
+	"enedis2mqtt"
+	// The alpine images have no time zone database
+	_ "time/tzdata"
+)
+
+func main() {
+	enedis2mqtt.Main()
+}
@@ -0,0 +1,218 @@
+// Package dataconnect is a client of the metering data APIs of Enedis Data Connect,
+// see https://datahub-enedis.fr/services-api/data-connect/documentation/
+package dataconnect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ProductionUrl = "https://ext.prod.api.enedis.fr"
+	SandboxUrl    = "https://ext.prod-sandbox.api.enedis.fr"
+
+	tokenPath  = "/oauth2/v3/token"
+	dateLayout = "2006-01-02"
+	timeLayout = "2006-01-02 15:04:05"
+)
+
+// Measure is a metering data API.
+type Measure string
+
+const (
+	DailyConsumption     Measure = "daily_consumption"
+	ConsumptionLoadCurve Measure = "consumption_load_curve"
+	DailyProduction      Measure = "daily_production"
+	ProductionLoadCurve  Measure = "production_load_curve"
+)
+
+var paths = map[Measure]string{
+	DailyConsumption:     "/metering_data_dc/v5/daily_consumption",
+	ConsumptionLoadCurve: "/metering_data_clc/v5/consumption_load_curve",
+	DailyProduction:      "/metering_data_dp/v5/daily_production",
+	ProductionLoadCurve:  "/metering_data_plc/v5/production_load_curve",
+}
+
+// ParseMeasure returns the measure of a name, e.g. daily_consumption.
+func ParseMeasure(name string) (Measure, error) {
+	if _, ok := paths[Measure(name)]; !ok {
+		return "", fmt.Errorf("unknown measure %s, expected daily_consumption, consumption_load_curve, daily_production or production_load_curve", name)
+	}
+	return Measure(name), nil
+}
+
+// IsLoadCurve reports whether the measure is a 30 minutes average power curve,
+// rather than daily energies.
+func (m Measure) IsLoadCurve() bool {
+	return m == ConsumptionLoadCurve || m == ProductionLoadCurve
+}
+
+// MaxRange is the longest period the API returns in a single request.
+func (m Measure) MaxRange() time.Duration {
+	if m.IsLoadCurve() {
+		return 7 * 24 * time.Hour
+	}
+	return 365 * 24 * time.Hour
+}
+
+// Config holds the credentials of the application. Token replaces the client
+// credentials for the gateways which hand out a long lived token.
+type Config struct {
+	// Url is the root of the APIs, ProductionUrl when empty.
+	Url          string `yaml:"url"`
+	ClientId     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	Token        string `yaml:"token"`
+}
+
+// Reading is a value of a curve, in Wh for the daily measures and W for the load curves.
+type Reading struct {
+	Time  time.Time
+	Value float64
+}
+
+// meterReading is the body of the metering data responses.
+type meterReading struct {
+	MeterReading struct {
+		UsagePointId    string `json:"usage_point_id"`
+		IntervalReading []struct {
+			Value string `json:"value"`
+			Date  string `json:"date"`
+		} `json:"interval_reading"`
+	} `json:"meter_reading"`
+}
+
+// Client calls the metering data APIs, renewing its access token when needed.
+type Client struct {
+	config   Config
+	http     *http.Client
+	location *time.Location
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// New creates a client. The dates of the curves are local to location, Europe/Paris.
+func New(config Config, location *time.Location) *Client {
+	if config.Url == "" {
+		config.Url = ProductionUrl
+	}
+	config.Url = strings.TrimSuffix(config.Url, "/")
+	return &Client{config: config, http: &http.Client{Timeout: 30 * time.Second}, location: location}
+}
+
+// Readings returns the readings of a usage point between the days start and end,
+// end excluded, splitting the period in as many requests as needed.
+func (c *Client) Readings(measure Measure, usagePoint string, start, end time.Time) ([]Reading, error) {
+	var readings []Reading
+	for from := start; from.Before(end); {
+		to := from.Add(measure.MaxRange())
+		if to.After(end) {
+			to = end
+		}
+		r, err := c.readings(measure, usagePoint, from, to)
+		if err != nil {
+			return readings, err
+		}
+		readings = append(readings, r...)
+		from = to
+	}
+	return readings, nil
+}
+
+func (c *Client) readings(measure Measure, usagePoint string, start, end time.Time) ([]Reading, error) {
+	query := url.Values{
+		"usage_point_id": {usagePoint},
+		"start":          {start.In(c.location).Format(dateLayout)},
+		"end":            {end.In(c.location).Format(dateLayout)},
+	}
+	var body meterReading
+	if err := c.get(paths[measure]+"?"+query.Encode(), &body); err != nil {
+		return nil, fmt.Errorf("error getting %s of %s: %w", measure, usagePoint, err)
+	}
+	var readings []Reading
+	for _, r := range body.MeterReading.IntervalReading {
+		layout := dateLayout
+		if measure.IsLoadCurve() {
+			layout = timeLayout
+		}
+		t, err := time.ParseInLocation(layout, r.Date, c.location)
+		if err != nil {
+			return readings, fmt.Errorf("error parsing %s reading date: %w", measure, err)
+		}
+		v, err := strconv.ParseFloat(r.Value, 64)
+		if err != nil {
+			return readings, fmt.Errorf("error parsing %s reading value: %w", measure, err)
+		}
+		readings = append(readings, Reading{Time: t, Value: v})
+	}
+	return readings, nil
+}
+
+func (c *Client) get(path string, body interface{}) error {
+	token, err := c.accessToken()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, c.config.Url+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	return c.do(req, body)
+}
+
+// accessToken returns the static token, or a token of the client credentials
+// renewed a minute before it expires.
+func (c *Client) accessToken() (string, error) {
+	if c.config.Token != "" {
+		return c.config.Token, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.config.ClientId},
+		"client_secret": {c.config.ClientSecret},
+	}
+	req, err := http.NewRequest(http.MethodPost, c.config.Url+tokenPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = c.do(req, &body); err != nil {
+		return "", fmt.Errorf("error getting an access token: %w", err)
+	}
+	c.token = body.AccessToken
+	c.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+func (c *Client) do(req *http.Request, body interface{}) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(body)
+}
@@ -0,0 +1,62 @@
+package dataconnect
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadings(t *testing.T) {
+	var tokens int
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case tokenPath:
+			if r.FormValue("client_secret") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tokens++
+			fmt.Fprint(w, `{"access_token":"abc","expires_in":3600}`)
+		case paths[ConsumptionLoadCurve]:
+			if r.Header.Get("Authorization") != "Bearer abc" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			start, end := r.FormValue("start"), r.FormValue("end")
+			ranges = append(ranges, start+"/"+end)
+			fmt.Fprintf(w, `{"meter_reading":{"usage_point_id":"%s","interval_reading":[{"value":"1200","date":"%s 00:30:00"}]}}`,
+				r.FormValue("usage_point_id"), start)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	c := New(Config{Url: server.URL, ClientId: "id", ClientSecret: "secret"}, paris)
+	start := time.Date(2023, 3, 1, 0, 0, 0, 0, paris)
+	readings, err := c.Readings(ConsumptionLoadCurve, "12345678901234", start, start.AddDate(0, 0, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2023-03-01/2023-03-08", "2023-03-08/2023-03-11"}; fmt.Sprint(ranges) != fmt.Sprint(want) {
+		t.Errorf("requested %v, want %v", ranges, want)
+	}
+	if tokens != 1 {
+		t.Errorf("got %d tokens, want the first one to be reused", tokens)
+	}
+	if len(readings) != 2 || readings[0].Value != 1200 || !readings[0].Time.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("readings = %+v", readings)
+	}
+
+	c = New(Config{Url: server.URL, ClientId: "id", ClientSecret: "wrong"}, paris)
+	if _, err = c.Readings(DailyConsumption, "12345678901234", start, start.AddDate(0, 0, 1)); err == nil {
+		t.Error("expected an error with wrong credentials")
+	}
+}
@@ -0,0 +1,138 @@
+// Package enedis2mqtt imports the consumption and production curves of a Linky
+// from the Enedis Data Connect APIs, the official history complementing the live
+// Teleinfo feed, to InfluxDB and MQTT.
+package enedis2mqtt
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"enedis2mqtt/dataconnect"
+	"energy-center/influx"
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+const ProgNameMqtt string = "enedis2mqtt"
+
+// Location is the time zone of the dates of the Enedis APIs.
+const Location = "Europe/Paris"
+
+const (
+	DefaultHistoryDays = 7
+	// The curves of a day are published by Enedis during the next morning
+	DefaultInterval = 6 * time.Hour
+)
+
+// Settings are the settings of the importer, from the configuration file of
+// enedis2mqtt or the enedis section of the energy-center configuration file.
+type Settings struct {
+	// Mqtt is the broker connection of enedis2mqtt, ignored by the daemon.
+	Mqtt mqttclient.Config `yaml:"mqtt"`
+	// Api holds the Data Connect credentials.
+	Api dataconnect.Config `yaml:"api"`
+	// UsagePoint is the PRM of the meter, whose owner consented to the access.
+	UsagePoint string `yaml:"usage_point"`
+	// Measures are the imported curves: daily_consumption, consumption_load_curve,
+	// daily_production or production_load_curve.
+	Measures []string `yaml:"measures"`
+	// HistoryDays is the number of past days imported on the first run.
+	HistoryDays int `yaml:"history_days"`
+	// Interval is the delay between two imports.
+	Interval time.Duration `yaml:"interval"`
+	// TopicPrefix is the root of the topics of the last readings.
+	TopicPrefix string `yaml:"topic_prefix"`
+	// StateFile persists the imported days across restarts, everything is
+	// imported again from HistoryDays ago when empty.
+	StateFile string `yaml:"state_file"`
+	// Influx configures the InfluxDB output receiving the whole curves.
+	Influx influx.Config `yaml:"influx"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Mqtt:        mqttclient.Config{Url: "192.168.0.20:1883", ClientId: ProgNameMqtt},
+		Measures:    []string{string(dataconnect.DailyConsumption), string(dataconnect.ConsumptionLoadCurve)},
+		HistoryDays: DefaultHistoryDays,
+		Interval:    DefaultInterval,
+		TopicPrefix: "enedis",
+	}
+}
+
+func (s Settings) Validate() error {
+	if s.UsagePoint == "" {
+		return fmt.Errorf("no usage point configured")
+	}
+	if s.Api.Token == "" && (s.Api.ClientId == "" || s.Api.ClientSecret == "") {
+		return fmt.Errorf("the api needs a token or a client id and secret")
+	}
+	if s.Interval <= 0 || s.HistoryDays <= 0 {
+		return fmt.Errorf("interval and history_days must be positive")
+	}
+	for _, m := range s.Measures {
+		if _, err := dataconnect.ParseMeasure(m); err != nil {
+			return err
+		}
+	}
+	return s.Influx.Validate()
+}
+
+// LoadSettings reads the settings from a YAML file, over the defaults.
+func LoadSettings(path string) (Settings, error) {
+	settings := DefaultSettings()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return settings, err
+	}
+	if err = yaml.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Main runs the importer with its own MQTT connection, configured by a YAML file.
+func Main() {
+	var path string
+	var once bool
+	flag.StringVar(&path, "config", "/etc/enedis2mqtt.yaml", "YAML configuration file")
+	flag.BoolVar(&once, "once", false, "import once and exit, e.g. from cron")
+	flag.Parse()
+
+	settings, err := LoadSettings(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	mqtt.ERROR = log.New(os.Stdout, "", 0)
+	client, err := mqttclient.New(settings.Mqtt, mqttclient.Options{ConnectRetry: true})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	service, err := NewService(client, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	if once {
+		service.importer.run(time.Now())
+		client.Disconnect(250)
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
@@ -0,0 +1,128 @@
+package enedis2mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"enedis2mqtt/dataconnect"
+	"energy-center/influx"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// importer pulls the curves of a usage point from the last imported day on.
+type importer struct {
+	api    *dataconnect.Client
+	client mqtt.Client
+	// influx is nil when the InfluxDB output is disabled. Unlike the live bridges,
+	// the points of an import are written at once, and the import is retried on error.
+	influx   *influx.Client
+	settings Settings
+	measures []dataconnect.Measure
+	location *time.Location
+	// next is the first day to import, by measure, persisted in the state file.
+	next map[dataconnect.Measure]time.Time
+}
+
+// lastReading is the payload of the MQTT topic of a measure.
+type lastReading struct {
+	Date  time.Time `json:"date"`
+	Value float64   `json:"value"`
+	Unit  string    `json:"unit"`
+}
+
+// run imports every measure up to yesterday, logging the errors. The measures
+// which failed are imported again from the same day by the next run.
+func (i *importer) run(now time.Time) {
+	end := startOfDay(now, i.location)
+	for _, measure := range i.measures {
+		start, ok := i.next[measure]
+		if !ok {
+			start = end.AddDate(0, 0, -i.settings.HistoryDays)
+		}
+		if !start.Before(end) {
+			continue
+		}
+		if err := i.importMeasure(measure, start, end); err != nil {
+			fmt.Printf("%s: error importing %s: %s\n", ProgNameMqtt, measure, err)
+		}
+	}
+	if err := i.saveState(); err != nil {
+		fmt.Printf("%s: error saving the state: %s\n", ProgNameMqtt, err)
+	}
+}
+
+func (i *importer) importMeasure(measure dataconnect.Measure, start, end time.Time) error {
+	readings, err := i.api.Readings(measure, i.settings.UsagePoint, start, end)
+	if err != nil {
+		return err
+	}
+	if len(readings) == 0 {
+		return nil
+	}
+	if i.influx != nil {
+		lines := make([]string, len(readings))
+		for n, r := range readings {
+			lines[n] = fmt.Sprintf("enedis,usage_point=%s,measure=%s value=%s %d",
+				i.settings.UsagePoint, measure, strconv.FormatFloat(r.Value, 'f', -1, 64), r.Time.UnixNano())
+		}
+		if err = i.influx.Post(lines); err != nil {
+			return fmt.Errorf("error writing to InfluxDB: %w", err)
+		}
+	}
+
+	last := readings[len(readings)-1]
+	unit := "Wh"
+	intervalEnd := last.Time.AddDate(0, 0, 1)
+	if measure.IsLoadCurve() {
+		// The date of the load curve readings is the end of their 30 minutes interval
+		unit = "W"
+		intervalEnd = last.Time
+	}
+	payload, _ := json.Marshal(lastReading{Date: last.Time, Value: last.Value, Unit: unit})
+	i.client.Publish(i.topic(measure), 0, true, payload)
+	fmt.Printf("%s: imported %d %s readings up to %s\n", ProgNameMqtt, len(readings), measure, last.Time)
+
+	// An incomplete day is imported again by the next run
+	i.next[measure] = startOfDay(intervalEnd, i.location)
+	return nil
+}
+
+// topic returns the topic of the last reading of a measure, e.g. enedis/<usage point>/daily_consumption.
+func (i *importer) topic(measure dataconnect.Measure) string {
+	return i.settings.TopicPrefix + "/" + i.settings.UsagePoint + "/" + string(measure)
+}
+
+// loadState reads the first day to import of every measure, none without state file.
+func (i *importer) loadState() error {
+	i.next = map[dataconnect.Measure]time.Time{}
+	if i.settings.StateFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(i.settings.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, &i.next)
+}
+
+func (i *importer) saveState() error {
+	if i.settings.StateFile == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(i.next, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(i.settings.StateFile, content, 0644)
+}
+
+func startOfDay(t time.Time, location *time.Location) time.Time {
+	y, m, d := t.In(location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, location)
+}
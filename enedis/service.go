@@ -0,0 +1,66 @@
+package enedis2mqtt
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"enedis2mqtt/dataconnect"
+	"energy-center/influx"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Service is the importer, publishing to a MQTT connection it does not own,
+// either the one of enedis2mqtt or the one shared by the energy-center daemon.
+type Service struct {
+	importer *importer
+	interval time.Duration
+}
+
+// NewService checks the settings and loads the imported days, the imports start with Run.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(Location)
+	if err != nil {
+		return nil, err
+	}
+	i := &importer{
+		api:      dataconnect.New(settings.Api, location),
+		client:   client,
+		settings: settings,
+		location: location,
+	}
+	for _, m := range settings.Measures {
+		measure, _ := dataconnect.ParseMeasure(m)
+		i.measures = append(i.measures, measure)
+	}
+	if settings.Influx.Enabled() {
+		i.influx = influx.NewClient(settings.Influx, 30*time.Second)
+	}
+	if err = i.loadState(); err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", settings.StateFile, err)
+	}
+	return &Service{importer: i, interval: settings.Interval}, nil
+}
+
+// OnConnect has nothing to restore, the last readings are retained.
+func (s *Service) OnConnect() {
+}
+
+// Run imports the curves every interval until a signal is received, and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	s.importer.run(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			s.importer.run(now)
+		case sig := <-signals:
+			fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+			return 0
+		}
+	}
+}
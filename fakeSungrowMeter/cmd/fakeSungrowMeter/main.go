@@ -0,0 +1,7 @@
+package main
+
+import "fakeSungrowMeter"
+
+func main() {
+	fakeSungrowMeter.Main()
+}
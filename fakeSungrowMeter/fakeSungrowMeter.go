@@ -1,4 +1,4 @@
-package main
+package fakeSungrowMeter
 
 import (
 	"encoding/binary"
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
+	"energy-center/alerting"
+	"energy-center/mqttclient"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/goburrow/serial"
 	mbserver "github.com/tbrandon/mbserver"
@@ -17,18 +21,25 @@ import (
 const ProgNameMqtt string = "fakeSungrowPower"
 const WatchdogTimeout = 3 * time.Minute
 
-var watchdogMqtt = time.AfterFunc(WatchdogTimeout, watchdogMqttFired)
-var watchdogModbus = time.AfterFunc(WatchdogTimeout, watchdogModbusFired)
+// The watchdogs are started with the service, so that importing the package does not arm them
+var watchdogMqtt, watchdogModbus *time.Timer
+
+// alerter reports the watchdog trips before the process is killed
+var alerter *alerting.Alerter
 
 var gridPower int32 = 0
 var gridIndex int32 = 0
 var injecIndex int32 = 0
 
 func watchdogMqttFired() {
+	alerter.Raise("watchdog_mqtt", alerting.Critical, "no powerinfo message for %s, killing process", WatchdogTimeout)
+	alerter.Flush(5 * time.Second)
 	log.Fatal("Watchdog mqtt fired, killing process")
 	os.Exit(4)
 }
 func watchdogModbusFired() {
+	alerter.Raise("watchdog_modbus", alerting.Critical, "no Modbus request from the inverter for %s, killing process", WatchdogTimeout)
+	alerter.Flush(5 * time.Second)
 	log.Fatal("Watchdog modbus fired, killing process")
 	os.Exit(4)
 }
@@ -55,28 +66,90 @@ func listenMqttInjectIndex(client mqtt.Client) {
 	})
 }
 
-func main() {
+// Settings are the settings of the emulator, from the command line of fakeSungrowMeter
+// or the fakemeter section of the energy-center configuration file.
+type Settings struct {
+	// Port is the RS485 serial port the inverter polls.
+	Port string `yaml:"port"`
+	// Alerting reports the watchdog trips.
+	Alerting alerting.Config `yaml:"alerting"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{Port: "/dev/serial/by-id/usb-1a86_USB2.0-Ser_-if00-port0"}
+}
+
+// Main runs the emulator with its own MQTT connection, configured by the command line.
+func Main() {
 	var url string
-	var serialDevice string
+	settings := DefaultSettings()
 
 	flag.StringVar(&url, "url", "192.168.0.20:1883", "mqtt server")
-	flag.StringVar(&serialDevice, "port", "/dev/serial/by-id/usb-1a86_USB2.0-Ser_-if00-port0", "serial port")
+	flag.StringVar(&settings.Port, "port", settings.Port, "serial port")
 
 	flag.Parse()
 
-	mqttClient := CreateMqttClient(url)
-	modbusServer := CreateModbusServer(serialDevice)
-	defer modbusServer.Close()
+	mqttClient, err := CreateMqttClient(url)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	service, err := NewService(mqttClient, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
 
-	go listenMqttGrid(mqttClient)
-	go listenMqttGridIndex(mqttClient)
-	go listenMqttInjectIndex(mqttClient)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	mqttClient.Disconnect(250)
+	os.Exit(code)
+}
 
+// Service is the meter emulator, fed by a MQTT connection it does not own, either
+// the one of fakeSungrowMeter or the one shared by the energy-center daemon.
+type Service struct {
+	client       mqtt.Client
+	modbusServer *mbserver.Server
+}
+
+// NewService listens on the serial port, arms the watchdogs and subscribes to the
+// powerinfo topics. The client must restore the subscriptions on reconnection, as
+// a mqttclient.Client does.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	var err error
+	if alerter, err = alerting.New(settings.Alerting, client, ProgNameMqtt); err != nil {
+		return nil, err
+	}
+	watchdogMqtt = time.AfterFunc(WatchdogTimeout, watchdogMqttFired)
+	watchdogModbus = time.AfterFunc(WatchdogTimeout, watchdogModbusFired)
+	modbusServer, err := CreateModbusServer(settings.Port)
+	if err != nil {
+		watchdogMqtt.Stop()
+		watchdogModbus.Stop()
+		return nil, err
+	}
 	modbusServer.RegisterFunctionHandler(3, modbusMessageHandler)
+	listenMqttGrid(client)
+	listenMqttGridIndex(client)
+	listenMqttInjectIndex(client)
+	return &Service{client: client, modbusServer: modbusServer}, nil
+}
 
-	<-(chan int)(nil) //trick to wait forever
+// OnConnect has nothing to restore, the client subscribes again to the powerinfo topics.
+func (s *Service) OnConnect() {
+}
 
-	fmt.Printf("%s: Reached end of app, should not happens\n", ProgNameMqtt)
+// Run answers the inverter until a signal is received, and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	sig := <-signals
+	fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+	s.modbusServer.Close()
+	return 0
 }
 
 func modbusMessageHandler(server *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
@@ -160,7 +233,7 @@ func modbusMessageHandler(server *mbserver.Server, frame mbserver.Framer) ([]byt
 	return data, &mbserver.Success
 }
 
-func CreateModbusServer(device string) *mbserver.Server {
+func CreateModbusServer(device string) (*mbserver.Server, error) {
 	serv := mbserver.NewServer()
 	serv.Debug = true
 	err := serv.ListenRTU(&serial.Config{
@@ -171,23 +244,13 @@ func CreateModbusServer(device string) *mbserver.Server {
 		Parity:   "N",
 		Timeout:  10 * time.Second})
 	if err != nil {
-		fmt.Errorf("failed to listen, got %v\n", err)
+		return nil, fmt.Errorf("failed to listen, got %v", err)
 	}
 
-	return serv
+	return serv, nil
 }
 
-func CreateMqttClient(url string) mqtt.Client {
+func CreateMqttClient(url string) (mqtt.Client, error) {
 	mqtt.ERROR = log.New(os.Stdout, "", 0)
-	opts := mqtt.NewClientOptions().AddBroker(url).SetClientID(ProgNameMqtt)
-	opts.SetKeepAlive(60 * time.Second)
-	opts.SetPingTimeout(1 * time.Second)
-
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		panic(token.Error())
-	}
-
-	fmt.Printf("%s: connected to %s\n", ProgNameMqtt, url)
-	return client
+	return mqttclient.New(mqttclient.Config{Url: url, ClientId: ProgNameMqtt}, mqttclient.Options{ConnectRetry: true})
 }
@@ -0,0 +1,7 @@
+package main
+
+import "fakeSunspecMeter"
+
+func main() {
+	fakeSunspecMeter.Main()
+}
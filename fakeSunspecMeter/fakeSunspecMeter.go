@@ -0,0 +1,213 @@
+// Package fakeSunspecMeter emulates a SunSpec meter over Modbus TCP, fed by the
+// powerinfo topics, for the inverters (SMA, Fronius, SolarEdge...) which expect one
+// at the grid connection point, as fakeSungrowMeter does for the Sungrow ones.
+package fakeSunspecMeter
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mbserver "github.com/tbrandon/mbserver"
+)
+
+const ProgNameMqtt string = "fakeSunspecMeter"
+
+// StaleTimeout is the delay without grid power after which the emulator stops
+// answering, for the inverter to fall back to its safe mode.
+const StaleTimeout = 1 * time.Minute
+
+// Identity is the content of the SunSpec common model.
+type Identity struct {
+	Manufacturer  string `yaml:"manufacturer"`
+	Model         string `yaml:"model"`
+	Version       string `yaml:"version"`
+	SerialNumber  string `yaml:"serial_number"`
+	DeviceAddress uint16 `yaml:"device_address"`
+}
+
+// Settings are the settings of the emulator, from the command line of fakeSunspecMeter
+// or the sunspecmeter section of the energy-center configuration file.
+type Settings struct {
+	// Address is the Modbus TCP listen address.
+	Address string `yaml:"address"`
+	// Model is the SunSpec meter model, 201 (single phase) or 203 (three phases wye).
+	Model int `yaml:"model"`
+	// Base is the address of the SunS marker, 40000 for most inverters.
+	Base uint16 `yaml:"base"`
+	// Invert reports the power drawn from the grid as negative.
+	Invert bool `yaml:"invert"`
+	// Voltage and Frequency are the nominal values reported, the powerinfo
+	// topics do not carry them.
+	Voltage   float64  `yaml:"voltage"`
+	Frequency float64  `yaml:"frequency"`
+	Identity  Identity `yaml:"identity"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Address:   ":502",
+		Model:     WyeMeter,
+		Base:      40000,
+		Voltage:   230,
+		Frequency: 50,
+		Identity: Identity{
+			Manufacturer:  "energy-center",
+			Model:         ProgNameMqtt,
+			Version:       "1.0",
+			SerialNumber:  "1",
+			DeviceAddress: 1,
+		},
+	}
+}
+
+func (s Settings) Validate() error {
+	if s.Model != SinglePhaseMeter && s.Model != WyeMeter {
+		return fmt.Errorf("unsupported model %d, expected %d or %d", s.Model, SinglePhaseMeter, WyeMeter)
+	}
+	if s.Voltage <= 0 {
+		return fmt.Errorf("voltage must be positive")
+	}
+	return nil
+}
+
+// Main runs the emulator with its own MQTT connection, configured by the command line.
+func Main() {
+	var url string
+	var model int
+	var base uint
+	settings := DefaultSettings()
+
+	flag.StringVar(&url, "url", "192.168.0.20:1883", "mqtt server")
+	flag.StringVar(&settings.Address, "address", settings.Address, "Modbus TCP listen address")
+	flag.IntVar(&model, "model", settings.Model, "SunSpec meter model, 201 (single phase) or 203 (three phases)")
+	flag.UintVar(&base, "base", uint(settings.Base), "address of the SunSpec map")
+	flag.BoolVar(&settings.Invert, "invert", false, "report the power drawn from the grid as negative")
+
+	flag.Parse()
+	settings.Model = model
+	settings.Base = uint16(base)
+
+	mqtt.ERROR = log.New(os.Stdout, "", 0)
+	client, err := mqttclient.New(mqttclient.Config{Url: url, ClientId: ProgNameMqtt}, mqttclient.Options{ConnectRetry: true})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	service, err := NewService(client, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
+
+// Service is the meter emulator, fed by a MQTT connection it does not own, either
+// the one of fakeSunspecMeter or the one shared by the energy-center daemon.
+type Service struct {
+	settings     Settings
+	modbusServer *mbserver.Server
+
+	mu       sync.Mutex
+	measures measures
+	updated  time.Time
+}
+
+// NewService listens on the Modbus TCP address and subscribes to the powerinfo
+// topics. The client must restore the subscriptions on reconnection, as a
+// mqttclient.Client does.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Service{settings: settings, measures: measures{voltage: settings.Voltage, frequency: settings.Frequency}}
+	s.modbusServer = mbserver.NewServer()
+	s.modbusServer.RegisterFunctionHandler(3, s.readHoldingRegisters)
+	if err := s.modbusServer.ListenTCP(settings.Address); err != nil {
+		return nil, fmt.Errorf("failed to listen, got %v", err)
+	}
+	client.Subscribe("powerinfo/grid", 0, s.listen(func(m *measures, v float64) {
+		if settings.Invert {
+			v = -v
+		}
+		m.power = v
+	}))
+	client.Subscribe("powerinfo/totalIndex", 0, s.listen(func(m *measures, v float64) { m.imported = v }))
+	client.Subscribe("powerinfo/totalInjIndex", 0, s.listen(func(m *measures, v float64) { m.exported = v }))
+	return s, nil
+}
+
+// listen returns a handler updating the measures with the value of a topic.
+// Only the grid power, which changes continuously, marks the measures as fresh.
+func (s *Service) listen(update func(m *measures, v float64)) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		v, err := strconv.ParseFloat(string(msg.Payload()), 64)
+		if err != nil {
+			fmt.Printf("%s: ignoring %s: %s\n", ProgNameMqtt, msg.Topic(), err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		update(&s.measures, v)
+		if msg.Topic() == "powerinfo/grid" {
+			s.updated = time.Now()
+		}
+	}
+}
+
+// OnConnect has nothing to restore, the client subscribes again to the powerinfo topics.
+func (s *Service) OnConnect() {
+}
+
+// Run answers the inverter until a signal is received, and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	sig := <-signals
+	fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+	s.modbusServer.Close()
+	return 0
+}
+
+func (s *Service) readHoldingRegisters(server *mbserver.Server, frame mbserver.Framer) ([]byte, *mbserver.Exception) {
+	data := frame.GetData()
+	if len(data) < 4 {
+		return []byte{}, &mbserver.IllegalDataValue
+	}
+	register := int(binary.BigEndian.Uint16(data[0:2]))
+	numRegs := int(binary.BigEndian.Uint16(data[2:4]))
+
+	s.mu.Lock()
+	m, updated := s.measures, s.updated
+	s.mu.Unlock()
+	if time.Since(updated) > StaleTimeout {
+		return []byte{}, &mbserver.SlaveDeviceFailure
+	}
+
+	regs := registers(s.settings.Model, s.settings.Identity, m)
+	start := register - int(s.settings.Base)
+	if numRegs == 0 || numRegs > 125 || start < 0 || start+numRegs > len(regs) {
+		return []byte{}, &mbserver.IllegalDataAddress
+	}
+	response := make([]byte, 1+2*numRegs)
+	response[0] = byte(2 * numRegs)
+	for i, reg := range regs[start : start+numRegs] {
+		binary.BigEndian.PutUint16(response[1+2*i:], reg)
+	}
+	return response, &mbserver.Success
+}
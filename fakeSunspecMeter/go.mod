@@ -0,0 +1,19 @@
+module fakeSunspecMeter
+
+go 1.17
+
+require (
+	energy-center/mqttclient v0.0.0
+	github.com/eclipse/paho.mqtt.golang v1.4.2
+	github.com/tbrandon/mbserver v0.0.0-20211210035124-daf3c8c4269f
+)
+
+require (
+	github.com/goburrow/modbus v0.1.0 // indirect
+	github.com/goburrow/serial v0.1.0 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
+	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+)
+
+replace energy-center/mqttclient => ../mqttclient
@@ -0,0 +1,168 @@
+package fakeSunspecMeter
+
+import (
+	"math"
+)
+
+// SunSpec markers and model ids, see the SunSpec Information Model Reference.
+const (
+	sunSpecId0  = 0x5375 // "Su"
+	sunSpecId1  = 0x6e53 // "nS"
+	commonModel = 1
+	commonLen   = 66
+	meterLen    = 105
+	endModel    = 0xffff
+
+	// Value of the int16 and sunssf points which are not implemented
+	notImplementedInt16 = 0x8000
+)
+
+// Meter models, which share the same layout of integer points with scale factors.
+const (
+	SinglePhaseMeter = 201
+	WyeMeter         = 203
+)
+
+// Offsets of the points of the meter models, from the first register after the length.
+const (
+	pointA        = 0
+	pointASF      = 4
+	pointPhV      = 5
+	pointPPV      = 9
+	pointVSF      = 13
+	pointHz       = 14
+	pointHzSF     = 15
+	pointW        = 16
+	pointWSF      = 20
+	pointVA       = 21
+	pointVASF     = 25
+	pointVAR      = 26
+	pointVARSF    = 30
+	pointPF       = 31
+	pointPFSF     = 35
+	pointTotWhExp = 36
+	pointTotWhImp = 44
+	pointTotWhSF  = 52
+	pointVAhSF    = 69
+	pointVArhSF   = 102
+	pointEvt      = 103
+)
+
+// Scale factors of the published values, as powers of ten.
+const (
+	currentSF     = -2
+	voltageSF     = -1
+	frequencySF   = -2
+	powerSF       = 0
+	powerFactorSF = -2
+	energySF      = 0
+)
+
+// measures are the values the meter reports, grid power positive when drawn.
+type measures struct {
+	power     float64
+	imported  float64
+	exported  float64
+	voltage   float64
+	frequency float64
+}
+
+// registers returns the SunSpec register map of the meter, from the SunS marker
+// to the end model, to be served from the base address.
+func registers(model int, identity Identity, m measures) []uint16 {
+	regs := []uint16{sunSpecId0, sunSpecId1, commonModel, commonLen}
+	regs = append(regs, str(identity.Manufacturer, 16)...)
+	regs = append(regs, str(identity.Model, 16)...)
+	regs = append(regs, str("", 8)...) // Options
+	regs = append(regs, str(identity.Version, 8)...)
+	regs = append(regs, str(identity.SerialNumber, 16)...)
+	regs = append(regs, identity.DeviceAddress, 0)
+
+	meter := make([]uint16, meterLen)
+	for i := range meter {
+		meter[i] = notImplementedInt16
+	}
+	phases := 1
+	if model == WyeMeter {
+		phases = 3
+	}
+	perPhase := m.power / float64(phases)
+	current := math.Abs(perPhase) / m.voltage
+
+	meter[pointA] = int16Reg(current*float64(phases), currentSF)
+	meter[pointASF] = scaleFactor(currentSF)
+	meter[pointPhV] = int16Reg(m.voltage, voltageSF)
+	meter[pointVSF] = scaleFactor(voltageSF)
+	meter[pointHz] = int16Reg(m.frequency, frequencySF)
+	meter[pointHzSF] = scaleFactor(frequencySF)
+	meter[pointW] = int16Reg(m.power, powerSF)
+	meter[pointWSF] = scaleFactor(powerSF)
+	meter[pointVA] = int16Reg(math.Abs(m.power), powerSF)
+	meter[pointVASF] = scaleFactor(powerSF)
+	meter[pointVAR] = 0
+	meter[pointVARSF] = scaleFactor(powerSF)
+	meter[pointPF] = int16Reg(1, powerFactorSF)
+	meter[pointPFSF] = scaleFactor(powerFactorSF)
+	for phase := 1; phase <= phases; phase++ {
+		meter[pointA+phase] = int16Reg(current, currentSF)
+		meter[pointPhV+phase] = int16Reg(m.voltage, voltageSF)
+		meter[pointW+phase] = int16Reg(perPhase, powerSF)
+		meter[pointVA+phase] = int16Reg(math.Abs(perPhase), powerSF)
+		meter[pointVAR+phase] = 0
+		meter[pointPF+phase] = int16Reg(1, powerFactorSF)
+	}
+	if model == WyeMeter {
+		meter[pointPPV] = int16Reg(m.voltage*math.Sqrt(3), voltageSF)
+	}
+	// The energies are acc32, whose phase values are not implemented when zero
+	for i := pointTotWhExp; i < pointTotWhSF; i++ {
+		meter[i] = 0
+	}
+	for i := pointTotWhSF + 1; i < pointEvt; i++ {
+		if i != pointVAhSF && i != pointVArhSF {
+			meter[i] = 0
+		}
+	}
+	copy(meter[pointTotWhExp:], acc32(m.exported, energySF))
+	copy(meter[pointTotWhImp:], acc32(m.imported, energySF))
+	meter[pointTotWhSF] = scaleFactor(energySF)
+	// No event
+	meter[pointEvt], meter[pointEvt+1] = 0, 0
+
+	regs = append(regs, uint16(model), meterLen)
+	regs = append(regs, meter...)
+	return append(regs, endModel, 0)
+}
+
+// str encodes a string on n registers, padded with NUL characters.
+func str(s string, n int) []uint16 {
+	b := make([]byte, 2*n)
+	copy(b, s)
+	regs := make([]uint16, n)
+	for i := range regs {
+		regs[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return regs
+}
+
+// int16Reg scales a value, clamped to the int16 range.
+func int16Reg(v float64, sf int) uint16 {
+	scaled := math.Round(v / math.Pow10(sf))
+	scaled = math.Max(math.MinInt16+1, math.Min(math.MaxInt16, scaled))
+	return uint16(int16(scaled))
+}
+
+func scaleFactor(sf int) uint16 {
+	return uint16(int16(sf))
+}
+
+// acc32 encodes an accumulator on two registers, high word first. Negative
+// values are not representable and reported as zero.
+func acc32(v float64, sf int) []uint16 {
+	scaled := math.Round(v / math.Pow10(sf))
+	if scaled < 0 {
+		scaled = 0
+	}
+	u := uint32(math.Min(scaled, math.MaxUint32))
+	return []uint16{uint16(u >> 16), uint16(u)}
+}
@@ -0,0 +1,76 @@
+package fakeSunspecMeter
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	mbserver "github.com/tbrandon/mbserver"
+)
+
+func TestRegisters(t *testing.T) {
+	identity := DefaultSettings().Identity
+	regs := registers(WyeMeter, identity, measures{power: -1500, imported: 123456, exported: 70000, voltage: 230, frequency: 50})
+	if len(regs) != 4+commonLen+2+meterLen+2 {
+		t.Fatalf("got %d registers", len(regs))
+	}
+	if regs[0] != sunSpecId0 || regs[1] != sunSpecId1 || regs[2] != commonModel || regs[3] != commonLen {
+		t.Errorf("header = %04X", regs[:4])
+	}
+	if regs[4] != 'e'<<8|'n' {
+		t.Errorf("manufacturer starts with %04X", regs[4])
+	}
+	meter := regs[4+commonLen:]
+	if meter[0] != WyeMeter || meter[1] != meterLen {
+		t.Errorf("meter model = %d, length %d", meter[0], meter[1])
+	}
+	points := meter[2:]
+	if w := int16(points[pointW]); w != -1500 {
+		t.Errorf("W = %d, want -1500", w)
+	}
+	if w := int16(points[pointW+1]); w != -500 {
+		t.Errorf("WphA = %d, want -500", w)
+	}
+	if v := int16(points[pointPhV+3]); v != 2300 {
+		t.Errorf("PhVphC = %d, want 2300 with a -1 scale factor", v)
+	}
+	if imp := uint32(points[pointTotWhImp])<<16 | uint32(points[pointTotWhImp+1]); imp != 123456 {
+		t.Errorf("TotWhImp = %d, want 123456", imp)
+	}
+	if points[pointVAhSF] != notImplementedInt16 {
+		t.Errorf("TotVAh_SF = %04X, want not implemented", points[pointVAhSF])
+	}
+	if end := meter[2+meterLen:]; end[0] != endModel || end[1] != 0 {
+		t.Errorf("end model = %04X", end)
+	}
+
+	single := registers(SinglePhaseMeter, identity, measures{power: 800, voltage: 230, frequency: 50})[4+commonLen+2:]
+	if wphB := single[pointW+2]; wphB != notImplementedInt16 {
+		t.Errorf("single phase WphB = %04X, want not implemented", wphB)
+	}
+}
+
+func TestReadHoldingRegisters(t *testing.T) {
+	s := &Service{settings: DefaultSettings(), measures: measures{power: 1000, voltage: 230, frequency: 50}}
+	read := func(register, count uint16) ([]byte, *mbserver.Exception) {
+		frame := &mbserver.TCPFrame{Function: 3, Data: make([]byte, 4)}
+		binary.BigEndian.PutUint16(frame.Data[0:2], register)
+		binary.BigEndian.PutUint16(frame.Data[2:4], count)
+		return s.readHoldingRegisters(nil, frame)
+	}
+
+	if _, exception := read(40000, 2); exception != &mbserver.SlaveDeviceFailure {
+		t.Errorf("without grid power: got %v, want SlaveDeviceFailure", exception)
+	}
+	s.updated = time.Now()
+	data, exception := read(40000, 2)
+	if exception != &mbserver.Success || len(data) != 5 || data[0] != 4 || binary.BigEndian.Uint16(data[1:]) != sunSpecId0 {
+		t.Errorf("SunS marker: got %v, %v", data, exception)
+	}
+	if _, exception = read(39999, 2); exception != &mbserver.IllegalDataAddress {
+		t.Errorf("before the map: got %v, want IllegalDataAddress", exception)
+	}
+	if _, exception = read(40177, 3); exception != &mbserver.IllegalDataAddress {
+		t.Errorf("after the map: got %v, want IllegalDataAddress", exception)
+	}
+}
@@ -0,0 +1,67 @@
+package homeassistant
+
+import (
+	"fmt"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// CommandHandler is called with every payload Home Assistant publishes on the
+// command topic of a writable entity, e.g. PayloadOn for a switch.
+type CommandHandler func(payload string)
+
+// Commands dispatches the commands of writable entities (switches, numbers,
+// selects and buttons) to their handlers.
+type Commands struct {
+	mu       sync.Mutex
+	handlers map[string]CommandHandler
+}
+
+func NewCommands() *Commands {
+	return &Commands{handlers: map[string]CommandHandler{}}
+}
+
+// Register subscribes to the command topic of item, calling handler with the
+// commands it receives. The item configuration still has to be published.
+func (c *Commands) Register(client mqtt.Client, item ConfigurationItem, handler CommandHandler) error {
+	if item.CommandTopic == "" {
+		return fmt.Errorf("%s has no command_topic", item.UniqueId)
+	}
+	c.mu.Lock()
+	c.handlers[item.CommandTopic] = handler
+	c.mu.Unlock()
+	token := client.Subscribe(item.CommandTopic, 0, c.dispatch)
+	token.Wait()
+	return token.Error()
+}
+
+// Resubscribe subscribes again to the command topics of every registered entity,
+// to be called after a reconnection to the broker without a persistent session.
+// A client restoring its subscriptions, as a mqttclient.Client, does not need it.
+func (c *Commands) Resubscribe(client mqtt.Client) error {
+	c.mu.Lock()
+	topics := make([]string, 0, len(c.handlers))
+	for topic := range c.handlers {
+		topics = append(topics, topic)
+	}
+	c.mu.Unlock()
+	// Subscribed one by one, a mqttclient.Client only keeping track of Subscribe
+	for _, topic := range topics {
+		token := client.Subscribe(topic, 0, c.dispatch)
+		token.Wait()
+		if err := token.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Commands) dispatch(client mqtt.Client, msg mqtt.Message) {
+	c.mu.Lock()
+	handler, ok := c.handlers[msg.Topic()]
+	c.mu.Unlock()
+	if ok {
+		handler(string(msg.Payload()))
+	}
+}
@@ -0,0 +1,121 @@
+package homeassistant
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mockClient records the subscriptions and the publications instead of sending
+// them to a broker, failing the first failures publications of every topic.
+// Every publication takes delay, and never completes when stuck.
+type mockClient struct {
+	mqtt.Client
+	handlers map[string]mqtt.MessageHandler
+	delay    time.Duration
+	stuck    bool
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	failures    int
+	attempts    map[string]int
+	published   map[string]string
+	retained    map[string]bool
+}
+
+func newMockClient() *mockClient {
+	return &mockClient{
+		handlers:  map[string]mqtt.MessageHandler{},
+		attempts:  map[string]int{},
+		published: map[string]string{},
+		retained:  map[string]bool{},
+	}
+}
+
+func (c *mockClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.mu.Unlock()
+	time.Sleep(c.delay)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	if c.stuck {
+		return &publishToken{stuck: true}
+	}
+	c.attempts[topic]++
+	if c.attempts[topic] <= c.failures {
+		return &publishToken{err: errors.New("not authorized")}
+	}
+	switch p := payload.(type) {
+	case string:
+		c.published[topic] = p
+	case []byte:
+		c.published[topic] = string(p)
+	}
+	c.retained[topic] = retained
+	return &publishToken{}
+}
+
+type publishToken struct {
+	mqtt.Token
+	err   error
+	stuck bool
+}
+
+func (t *publishToken) WaitTimeout(timeout time.Duration) bool {
+	if t.stuck {
+		time.Sleep(timeout)
+		return false
+	}
+	return true
+}
+
+func (t *publishToken) Error() error { return t.err }
+
+func (c *mockClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.handlers[topic] = callback
+	return &mqtt.DummyToken{}
+}
+
+type mockMessage struct {
+	mqtt.Message
+	topic   string
+	payload string
+}
+
+func (m mockMessage) Topic() string   { return m.topic }
+func (m mockMessage) Payload() []byte { return []byte(m.payload) }
+
+func TestCommands(t *testing.T) {
+	client := newMockClient()
+	commands := NewCommands()
+	device := Device{Identifiers: []string{"charger"}, Name: "charger"}
+
+	var state string
+	relay := NewSwitch("Relay", "charger_relay", "charger/relay", "charger/relay/set", device)
+	if err := commands.Register(client, relay, func(payload string) { state = payload }); err != nil {
+		t.Fatal(err)
+	}
+	if err := commands.Register(client, NewSensor("Power", "charger_power", "charger/power", device), nil); err == nil {
+		t.Error("registered an entity without command topic")
+	}
+
+	// A reconnection without persistent session loses the subscriptions
+	client.handlers = map[string]mqtt.MessageHandler{}
+	if err := commands.Resubscribe(client); err != nil {
+		t.Fatal(err)
+	}
+	client.handlers["charger/relay/set"](client, mockMessage{topic: "charger/relay/set", payload: PayloadOn})
+	if state != PayloadOn {
+		t.Errorf("handler got %q, want %q", state, PayloadOn)
+	}
+}
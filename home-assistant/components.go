@@ -0,0 +1,63 @@
+package homeassistant
+
+// Component is the kind of a Home Assistant entity.
+type Component string
+
+const (
+	Sensor       Component = "sensor"
+	BinarySensor Component = "binary_sensor"
+	Switch       Component = "switch"
+	Number       Component = "number"
+	Select       Component = "select"
+	Button       Component = "button"
+)
+
+// Default payloads of binary sensors and switches.
+const (
+	PayloadOn  = "ON"
+	PayloadOff = "OFF"
+)
+
+// NewSensor returns a sensor reporting the values published on stateTopic.
+func NewSensor(name, uniqueId, stateTopic string, device Device) ConfigurationItem {
+	return ConfigurationItem{Component: Sensor, Name: name, UniqueId: uniqueId, StateTopic: stateTopic, Device: device}
+}
+
+// NewBinarySensor returns a binary sensor whose state is PayloadOn or PayloadOff.
+func NewBinarySensor(name, uniqueId, stateTopic string, device Device) ConfigurationItem {
+	item := NewSensor(name, uniqueId, stateTopic, device)
+	item.Component = BinarySensor
+	item.PayloadOn, item.PayloadOff = PayloadOn, PayloadOff
+	return item
+}
+
+// NewSwitch returns a switch turned on and off with PayloadOn and PayloadOff.
+func NewSwitch(name, uniqueId, stateTopic, commandTopic string, device Device) ConfigurationItem {
+	item := NewBinarySensor(name, uniqueId, stateTopic, device)
+	item.Component = Switch
+	item.CommandTopic = commandTopic
+	return item
+}
+
+// NewNumber returns a number set between min and max, by step increments.
+func NewNumber(name, uniqueId, stateTopic, commandTopic string, min, max, step float64, device Device) ConfigurationItem {
+	item := NewSensor(name, uniqueId, stateTopic, device)
+	item.Component = Number
+	item.CommandTopic = commandTopic
+	item.Min, item.Max, item.Step = &min, &max, &step
+	return item
+}
+
+// NewSelect returns a select whose value is one of options.
+func NewSelect(name, uniqueId, stateTopic, commandTopic string, options []string, device Device) ConfigurationItem {
+	item := NewSensor(name, uniqueId, stateTopic, device)
+	item.Component = Select
+	item.CommandTopic = commandTopic
+	item.Options = options
+	return item
+}
+
+// NewButton returns a button publishing PayloadPress on commandTopic. It has no state.
+func NewButton(name, uniqueId, commandTopic string, device Device) ConfigurationItem {
+	return ConfigurationItem{Component: Button, Name: name, UniqueId: uniqueId, CommandTopic: commandTopic, PayloadPress: "PRESS", Device: device}
+}
@@ -0,0 +1,11 @@
+module energy-center/home-assistant
+
+go 1.17
+
+require github.com/eclipse/paho.mqtt.golang v1.4.2
+
+require (
+	github.com/gorilla/websocket v1.4.2 // indirect
+	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+)
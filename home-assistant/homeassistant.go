@@ -0,0 +1,415 @@
+// Package homeassistant publishes the MQTT discovery configuration of the
+// entities of the energy-center bridges to Home Assistant.
+//
+// https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+package homeassistant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Unit is the unit_of_measurement announced to Home Assistant.
+type Unit string
+
+const (
+	None  Unit = ""
+	Wh    Unit = "Wh"
+	KWh   Unit = "kWh"
+	W     Unit = "W"
+	KW    Unit = "kW"
+	VA    Unit = "VA"
+	KVA   Unit = "kVA"
+	VAh   Unit = "VAh"
+	VAr   Unit = "var"
+	KVAr  Unit = "kvar"
+	VArh  Unit = "varh"
+	KVArh Unit = "kvarh"
+	A     Unit = "A"
+	V     Unit = "V"
+	Hz    Unit = "Hz"
+	DBm   Unit = "dBm"
+	M3    Unit = "m³"
+
+	Celsius Unit = "°C"
+	Percent Unit = "%"
+)
+
+// deviceClassUnits are the units Home Assistant accepts for the device classes
+// used by the bridges. Other device classes are not checked.
+var deviceClassUnits = map[string][]Unit{
+	"energy":          {Wh, KWh},
+	"power":           {W, KW},
+	"apparent_power":  {VA, KVA},
+	"reactive_power":  {VAr, KVAr},
+	"current":         {A},
+	"voltage":         {V},
+	"frequency":       {Hz},
+	"temperature":     {Celsius},
+	"signal_strength": {DBm},
+	"battery":         {Percent},
+	"power_factor":    {None, Percent},
+	"gas":             {M3},
+}
+
+// CheckUnit returns an error when Home Assistant rejects unit for the device class.
+func CheckUnit(deviceClass string, unit Unit) error {
+	units, checked := deviceClassUnits[deviceClass]
+	if !checked {
+		return nil
+	}
+	for _, u := range units {
+		if u == unit {
+			return nil
+		}
+	}
+	return fmt.Errorf("unit '%s' is not supported by device class %s, expected one of %v", unit, deviceClass, units)
+}
+
+// Device groups entities under a single device in Home Assistant.
+type Device struct {
+	Identifiers   []string `json:"identifiers"`
+	Name          string   `json:"name"`
+	Manufacturer  string   `json:"manufacturer,omitempty"`
+	Model         string   `json:"model,omitempty"`
+	SuggestedArea string   `json:"suggested_area,omitempty"`
+	// SwVersion and HwVersion are the firmware and hardware revisions of the device.
+	SwVersion string `json:"sw_version,omitempty"`
+	HwVersion string `json:"hw_version,omitempty"`
+	// ViaDevice is the identifier of the device routing the messages of this one, e.g. a gateway.
+	ViaDevice string `json:"via_device,omitempty"`
+}
+
+// Origin identifies the application which published a discovery configuration.
+type Origin struct {
+	Name       string `json:"name"`
+	SwVersion  string `json:"sw_version,omitempty"`
+	SupportUrl string `json:"support_url,omitempty"`
+}
+
+// SupportUrl is the support_url of the energy-center tools.
+const SupportUrl = "https://github.com/octera/energy-center"
+
+// NewOrigin returns the origin of an energy-center tool.
+func NewOrigin(name, version string) *Origin {
+	return &Origin{Name: name, SwVersion: version, SupportUrl: SupportUrl}
+}
+
+// EntityCategory classifies the entities which are not the primary ones of a device.
+type EntityCategory string
+
+const (
+	// Diagnostic entities expose the state of the device, e.g. a link quality.
+	Diagnostic EntityCategory = "diagnostic"
+	// Config entities change the settings of the device.
+	Config EntityCategory = "config"
+)
+
+// Default payloads of the availability topics, as published by the bridges and their Last Will.
+const (
+	PayloadAvailable    = "online"
+	PayloadNotAvailable = "offline"
+)
+
+// Availability modes, when an entity depends on several availability topics.
+const (
+	AvailabilityAll    = "all"
+	AvailabilityAny    = "any"
+	AvailabilityLatest = "latest"
+)
+
+// Availability is a topic the availability of an entity depends on.
+type Availability struct {
+	Topic               string `json:"topic"`
+	PayloadAvailable    string `json:"payload_available,omitempty"`
+	PayloadNotAvailable string `json:"payload_not_available,omitempty"`
+}
+
+// LastWill returns the availability of an entity tied to the Last Will of a bridge.
+func LastWill(topic string) Availability {
+	return Availability{Topic: topic, PayloadAvailable: PayloadAvailable, PayloadNotAvailable: PayloadNotAvailable}
+}
+
+// ConfigurationItem is the discovery payload of a single entity, a sensor unless
+// Component says otherwise. See components.go for the builders of the other components.
+type ConfigurationItem struct {
+	// Component is the kind of entity, Sensor when empty. It is part of the discovery topic.
+	Component         Component `json:"-"`
+	Name              string    `json:"name"`
+	UniqueId          string    `json:"unique_id"`
+	StateTopic        string    `json:"state_topic,omitempty"`
+	ValueTemplate     string    `json:"value_template,omitempty"`
+	DeviceClass       string    `json:"device_class,omitempty"`
+	StateClass        string    `json:"state_class,omitempty"`
+	UnitOfMeasurement Unit      `json:"unit_of_measurement,omitempty"`
+	// JsonAttributesTopic is a topic holding a JSON object whose keys become attributes
+	// of the entity, JsonAttributesTemplate optionally extracts that object from the payload.
+	JsonAttributesTopic    string `json:"json_attributes_topic,omitempty"`
+	JsonAttributesTemplate string `json:"json_attributes_template,omitempty"`
+	// LastResetValueTemplate extracts the start of the cycle of a total sensor.
+	LastResetValueTemplate string `json:"last_reset_value_template,omitempty"`
+	// AvailabilityTopic is the single availability topic of the entity,
+	// Availability lists several of them.
+	AvailabilityTopic string         `json:"availability_topic,omitempty"`
+	Availability      []Availability `json:"availability,omitempty"`
+	// PayloadAvailable and PayloadNotAvailable apply to AvailabilityTopic.
+	PayloadAvailable    string `json:"payload_available,omitempty"`
+	PayloadNotAvailable string `json:"payload_not_available,omitempty"`
+	// AvailabilityMode is one of AvailabilityAll, AvailabilityAny or AvailabilityLatest.
+	AvailabilityMode string         `json:"availability_mode,omitempty"`
+	EntityCategory   EntityCategory `json:"entity_category,omitempty"`
+	// Icon overrides the icon of the device class, e.g. "mdi:flash".
+	Icon string `json:"icon,omitempty"`
+	// ExpireAfter is the delay in seconds after which the state expires when it is not updated.
+	ExpireAfter int `json:"expire_after,omitempty"`
+	// SuggestedDisplayPrecision is the number of decimals displayed, see Precision.
+	SuggestedDisplayPrecision *int `json:"suggested_display_precision,omitempty"`
+
+	// CommandTopic is where Home Assistant publishes the commands of a writable entity.
+	CommandTopic string `json:"command_topic,omitempty"`
+	// PayloadOn and PayloadOff are the states of binary sensors and switches.
+	PayloadOn  string `json:"payload_on,omitempty"`
+	PayloadOff string `json:"payload_off,omitempty"`
+	// Min, Max and Step bound the value of a number.
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+	Step *float64 `json:"step,omitempty"`
+	// Options are the choices of a select.
+	Options []string `json:"options,omitempty"`
+	// PayloadPress is the command sent by a button.
+	PayloadPress string `json:"payload_press,omitempty"`
+
+	Device Device `json:"device"`
+	// Origin is set from the Options when publishing, unless already set.
+	Origin *Origin `json:"origin,omitempty"`
+}
+
+// Precision returns a SuggestedDisplayPrecision.
+func Precision(decimals int) *int {
+	return &decimals
+}
+
+// DefaultDiscoveryPrefix is the root of the discovery topics, unless changed in
+// the MQTT integration of Home Assistant.
+const DefaultDiscoveryPrefix = "homeassistant"
+
+// Options holds the settings of the publication of the discovery configuration.
+type Options struct {
+	// Prefix is the root of the discovery topics, DefaultDiscoveryPrefix when empty.
+	Prefix string
+	// Origin is added to the configuration of every item.
+	Origin *Origin
+	// Concurrency bounds the configurations being published at once, DefaultConcurrency when zero.
+	Concurrency int
+	// Retries is the number of additional attempts to publish a configuration after a failure.
+	Retries int
+	// Timeout bounds the publication of all the configurations, DefaultTimeout when zero.
+	Timeout time.Duration
+}
+
+const (
+	DefaultConcurrency = 8
+	DefaultTimeout     = 30 * time.Second
+)
+
+// ErrTimeout is the error of the configurations which could not be published within the Timeout.
+var ErrTimeout = errors.New("discovery publication timed out")
+
+func (o Options) prefix() string {
+	if o.Prefix == "" {
+		return DefaultDiscoveryPrefix
+	}
+	return o.Prefix
+}
+
+func (o Options) concurrency() int {
+	if o.Concurrency <= 0 {
+		return DefaultConcurrency
+	}
+	return o.Concurrency
+}
+
+func (o Options) timeout() time.Duration {
+	if o.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return o.Timeout
+}
+
+// publish publishes a retained payload, retrying after a failure until the deadline.
+func (o Options) publish(client mqtt.Client, topic string, payload interface{}, deadline time.Time) error {
+	var err error
+	for attempt := 0; attempt <= o.Retries; attempt++ {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return ErrTimeout
+		}
+		token := client.Publish(topic, 0, true, payload)
+		if !token.WaitTimeout(remaining) {
+			return ErrTimeout
+		}
+		if err = token.Error(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// StatusTopic is the topic Home Assistant announces its status on.
+func (o Options) StatusTopic() string {
+	return o.prefix() + "/status"
+}
+
+// PayloadOnline is the status Home Assistant announces on StatusTopic once started.
+const PayloadOnline = "online"
+
+// OnHaOnline subscribes to the status of Home Assistant and calls republish every
+// time it comes online, as it may have lost the discovery configurations while
+// restarting. It must be called again after a reconnection without a persistent session.
+func OnHaOnline(client mqtt.Client, opts Options, republish func()) mqtt.Token {
+	return client.Subscribe(opts.StatusTopic(), 0, func(client mqtt.Client, msg mqtt.Message) {
+		if string(msg.Payload()) == PayloadOnline {
+			republish()
+		}
+	})
+}
+
+// discoveryTopic returns the topic the configuration of the item is published to.
+func (o Options) discoveryTopic(item ConfigurationItem) string {
+	component := item.Component
+	if component == "" {
+		component = Sensor
+	}
+	return o.prefix() + "/" + string(component) + "/" + item.UniqueId + "/config"
+}
+
+// SendConfigurationToHa publishes the discovery configuration of every item
+// as a retained message, with up to opts.Concurrency publications in flight so
+// that a slow broker does not block on every item. Invalid items are skipped.
+// It returns the result of every item and the aggregated Errors of those which
+// were not published.
+func SendConfigurationToHa(client mqtt.Client, opts Options, items []ConfigurationItem) ([]Result, error) {
+	results := make([]Result, len(items))
+	deadline := time.Now().Add(opts.timeout())
+	inFlight := make(chan struct{}, opts.concurrency())
+	var wg sync.WaitGroup
+	for i, item := range items {
+		results[i] = Result{UniqueId: item.UniqueId, Err: item.Validate()}
+		if results[i].Err != nil {
+			continue
+		}
+		if item.Origin == nil {
+			item.Origin = opts.Origin
+		}
+		payload, err := json.Marshal(item)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		inFlight <- struct{}{}
+		wg.Add(1)
+		go func(result *Result, topic string) {
+			defer wg.Done()
+			result.Err = opts.publish(client, topic, payload, deadline)
+			<-inFlight
+		}(&results[i], opts.discoveryTopic(item))
+	}
+	wg.Wait()
+	return results, errorsOf(results)
+}
+
+// DefaultOrigin is the origin of device-based payloads published without one, which
+// Home Assistant requires.
+var DefaultOrigin = Origin{Name: "energy-center", SupportUrl: SupportUrl}
+
+// deviceConfiguration is the payload of the device-based discovery, holding the
+// device and all its entities at once.
+type deviceConfiguration struct {
+	Device     Device                            `json:"device"`
+	Origin     *Origin                           `json:"origin"`
+	Components map[string]map[string]interface{} `json:"components"`
+}
+
+// SendDeviceConfigurationToHa publishes the configuration of items, which belong to
+// the device of the first one, as a single retained device-based discovery payload.
+// The payload replaces the previous one, so items must list every entity of the
+// device. It requires Home Assistant 2024.11 or later. Invalid items are left out
+// of the payload and reported in the returned Errors.
+func SendDeviceConfigurationToHa(client mqtt.Client, opts Options, objectId string, items []ConfigurationItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	config := deviceConfiguration{
+		Device:     items[0].Device,
+		Origin:     opts.Origin,
+		Components: map[string]map[string]interface{}{},
+	}
+	if config.Origin == nil {
+		config.Origin = &DefaultOrigin
+	}
+	results := make([]Result, len(items))
+	for i, item := range items {
+		results[i] = Result{UniqueId: item.UniqueId, Err: item.Validate()}
+		if results[i].Err != nil {
+			continue
+		}
+		component, err := componentConfiguration(item)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		config.Components[item.UniqueId] = component
+	}
+	if len(config.Components) > 0 {
+		payload, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		topic := opts.prefix() + "/device/" + objectId + "/config"
+		if err := opts.publish(client, topic, payload, time.Now().Add(opts.timeout())); err != nil {
+			return err
+		}
+	}
+	return errorsOf(results)
+}
+
+// componentConfiguration returns the configuration of an item within a device-based
+// payload: without the shared device and origin, with its platform.
+func componentConfiguration(item ConfigurationItem) (map[string]interface{}, error) {
+	item.Origin = nil
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var component map[string]interface{}
+	if err := json.Unmarshal(payload, &component); err != nil {
+		return nil, err
+	}
+	delete(component, "device")
+	platform := item.Component
+	if platform == "" {
+		platform = Sensor
+	}
+	component["platform"] = platform
+	return component, nil
+}
+
+// RemoveConfigurationFromHa deletes the entities of the items from Home Assistant
+// by replacing their retained discovery configuration with an empty payload, e.g.
+// after renaming them or when a device is gone.
+func RemoveConfigurationFromHa(client mqtt.Client, opts Options, items []ConfigurationItem) {
+	deadline := time.Now().Add(opts.timeout())
+	for _, item := range items {
+		opts.publish(client, opts.discoveryTopic(item), "", deadline)
+	}
+}
+
+// RemoveDeviceConfigurationFromHa deletes a device announced with SendDeviceConfigurationToHa.
+func RemoveDeviceConfigurationFromHa(client mqtt.Client, opts Options, objectId string) {
+	opts.publish(client, opts.prefix()+"/device/"+objectId+"/config", "", time.Now().Add(opts.timeout()))
+}
@@ -0,0 +1,198 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSendConfigurationToHa(t *testing.T) {
+	device := Device{Identifiers: []string{"meter"}, Name: "meter"}
+	items := []ConfigurationItem{
+		NewSensor("Power", "meter_power", "meter/power", device),
+		NewSensor("Energy", "meter_energy", "meter/energy", device),
+		NewSensor("Broken", "", "meter/broken", device),
+	}
+	for _, test := range []struct {
+		retries   int
+		published int
+	}{
+		{0, 0},
+		{1, 2},
+	} {
+		client := newMockClient()
+		client.failures = 1
+		opts := Options{Prefix: "ha", Retries: test.retries, Concurrency: 2}
+		results, err := SendConfigurationToHa(client, opts, items)
+		if len(client.published) != test.published {
+			t.Errorf("%d retries: published %v, want %d items", test.retries, client.published, test.published)
+		}
+		var errs Errors
+		if !errors.As(err, &errs) || len(errs) != len(items)-test.published {
+			t.Errorf("%d retries: error %v, want %d failed items", test.retries, err, len(items)-test.published)
+		}
+		if len(results) != len(items) || results[2].Err == nil {
+			t.Errorf("%d retries: results %v, want the invalid item to fail", test.retries, results)
+		}
+		if _, ok := client.published["ha/sensor/meter_power/config"]; test.published > 0 && !ok {
+			t.Errorf("%d retries: published %v, want ha/sensor/meter_power/config", test.retries, client.published)
+		}
+	}
+}
+
+func TestSendDeviceConfigurationToHa(t *testing.T) {
+	device := Device{Identifiers: []string{"charger"}, Name: "charger"}
+	power := NewSensor("Power", "charger_power", "charger/power", device)
+	relay := NewSwitch("Relay", "charger_relay", "charger/relay", "charger/relay/set", device)
+	broken := NewSensor("Broken", "", "charger/broken", device)
+	origin := NewOrigin("charger2mqtt", "1.0")
+	for _, test := range []struct {
+		name       string
+		opts       Options
+		items      []ConfigurationItem
+		topic      string
+		origin     string
+		components map[string]Component
+		failed     int
+	}{
+		{"default origin", Options{}, []ConfigurationItem{power, relay}, "homeassistant/device/charger/config",
+			DefaultOrigin.Name, map[string]Component{"charger_power": Sensor, "charger_relay": Switch}, 0},
+		{"origin and prefix", Options{Prefix: "ha", Origin: origin}, []ConfigurationItem{relay}, "ha/device/charger/config",
+			origin.Name, map[string]Component{"charger_relay": Switch}, 0},
+		{"invalid item", Options{}, []ConfigurationItem{power, broken}, "homeassistant/device/charger/config",
+			DefaultOrigin.Name, map[string]Component{"charger_power": Sensor}, 1},
+		{"no item", Options{}, nil, "", "", nil, 0},
+	} {
+		client := newMockClient()
+		err := SendDeviceConfigurationToHa(client, test.opts, "charger", test.items)
+		var errs Errors
+		if test.failed == 0 && err != nil || test.failed > 0 && (!errors.As(err, &errs) || len(errs) != test.failed) {
+			t.Errorf("%s: error %v, want %d failed items", test.name, err, test.failed)
+		}
+		if test.topic == "" {
+			if len(client.published) != 0 {
+				t.Errorf("%s: published %v, want nothing", test.name, client.published)
+			}
+			continue
+		}
+		payload, ok := client.published[test.topic]
+		if !ok || len(client.published) != 1 {
+			t.Errorf("%s: published %v, want %s only", test.name, client.published, test.topic)
+			continue
+		}
+		var config deviceConfiguration
+		if err := json.Unmarshal([]byte(payload), &config); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if !reflect.DeepEqual(config.Device, device) || config.Origin == nil || config.Origin.Name != test.origin {
+			t.Errorf("%s: device %v and origin %v, want %v and %s", test.name, config.Device, config.Origin, device, test.origin)
+		}
+		if len(config.Components) != len(test.components) {
+			t.Errorf("%s: components %v, want %v", test.name, config.Components, test.components)
+		}
+		for id, platform := range test.components {
+			component, ok := config.Components[id]
+			if !ok || component["platform"] != string(platform) {
+				t.Errorf("%s: component %s = %v, want the %s platform", test.name, id, component, platform)
+			}
+			// The device and origin are shared by the components
+			if _, ok := component["device"]; ok {
+				t.Errorf("%s: component %s has its own device", test.name, id)
+			}
+			if _, ok := component["origin"]; ok {
+				t.Errorf("%s: component %s has its own origin", test.name, id)
+			}
+		}
+	}
+}
+
+func TestRemoveConfigurationFromHa(t *testing.T) {
+	device := Device{Identifiers: []string{"meter"}, Name: "meter"}
+	items := []ConfigurationItem{
+		NewSensor("Power", "meter_power", "meter/power", device),
+		NewSwitch("Relay", "meter_relay", "meter/relay", "meter/relay/set", device),
+	}
+	opts := Options{Prefix: "ha"}
+	client := newMockClient()
+	RemoveConfigurationFromHa(client, opts, items)
+	RemoveDeviceConfigurationFromHa(client, opts, "meter")
+
+	// An empty retained payload deletes the entity or the device
+	for _, topic := range []string{"ha/sensor/meter_power/config", "ha/switch/meter_relay/config", "ha/device/meter/config"} {
+		if payload, ok := client.published[topic]; !ok || payload != "" || !client.retained[topic] {
+			t.Errorf("%s: published %q (retained %v), want an empty retained payload", topic, payload, client.retained[topic])
+		}
+	}
+	if len(client.published) != 3 {
+		t.Errorf("published %v, want the 3 configuration topics only", client.published)
+	}
+}
+
+func TestOnHaOnline(t *testing.T) {
+	device := Device{Identifiers: []string{"meter"}, Name: "meter"}
+	items := []ConfigurationItem{NewSensor("Power", "meter_power", "meter/power", device)}
+	opts := Options{Prefix: "ha"}
+	client := newMockClient()
+	OnHaOnline(client, opts, func() {
+		if _, err := SendConfigurationToHa(client, opts, items); err != nil {
+			t.Error(err)
+		}
+	})
+	status, ok := client.handlers["ha/status"]
+	if !ok {
+		t.Fatalf("subscribed to %v, want ha/status", client.handlers)
+	}
+
+	for _, test := range []struct {
+		payload string
+		resent  bool
+	}{
+		{"offline", false},
+		{PayloadOnline, true},
+	} {
+		client.published = map[string]string{}
+		status(client, mockMessage{topic: "ha/status", payload: test.payload})
+		if _, ok := client.published["ha/sensor/meter_power/config"]; ok != test.resent {
+			t.Errorf("status %s: published %v, want the configuration re-sent %v", test.payload, client.published, test.resent)
+		}
+	}
+}
+
+func TestSendConfigurationToHaConcurrency(t *testing.T) {
+	device := Device{Identifiers: []string{"meter"}, Name: "meter"}
+	var items []ConfigurationItem
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("meter_%d", i)
+		items = append(items, NewSensor(id, id, "meter/"+id, device))
+	}
+	for _, concurrency := range []int{1, 3} {
+		client := newMockClient()
+		client.delay = 10 * time.Millisecond
+		if _, err := SendConfigurationToHa(client, Options{Concurrency: concurrency}, items); err != nil {
+			t.Fatal(err)
+		}
+		if client.maxInFlight > concurrency || len(client.published) != len(items) {
+			t.Errorf("concurrency %d: %d publications in flight, %d published, want at most %d and %d",
+				concurrency, client.maxInFlight, len(client.published), concurrency, len(items))
+		}
+	}
+}
+
+func TestSendConfigurationToHaTimeout(t *testing.T) {
+	device := Device{Identifiers: []string{"meter"}, Name: "meter"}
+	items := []ConfigurationItem{NewSensor("Power", "meter_power", "meter/power", device)}
+	client := newMockClient()
+	client.stuck = true
+
+	start := time.Now()
+	results, err := SendConfigurationToHa(client, Options{Timeout: 50 * time.Millisecond, Retries: 3}, items)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %s, want the timeout of 50ms", elapsed)
+	}
+	if err == nil || !errors.Is(results[0].Err, ErrTimeout) {
+		t.Errorf("error %v, results %v, want %s", err, results, ErrTimeout)
+	}
+}
@@ -0,0 +1,67 @@
+package homeassistant
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Result is the outcome of the publication of the configuration of an item.
+type Result struct {
+	UniqueId string
+	// Err is nil when the configuration was published.
+	Err error
+}
+
+// Errors aggregates the errors of the items which could not be published.
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// errorsOf returns the aggregated errors of the results, nil when every item was published.
+func errorsOf(results []Result) error {
+	var errs Errors
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.UniqueId, r.Err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Validate returns an error when Home Assistant would reject the configuration of the item.
+func (item ConfigurationItem) Validate() error {
+	if item.UniqueId == "" {
+		return fmt.Errorf("configuration of '%s' has no unique_id", item.Name)
+	}
+	switch item.Component {
+	case "", Sensor, BinarySensor:
+		if item.StateTopic == "" {
+			return fmt.Errorf("%s has no state_topic", item.UniqueId)
+		}
+	case Switch, Number, Select, Button:
+		if item.CommandTopic == "" {
+			return fmt.Errorf("%s has no command_topic", item.UniqueId)
+		}
+	default:
+		return fmt.Errorf("%s has unknown component %s", item.UniqueId, item.Component)
+	}
+	if item.Component == Select && len(item.Options) == 0 {
+		return fmt.Errorf("select %s has no options", item.UniqueId)
+	}
+	if item.Min != nil && item.Max != nil && *item.Min > *item.Max {
+		return fmt.Errorf("number %s has min %g greater than max %g", item.UniqueId, *item.Min, *item.Max)
+	}
+	if err := CheckUnit(item.DeviceClass, item.UnitOfMeasurement); err != nil {
+		return fmt.Errorf("%s: %w", item.UniqueId, err)
+	}
+	return nil
+}
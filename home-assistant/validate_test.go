@@ -0,0 +1,62 @@
+package homeassistant
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	device := Device{Identifiers: []string{"meter"}, Name: "meter"}
+	power := NewSensor("Power", "meter_power", "meter/power", device)
+	power.DeviceClass = "power"
+	power.UnitOfMeasurement = W
+
+	wrongUnit := power
+	wrongUnit.UnitOfMeasurement = Wh
+	noUniqueId := power
+	noUniqueId.UniqueId = ""
+	noStateTopic := power
+	noStateTopic.StateTopic = ""
+
+	for name, test := range map[string]struct {
+		item  ConfigurationItem
+		valid bool
+	}{
+		"sensor":          {power, true},
+		"wrong unit":      {wrongUnit, false},
+		"no unique_id":    {noUniqueId, false},
+		"no state_topic":  {noStateTopic, false},
+		"button":          {NewButton("Reset", "meter_reset", "meter/reset", device), true},
+		"number":          {NewNumber("Limit", "meter_limit", "meter/limit", "meter/limit/set", 0, 10, 1, device), true},
+		"number min, max": {NewNumber("Limit", "meter_limit", "meter/limit", "meter/limit/set", 10, 0, 1, device), false},
+		"select":          {NewSelect("Mode", "meter_mode", "meter/mode", "meter/mode/set", nil, device), false},
+	} {
+		if err := test.item.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", name, err, test.valid)
+		}
+	}
+}
+
+func TestCheckUnit(t *testing.T) {
+	if err := CheckUnit("energy", KWh); err != nil {
+		t.Errorf("CheckUnit(energy, kWh) = %v", err)
+	}
+	if err := CheckUnit("energy", KW); err == nil {
+		t.Error("CheckUnit(energy, kW) accepted")
+	}
+	if err := CheckUnit("monetary", "EUR"); err != nil {
+		t.Errorf("CheckUnit(monetary, EUR) = %v, unchecked classes must be accepted", err)
+	}
+}
+
+func TestErrorsOf(t *testing.T) {
+	cause := errors.New("broker unreachable")
+	err := errorsOf([]Result{{UniqueId: "a"}, {UniqueId: "b", Err: cause}})
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.Is(errs[0], cause) {
+		t.Errorf("errorsOf() = %v, want the error of b", err)
+	}
+	if err := errorsOf([]Result{{UniqueId: "a"}}); err != nil {
+		t.Errorf("errorsOf() = %v, want nil", err)
+	}
+}
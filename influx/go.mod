@@ -0,0 +1,3 @@
+module energy-center/influx
+
+go 1.17
@@ -0,0 +1,152 @@
+// Package influx writes InfluxDB line protocol to the InfluxDB 1 or 2 write API,
+// for the programs having an InfluxDB output.
+package influx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultBatchSize = 100
+const DefaultFlushInterval = 10 * time.Second
+
+// MaxBuffered bounds the lines a Writer keeps in memory while InfluxDB is unreachable.
+const MaxBuffered = 10000
+
+// Config configures an InfluxDB output. Bucket and Org select the InfluxDB 2
+// write API, Database the InfluxDB 1 one.
+type Config struct {
+	Url      string `yaml:"url"`
+	Token    string `yaml:"token"`
+	Org      string `yaml:"org"`
+	Bucket   string `yaml:"bucket"`
+	Database string `yaml:"database"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Enabled reports whether the output is configured.
+func (c Config) Enabled() bool {
+	return c.Url != ""
+}
+
+func (c Config) Validate() error {
+	if c.Enabled() && c.Bucket == "" && c.Database == "" {
+		return fmt.Errorf("influx output needs a bucket or a database")
+	}
+	return nil
+}
+
+func (c Config) writeUrl() string {
+	base := strings.TrimSuffix(c.Url, "/")
+	if c.Bucket != "" {
+		return base + "/api/v2/write?" + url.Values{"org": {c.Org}, "bucket": {c.Bucket}}.Encode()
+	}
+	return base + "/write?" + url.Values{"db": {c.Database}}.Encode()
+}
+
+// Client posts lines to InfluxDB.
+type Client struct {
+	config Config
+	client *http.Client
+}
+
+// NewClient creates a client whose requests are bounded by timeout.
+func NewClient(config Config, timeout time.Duration) *Client {
+	return &Client{config: config, client: &http.Client{Timeout: timeout}}
+}
+
+// Post writes lines of line protocol in one request.
+func (c *Client) Post(lines []string) error {
+	body := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequest(http.MethodPost, c.config.writeUrl(), bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if c.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+c.config.Token)
+	} else if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Writer writes lines to InfluxDB by batches, in the background. The lines of a
+// failed batch are kept for the next one, up to MaxBuffered.
+type Writer struct {
+	client    *Client
+	batchSize int
+	logf      func(format string, args ...interface{})
+
+	mu    sync.Mutex
+	lines []string
+}
+
+// NewWriter creates a writer posting every batchSize lines and every
+// flushInterval, the defaults applying when zero. Its errors are logged with logf.
+func NewWriter(config Config, batchSize int, flushInterval time.Duration, logf func(format string, args ...interface{})) *Writer {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+	w := &Writer{client: NewClient(config, 10*time.Second), batchSize: batchSize, logf: logf}
+	go func() {
+		for range time.Tick(flushInterval) {
+			w.Flush()
+		}
+	}()
+	return w
+}
+
+// Write queues a line protocol line, flushing when a batch is complete.
+func (w *Writer) Write(line string) {
+	w.mu.Lock()
+	if len(w.lines) >= MaxBuffered {
+		w.lines = w.lines[1:]
+	}
+	w.lines = append(w.lines, line)
+	full := len(w.lines) >= w.batchSize
+	w.mu.Unlock()
+	if full {
+		go w.Flush()
+	}
+}
+
+// Flush posts the queued lines.
+func (w *Writer) Flush() {
+	w.mu.Lock()
+	lines := w.lines
+	w.lines = nil
+	w.mu.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+	if err := w.client.Post(lines); err != nil {
+		w.logf("error writing to InfluxDB: %s", err)
+		// Keep the lines for the next flush
+		w.mu.Lock()
+		w.lines = append(lines, w.lines...)
+		if len(w.lines) > MaxBuffered {
+			w.lines = w.lines[len(w.lines)-MaxBuffered:]
+		}
+		w.mu.Unlock()
+	}
+}
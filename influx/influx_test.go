@@ -0,0 +1,93 @@
+package influx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	for _, test := range []struct {
+		config Config
+		url    string
+	}{
+		{Config{Url: "http://influxdb:8086/", Org: "home", Bucket: "energy"}, "http://influxdb:8086/api/v2/write?bucket=energy&org=home"},
+		{Config{Url: "http://influxdb:8086", Database: "energy"}, "http://influxdb:8086/write?db=energy"},
+	} {
+		if err := test.config.Validate(); err != nil {
+			t.Errorf("%+v: %s", test.config, err)
+		}
+		if got := test.config.writeUrl(); got != test.url {
+			t.Errorf("writeUrl() = %s, want %s", got, test.url)
+		}
+	}
+	if err := (Config{Url: "http://influxdb:8086"}).Validate(); err == nil {
+		t.Error("no error without bucket nor database")
+	}
+	if (Config{}).Enabled() {
+		t.Error("enabled without url")
+	}
+}
+
+// server records the bodies posted to it, answering status.
+type server struct {
+	mu     sync.Mutex
+	status int
+	auth   string
+	bodies []string
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = r.Header.Get("Authorization")
+	if s.status != http.StatusNoContent {
+		http.Error(w, "unavailable", s.status)
+		return
+	}
+	s.bodies = append(s.bodies, string(body))
+	w.WriteHeader(s.status)
+}
+
+func TestClient(t *testing.T) {
+	s := &server{status: http.StatusNoContent}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	client := NewClient(Config{Url: ts.URL, Bucket: "energy", Token: "secret"}, time.Second)
+	if err := client.Post([]string{"energy import=1", "energy import=2"}); err != nil {
+		t.Fatal(err)
+	}
+	if s.bodies[0] != "energy import=1\nenergy import=2\n" || s.auth != "Token secret" {
+		t.Errorf("posted %q with %q", s.bodies[0], s.auth)
+	}
+	s.status = http.StatusServiceUnavailable
+	if err := client.Post([]string{"energy import=3"}); err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Errorf("error = %v, want the answer of InfluxDB", err)
+	}
+}
+
+func TestWriterRetry(t *testing.T) {
+	s := &server{status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	var errors int
+	w := NewWriter(Config{Url: ts.URL, Database: "energy"}, 10, time.Hour, func(format string, args ...interface{}) {
+		errors++
+	})
+	w.Write("power value=1")
+	w.Flush()
+	if errors != 1 || len(s.bodies) != 0 {
+		t.Fatalf("%d errors, %d bodies after a failure", errors, len(s.bodies))
+	}
+	s.status = http.StatusNoContent
+	w.Write("power value=2")
+	w.Flush()
+	if len(s.bodies) != 1 || s.bodies[0] != "power value=1\npower value=2\n" {
+		t.Errorf("posted %q, want the failed line kept", s.bodies)
+	}
+}
@@ -0,0 +1,195 @@
+// Package integration runs the energy-center services together on an embedded
+// MQTT broker, fed by replayed Teleinfo frames, to check the topic contracts
+// between the modules. See pipeline_test.go.
+package integration
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// Broker is a minimal MQTT 3.1.1 broker for the tests: clean sessions, retained
+// messages and wildcards, every message being delivered at QoS 0.
+type Broker struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	sessions map[*session]bool
+	retained map[string]*packets.PublishPacket
+}
+
+type session struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	filters map[string]bool
+}
+
+// NewBroker listens on address, e.g. 127.0.0.1:0.
+func NewBroker(address string) (*Broker, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	b := &Broker{listener: listener, sessions: map[*session]bool{}, retained: map[string]*packets.PublishPacket{}}
+	go b.accept()
+	return b, nil
+}
+
+// Url is the url of the broker for the clients.
+func (b *Broker) Url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+// Close stops the broker and disconnects the clients.
+func (b *Broker) Close() {
+	b.listener.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+}
+
+func (b *Broker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.serve(&session{conn: conn, filters: map[string]bool{}})
+	}
+}
+
+// serve handles the packets of a client until it disconnects.
+func (b *Broker) serve(s *session) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, s)
+		b.mu.Unlock()
+		s.conn.Close()
+	}()
+	for {
+		packet, err := packets.ReadPacket(s.conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			b.mu.Lock()
+			b.sessions[s] = true
+			b.mu.Unlock()
+			s.write(packets.NewControlPacket(packets.Connack))
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			s.mu.Lock()
+			for _, filter := range p.Topics {
+				s.filters[filter] = true
+				ack.ReturnCodes = append(ack.ReturnCodes, 0)
+			}
+			s.mu.Unlock()
+			s.write(ack)
+			b.sendRetained(s, p.Topics)
+		case *packets.UnsubscribePacket:
+			s.mu.Lock()
+			for _, filter := range p.Topics {
+				delete(s.filters, filter)
+			}
+			s.mu.Unlock()
+			ack := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			ack.MessageID = p.MessageID
+			s.write(ack)
+		case *packets.PublishPacket:
+			if p.Qos > 0 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				s.write(ack)
+			}
+			b.publish(p)
+		case *packets.PingreqPacket:
+			s.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+// publish delivers a message to the matching subscriptions, and keeps it when retained.
+func (b *Broker) publish(p *packets.PublishPacket) {
+	b.mu.Lock()
+	if p.Retain {
+		if len(p.Payload) == 0 {
+			delete(b.retained, p.TopicName)
+		} else {
+			b.retained[p.TopicName] = p
+		}
+	}
+	var targets []*session
+	for s := range b.sessions {
+		if s.subscribed(p.TopicName) {
+			targets = append(targets, s)
+		}
+	}
+	b.mu.Unlock()
+	for _, s := range targets {
+		s.write(message(p.TopicName, p.Payload, false))
+	}
+}
+
+func (b *Broker) sendRetained(s *session, filters []string) {
+	b.mu.Lock()
+	var messages []*packets.PublishPacket
+	for topic, p := range b.retained {
+		for _, filter := range filters {
+			if match(filter, topic) {
+				messages = append(messages, p)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	for _, p := range messages {
+		s.write(message(p.TopicName, p.Payload, true))
+	}
+}
+
+func message(topic string, payload []byte, retained bool) *packets.PublishPacket {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName, p.Payload, p.Retain = topic, payload, retained
+	return p
+}
+
+func (s *session) subscribed(topic string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for filter := range s.filters {
+		if match(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// write sends a packet, a failure being detected by the read loop.
+func (s *session) write(p packets.ControlPacket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.Write(s.conn)
+}
+
+// match reports whether a topic matches a subscription filter with + and # wildcards.
+func match(filter, topic string) bool {
+	filterLevels, topicLevels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
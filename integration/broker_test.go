@@ -0,0 +1,24 @@
+package integration
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"powerinfo/grid", "powerinfo/grid", true},
+		{"powerinfo/grid", "powerinfo/gridx", false},
+		{"powerinfo/#", "powerinfo/grid", true},
+		{"#", "teleinfo/EAST", true},
+		{"powertag/+/energy", "powertag/kitchen/energy", true},
+		{"powertag/+/energy", "powertag/kitchen/power", false},
+		{"powertag/+", "powertag/kitchen/energy", false},
+		{"powertag/kitchen/energy", "powertag/kitchen", false},
+	}
+	for _, test := range tests {
+		if got := match(test.filter, test.topic); got != test.want {
+			t.Errorf("match(%s, %s) = %v, want %v", test.filter, test.topic, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+module integration
+
+go 1.17
+
+require (
+	batterycoordinator v0.0.0
+	energy-center/mqttclient v0.0.0
+	energyaccounting v0.0.0
+	github.com/eclipse/paho.mqtt.golang v1.4.2
+	mqttmapper v0.0.0
+	teleinfo2mqtt v0.0.0
+)
+
+require (
+	energy-center/alerting v0.0.0 // indirect
+	energy-center/curtailment v0.0.0 // indirect
+	energy-center/home-assistant v0.0.0 // indirect
+	energy-center/influx v0.0.0 // indirect
+	energy-center/tariff v0.0.0 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
+	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07 // indirect
+	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace (
+	batterycoordinator => ../battery
+	energy-center/alerting => ../alerting
+	energy-center/curtailment => ../curtailment
+	energy-center/home-assistant => ../home-assistant
+	energy-center/influx => ../influx
+	energy-center/mqttclient => ../mqttclient
+	energy-center/tariff => ../tariff
+	energyaccounting => ../accounting
+	mqttmapper => ../mqttmapper
+	teleinfo2mqtt => ../teleinfo
+)
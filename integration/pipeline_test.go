@@ -0,0 +1,237 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"batterycoordinator"
+	"energy-center/mqttclient"
+	"energyaccounting"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"mqttmapper"
+	"teleinfo2mqtt"
+)
+
+// service is a service of the energy-center daemon.
+type service interface {
+	OnConnect()
+	Run(signals <-chan os.Signal) int
+}
+
+// pipeline runs services on one shared connection to the broker, as the
+// energy-center daemon does: they are created before connecting and notified of
+// every (re)connection.
+type pipeline struct {
+	t        *testing.T
+	broker   *Broker
+	client   mqtt.Client
+	services []service
+	stops    []chan os.Signal
+	done     sync.WaitGroup
+}
+
+// connect connects a client standing for another program, e.g. a battery bridge.
+func (p *pipeline) connect(name string) mqtt.Client {
+	client, err := mqttclient.New(mqttclient.Config{Url: p.broker.Url(), ClientId: name}, mqttclient.Options{})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		p.t.Fatal(token.Error())
+	}
+	return client
+}
+
+// add creates a service on the shared connection.
+func (p *pipeline) add(name string, create func(client mqtt.Client) (service, error)) {
+	if p.client == nil {
+		client, err := mqttclient.New(mqttclient.Config{Url: p.broker.Url(), ClientId: "energy-center"}, mqttclient.Options{
+			OnConnect: func(client mqtt.Client) {
+				for _, s := range p.services {
+					s.OnConnect()
+				}
+			},
+		})
+		if err != nil {
+			p.t.Fatal(err)
+		}
+		p.client = client
+	}
+	s, err := create(p.client)
+	if err != nil {
+		p.t.Fatalf("%s: %s", name, err)
+	}
+	p.services = append(p.services, s)
+}
+
+// start connects the shared connection and runs the services.
+func (p *pipeline) start() {
+	if token := p.client.Connect(); token.Wait() && token.Error() != nil {
+		p.t.Fatal(token.Error())
+	}
+	for _, s := range p.services {
+		stop := make(chan os.Signal, 1)
+		p.stops = append(p.stops, stop)
+		p.done.Add(1)
+		go func(s service) {
+			defer p.done.Done()
+			s.Run(stop)
+		}(s)
+	}
+}
+
+func (p *pipeline) stop() {
+	for _, stop := range p.stops {
+		stop <- syscall.SIGTERM
+	}
+	p.done.Wait()
+	p.client.Disconnect(250)
+}
+
+// watcher records the last payload of the topics it subscribed to.
+type watcher struct {
+	mu   sync.Mutex
+	last map[string]string
+}
+
+func (p *pipeline) watch(topics ...string) *watcher {
+	w := &watcher{last: map[string]string{}}
+	client := p.connect("watcher")
+	for _, topic := range topics {
+		client.Subscribe(topic, 0, func(client mqtt.Client, msg mqtt.Message) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.last[msg.Topic()] = string(msg.Payload())
+		}).Wait()
+	}
+	return w
+}
+
+// await waits for a topic to hold a payload.
+func (w *watcher) await(t *testing.T, topic, want string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		w.mu.Lock()
+		got := w.last[topic]
+		w.mu.Unlock()
+		if got == want {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	t.Fatalf("%s = %q, want %q", topic, w.last[topic], want)
+}
+
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// TestBrokerMapperAccountingPipeline replays the frames of a Linky exporting the
+// solar surplus, mapped to the powerinfo topics, to check the EV budget of
+// batterycoordinator and the accounting of the exported energy.
+func TestBrokerMapperAccountingPipeline(t *testing.T) {
+	broker, err := NewBroker("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	var mu sync.Mutex
+	injected, exported := 4000, 1000000
+	replay, err := NewReplay("127.0.0.1:0", 100*time.Millisecond, func() []Group {
+		mu.Lock()
+		defer mu.Unlock()
+		exported += 10
+		return []Group{
+			{"ADSC", "041234567890"},
+			{"EAST", "012345678"},
+			{"EAIT", fmt.Sprintf("%09d", exported)},
+			{"SINSTS", "00000"},
+			{"SINSTI", fmt.Sprintf("%05d", injected)},
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+
+	p := &pipeline{t: t, broker: broker}
+	w := p.watch("powerinfo/#", "batterycoordinator/ev_budget")
+	api := freeAddress(t)
+
+	p.add("teleinfo", func(client mqtt.Client) (service, error) {
+		settings := teleinfo2mqtt.DefaultSettings()
+		settings.Port, settings.Mode = replay.Port(), "standard"
+		return teleinfo2mqtt.NewService(client, settings)
+	})
+	p.add("mapper", func(client mqtt.Client) (service, error) {
+		settings := mqttmapper.DefaultSettings()
+		settings.Mappings = []mqttmapper.Mapping{
+			// The house only exports in this replay
+			{Source: "teleinfo/SINSTI", Target: "grid", Invert: true},
+			{Source: "teleinfo/EAST", Target: "totalIndex"},
+			{Source: "teleinfo/EAIT", Target: "totalInjIndex"},
+		}
+		return mqttmapper.NewService(client, settings)
+	})
+	p.add("battery", func(client mqtt.Client) (service, error) {
+		settings := batterycoordinator.DefaultSettings()
+		settings.Topics.Soc, settings.Topics.BatteryPower = "battery/soc", "battery/power"
+		settings.Interval = 100 * time.Millisecond
+		return batterycoordinator.NewService(client, settings)
+	})
+	p.add("accounting", func(client mqtt.Client) (service, error) {
+		settings := energyaccounting.DefaultSettings()
+		settings.StoreFile, settings.Listen = "", api
+		return energyaccounting.NewService(client, settings)
+	})
+	p.start()
+	defer p.stop()
+
+	battery := p.connect("battery-bridge")
+	battery.Publish("battery/soc", 0, true, "100").Wait()
+	battery.Publish("battery/power", 0, true, "0").Wait()
+
+	// The full battery leaves the 4000 W exported to the EV
+	w.await(t, "powerinfo/grid", "-4000")
+	w.await(t, "batterycoordinator/ev_budget", "4000")
+
+	// Below the minimum charging power of the EV, the budget is withdrawn
+	mu.Lock()
+	injected = 1000
+	mu.Unlock()
+	w.await(t, "powerinfo/grid", "-1000")
+	w.await(t, "batterycoordinator/ev_budget", "0")
+
+	resp, err := http.Get("http://" + api + "/api/summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var summary energyaccounting.Summary
+	if err = json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+	var total float64
+	for _, row := range summary.Rows {
+		total += row.Export
+	}
+	if total <= 0 {
+		t.Errorf("exported energy = %v, want the increase of EAIT", total)
+	}
+}
@@ -0,0 +1,93 @@
+package integration
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+)
+
+// Group is a label and value of a Teleinfo frame.
+type Group struct {
+	Label string
+	Value string
+}
+
+// StandardFrame encodes a frame of the standard mode, with the checksums of its groups.
+func StandardFrame(groups []Group) []byte {
+	var b bytes.Buffer
+	b.WriteByte(0x02)
+	for _, g := range groups {
+		sum := byte(0x09 + 0x09)
+		for _, c := range []byte(g.Label + g.Value) {
+			sum += c
+		}
+		b.WriteString("\n" + g.Label + "\t" + g.Value + "\t")
+		b.WriteByte(sum&0x3F + 0x20)
+		b.WriteByte('\r')
+	}
+	b.WriteByte(0x03)
+	return b.Bytes()
+}
+
+// Replay is a Teleinfo network bridge, as read by teleinfo2mqtt from tcp://host:port,
+// sending the frame returned by a function every period.
+type Replay struct {
+	listener net.Listener
+	period   time.Duration
+
+	mu    sync.Mutex
+	frame func() []Group
+	conns []net.Conn
+}
+
+// NewReplay listens on address, e.g. 127.0.0.1:0.
+func NewReplay(address string, period time.Duration, frame func() []Group) (*Replay, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	r := &Replay{listener: listener, period: period, frame: frame}
+	go r.accept()
+	return r, nil
+}
+
+// Port is the Teleinfo port of the bridge for teleinfo2mqtt.
+func (r *Replay) Port() string {
+	return "tcp://" + r.listener.Addr().String()
+}
+
+func (r *Replay) Close() {
+	r.listener.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+}
+
+func (r *Replay) accept() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.conns = append(r.conns, conn)
+		r.mu.Unlock()
+		go r.send(conn)
+	}
+}
+
+func (r *Replay) send(conn net.Conn) {
+	ticker := time.NewTicker(r.period)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.mu.Lock()
+		frame := StandardFrame(r.frame())
+		r.mu.Unlock()
+		if _, err := conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
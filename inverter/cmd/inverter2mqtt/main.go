@@ -0,0 +1,7 @@
+package main
+
+import "inverter2mqtt"
+
+func main() {
+	inverter2mqtt.Main()
+}
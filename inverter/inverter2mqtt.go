@@ -0,0 +1,224 @@
+// Package inverter2mqtt polls the PV production of the inverters (Sungrow, Huawei,
+// Fronius and other SunSpec ones) over Modbus TCP and publishes it on
+// powerinfo/pv_power, next to the grid power of the meter.
+package inverter2mqtt
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/goburrow/modbus"
+	"gopkg.in/yaml.v3"
+)
+
+const ProgNameMqtt string = "inverter2mqtt"
+
+// Inverter is an inverter polled over Modbus TCP.
+type Inverter struct {
+	Name string `yaml:"name"`
+	// Model is sungrow, huawei, fronius or sunspec.
+	Model string `yaml:"model"`
+	// Address is the Modbus TCP address of the inverter, e.g. 192.168.0.30:502.
+	Address string `yaml:"address"`
+	UnitId  byte   `yaml:"unit_id"`
+	// Topic receives the PV power of this inverter, in W, optional.
+	Topic string `yaml:"topic"`
+}
+
+func (i Inverter) validate() error {
+	if _, ok := models[i.Model]; !ok {
+		return fmt.Errorf("inverter %s: unsupported model '%s', expected %s, %s, %s or %s", i.Name, i.Model, Sungrow, Huawei, Fronius, SunSpec)
+	}
+	if i.Address == "" {
+		return fmt.Errorf("inverter %s: no address", i.Name)
+	}
+	return nil
+}
+
+// Settings are the settings of the poller, from the configuration file of
+// inverter2mqtt or the inverter section of the energy-center configuration file.
+type Settings struct {
+	// Mqtt is the broker connection of inverter2mqtt, ignored by the daemon.
+	Mqtt      mqttclient.Config `yaml:"mqtt"`
+	Inverters []Inverter        `yaml:"inverters"`
+	// Topic receives the PV power of all the inverters, in W.
+	Topic string `yaml:"topic"`
+	// Interval is the delay between two polls.
+	Interval time.Duration `yaml:"interval"`
+	// Timeout bounds the connection and every request to an inverter.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Mqtt:     mqttclient.Config{Url: "192.168.0.20:1883", ClientId: ProgNameMqtt},
+		Topic:    "powerinfo/pv_power",
+		Interval: 10 * time.Second,
+		Timeout:  5 * time.Second,
+	}
+}
+
+func (s Settings) Validate() error {
+	if len(s.Inverters) == 0 {
+		return fmt.Errorf("no inverter configured")
+	}
+	for _, i := range s.Inverters {
+		if err := i.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Interval <= 0 || s.Timeout <= 0 {
+		return fmt.Errorf("interval and timeout must be positive")
+	}
+	return nil
+}
+
+// LoadSettings reads the settings from a YAML file, over the defaults.
+func LoadSettings(path string) (Settings, error) {
+	settings := DefaultSettings()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return settings, err
+	}
+	if err = yaml.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Main runs the poller with its own MQTT connection, configured by a YAML file.
+func Main() {
+	var path string
+	flag.StringVar(&path, "config", "/etc/inverter2mqtt.yaml", "YAML configuration file")
+	flag.Parse()
+
+	settings, err := LoadSettings(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	mqtt.ERROR = log.New(os.Stdout, "", 0)
+	client, err := mqttclient.New(settings.Mqtt, mqttclient.Options{ConnectRetry: true})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	service, err := NewService(client, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
+
+// Service is the poller, publishing to a MQTT connection it does not own, either
+// the one of inverter2mqtt or the one shared by the energy-center daemon.
+type Service struct {
+	client   mqtt.Client
+	settings Settings
+	handlers []*modbus.TCPClientHandler
+}
+
+// NewService creates the Modbus clients, which connect on the first poll.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Service{client: client, settings: settings}
+	for _, i := range settings.Inverters {
+		handler := modbus.NewTCPClientHandler(i.Address)
+		handler.SlaveId = i.UnitId
+		handler.Timeout = settings.Timeout
+		s.handlers = append(s.handlers, handler)
+	}
+	return s, nil
+}
+
+// OnConnect has nothing to restore, the power is published every interval.
+func (s *Service) OnConnect() {
+}
+
+// Run polls the inverters every interval until a signal is received, and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	ticker := time.NewTicker(s.settings.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.poll()
+		case sig := <-signals:
+			fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+			for _, handler := range s.handlers {
+				handler.Close()
+			}
+			return 0
+		}
+	}
+}
+
+// poll publishes the power of every inverter, and their total unless one of them
+// did not answer, not to publish a production too low.
+func (s *Service) poll() {
+	var total float64
+	complete := true
+	for n, i := range s.settings.Inverters {
+		power, err := read(s.handlers[n], models[i.Model])
+		if err != nil {
+			fmt.Printf("%s: error reading %s at %s: %s\n", ProgNameMqtt, i.Name, i.Address, err)
+			// Reconnects on the next poll
+			s.handlers[n].Close()
+			complete = false
+			continue
+		}
+		// The inverters draw a few watts at night
+		power = math.Max(power, 0)
+		total += power
+		if i.Topic != "" {
+			s.publish(i.Topic, power)
+		}
+	}
+	if complete {
+		s.publish(s.settings.Topic, total)
+	}
+}
+
+// read reads the PV power of an inverter, in W.
+func read(handler *modbus.TCPClientHandler, m model) (float64, error) {
+	client := modbus.NewClient(handler)
+	var data []byte
+	var err error
+	if m.holding {
+		data, err = client.ReadHoldingRegisters(m.address, m.count)
+	} else {
+		data, err = client.ReadInputRegisters(m.address, m.count)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 2*int(m.count) {
+		return 0, fmt.Errorf("got %d bytes, expected %d", len(data), 2*m.count)
+	}
+	return m.decode(data)
+}
+
+func (s *Service) publish(topic string, power float64) {
+	s.client.Publish(topic, 0, false, strconv.FormatFloat(power, 'f', 0, 64))
+}
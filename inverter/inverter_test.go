@@ -0,0 +1,94 @@
+package inverter2mqtt
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mbserver "github.com/tbrandon/mbserver"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		model string
+		data  []byte
+		want  float64
+	}{
+		// 70000 W, low word first
+		{Sungrow, []byte{0x11, 0x70, 0x00, 0x01}, 70000},
+		{Huawei, []byte{0x00, 0x00, 0x0f, 0xa0}, 4000},
+		{Huawei, []byte{0xff, 0xff, 0xff, 0xf6}, -10},
+		// 432 with a scale factor of 1, 4320 W
+		{Fronius, []byte{0x01, 0xb0, 0x00, 0x01}, 4320},
+		{SunSpec, []byte{0x0f, 0xa0, 0xff, 0xff}, 400},
+	}
+	for _, test := range tests {
+		got, err := models[test.model].decode(test.data)
+		if err != nil || got != test.want {
+			t.Errorf("%s decode(% x) = %v, %v, want %v", test.model, test.data, got, err, test.want)
+		}
+	}
+	if _, err := models[SunSpec].decode([]byte{0x80, 0x00, 0x80, 0x00}); err == nil {
+		t.Error("decoding a W not implemented succeeded")
+	}
+}
+
+type publishClient struct {
+	mqtt.Client
+	published map[string]string
+}
+
+func (c *publishClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.published[topic] = payload.(string)
+	return nil
+}
+
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestPoll(t *testing.T) {
+	server := mbserver.NewServer()
+	address := freeAddress(t)
+	if err := server.ListenTCP(address); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.InputRegisters[5016], server.InputRegisters[5017] = 3000, 0
+	server.HoldingRegisters[32064], server.HoldingRegisters[32065] = 0, 1500
+
+	settings := DefaultSettings()
+	settings.Timeout = time.Second
+	settings.Inverters = []Inverter{
+		{Name: "roof", Model: Sungrow, Address: address, UnitId: 1, Topic: "inverter/roof"},
+		{Name: "garage", Model: Huawei, Address: address, UnitId: 1},
+	}
+	client := &publishClient{published: map[string]string{}}
+	s, err := NewService(client, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.poll()
+	if got := client.published["powerinfo/pv_power"]; got != "4500" {
+		t.Errorf("pv_power = %s, want 4500", got)
+	}
+	if got := client.published["inverter/roof"]; got != "3000" {
+		t.Errorf("roof power = %s, want 3000", got)
+	}
+
+	// Without the total when an inverter does not answer
+	delete(client.published, "powerinfo/pv_power")
+	s.settings.Inverters[1].Address = freeAddress(t)
+	s.handlers[1].Close()
+	s.handlers[1].Address = s.settings.Inverters[1].Address
+	s.poll()
+	if got, ok := client.published["powerinfo/pv_power"]; ok {
+		t.Errorf("pv_power = %s, want no publication", got)
+	}
+}
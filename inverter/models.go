@@ -0,0 +1,49 @@
+package inverter2mqtt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Inverter models
+const (
+	Sungrow = "sungrow"
+	Huawei  = "huawei"
+	Fronius = "fronius"
+	// SunSpec is any inverter exposing the SunSpec inverter models with integer
+	// points and scale factors (SMA, SolarEdge, Fronius...) at 40000.
+	SunSpec = "sunspec"
+)
+
+// model is where the PV power of an inverter model is read.
+type model struct {
+	// holding selects the holding registers, the input registers otherwise.
+	holding bool
+	address uint16
+	count   uint16
+	decode  func(data []byte) (float64, error)
+}
+
+var models = map[string]model{
+	// Total DC power, U32 in W, the low word first, of the SG and SH series
+	Sungrow: {address: 5016, count: 2, decode: func(data []byte) (float64, error) {
+		return float64(uint32(binary.BigEndian.Uint16(data[2:]))<<16 | uint32(binary.BigEndian.Uint16(data[0:]))), nil
+	}},
+	// Input power, I32 in W, of the SUN2000 series
+	Huawei: {holding: true, address: 32064, count: 2, decode: func(data []byte) (float64, error) {
+		return float64(int32(binary.BigEndian.Uint32(data))), nil
+	}},
+	Fronius: sunSpec,
+	SunSpec: sunSpec,
+}
+
+// sunSpec reads the W point and its scale factor of the SunSpec inverter models
+// 101 to 103, following the common model at 40000.
+var sunSpec = model{holding: true, address: 40083, count: 2, decode: func(data []byte) (float64, error) {
+	w, sf := binary.BigEndian.Uint16(data[0:]), binary.BigEndian.Uint16(data[2:])
+	if w == 0x8000 || sf == 0x8000 {
+		return 0, fmt.Errorf("W not implemented, is the SunSpec model set to int + SF?")
+	}
+	return float64(int16(w)) * math.Pow10(int(int16(sf))), nil
+}}
@@ -0,0 +1,227 @@
+// Package mqttclient creates the MQTT connections of the energy-center programs,
+// so that they share the same defaults: authentication, TLS, Last Will,
+// reconnection with exponential backoff and restoration of the subscriptions.
+package mqttclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Config holds the settings of a broker connection.
+type Config struct {
+	// Url is the broker address, e.g. tcp://host:1883 or ssl://host:8883.
+	Url      string `yaml:"url"`
+	ClientId string `yaml:"client_id"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// CaFile is a PEM file of the certificate authorities trusted for TLS connections.
+	CaFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the PEM client certificate and key for mutual TLS.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// Insecure disables the verification of the broker certificate.
+	Insecure bool `yaml:"insecure"`
+}
+
+// TLSConfig returns the TLS settings of the connection, nil when none are configured.
+func (c Config) TLSConfig() (*tls.Config, error) {
+	if c.CaFile == "" && c.CertFile == "" && !c.Insecure {
+		return nil, nil
+	}
+	cfg := &tls.Config{InsecureSkipVerify: c.Insecure}
+	if c.CaFile != "" {
+		pem, err := os.ReadFile(c.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", c.CaFile)
+		}
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Will is the Last Will published by the broker when the connection is lost.
+type Will struct {
+	Topic    string
+	Payload  string
+	QoS      byte
+	Retained bool
+}
+
+// Logger receives the connection events. The logrus loggers implement it.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// Options tunes the behavior of the connection.
+type Options struct {
+	// Will is the Last Will of the connection, none when nil.
+	Will *Will
+	// ConnectRetry retries the first connection until the broker is reachable,
+	// Connect returning at once.
+	ConnectRetry bool
+	// MaxReconnectInterval bounds the delay between two reconnection attempts, which
+	// doubles after every failure. DefaultMaxReconnectInterval when zero.
+	MaxReconnectInterval time.Duration
+	// OnConnect is called after every (re)connection, once the subscriptions are restored.
+	OnConnect func(client mqtt.Client)
+	// OnConnectionLost is called when the connection is lost, before the reconnection attempts.
+	OnConnectionLost func(client mqtt.Client, err error)
+	// Logger receives the connection events, the standard logger prefixed by the
+	// client id when nil.
+	Logger Logger
+}
+
+const (
+	DefaultMaxReconnectInterval = 1 * time.Minute
+	ConnectRetryInterval        = 5 * time.Second
+	KeepAlive                   = 60 * time.Second
+	PingTimeout                 = 1 * time.Second
+)
+
+// Client is a MQTT client which subscribes again to its topics after a reconnection.
+// Several services may subscribe to the same topic on a shared client, every
+// callback receiving its messages.
+type Client struct {
+	mqtt.Client
+	mu            sync.Mutex
+	subscriptions map[string]*subscription
+}
+
+// subscription holds the callbacks of a topic, subscribed at the highest QoS.
+type subscription struct {
+	qos       byte
+	callbacks []mqtt.MessageHandler
+}
+
+// New creates a client, which is connected with Connect.
+func New(config Config, opts Options) (*Client, error) {
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = stdLogger{prefix: config.ClientId + ": "}
+	}
+	maxReconnectInterval := opts.MaxReconnectInterval
+	if maxReconnectInterval <= 0 {
+		maxReconnectInterval = DefaultMaxReconnectInterval
+	}
+
+	c := &Client{subscriptions: map[string]*subscription{}}
+	o := mqtt.NewClientOptions().AddBroker(config.Url).SetClientID(config.ClientId)
+	o.SetUsername(config.Username)
+	o.SetPassword(config.Password)
+	o.SetTLSConfig(tlsConfig)
+	o.SetKeepAlive(KeepAlive)
+	o.SetPingTimeout(PingTimeout)
+	o.SetAutoReconnect(true)
+	o.SetMaxReconnectInterval(maxReconnectInterval)
+	o.SetConnectRetry(opts.ConnectRetry)
+	o.SetConnectRetryInterval(ConnectRetryInterval)
+	if opts.Will != nil {
+		o.SetWill(opts.Will.Topic, opts.Will.Payload, opts.Will.QoS, opts.Will.Retained)
+	}
+	o.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		logger.Warnf("connection lost to %s: %s", config.Url, err)
+		if opts.OnConnectionLost != nil {
+			opts.OnConnectionLost(c, err)
+		}
+	})
+	o.SetOnConnectHandler(func(client mqtt.Client) {
+		logger.Infof("connected to %s", config.Url)
+		c.restoreSubscriptions()
+		if opts.OnConnect != nil {
+			opts.OnConnect(c)
+		}
+	})
+	c.Client = mqtt.NewClient(o)
+	return c, nil
+}
+
+// Subscribe subscribes to topic now if connected, and after every reconnection.
+// The callback is added to those of the previous subscriptions to the topic.
+func (c *Client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mu.Lock()
+	s, ok := c.subscriptions[topic]
+	if !ok {
+		s = &subscription{}
+		c.subscriptions[topic] = s
+	}
+	if qos > s.qos {
+		s.qos = qos
+	}
+	s.callbacks = append(s.callbacks, callback)
+	qos = s.qos
+	c.mu.Unlock()
+	if !c.Client.IsConnectionOpen() {
+		return &mqtt.DummyToken{}
+	}
+	return c.Client.Subscribe(topic, qos, c.dispatch(topic))
+}
+
+// dispatch returns the paho callback of a topic, calling every callback of its
+// subscription in turn. paho keeps a single callback by topic filter.
+func (c *Client) dispatch(topic string) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		c.mu.Lock()
+		var callbacks []mqtt.MessageHandler
+		if s, ok := c.subscriptions[topic]; ok {
+			callbacks = append(callbacks, s.callbacks...)
+		}
+		c.mu.Unlock()
+		for _, callback := range callbacks {
+			callback(c, msg)
+		}
+	}
+}
+
+// Unsubscribe unsubscribes every callback from the topics, which are no longer restored.
+func (c *Client) Unsubscribe(topics ...string) mqtt.Token {
+	c.mu.Lock()
+	for _, topic := range topics {
+		delete(c.subscriptions, topic)
+	}
+	c.mu.Unlock()
+	return c.Client.Unsubscribe(topics...)
+}
+
+func (c *Client) restoreSubscriptions() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic, s := range c.subscriptions {
+		c.Client.Subscribe(topic, s.qos, c.dispatch(topic))
+	}
+}
+
+// stdLogger logs the connection events with the standard logger.
+type stdLogger struct {
+	prefix string
+}
+
+func (l stdLogger) Infof(format string, args ...interface{}) {
+	log.Printf(l.prefix+format, args...)
+}
+
+func (l stdLogger) Warnf(format string, args ...interface{}) {
+	log.Printf(l.prefix+format, args...)
+}
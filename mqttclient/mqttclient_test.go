@@ -0,0 +1,66 @@
+package mqttclient
+
+import (
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestSubscribeWhileDisconnected(t *testing.T) {
+	client, err := New(Config{Url: "tcp://127.0.0.1:1", ClientId: "test"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := client.Subscribe("powerinfo/grid", 1, func(mqtt.Client, mqtt.Message) {})
+	if token.Wait() && token.Error() != nil {
+		t.Errorf("Subscribe() = %v, want the subscription to be delayed until connected", token.Error())
+	}
+	if s, ok := client.subscriptions["powerinfo/grid"]; !ok || s.qos != 1 {
+		t.Errorf("subscriptions = %v, want powerinfo/grid to be restored", client.subscriptions)
+	}
+	client.Unsubscribe("powerinfo/grid")
+	if len(client.subscriptions) != 0 {
+		t.Errorf("subscriptions = %v after Unsubscribe, want none", client.subscriptions)
+	}
+}
+
+func TestSubscribeTwice(t *testing.T) {
+	client, err := New(Config{Url: "tcp://127.0.0.1:1", ClientId: "test"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received []string
+	client.Subscribe("powerinfo/grid", 0, func(_ mqtt.Client, msg mqtt.Message) {
+		received = append(received, "router "+string(msg.Payload()))
+	})
+	client.Subscribe("powerinfo/grid", 1, func(_ mqtt.Client, msg mqtt.Message) {
+		received = append(received, "meter "+string(msg.Payload()))
+	})
+	if s := client.subscriptions["powerinfo/grid"]; len(s.callbacks) != 2 || s.qos != 1 {
+		t.Fatalf("subscription = %+v, want both callbacks at QoS 1", s)
+	}
+
+	client.dispatch("powerinfo/grid")(client, message{payload: "-1200"})
+	if len(received) != 2 || received[0] != "router -1200" || received[1] != "meter -1200" {
+		t.Errorf("received = %q, want the message in both callbacks", received)
+	}
+}
+
+type message struct {
+	mqtt.Message
+	payload string
+}
+
+func (m message) Payload() []byte { return []byte(m.payload) }
+
+func TestTLSConfig(t *testing.T) {
+	if cfg, err := (Config{}).TLSConfig(); cfg != nil || err != nil {
+		t.Errorf("TLSConfig() = %v, %v, want no TLS", cfg, err)
+	}
+	if cfg, err := (Config{Insecure: true}).TLSConfig(); err != nil || !cfg.InsecureSkipVerify {
+		t.Errorf("TLSConfig() = %v, %v, want an insecure TLS connection", cfg, err)
+	}
+	if _, err := (Config{CaFile: "missing.pem"}).TLSConfig(); err == nil {
+		t.Error("TLSConfig() accepted a missing CA file")
+	}
+}
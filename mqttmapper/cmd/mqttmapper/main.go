@@ -0,0 +1,7 @@
+package main
+
+import "mqttmapper"
+
+func main() {
+	mqttmapper.Main()
+}
@@ -0,0 +1,161 @@
+package mqttmapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Canonical targets, the topics the rest of energy-center listens to.
+var Targets = map[string]string{
+	"grid":          "powerinfo/grid",
+	"totalIndex":    "powerinfo/totalIndex",
+	"totalInjIndex": "powerinfo/totalInjIndex",
+}
+
+// Mapping republishes a value of a source topic to a target topic.
+type Mapping struct {
+	// Source is the topic the value is read from, e.g. tele/tasmota/SENSOR, or a
+	// filter with + and # wildcards.
+	Source string `yaml:"source"`
+	// Field is the dotted path of the value in a JSON payload, e.g. ENERGY.Power or
+	// emeters.0.power. The whole payload is the value when empty.
+	Field string `yaml:"field"`
+	// Target is grid, totalIndex, totalInjIndex or any other topic.
+	Target string `yaml:"target"`
+	// Scale multiplies the value, e.g. 1000 for kWh to Wh. 1 when zero.
+	Scale float64 `yaml:"scale"`
+	// Invert negates the value, for meters counting the injection as positive.
+	Invert bool `yaml:"invert"`
+	// Decimals is the number of decimals published, the consumers of the powerinfo
+	// topics expect integers.
+	Decimals int `yaml:"decimals"`
+	// MinInterval drops the values received sooner after the last published one.
+	MinInterval time.Duration `yaml:"min_interval"`
+	// Retain publishes the value as a retained message.
+	Retain bool `yaml:"retain"`
+}
+
+func (m Mapping) validate() error {
+	if m.Source == "" {
+		return fmt.Errorf("mapping without source")
+	}
+	if m.Target == "" {
+		return fmt.Errorf("mapping of %s without target", m.Source)
+	}
+	if m.Decimals < 0 {
+		return fmt.Errorf("mapping of %s: negative decimals", m.Source)
+	}
+	if strings.ContainsAny(m.Target, "+#") {
+		return fmt.Errorf("mapping of %s: wildcard in target %s", m.Source, m.Target)
+	}
+	// The published values would be mapped again, endlessly
+	if matches(m.Source, m.topic()) {
+		return fmt.Errorf("mapping of %s: target %s is a source topic", m.Source, m.topic())
+	}
+	return nil
+}
+
+// matches tells whether a topic matches a subscription filter with + and # wildcards.
+func matches(filter, topic string) bool {
+	filterLevels, topicLevels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// topic returns the topic the value is published to.
+func (m Mapping) topic() string {
+	if topic, ok := Targets[m.Target]; ok {
+		return topic
+	}
+	return m.Target
+}
+
+// value extracts the value of the payload and applies the transforms.
+func (m Mapping) value(payload []byte) (float64, error) {
+	var v float64
+	var err error
+	if m.Field == "" {
+		v, err = strconv.ParseFloat(strings.TrimSpace(string(payload)), 64)
+	} else {
+		v, err = field(payload, m.Field)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if m.Scale != 0 {
+		v *= m.Scale
+	}
+	if m.Invert {
+		v = -v
+	}
+	return v, nil
+}
+
+// format rounds the value to the decimals of the mapping.
+func (m Mapping) format(v float64) string {
+	pow := math.Pow10(m.Decimals)
+	return strconv.FormatFloat(math.Round(v*pow)/pow, 'f', m.Decimals, 64)
+}
+
+// field returns the number at the dotted path of a JSON document. The elements of
+// arrays are selected by their index, numbers in strings are accepted.
+func field(payload []byte, path string) (float64, error) {
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return 0, err
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if doc, ok = node[key]; !ok {
+				return 0, fmt.Errorf("no field %s in %s", key, path)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return 0, fmt.Errorf("no element %s in %s", key, path)
+			}
+			doc = node[i]
+		default:
+			return 0, fmt.Errorf("no field %s in %s", key, path)
+		}
+	}
+	switch v := doc.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, fmt.Errorf("%s is not a number", path)
+}
+
+// mapper is a mapping with its rate limiting state.
+type mapper struct {
+	Mapping
+	mu   sync.Mutex
+	last time.Time
+}
+
+// allow reports whether a value received at now can be published.
+func (m *mapper) allow(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.MinInterval > 0 && !m.last.IsZero() && now.Sub(m.last) < m.MinInterval {
+		return false
+	}
+	m.last = now
+	return true
+}
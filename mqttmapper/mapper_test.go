@@ -0,0 +1,82 @@
+package mqttmapper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMappingValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping Mapping
+		payload string
+		want    string
+	}{
+		{"raw", Mapping{}, " 1234.4\n", "1234"},
+		{"tasmota", Mapping{Field: "ENERGY.Power"}, `{"ENERGY":{"Power":512}}`, "512"},
+		{"shelly", Mapping{Field: "emeters.1.total", Scale: 0.001, Decimals: 2}, `{"emeters":[{"total":1},{"total":"1234.5"}]}`, "1.23"},
+		{"invert", Mapping{Field: "power", Invert: true}, `{"power":-300.6}`, "301"},
+	}
+	for _, tt := range tests {
+		v, err := tt.mapping.value([]byte(tt.payload))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got := tt.mapping.format(v); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	for _, payload := range []string{`{"ENERGY":{}}`, `{"ENERGY":{"Power":"on"}}`, `{"ENERGY":[1]}`, "nan?"} {
+		if _, err := (Mapping{Field: "ENERGY.Power"}).value([]byte(payload)); err == nil {
+			t.Errorf("%s: expected an error", payload)
+		}
+	}
+}
+
+func TestMappingTopic(t *testing.T) {
+	if got := (Mapping{Target: "grid"}).topic(); got != "powerinfo/grid" {
+		t.Errorf("grid target: got %s", got)
+	}
+	if got := (Mapping{Target: "home/power"}).topic(); got != "home/power" {
+		t.Errorf("topic target: got %s", got)
+	}
+}
+
+func TestMappingValidate(t *testing.T) {
+	for _, tt := range []struct {
+		mapping Mapping
+		valid   bool
+	}{
+		{Mapping{Source: "shellies/em/emeter/0/power", Target: "grid"}, true},
+		{Mapping{Source: "shellies/+/emeter/+/power", Target: "grid"}, true},
+		{Mapping{Source: "home/#", Target: "grid"}, true},
+		{Mapping{Source: "grid", Target: "home/power"}, true},
+		{Mapping{Target: "grid"}, false},
+		{Mapping{Source: "home/power"}, false},
+		{Mapping{Source: "home/power", Target: "grid", Decimals: -1}, false},
+		{Mapping{Source: "home/power", Target: "home/+"}, false},
+		{Mapping{Source: "home/power", Target: "home/power"}, false},
+		{Mapping{Source: "powerinfo/grid", Target: "grid"}, false},
+		{Mapping{Source: "home/+", Target: "home/grid"}, false},
+		{Mapping{Source: "home/#", Target: "home/meter/grid"}, false},
+	} {
+		if err := tt.mapping.validate(); (err == nil) != tt.valid {
+			t.Errorf("validate(%+v) = %v, want valid %v", tt.mapping, err, tt.valid)
+		}
+	}
+}
+
+func TestMapperAllow(t *testing.T) {
+	m := &mapper{Mapping: Mapping{MinInterval: 10 * time.Second}}
+	now := time.Now()
+	for _, tt := range []struct {
+		at   time.Duration
+		want bool
+	}{{0, true}, {5 * time.Second, false}, {10 * time.Second, true}, {19 * time.Second, false}} {
+		if got := m.allow(now.Add(tt.at)); got != tt.want {
+			t.Errorf("allow at %s = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
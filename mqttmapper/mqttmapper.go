@@ -0,0 +1,148 @@
+// Package mqttmapper republishes the values of arbitrary topics to the powerinfo
+// topics, so that any meter (Tasmota, Shelly, zigbee2mqtt...) can feed energy-center.
+package mqttmapper
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+const ProgNameMqtt string = "mqttmapper"
+
+// Settings are the settings of the mapper, from the configuration file of mqttmapper
+// or the mapper section of the energy-center configuration file.
+type Settings struct {
+	// Mqtt is the broker connection of mqttmapper, ignored by the daemon.
+	Mqtt     mqttclient.Config `yaml:"mqtt"`
+	Mappings []Mapping         `yaml:"mappings"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{Mqtt: mqttclient.Config{Url: "192.168.0.20:1883", ClientId: ProgNameMqtt}}
+}
+
+func (s Settings) Validate() error {
+	if len(s.Mappings) == 0 {
+		return fmt.Errorf("no mapping configured")
+	}
+	for _, m := range s.Mappings {
+		if err := m.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadSettings reads the settings from a YAML file, over the defaults.
+func LoadSettings(path string) (Settings, error) {
+	settings := DefaultSettings()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return settings, err
+	}
+	if err = yaml.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Main runs the mapper with its own MQTT connection, configured by a YAML file.
+func Main() {
+	var path, url string
+	flag.StringVar(&path, "config", "/etc/mqttmapper.yaml", "YAML configuration file")
+	flag.StringVar(&url, "url", "", "mqtt server, overrides the configuration file")
+	flag.Parse()
+
+	settings, err := LoadSettings(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if url != "" {
+		settings.Mqtt.Url = url
+	}
+
+	mqtt.ERROR = log.New(os.Stdout, "", 0)
+	client, err := mqttclient.New(settings.Mqtt, mqttclient.Options{ConnectRetry: true})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	service, err := NewService(client, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
+
+// Service is the mapper, on a MQTT connection it does not own, either the one of
+// mqttmapper or the one shared by the energy-center daemon.
+type Service struct {
+	client mqtt.Client
+}
+
+// NewService subscribes to the source topics. The client must restore the
+// subscriptions on reconnection, as a mqttclient.Client does.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Service{client: client}
+	sources := map[string][]*mapper{}
+	for _, m := range settings.Mappings {
+		sources[m.Source] = append(sources[m.Source], &mapper{Mapping: m})
+	}
+	// The messages of a wildcard source arrive with their own topic, the mappers
+	// are bound to the subscription
+	for source, mappers := range sources {
+		mappers := mappers
+		client.Subscribe(source, 0, func(client mqtt.Client, msg mqtt.Message) {
+			s.onMessage(mappers, msg)
+		})
+	}
+	return s, nil
+}
+
+// OnConnect has nothing to restore, the client subscribes again to the source topics.
+func (s *Service) OnConnect() {
+}
+
+// Run maps the values until a signal is received, and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	sig := <-signals
+	fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+	return 0
+}
+
+func (s *Service) onMessage(mappers []*mapper, msg mqtt.Message) {
+	now := time.Now()
+	for _, m := range mappers {
+		v, err := m.value(msg.Payload())
+		if err != nil {
+			fmt.Printf("%s: ignoring %s: %s\n", ProgNameMqtt, msg.Topic(), err)
+			continue
+		}
+		if !m.allow(now) {
+			continue
+		}
+		s.client.Publish(m.topic(), 0, m.Retain, m.format(v))
+	}
+}
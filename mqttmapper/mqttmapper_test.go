@@ -0,0 +1,58 @@
+package mqttmapper
+
+import (
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeClient records the publications and delivers messages to the subscriptions.
+type fakeClient struct {
+	mqtt.Client
+	handlers  map[string]mqtt.MessageHandler
+	published map[string]string
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, handler mqtt.MessageHandler) mqtt.Token {
+	c.handlers[topic] = handler
+	return nil
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.published[topic] = payload.(string)
+	return nil
+}
+
+// deliver sends a message on topic to the subscription of filter.
+func (c *fakeClient) deliver(filter, topic, payload string) {
+	c.handlers[filter](c, message{topic: topic, payload: payload})
+}
+
+type message struct {
+	mqtt.Message
+	topic, payload string
+}
+
+func (m message) Topic() string   { return m.topic }
+func (m message) Payload() []byte { return []byte(m.payload) }
+
+func TestServiceWildcard(t *testing.T) {
+	client := &fakeClient{handlers: map[string]mqtt.MessageHandler{}, published: map[string]string{}}
+	settings := DefaultSettings()
+	settings.Mappings = []Mapping{
+		{Source: "shellies/+/emeter/0/power", Target: "grid"},
+		{Source: "tele/tasmota/SENSOR", Field: "ENERGY.Total", Target: "totalIndex", Scale: 1000},
+	}
+	if _, err := NewService(client, settings); err != nil {
+		t.Fatal(err)
+	}
+
+	client.deliver("shellies/+/emeter/0/power", "shellies/em3/emeter/0/power", "-1500")
+	client.deliver("tele/tasmota/SENSOR", "tele/tasmota/SENSOR", `{"ENERGY":{"Total":12.5}}`)
+	if got := client.published["powerinfo/grid"]; got != "-1500" {
+		t.Errorf("grid = %q, want the value of the wildcard source", got)
+	}
+	if got := client.published["powerinfo/totalIndex"]; got != "12500" {
+		t.Errorf("totalIndex = %q", got)
+	}
+}
@@ -0,0 +1,78 @@
+package p1tomqtt
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"energy-center/home-assistant"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const AvailabilityTopic = "p1/availability"
+const DefaultExitAfter = 30 * time.Minute
+
+// ShutdownTimeout bounds the delivery of the offline availability on shutdown.
+const ShutdownTimeout = 5 * time.Second
+
+// availability reports whether telegrams are flowing. The bridge is marked
+// offline after WatchdogTimeout without telegrams and the process only exits
+// once exitAfter has elapsed without any telegram.
+type availability struct {
+	client    mqtt.Client
+	mu        sync.Mutex
+	online    bool
+	exitAfter time.Duration
+	watchdog  *time.Timer
+	deadline  *time.Timer
+}
+
+func newAvailability(exitAfter time.Duration) *availability {
+	a := &availability{exitAfter: exitAfter}
+	a.watchdog = time.AfterFunc(WatchdogTimeout, a.silenceDetected)
+	a.deadline = time.AfterFunc(exitAfter, deadlineReached)
+	return a
+}
+
+func deadlineReached() {
+	log.Fatal("No P1 telegram received before deadline, killing process")
+	os.Exit(4)
+}
+
+// telegramReceived resets the timers and reports the bridge online if needed.
+func (a *availability) telegramReceived() {
+	a.watchdog.Reset(WatchdogTimeout)
+	a.deadline.Reset(a.exitAfter)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.online {
+		a.online = true
+		a.publish()
+	}
+}
+
+func (a *availability) silenceDetected() {
+	fmt.Printf("%s: no P1 telegram for %s, reporting offline\n", ProgNameMqtt, WatchdogTimeout)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.online = false
+	a.publish()
+}
+
+// republish sends the current state again, e.g. after a reconnection to the broker
+// which got the Last Will published.
+func (a *availability) republish() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.publish()
+}
+
+func (a *availability) publish() {
+	payload := homeassistant.PayloadNotAvailable
+	if a.online {
+		payload = homeassistant.PayloadAvailable
+	}
+	a.client.Publish(AvailabilityTopic, 0, true, payload)
+}
@@ -0,0 +1,7 @@
+package main
+
+import "p1tomqtt"
+
+func main() {
+	p1tomqtt.Main()
+}
@@ -0,0 +1,124 @@
+package p1tomqtt
+
+import (
+	"fmt"
+	"sync"
+
+	"energy-center/home-assistant"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"p1tomqtt/dsmr"
+)
+
+// discoveryOptions holds the discovery prefix, set from the settings.
+var discoveryOptions = homeassistant.Options{Origin: homeassistant.NewOrigin(ProgNameMqtt, Version)}
+
+// manufacturers are the meter manufacturers, by the identifier heading the telegrams.
+var manufacturers = map[string]string{
+	"ISk": "Iskra",
+	"KFM": "Kaifa",
+	"KMP": "Kamstrup",
+	"XMX": "Xemex",
+	"Ene": "Sagemcom",
+}
+
+// sentConfigs tracks the keys for which a discovery configuration was published.
+type sentConfigs struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+var configSent = sentConfigs{keys: map[string]bool{}}
+
+// markSent records key as sent and reports whether it had to be sent.
+func (s *sentConfigs) markSent(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[key] {
+		return false
+	}
+	s.keys[key] = true
+	return true
+}
+
+// reset forgets every sent configuration so that they are published again with the next telegram.
+func (s *sentConfigs) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = map[string]bool{}
+}
+
+// listenHaStatus republishes the discovery configurations when Home Assistant
+// announces it is online, as it may have lost them while restarting.
+func listenHaStatus(client mqtt.Client) {
+	homeassistant.OnHaOnline(client, discoveryOptions, func() {
+		fmt.Printf("%s: Home Assistant is online, republishing discovery\n", ProgNameMqtt)
+		configSent.reset()
+	})
+}
+
+// sendConfiguration publishes the discovery configuration of the items, logging
+// those which could not be published.
+func sendConfiguration(client mqtt.Client, items []homeassistant.ConfigurationItem) {
+	if _, err := homeassistant.SendConfigurationToHa(client, discoveryOptions, items); err != nil {
+		fmt.Printf("%s: error publishing discovery: %s\n", ProgNameMqtt, err)
+	}
+}
+
+// meterDevice returns the device of the meter which sent the telegram.
+func meterDevice(telegram dsmr.Telegram) homeassistant.Device {
+	device := homeassistant.Device{
+		Identifiers: []string{meterId(telegram)},
+		Name:        ProgNameMqtt,
+		Model:       telegram.Header,
+		SwVersion:   telegram.Version(),
+	}
+	// The header starts with the FLAG identifier of the manufacturer, e.g. ISk5\2MT382-1000
+	if len(telegram.Header) >= 3 {
+		device.Manufacturer = manufacturers[telegram.Header[:3]]
+	}
+	return device
+}
+
+// meterId returns the equipment identifier of the meter, used as device identifier.
+func meterId(telegram dsmr.Telegram) string {
+	if id, ok := telegram.Get("0-0:96.1.1"); ok && id.Value != "" {
+		return id.Value
+	}
+	return "unknown"
+}
+
+func configurationItem(object dsmr.Object, device homeassistant.Device, units unitOptions) homeassistant.ConfigurationItem {
+	item := homeassistant.ConfigurationItem{
+		Name:                object.Description,
+		UniqueId:            ProgNameMqtt + "_" + device.Identifiers[0] + "_" + object.Key,
+		StateTopic:          TopicPrefix + object.Key,
+		UnitOfMeasurement:   units.unit(object),
+		AvailabilityTopic:   AvailabilityTopic,
+		PayloadAvailable:    homeassistant.PayloadAvailable,
+		PayloadNotAvailable: homeassistant.PayloadNotAvailable,
+		Device:              device,
+	}
+	if object.Diagnostic {
+		item.EntityCategory = homeassistant.Diagnostic
+	}
+	switch object.Kind {
+	case dsmr.KindEnergy:
+		item.DeviceClass = "energy"
+		item.StateClass = "total_increasing"
+	case dsmr.KindGas:
+		item.DeviceClass = "gas"
+		item.StateClass = "total_increasing"
+	case dsmr.KindCount:
+		item.StateClass = "total_increasing"
+	case dsmr.KindActivePower:
+		item.DeviceClass = "power"
+		item.StateClass = "measurement"
+	case dsmr.KindCurrent:
+		item.DeviceClass = "current"
+		item.StateClass = "measurement"
+	case dsmr.KindVoltage:
+		item.DeviceClass = "voltage"
+		item.StateClass = "measurement"
+	}
+	return item
+}
@@ -0,0 +1,105 @@
+package dsmr
+
+import "fmt"
+
+// Kind describes the physical quantity carried by a COSEM object.
+type Kind int
+
+const (
+	// KindText is used for objects carrying identifiers, codes or timestamps.
+	KindText Kind = iota
+	// KindEnergy is used for active energy indices, in kWh.
+	KindEnergy
+	// KindActivePower is used for active powers, in kW.
+	KindActivePower
+	// KindCurrent is used for currents, in A.
+	KindCurrent
+	// KindVoltage is used for voltages, in V.
+	KindVoltage
+	// KindGas is used for gas indices, in m³.
+	KindGas
+	// KindCount is used for event counters.
+	KindCount
+)
+
+// Object describes a known COSEM object.
+type Object struct {
+	Obis string
+	// Key names the object in the published topics.
+	Key         string
+	Description string
+	Kind        Kind
+	// Diagnostic objects report the meter state rather than a measure.
+	Diagnostic bool
+}
+
+var objects = map[string]Object{}
+
+func register(obis string, key string, kind Kind, description string) {
+	objects[obis] = Object{Obis: obis, Key: key, Description: description, Kind: kind}
+}
+
+func diagnostic(obis ...string) {
+	for _, o := range obis {
+		object := objects[o]
+		object.Diagnostic = true
+		objects[o] = object
+	}
+}
+
+func init() {
+	register("1-3:0.2.8", "p1_version", KindText, "DSMR version")
+	register("0-0:96.1.4", "p1_version_be", KindText, "Version (Belgium)")
+	register("0-0:1.0.0", "timestamp", KindText, "Telegram timestamp")
+	register("0-0:96.1.1", "equipment_id", KindText, "Equipment identifier")
+	register("0-0:96.14.0", "electricity_tariff", KindText, "Tariff indicator")
+	register("1-0:1.8.0", "energy_delivered", KindEnergy, "Energy delivered")
+	register("1-0:2.8.0", "energy_returned", KindEnergy, "Energy returned")
+	register("1-0:1.8.1", "energy_delivered_tariff1", KindEnergy, "Energy delivered tariff 1")
+	register("1-0:1.8.2", "energy_delivered_tariff2", KindEnergy, "Energy delivered tariff 2")
+	register("1-0:2.8.1", "energy_returned_tariff1", KindEnergy, "Energy returned tariff 1")
+	register("1-0:2.8.2", "energy_returned_tariff2", KindEnergy, "Energy returned tariff 2")
+	register("1-0:1.7.0", "power_delivered", KindActivePower, "Power delivered")
+	register("1-0:2.7.0", "power_returned", KindActivePower, "Power returned")
+	register("1-0:1.4.0", "power_average_delivered", KindActivePower, "Current average demand (Belgium)")
+	register("1-0:21.7.0", "power_delivered_l1", KindActivePower, "Power delivered L1")
+	register("1-0:41.7.0", "power_delivered_l2", KindActivePower, "Power delivered L2")
+	register("1-0:61.7.0", "power_delivered_l3", KindActivePower, "Power delivered L3")
+	register("1-0:22.7.0", "power_returned_l1", KindActivePower, "Power returned L1")
+	register("1-0:42.7.0", "power_returned_l2", KindActivePower, "Power returned L2")
+	register("1-0:62.7.0", "power_returned_l3", KindActivePower, "Power returned L3")
+	register("1-0:32.7.0", "voltage_l1", KindVoltage, "Voltage L1")
+	register("1-0:52.7.0", "voltage_l2", KindVoltage, "Voltage L2")
+	register("1-0:72.7.0", "voltage_l3", KindVoltage, "Voltage L3")
+	register("1-0:31.7.0", "current_l1", KindCurrent, "Current L1")
+	register("1-0:51.7.0", "current_l2", KindCurrent, "Current L2")
+	register("1-0:71.7.0", "current_l3", KindCurrent, "Current L3")
+	register("0-0:96.7.21", "electricity_failures", KindCount, "Power failures")
+	register("0-0:96.7.9", "electricity_long_failures", KindCount, "Long power failures")
+	register("1-0:32.32.0", "electricity_sags_l1", KindCount, "Voltage sags L1")
+	register("1-0:52.32.0", "electricity_sags_l2", KindCount, "Voltage sags L2")
+	register("1-0:72.32.0", "electricity_sags_l3", KindCount, "Voltage sags L3")
+	register("1-0:32.36.0", "electricity_swells_l1", KindCount, "Voltage swells L1")
+	register("1-0:52.36.0", "electricity_swells_l2", KindCount, "Voltage swells L2")
+	register("1-0:72.36.0", "electricity_swells_l3", KindCount, "Voltage swells L3")
+	// Gas meters on the M-Bus channels, hourly (DSMR 4) or 5 minutes (DSMR 5 and Belgium) readings
+	for channel := 1; channel <= 4; channel++ {
+		key := "gas_delivered"
+		if channel > 1 {
+			key = fmt.Sprintf("gas_delivered_%d", channel)
+		}
+		register(fmt.Sprintf("0-%d:24.2.1", channel), key, KindGas, "Gas delivered")
+		register(fmt.Sprintf("0-%d:24.2.3", channel), key, KindGas, "Gas delivered")
+	}
+
+	diagnostic("1-3:0.2.8", "0-0:96.1.4", "0-0:1.0.0", "0-0:96.1.1",
+		"0-0:96.7.21", "0-0:96.7.9",
+		"1-0:32.32.0", "1-0:52.32.0", "1-0:72.32.0",
+		"1-0:32.36.0", "1-0:52.36.0", "1-0:72.36.0")
+}
+
+// LookupObject returns the description of a known COSEM object.
+func LookupObject(obis string) (Object, bool) {
+	o, ok := objects[obis]
+	return o, ok
+}
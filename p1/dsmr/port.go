@@ -0,0 +1,103 @@
+package dsmr
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+const (
+	tcpScheme = "tcp://"
+
+	dialTimeout    = 10 * time.Second
+	reconnectDelay = 1 * time.Second
+)
+
+// Open opens a P1 source, either a local serial device or a network bridge
+// given as tcp://host:port, e.g. ser2net or a P1 WiFi dongle.
+func Open(source string, baud int) (io.ReadCloser, error) {
+	if strings.HasPrefix(source, tcpScheme) {
+		address := strings.TrimPrefix(source, tcpScheme)
+		return newNetPort(func() (io.ReadCloser, error) {
+			return net.DialTimeout("tcp", address, dialTimeout)
+		})
+	}
+	return OpenPort(source, baud)
+}
+
+// OpenPort opens the P1 port of a meter. DSMR 4 and 5 meters send at 115200 bauds 8N1,
+// the DSMR 2.2 and 3 ones at 9600 bauds 7E1.
+func OpenPort(serialDevice string, baud int) (*serial.Port, error) {
+	cfg := &serial.Config{
+		Name:     serialDevice,
+		Baud:     baud,
+		Size:     8,
+		Parity:   serial.ParityNone,
+		StopBits: serial.Stop1,
+	}
+	if baud == 9600 {
+		cfg.Size = 7
+		cfg.Parity = serial.ParityEven
+	}
+	return serial.OpenPort(cfg)
+}
+
+// netPort is a network connection which is transparently re-established
+// when the remote end closes it.
+type netPort struct {
+	dial   func() (io.ReadCloser, error)
+	mu     sync.Mutex
+	conn   io.ReadCloser
+	closed bool
+}
+
+func newNetPort(dial func() (io.ReadCloser, error)) (*netPort, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	return &netPort{dial: dial, conn: conn}, nil
+}
+
+func (p *netPort) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	conn := p.conn
+	p.mu.Unlock()
+
+	n, err := conn.Read(b)
+	if err == nil || n > 0 {
+		return n, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, err
+	}
+	fmt.Printf("P1 connection lost (%s), reconnecting\n", err)
+	conn.Close()
+	time.Sleep(reconnectDelay)
+	if p.conn, err = p.dial(); err != nil {
+		// Keep a closed connection so that the next Read retries to dial
+		p.conn = closedConn{}
+		return 0, fmt.Errorf("error reconnecting P1 source: %w", err)
+	}
+	return 0, nil
+}
+
+func (p *netPort) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return p.conn.Close()
+}
+
+type closedConn struct{}
+
+func (closedConn) Read([]byte) (int, error) { return 0, io.EOF }
+func (closedConn) Close() error             { return nil }
@@ -0,0 +1,40 @@
+package dsmr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Reader defines an interface to read DSMR telegrams.
+type Reader interface {
+	// ReadTelegram reads and decodes the next telegram.
+	ReadTelegram() (Telegram, error)
+}
+
+type reader struct {
+	buffer *bufio.Reader
+}
+
+// NewReader creates a telegram reader from a simple Reader, usually the port
+// returned by OpenPort().
+func NewReader(r io.Reader) Reader {
+	return &reader{buffer: bufio.NewReader(r)}
+}
+
+// NOTE: as for Teleinfo, bufio.Reader.ReadSlice never considers more than its
+// buffer size to find the start of telegram, which bounds the garbage skipped.
+func (r *reader) ReadTelegram() (Telegram, error) {
+	if _, err := r.buffer.ReadSlice('/'); err != nil {
+		return Telegram{}, fmt.Errorf("error looking for start of telegram marker: %w", err)
+	}
+	raw, err := r.buffer.ReadBytes('!')
+	if err != nil {
+		return Telegram{}, fmt.Errorf("error looking for end of telegram marker: %w", err)
+	}
+	crc, err := r.buffer.ReadBytes('\n')
+	if err != nil {
+		return Telegram{}, fmt.Errorf("error reading telegram CRC: %w", err)
+	}
+	return Decode(append(append([]byte{'/'}, raw...), crc...))
+}
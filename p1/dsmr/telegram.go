@@ -0,0 +1,126 @@
+package dsmr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrChecksum is wrapped by decoding errors caused by a CRC mismatch.
+var ErrChecksum = errors.New("error decoding telegram, invalid CRC")
+
+// Value is a value of a COSEM object, with its unit if any, e.g. 001234.567*kWh.
+type Value struct {
+	Value string
+	Unit  string
+}
+
+// Telegram holds a single DSMR telegram.
+type Telegram struct {
+	// Header is the meter identification following the leading /, e.g. ISk5\2MT382-1000.
+	Header string
+	// Objects holds the values of the COSEM objects, by OBIS reference, e.g. 1-0:1.8.1.
+	// Most objects have a single value, the M-Bus ones are prefixed by a timestamp.
+	Objects map[string][]Value
+}
+
+// Get returns the last value of an object, the measure of the M-Bus objects.
+func (t Telegram) Get(obis string) (Value, bool) {
+	values := t.Objects[obis]
+	if len(values) == 0 {
+		return Value{}, false
+	}
+	return values[len(values)-1], true
+}
+
+// Version returns the DSMR version reported by the meter, empty before DSMR 4.
+func (t Telegram) Version() string {
+	for _, obis := range []string{"1-3:0.2.8", "0-0:96.1.4"} {
+		if v, ok := t.Get(obis); ok {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+// Decode parses a raw telegram, from the leading / to the line of the trailing !.
+// The CRC following the ! is checked when present, DSMR 2.2 and 3 telegrams have none.
+func Decode(raw []byte) (Telegram, error) {
+	end := bytes.LastIndexByte(raw, '!')
+	if len(raw) == 0 || raw[0] != '/' || end < 0 {
+		return Telegram{}, fmt.Errorf("error decoding telegram, missing / or !")
+	}
+	if crc := strings.TrimSpace(string(raw[end+1:])); crc != "" {
+		expected, err := strconv.ParseUint(crc, 16, 16)
+		if err != nil {
+			return Telegram{}, fmt.Errorf("error decoding telegram CRC %q: %w", crc, err)
+		}
+		if computed := crc16(raw[:end+1]); computed != uint16(expected) {
+			return Telegram{}, fmt.Errorf("%w: got %04X, computed %04X", ErrChecksum, expected, computed)
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(raw[1:end]), "\r", ""), "\n")
+	t := Telegram{Header: strings.TrimSpace(lines[0]), Objects: map[string][]Value{}}
+	var obis string
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// The values of an object may continue on the following lines, e.g. the
+		// gas readings of the DSMR 3 meters
+		if line[0] != '(' {
+			i := strings.IndexByte(line, '(')
+			if i < 0 {
+				return t, fmt.Errorf("error decoding telegram line %q", line)
+			}
+			obis, line = line[:i], line[i:]
+		}
+		if obis == "" {
+			return t, fmt.Errorf("error decoding telegram line %q", line)
+		}
+		values, err := decodeValues(line)
+		if err != nil {
+			return t, err
+		}
+		t.Objects[obis] = append(t.Objects[obis], values...)
+	}
+	return t, nil
+}
+
+// decodeValues parses the (value*unit) sequence of an object.
+func decodeValues(line string) ([]Value, error) {
+	var values []Value
+	for line != "" {
+		end := strings.IndexByte(line, ')')
+		if line[0] != '(' || end < 0 {
+			return nil, fmt.Errorf("error decoding telegram values %q", line)
+		}
+		v := Value{Value: line[1:end]}
+		if i := strings.IndexByte(v.Value, '*'); i >= 0 {
+			v.Value, v.Unit = v.Value[:i], v.Value[i+1:]
+		}
+		values = append(values, v)
+		line = line[end+1:]
+	}
+	return values, nil
+}
+
+// crc16 is the CRC16/ARC of the telegram, from the / to the ! included.
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,87 @@
+package dsmr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const body = "/ISk5\\2MT382-1000\r\n" +
+	"\r\n" +
+	"1-3:0.2.8(50)\r\n" +
+	"0-0:96.1.1(4B384547303034303436333935353037)\r\n" +
+	"1-0:1.8.1(123456.789*kWh)\r\n" +
+	"1-0:1.8.2(000012.001*kWh)\r\n" +
+	"1-0:1.7.0(01.193*kW)\r\n" +
+	"1-0:99.97.0(2)(0-0:96.7.19)(101208152415W)(0000000240*s)(101208151004W)(0000000301*s)\r\n" +
+	"0-1:24.2.1(101209112500W)(12785.123*m3)\r\n" +
+	"!"
+
+func withCrc(body string) string {
+	return fmt.Sprintf("%s%04X\r\n", body, crc16([]byte(body)))
+}
+
+func TestCrc16(t *testing.T) {
+	// Check value of the CRC-16/ARC catalog
+	if got := crc16([]byte("123456789")); got != 0xBB3D {
+		t.Errorf("crc16 = %04X, want BB3D", got)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	telegram, err := Decode([]byte(withCrc(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if telegram.Header != "ISk5\\2MT382-1000" || telegram.Version() != "50" {
+		t.Errorf("header %q, version %q", telegram.Header, telegram.Version())
+	}
+	if v, _ := telegram.Get("1-0:1.8.1"); v != (Value{"123456.789", "kWh"}) {
+		t.Errorf("1-0:1.8.1 = %+v", v)
+	}
+	if v, _ := telegram.Get("0-1:24.2.1"); v != (Value{"12785.123", "m3"}) {
+		t.Errorf("0-1:24.2.1 = %+v, want the reading after the timestamp", v)
+	}
+	if n := len(telegram.Objects["1-0:99.97.0"]); n != 6 {
+		t.Errorf("1-0:99.97.0 has %d values, want 6", n)
+	}
+
+	corrupted := strings.Replace(withCrc(body), "01.193", "01.194", 1)
+	if _, err := Decode([]byte(corrupted)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("corrupted telegram: got %v, want %v", err, ErrChecksum)
+	}
+}
+
+func TestDecodeDsmr3(t *testing.T) {
+	// No CRC, the gas reading continues on the next line
+	raw := "/KMP5 ZABF001587315111\r\n\r\n" +
+		"0-0:96.1.1(205C4D246333034353537383234323121)\r\n" +
+		"0-1:24.3.0(121030140000)(00)(60)(1)(0-1:24.2.1)(m3)\r\n" +
+		"(00317.959)\r\n" +
+		"!\r\n"
+	telegram, err := Decode([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := telegram.Get("0-1:24.3.0"); v.Value != "00317.959" {
+		t.Errorf("0-1:24.3.0 = %+v", v)
+	}
+	if telegram.Version() != "" {
+		t.Errorf("version = %q, want none", telegram.Version())
+	}
+}
+
+func TestReader(t *testing.T) {
+	stream := "0-1:24.2.1(1)\r\n!1234\r\n" + withCrc(body) + withCrc(body)
+	r := NewReader(strings.NewReader(stream))
+	for i := 0; i < 2; i++ {
+		telegram, err := r.ReadTelegram()
+		if err != nil {
+			t.Fatalf("telegram %d: %s", i, err)
+		}
+		if _, ok := telegram.Get("1-0:1.7.0"); !ok {
+			t.Errorf("telegram %d: missing 1-0:1.7.0", i)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+module p1tomqtt
+
+go 1.17
+
+require (
+	energy-center/home-assistant v0.0.0
+	energy-center/mqttclient v0.0.0
+	github.com/eclipse/paho.mqtt.golang v1.4.2
+	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+)
+
+require (
+	github.com/gorilla/websocket v1.4.2 // indirect
+	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da // indirect
+)
+
+replace (
+	energy-center/home-assistant => ../home-assistant
+	energy-center/mqttclient => ../mqttclient
+)
@@ -0,0 +1,192 @@
+package p1tomqtt
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"energy-center/home-assistant"
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"p1tomqtt/dsmr"
+)
+
+const ProgNameMqtt string = "p1tomqtt"
+
+// Version is set when building, with -ldflags "-X p1tomqtt.Version=..."
+var Version = "dev"
+
+const TopicPrefix = "p1/"
+const WatchdogTimeout = 1 * time.Minute
+
+// Topics of the other energy-center services, fed with the grid measures.
+const (
+	GridTopic          = "powerinfo/grid"
+	TotalIndexTopic    = "powerinfo/totalIndex"
+	TotalInjIndexTopic = "powerinfo/totalInjIndex"
+)
+
+// Settings are the settings of the bridge, from the command line of p1tomqtt
+// or the p1 section of the energy-center configuration file.
+type Settings struct {
+	// Port is the serial port, or tcp://host:port for a network bridge.
+	Port string `yaml:"port"`
+	// Baud is 115200 for DSMR 4 and 5 meters, 9600 (7E1) for DSMR 2.2 and 3 ones.
+	Baud int `yaml:"baud"`
+	// EnergyInKwh and PowerInKw keep the kWh and kW units of the meter.
+	EnergyInKwh bool `yaml:"kwh"`
+	PowerInKw   bool `yaml:"kw"`
+	// Powerinfo publishes the grid power and indices to the powerinfo topics.
+	Powerinfo bool `yaml:"powerinfo"`
+	// ExitAfter is the delay without telegram after which the process exits.
+	ExitAfter time.Duration `yaml:"exit_after"`
+	// DiscoveryPrefix is the root of the Home Assistant discovery topics.
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+	// Keys selects the objects published to MQTT, by key, e.g. voltage_l1.
+	Keys KeyFilter `yaml:"keys"`
+}
+
+// KeyFilter is an allowlist/denylist of object keys.
+// An empty Include list allows every key not listed in Exclude.
+type KeyFilter struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+func (f KeyFilter) allows(key string) bool {
+	for _, k := range f.Exclude {
+		if k == key {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, k := range f.Include {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Port:            "/dev/ttyUSB0",
+		Baud:            115200,
+		Powerinfo:       true,
+		ExitAfter:       DefaultExitAfter,
+		DiscoveryPrefix: homeassistant.DefaultDiscoveryPrefix,
+	}
+}
+
+func (s Settings) Validate() error {
+	if s.Baud != 115200 && s.Baud != 9600 {
+		return fmt.Errorf("unsupported baud rate %d, expected 115200 or 9600", s.Baud)
+	}
+	return nil
+}
+
+// Main runs p1tomqtt with its own MQTT connection, configured by the command line.
+func Main() {
+	broker := mqttclient.Config{ClientId: ProgNameMqtt}
+	settings := DefaultSettings()
+
+	flag.StringVar(&broker.Url, "url", "192.168.0.20:1883", "mqtt server, e.g. tcp://host:1883 or ssl://host:8883")
+	flag.StringVar(&broker.Username, "username", "", "mqtt username")
+	flag.StringVar(&broker.Password, "password", "", "mqtt password")
+	flag.StringVar(&broker.CaFile, "ca-file", "", "PEM certificate authorities trusted for TLS")
+	flag.StringVar(&settings.Port, "port", settings.Port, "serial port, or tcp://host:port for a network bridge")
+	flag.IntVar(&settings.Baud, "baud", settings.Baud, "115200 for DSMR 4 and 5 meters, 9600 for DSMR 2.2 and 3")
+	flag.BoolVar(&settings.EnergyInKwh, "kwh", false, "publish energy indices in kWh instead of Wh")
+	flag.BoolVar(&settings.PowerInKw, "kw", false, "publish powers in kW instead of W")
+	flag.BoolVar(&settings.Powerinfo, "powerinfo", settings.Powerinfo, "publish the grid power and indices to the powerinfo topics")
+	flag.DurationVar(&settings.ExitAfter, "exit-after", settings.ExitAfter, "exit when no telegram was received for this duration")
+	flag.StringVar(&settings.DiscoveryPrefix, "discovery-prefix", settings.DiscoveryPrefix, "root of the Home Assistant discovery topics")
+
+	flag.Parse()
+
+	if err := settings.Validate(); err != nil {
+		fmt.Println(err)
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	mqtt.ERROR = log.New(os.Stdout, "", 0)
+	var service *Service
+	client, err := mqttclient.New(broker, mqttclient.Options{
+		Will:         &mqttclient.Will{Topic: AvailabilityTopic, Payload: homeassistant.PayloadNotAvailable, Retained: true},
+		ConnectRetry: true,
+		OnConnect: func(client mqtt.Client) {
+			service.OnConnect()
+		},
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	service, err = NewService(client, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
+
+func handleTelegram(reader dsmr.Reader, client mqtt.Client, available *availability, settings Settings) {
+	units := unitOptions{energyInKwh: settings.EnergyInKwh, powerInKw: settings.PowerInKw}
+	for {
+		telegram, err := reader.ReadTelegram()
+		if err != nil {
+			fmt.Printf("Error reading P1 telegram: %s\n", err)
+			continue
+		}
+		device := meterDevice(telegram)
+		var configs []homeassistant.ConfigurationItem
+		for obis := range telegram.Objects {
+			object, known := dsmr.LookupObject(obis)
+			if !known || !settings.Keys.allows(object.Key) {
+				continue
+			}
+			value, _ := telegram.Get(obis)
+			if configSent.markSent(object.Key) {
+				configs = append(configs, configurationItem(object, device, units))
+			}
+			client.Publish(TopicPrefix+object.Key, 0, false, units.normalize(object, value.Value))
+		}
+		available.telegramReceived()
+		sendConfiguration(client, configs)
+		if settings.Powerinfo {
+			publishPowerinfo(client, telegram)
+		}
+	}
+}
+
+// publishPowerinfo publishes the grid power, positive when drawn, and the
+// indices summed over the tariffs, in W and Wh.
+func publishPowerinfo(client mqtt.Client, telegram dsmr.Telegram) {
+	delivered, okDelivered := sum(telegram, "1-0:1.7.0")
+	returned, okReturned := sum(telegram, "1-0:2.7.0")
+	if okDelivered || okReturned {
+		client.Publish(GridTopic, 0, false, fmt.Sprintf("%.0f", (delivered-returned)*1000))
+	}
+	if index, ok := energyIndex(telegram, "1-0:1.8.0", "1-0:1.8.1", "1-0:1.8.2"); ok {
+		client.Publish(TotalIndexTopic, 0, false, fmt.Sprintf("%.0f", index*1000))
+	}
+	if index, ok := energyIndex(telegram, "1-0:2.8.0", "1-0:2.8.1", "1-0:2.8.2"); ok {
+		client.Publish(TotalInjIndexTopic, 0, false, fmt.Sprintf("%.0f", index*1000))
+	}
+}
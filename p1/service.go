@@ -0,0 +1,54 @@
+package p1tomqtt
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"energy-center/home-assistant"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"p1tomqtt/dsmr"
+)
+
+// Service is a P1 bridge publishing to a MQTT connection it does not own,
+// either the one of p1tomqtt or the one shared by the energy-center daemon.
+type Service struct {
+	client    mqtt.Client
+	settings  Settings
+	port      io.ReadCloser
+	available *availability
+}
+
+// NewService opens the P1 source. The telegrams are published once Run is called,
+// OnConnect must be called on every connection. The client must restore the
+// subscriptions on reconnection, as a mqttclient.Client does.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	discoveryOptions.Prefix = settings.DiscoveryPrefix
+	port, err := dsmr.Open(settings.Port, settings.Baud)
+	if err != nil {
+		return nil, err
+	}
+	available := newAvailability(settings.ExitAfter)
+	available.client = client
+	listenHaStatus(client)
+	return &Service{client: client, settings: settings, port: port, available: available}, nil
+}
+
+// OnConnect restores the availability after a (re)connection.
+func (s *Service) OnConnect() {
+	s.available.republish()
+}
+
+// Run publishes the telegrams until a signal is received, and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	go handleTelegram(dsmr.NewReader(s.port), s.client, s.available, s.settings)
+
+	sig := <-signals
+	fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+	s.client.Publish(AvailabilityTopic, 0, true, homeassistant.PayloadNotAvailable).WaitTimeout(ShutdownTimeout)
+	s.port.Close()
+	return 0
+}
@@ -0,0 +1,83 @@
+package p1tomqtt
+
+import (
+	"strconv"
+
+	"energy-center/home-assistant"
+	"p1tomqtt/dsmr"
+)
+
+// unitOptions selects the units used when publishing values.
+type unitOptions struct {
+	energyInKwh bool
+	powerInKw   bool
+}
+
+// normalize converts a raw telegram value to the configured unit, dropping the
+// leading zeros of the numbers. Text values are returned as is.
+func (o unitOptions) normalize(object dsmr.Object, value string) string {
+	if object.Kind == dsmr.KindText {
+		return value
+	}
+	num, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	switch {
+	case object.Kind == dsmr.KindEnergy && !o.energyInKwh,
+		object.Kind == dsmr.KindActivePower && !o.powerInKw:
+		return strconv.FormatFloat(num*1000, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(num, 'f', -1, 64)
+}
+
+// unit returns the unit announced in the discovery configuration of object.
+func (o unitOptions) unit(object dsmr.Object) homeassistant.Unit {
+	switch object.Kind {
+	case dsmr.KindEnergy:
+		if o.energyInKwh {
+			return homeassistant.KWh
+		}
+		return homeassistant.Wh
+	case dsmr.KindActivePower:
+		if o.powerInKw {
+			return homeassistant.KW
+		}
+		return homeassistant.W
+	case dsmr.KindCurrent:
+		return homeassistant.A
+	case dsmr.KindVoltage:
+		return homeassistant.V
+	case dsmr.KindGas:
+		return homeassistant.M3
+	}
+	return homeassistant.None
+}
+
+// sum adds the values of the objects present in the telegram, in the units of the meter.
+func sum(telegram dsmr.Telegram, obis ...string) (float64, bool) {
+	var total float64
+	var found bool
+	for _, o := range obis {
+		v, ok := telegram.Get(o)
+		if !ok {
+			continue
+		}
+		num, err := strconv.ParseFloat(v.Value, 64)
+		if err != nil {
+			continue
+		}
+		total += num
+		found = true
+	}
+	return total, found
+}
+
+// energyIndex returns the sum of the tariff indices, or the total index reported
+// by the meters without tariffs, in kWh.
+func energyIndex(telegram dsmr.Telegram, total string, tariffs ...string) (float64, bool) {
+	if index, ok := sum(telegram, tariffs...); ok {
+		return index, ok
+	}
+	return sum(telegram, total)
+}
@@ -0,0 +1,51 @@
+package powertag2mqtt
+
+import (
+	"time"
+
+	"energy-center/home-assistant"
+)
+
+const DefaultTagTimeout = 5 * time.Minute
+
+func (b *bridge) availabilityTopic() string {
+	return b.config.TopicPrefix + "/availability"
+}
+
+func (b *bridge) tagAvailabilityTopic(id string) string {
+	return b.tagTopic(id) + "/availability"
+}
+
+// publishAvailability reports the bridge online, overriding its Last Will.
+func (b *bridge) publishAvailability() {
+	b.client.Publish(b.availabilityTopic(), 0, true, homeassistant.PayloadAvailable)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id := range b.online {
+		b.publishTagAvailability(id)
+	}
+}
+
+// publishTagAvailability must be called with b.mu held.
+func (b *bridge) publishTagAvailability(id string) {
+	payload := homeassistant.PayloadNotAvailable
+	if b.online[id] {
+		payload = homeassistant.PayloadAvailable
+	}
+	b.client.Publish(b.tagAvailabilityTopic(id), 0, true, payload)
+}
+
+// watchTags reports offline the tags which did not report within the tag timeout.
+func (b *bridge) watchTags() {
+	timeout := b.config.TagTimeout
+	for range time.Tick(timeout / 10) {
+		b.mu.Lock()
+		for id, seen := range b.lastSeen {
+			if b.online[id] && time.Since(seen) > timeout {
+				b.online[id] = false
+				b.publishTagAvailability(id)
+			}
+		}
+		b.mu.Unlock()
+	}
+}
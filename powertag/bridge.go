@@ -0,0 +1,253 @@
+package powertag2mqtt
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"energy-center/influx"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+	"powertag2mqtt/jsonformat"
+	"powertag2mqtt/lineprotocol"
+)
+
+// bridge publishes powertagd lines to MQTT and tracks the state of every tag.
+type bridge struct {
+	client mqtt.Client
+	config Config
+	// influx is nil when the InfluxDB output is disabled
+	influx *influx.Writer
+	// costs is nil when no tariff is configured
+	costs *costs
+
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+	online   map[string]bool
+	// powertagConfigSent holds, per tag, the measures announced to Home Assistant
+	powertagConfigSent map[string]map[string]bool
+	// models holds the tag types reported by powertagd, e.g. A9MEM1540
+	models map[string]string
+	// removedTags holds the measures of the tags of the registry which are now
+	// filtered out, whose discovery configuration is removed at connection
+	removedTags map[string][]string
+
+	// lastPublished and lastValues are only used by handleLine
+	lastPublished map[string]time.Time
+	lastValues    map[string]map[string]string
+	// memberValues holds the last raw fields of the members of virtual tags
+	memberValues map[string]map[string]string
+
+	backlogMu sync.Mutex
+	backlog   []queuedMessage
+
+	// inputErr is the read error of the input, set before the lines channel is closed
+	inputErr error
+}
+
+func newBridge(client mqtt.Client, config Config) *bridge {
+	b := &bridge{
+		client:             client,
+		config:             config,
+		lastSeen:           map[string]time.Time{},
+		online:             map[string]bool{},
+		powertagConfigSent: map[string]map[string]bool{},
+		models:             map[string]string{},
+		removedTags:        map[string][]string{},
+		lastPublished:      map[string]time.Time{},
+		lastValues:         map[string]map[string]string{},
+		memberValues:       map[string]map[string]string{},
+	}
+	if config.Influx.Enabled() {
+		b.influx = influx.NewWriter(config.Influx.Config, config.Influx.BatchSize, config.Influx.FlushInterval, log.Errorf)
+	}
+	if config.Tariff.enabled() {
+		b.costs = newCosts(config.Tariff)
+	}
+	return b
+}
+
+// subscribe subscribes to topic, which the client restores on every reconnection.
+func (b *bridge) subscribe(topic string, handler mqtt.MessageHandler) error {
+	token := b.client.Subscribe(topic, 0, handler)
+	token.Wait()
+	return token.Error()
+}
+
+// onConnect restores the bridge state after a (re)connection to the broker.
+func (b *bridge) onConnect() {
+	b.publishAvailability()
+	b.publishDiscovery()
+	b.flushBacklog()
+}
+
+// tagId returns the id of the tag which reported a line. Tags of a named gateway
+// are namespaced by it, e.g. garage/0x42, so that the short ids of tags paired to
+// different gateways do not collide.
+func (b *bridge) tagId(tags map[string]string) (string, bool) {
+	id, exist := tags["id"]
+	if !exist {
+		return "", false
+	}
+	gateway, named := tags["gateway"]
+	if !named {
+		gateway = b.config.Gateway
+	}
+	if gateway != "" {
+		id = gateway + "/" + id
+	}
+	return id, true
+}
+
+// tagTopic returns the root topic of a tag, e.g. powertag/0x42 or powertag/garage/0x42.
+func (b *bridge) tagTopic(id string) string {
+	return b.config.TopicPrefix + "/" + id
+}
+
+func (b *bridge) handleLine(line string) {
+	log.Debug(line)
+	point, ok := b.parse(line)
+	if !ok {
+		return
+	}
+
+	id, idExist := b.tagId(point.Tags)
+	if !idExist {
+		return
+	}
+	timestamp, hasTimestamp := point.Time()
+	if hasTimestamp && b.config.MaxAge > 0 && time.Since(timestamp) > b.config.MaxAge {
+		log.Debugf("skipping stale line of %s from %s", id, timestamp)
+		return
+	}
+	if !hasTimestamp {
+		timestamp = time.Now()
+	}
+	// Filtered out tags may still be part of a virtual tag
+	defer b.aggregate(id, point.Fields, timestamp)
+	if !b.config.Filter.allows(id) {
+		return
+	}
+	stats.tagSeen(id)
+	// InfluxDB gets every line, at full resolution
+	if b.influx != nil {
+		if isJsonLine(line) {
+			line = point.String()
+		}
+		b.influx.Write(line)
+	}
+	if model, ok := point.Tags["type"]; ok {
+		b.setModel(id, model)
+	}
+	b.handleTag(id, point.Fields, timestamp)
+}
+
+// parse parses a powertagd line in the configured format, false when the line
+// is not a PowerTag report.
+func (b *bridge) parse(line string) (lineprotocol.Point, bool) {
+	var point lineprotocol.Point
+	var err error
+	switch {
+	case b.config.Format != FormatLine && isJsonLine(line):
+		point, err = jsonformat.Parse(line)
+		if err == nil && point.Measurement != "powertag" {
+			return point, false
+		}
+	case b.config.Format != FormatJson && strings.HasPrefix(line, "powertag,"):
+		point, err = lineprotocol.Parse(line)
+	default:
+		return point, false
+	}
+	if err != nil {
+		stats.parseError()
+		log.Warnf("error parsing line '%s': %s", line, err)
+		return point, false
+	}
+	stats.lineParsed()
+	return point, true
+}
+
+// handleTag publishes the measures reported by a physical or virtual tag.
+func (b *bridge) handleTag(id string, fields map[string]string, timestamp time.Time) {
+	measures := b.normalize(fields)
+	b.tagSeen(id, measures)
+	throttled := b.throttled(id)
+	if b.costs != nil {
+		b.updateCost(id, fields, timestamp, !throttled)
+	}
+	if throttled {
+		return
+	}
+	changed := b.changedMeasures(id, measures)
+	if len(changed) == 0 {
+		return
+	}
+	b.lastPublished[id] = time.Now()
+
+	if b.publishesJson() {
+		payload := make(map[string]string, len(measures)+1)
+		for k, v := range measures {
+			payload[k] = v
+		}
+		payload["timestamp"] = timestamp.UTC().Format(time.RFC3339Nano)
+		jsonStr, _ := json.Marshal(payload)
+		b.publish(b.tagTopic(id), b.config.Publish.Json, jsonStr)
+	}
+	if b.publishesPerKey() {
+		for k, v := range changed {
+			b.publish(b.tagTopic(id)+"/"+k, b.config.Publish.measurePolicy(k), v)
+		}
+	}
+}
+
+// tagSeen records a report of the tag, announcing to Home Assistant the measures
+// it reports for the first time.
+func (b *bridge) tagSeen(id string, measures map[string]string) {
+	b.mu.Lock()
+	b.lastSeen[id] = time.Now()
+	if !b.online[id] {
+		b.online[id] = true
+		b.publishTagAvailability(id)
+	}
+	sent, exist := b.powertagConfigSent[id]
+	if !exist {
+		sent = map[string]bool{}
+		b.powertagConfigSent[id] = sent
+	}
+	var keys []string
+	for key := range measures {
+		if !sent[key] {
+			sent[key] = true
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	configuration := b.tagConfiguration(id, keys)
+	b.saveRegistry()
+	b.mu.Unlock()
+	b.sendTagConfigurations(configuration)
+}
+
+// setModel records the type of a tag, republishing its discovery configuration
+// when it was announced without it.
+func (b *bridge) setModel(id string, model string) {
+	b.mu.Lock()
+	if b.models[id] == model {
+		b.mu.Unlock()
+		return
+	}
+	b.models[id] = model
+	keys := b.sentKeys(id)
+	if len(keys) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	configuration := b.tagConfiguration(id, keys)
+	b.saveRegistry()
+	b.mu.Unlock()
+	b.sendTagConfigurations(configuration)
+}
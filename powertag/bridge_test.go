@@ -0,0 +1,305 @@
+package powertag2mqtt
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type message struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  string
+}
+
+// mockClient records the published messages instead of sending them to a broker,
+// and the handlers of the subscriptions.
+type mockClient struct {
+	mu       sync.Mutex
+	messages []message
+	handlers map[string]mqtt.MessageHandler
+}
+
+func (c *mockClient) IsConnected() bool      { return true }
+func (c *mockClient) IsConnectionOpen() bool { return true }
+func (c *mockClient) Connect() mqtt.Token    { return &mqtt.DummyToken{} }
+func (c *mockClient) Disconnect(uint)        {}
+func (c *mockClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var p string
+	switch v := payload.(type) {
+	case []byte:
+		p = string(v)
+	default:
+		p = fmt.Sprint(v)
+	}
+	c.messages = append(c.messages, message{topic, qos, retained, p})
+	return &mqtt.DummyToken{}
+}
+func (c *mockClient) Subscribe(topic string, qos byte, handler mqtt.MessageHandler) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.handlers == nil {
+		c.handlers = map[string]mqtt.MessageHandler{}
+	}
+	c.handlers[topic] = handler
+	return &mqtt.DummyToken{}
+}
+func (c *mockClient) SubscribeMultiple(map[string]byte, mqtt.MessageHandler) mqtt.Token {
+	return &mqtt.DummyToken{}
+}
+func (c *mockClient) Unsubscribe(...string) mqtt.Token        { return &mqtt.DummyToken{} }
+func (c *mockClient) AddRoute(string, mqtt.MessageHandler)    {}
+func (c *mockClient) OptionsReader() mqtt.ClientOptionsReader { return mqtt.ClientOptionsReader{} }
+
+// data returns the published messages, except the discovery configurations, by topic.
+func (c *mockClient) data() map[string]message {
+	data := map[string]message{}
+	for _, m := range c.messages {
+		if !strings.HasPrefix(m.topic, "homeassistant/") {
+			data[m.topic] = m
+		}
+	}
+	return data
+}
+
+// discovery returns the sorted topics of the published discovery configurations.
+func (c *mockClient) discovery() []string {
+	var topics []string
+	for _, m := range c.messages {
+		if strings.HasPrefix(m.topic, "homeassistant/") {
+			topics = append(topics, m.topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// feed runs the lines of a fixture through a bridge using the given configuration.
+func feed(t *testing.T, fixture string, config Config) *mockClient {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	client := &mockClient{}
+	b := newBridge(client, config)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		b.handleLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestSinglePhase(t *testing.T) {
+	client := feed(t, "single-phase.txt", DefaultConfig())
+
+	want := map[string]message{
+		"powertag/0x1234abcd/availability": {"powertag/0x1234abcd/availability", 0, true, "online"},
+		"powertag/0x1234abcd": {"powertag/0x1234abcd", 0, false,
+			`{"current_p1":"0.6","energy":"123456","power_p1":"120","timestamp":"2023-02-14T18:40:00Z","voltage_p1":"231.5"}`},
+		"powertag/0x1234abcd/current_p1": {"powertag/0x1234abcd/current_p1", 0, false, "0.6"},
+		"powertag/0x1234abcd/voltage_p1": {"powertag/0x1234abcd/voltage_p1", 0, false, "231.5"},
+		"powertag/0x1234abcd/power_p1":   {"powertag/0x1234abcd/power_p1", 0, false, "120"},
+		"powertag/0x1234abcd/energy":     {"powertag/0x1234abcd/energy", 0, true, "123456"},
+	}
+	if got := client.data(); !reflect.DeepEqual(got, want) {
+		t.Errorf("published %+v, want %+v", got, want)
+	}
+	wantDiscovery := []string{
+		"homeassistant/sensor/powertag2mqtt_0x1234abcd_current_p1/config",
+		"homeassistant/sensor/powertag2mqtt_0x1234abcd_energy/config",
+		"homeassistant/sensor/powertag2mqtt_0x1234abcd_power_p1/config",
+		"homeassistant/sensor/powertag2mqtt_0x1234abcd_voltage_p1/config",
+	}
+	if got := client.discovery(); !reflect.DeepEqual(got, wantDiscovery) {
+		t.Errorf("discovery published to %v, want %v", got, wantDiscovery)
+	}
+}
+
+func TestThreePhase(t *testing.T) {
+	config := DefaultConfig()
+	config.Output = OutputPerKey
+	client := feed(t, "three-phase.txt", config)
+
+	want := map[string]message{
+		"powertag/0x42/availability": {"powertag/0x42/availability", 0, true, "online"},
+		"powertag/0x42/energy":       {"powertag/0x42/energy", 0, true, "9876543"},
+		"powertag/0x42/power":        {"powertag/0x42/power", 0, false, "950"},
+	}
+	for _, phase := range []struct{ p, current, voltage, power string }{
+		{"1", "1.2", "230.1", "250"},
+		{"2", "0.8", "231.4", "160"},
+		{"3", "2.5", "229.8", "540"},
+	} {
+		for key, value := range map[string]string{"current": phase.current, "voltage": phase.voltage, "power": phase.power} {
+			topic := "powertag/0x42/" + key + "_p" + phase.p
+			want[topic] = message{topic, 0, false, value}
+		}
+	}
+	if got := client.data(); !reflect.DeepEqual(got, want) {
+		t.Errorf("published %+v, want %+v", got, want)
+	}
+	if got := client.discovery(); len(got) != 11 {
+		t.Errorf("discovery published to %v, want the 11 measures", got)
+	}
+	// The gateway and model are announced with every measure
+	for _, m := range client.messages {
+		if strings.HasPrefix(m.topic, "homeassistant/") &&
+			(!strings.Contains(m.payload, `"model":"A9MEM1540"`) || !strings.Contains(m.payload, `"via_device":"powertag2mqtt"`)) {
+			t.Errorf("discovery %s = %s, want the model and gateway", m.topic, m.payload)
+		}
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	client := feed(t, "malformed.txt", DefaultConfig())
+
+	want := map[string]message{
+		"powertag/0x42/availability": {"powertag/0x42/availability", 0, true, "online"},
+		"powertag/0x42":              {"powertag/0x42", 0, false, `{"power":"12","timestamp":"2023-02-14T18:40:01Z"}`},
+		"powertag/0x42/power":        {"powertag/0x42/power", 0, false, "12"},
+	}
+	if got := client.data(); !reflect.DeepEqual(got, want) {
+		t.Errorf("published %+v, want %+v", got, want)
+	}
+}
+
+func TestChangeOnly(t *testing.T) {
+	config := DefaultConfig()
+	config.ChangeOnly = true
+	config.Output = OutputPerKey
+	client := &mockClient{}
+	b := newBridge(client, config)
+	b.handleLine("powertag,id=0x42 power=12i,energy=100i")
+	b.handleLine("powertag,id=0x42 power=12i,energy=101i")
+
+	var energy, power int
+	for _, m := range client.messages {
+		switch m.topic {
+		case "powertag/0x42/energy":
+			energy++
+		case "powertag/0x42/power":
+			power++
+		}
+	}
+	if energy != 2 || power != 1 {
+		t.Errorf("published energy %d and power %d times, want 2 and 1", energy, power)
+	}
+}
+
+func TestJson(t *testing.T) {
+	config := DefaultConfig()
+	config.Output = OutputJson
+	client := &mockClient{}
+	b := newBridge(client, config)
+	b.handleLine(`{"id":"0x42","power":12,"timestamp":1676400000}`)
+
+	want := map[string]message{
+		"powertag/0x42/availability": {"powertag/0x42/availability", 0, true, "online"},
+		"powertag/0x42":              {"powertag/0x42", 0, false, `{"power":"12","timestamp":"2023-02-14T18:40:00Z"}`},
+	}
+	if got := client.data(); !reflect.DeepEqual(got, want) {
+		t.Errorf("published %+v, want %+v", got, want)
+	}
+}
+
+func TestGateways(t *testing.T) {
+	config := DefaultConfig()
+	config.Output = OutputPerKey
+	config.Gateway = "house"
+	client := &mockClient{}
+	b := newBridge(client, config)
+	b.handleLine("powertag,id=0x42 power=12i")
+	b.handleLine("powertag,id=0x42,gateway=garage power=34i")
+
+	data := client.data()
+	for topic, payload := range map[string]string{"powertag/house/0x42/power": "12", "powertag/garage/0x42/power": "34"} {
+		if data[topic].payload != payload {
+			t.Errorf("%s = %q, want %q", topic, data[topic].payload, payload)
+		}
+	}
+	want := []string{
+		"homeassistant/sensor/powertag2mqtt_garage_0x42_power/config",
+		"homeassistant/sensor/powertag2mqtt_house_0x42_power/config",
+	}
+	if got := client.discovery(); !reflect.DeepEqual(got, want) {
+		t.Errorf("discovery published to %v, want %v", got, want)
+	}
+}
+
+func TestDeviceDiscovery(t *testing.T) {
+	config := DefaultConfig()
+	config.DeviceDiscovery = true
+	client := feed(t, "single-phase.txt", config)
+
+	want := []string{"homeassistant/device/powertag2mqtt_0x1234abcd/config"}
+	if got := client.discovery(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("discovery published to %v, want %v", got, want)
+	}
+	var payload string
+	for _, m := range client.messages {
+		if m.topic == want[0] {
+			payload = m.payload
+		}
+	}
+	for _, component := range []string{"current_p1", "energy", "power_p1", "voltage_p1"} {
+		if !strings.Contains(payload, `"powertag2mqtt_0x1234abcd_`+component+`":{`) {
+			t.Errorf("device discovery %s does not announce %s", payload, component)
+		}
+	}
+	if !strings.Contains(payload, `"platform":"sensor"`) || !strings.Contains(payload, `"origin":{"name":"powertag2mqtt"`) {
+		t.Errorf("device discovery %s misses the platform or origin", payload)
+	}
+}
+
+func TestRemoveFilteredOutTags(t *testing.T) {
+	config := DefaultConfig()
+	config.StateFile = filepath.Join(t.TempDir(), "registry.json")
+	config.Filter.Exclude = []string{"0x42"}
+	registry := `{"tags":{"0x42":["power"],"0x43":["power"]}}`
+	if err := os.WriteFile(config.StateFile, []byte(registry), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := &mockClient{}
+	b := newBridge(client, config)
+	if err := b.loadRegistry(); err != nil {
+		t.Fatal(err)
+	}
+	b.publishDiscovery()
+
+	removed := map[string]bool{}
+	for _, m := range client.messages {
+		if m.payload == "" && m.retained {
+			removed[m.topic] = true
+		}
+	}
+	want := map[string]bool{
+		"homeassistant/sensor/powertag2mqtt_0x42_power/config": true,
+		"homeassistant/device/powertag2mqtt_0x42/config":       true,
+	}
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed %v, want %v", removed, want)
+	}
+	content, err := os.ReadFile(config.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "0x42") {
+		t.Errorf("registry %s still holds the removed tag", content)
+	}
+}
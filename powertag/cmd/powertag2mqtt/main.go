@@ -0,0 +1,7 @@
+package main
+
+import "powertag2mqtt"
+
+func main() {
+	powertag2mqtt.Main()
+}
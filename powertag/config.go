@@ -0,0 +1,287 @@
+package powertag2mqtt
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"energy-center/home-assistant"
+	"energy-center/mqttclient"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the bridge settings. They are read, by increasing precedence,
+// from the defaults, the YAML configuration file, the environment and the flags.
+type Config struct {
+	Broker mqttclient.Config `yaml:"broker"`
+	// Input is where powertagd lines are read from, see -input.
+	Input string `yaml:"input"`
+	// Format is the format of the powertagd lines: auto, line or json.
+	Format string `yaml:"format"`
+	// TopicPrefix is the root of the topics data is published to.
+	TopicPrefix string `yaml:"topic_prefix"`
+	// DiscoveryPrefix is the root of the Home Assistant discovery topics.
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+	// DeviceDiscovery announces every tag with a single device-based discovery payload
+	// instead of a payload per entity. It requires Home Assistant 2024.11 or later.
+	DeviceDiscovery bool `yaml:"device_discovery"`
+	// Gateway namespaces the tags whose lines have no gateway tag, when several gateways feed the bridge.
+	Gateway string `yaml:"gateway"`
+	// TagTimeout is the delay after which a silent tag is reported offline.
+	TagTimeout time.Duration `yaml:"tag_timeout"`
+	// Tags holds the per tag settings, by powertag id, prefixed by the gateway, e.g. garage/0x42.
+	Tags map[string]TagConfig `yaml:"tags"`
+	// Filter selects the bridged tags.
+	Filter TagFilter `yaml:"filter"`
+	// Publish holds the QoS and retain policies of the published topics.
+	Publish PublishConfig `yaml:"publish"`
+	// ChangeOnly skips the publication of measures whose value did not change.
+	ChangeOnly bool `yaml:"change_only"`
+	// MinInterval is the minimum delay between two publications of a tag.
+	MinInterval time.Duration `yaml:"min_interval"`
+	// Measures holds the rounding and unit conversion, by measure.
+	Measures map[string]MeasureConfig `yaml:"measures"`
+	// Output selects the published topics: the JSON payload of a tag, its per-key topics or both.
+	Output string `yaml:"output"`
+	// Influx configures the optional InfluxDB output, written in parallel to MQTT.
+	Influx InfluxConfig `yaml:"influx"`
+	// MetricsAddress is the listen address of the Prometheus and health endpoints, disabled when empty.
+	MetricsAddress string `yaml:"metrics_address"`
+	// HeartbeatInterval is the period of the health reports published on <prefix>/heartbeat, disabled when zero.
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+	// BacklogSize bounds the messages queued while the broker is unreachable.
+	BacklogSize int `yaml:"backlog_size"`
+	// StateFile persists the known tags across restarts, disabled when empty.
+	StateFile string `yaml:"state_file"`
+	// LogLevel is one of trace, debug, info, warning or error.
+	LogLevel string `yaml:"log_level"`
+	// Quiet only logs warnings and errors, without timestamps.
+	Quiet bool `yaml:"quiet"`
+	// MaxAge skips the lines whose timestamp is older, disabled when zero.
+	MaxAge time.Duration `yaml:"max_age"`
+	// Tariff enables the daily cost sensors of the circuits.
+	Tariff TariffConfig `yaml:"tariff"`
+	// VirtualTags declares tags summing physical tags, by virtual tag id.
+	VirtualTags map[string]VirtualTagConfig `yaml:"virtual_tags"`
+}
+
+// TagFilter is an allowlist/denylist of powertag ids, prefixed by their gateway if any.
+// An empty Include list allows every tag not listed in Exclude.
+type TagFilter struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+func (f TagFilter) allows(id string) bool {
+	for _, t := range f.Exclude {
+		if t == id {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, t := range f.Include {
+		if t == id {
+			return true
+		}
+	}
+	return false
+}
+
+// TagConfig holds the settings of a single tag.
+type TagConfig struct {
+	// Name is the friendly name of the Home Assistant device, e.g. "Kitchen oven".
+	Name string `yaml:"name"`
+	// Area is the area suggested to Home Assistant for the device.
+	Area string `yaml:"area"`
+	// MinInterval overrides the global minimum delay between two publications.
+	MinInterval time.Duration `yaml:"min_interval"`
+}
+
+// DefaultConfig returns the settings used when neither set in the configuration file,
+// the environment nor the flags.
+func DefaultConfig() Config {
+	return Config{
+		Broker: mqttclient.Config{
+			Url:      "192.168.0.20:1883",
+			ClientId: ProgNameMqtt,
+		},
+		Input:           "stdin",
+		Format:          FormatAuto,
+		TopicPrefix:     "powertag",
+		DiscoveryPrefix: homeassistant.DefaultDiscoveryPrefix,
+		TagTimeout:      DefaultTagTimeout,
+		Publish:         defaultPublishConfig(),
+		Output:          OutputBoth,
+		BacklogSize:     DefaultBacklogSize,
+		LogLevel:        "info",
+	}
+}
+
+// loadConfig builds the configuration from the command line, the environment
+// and the configuration file given with -config.
+func loadConfig() (Config, error) {
+	config := DefaultConfig()
+	var configFile string
+	var fromFlags Config
+
+	flag.StringVar(&configFile, "config", "", "optional YAML configuration file")
+	flag.StringVar(&fromFlags.Broker.Url, "url", config.Broker.Url, "mqtt server, e.g. tcp://host:1883 or ssl://host:8883")
+	flag.StringVar(&fromFlags.Broker.ClientId, "client-id", config.Broker.ClientId, "mqtt client id")
+	flag.StringVar(&fromFlags.Broker.Username, "username", "", "mqtt username")
+	flag.StringVar(&fromFlags.Broker.Password, "password", "", "mqtt password")
+	flag.StringVar(&fromFlags.Broker.CaFile, "ca-file", "", "PEM certificate authorities trusted for TLS")
+	flag.StringVar(&fromFlags.Broker.CertFile, "cert-file", "", "PEM client certificate for TLS")
+	flag.StringVar(&fromFlags.Broker.KeyFile, "key-file", "", "PEM client key for TLS")
+	flag.BoolVar(&fromFlags.Broker.Insecure, "insecure", false, "do not verify the broker certificate")
+	flag.StringVar(&fromFlags.Input, "input", config.Input, "powertagd lines input: stdin, tcp://[host]:port, udp://[host]:port or mqtt://topic")
+	flag.StringVar(&fromFlags.Format, "format", config.Format, "format of the powertagd lines: auto, line (InfluxDB line protocol) or json")
+	flag.StringVar(&fromFlags.Gateway, "gateway", "", "gateway id namespacing the tags of lines without a gateway tag")
+	flag.StringVar(&fromFlags.TopicPrefix, "topic-prefix", config.TopicPrefix, "root of the published topics")
+	flag.StringVar(&fromFlags.DiscoveryPrefix, "discovery-prefix", config.DiscoveryPrefix, "root of the Home Assistant discovery topics")
+	flag.BoolVar(&fromFlags.DeviceDiscovery, "device-discovery", false, "announce every tag with a single device-based discovery payload")
+	flag.BoolVar(&fromFlags.ChangeOnly, "change-only", false, "only publish measures whose value changed")
+	flag.DurationVar(&fromFlags.MinInterval, "min-interval", 0, "minimum delay between two publications of a tag")
+	flag.StringVar(&fromFlags.Output, "output", config.Output, "published topics: json, per-key or both")
+	flag.StringVar(&fromFlags.MetricsAddress, "metrics", "", "address of the Prometheus /metrics and /health endpoints, e.g. :9101 (disabled when empty)")
+	flag.DurationVar(&fromFlags.HeartbeatInterval, "heartbeat", config.HeartbeatInterval, "period of the heartbeat messages, 0 to disable")
+	flag.StringVar(&fromFlags.StateFile, "state-file", "", "file persisting the known tags across restarts")
+	flag.StringVar(&fromFlags.LogLevel, "log-level", config.LogLevel, "log level: trace, debug, info, warning or error")
+	flag.BoolVar(&fromFlags.Quiet, "quiet", false, "only log warnings and errors, without timestamps (for systemd)")
+	flag.DurationVar(&fromFlags.MaxAge, "max-age", 0, "skip lines whose timestamp is older than this duration")
+	flag.DurationVar(&fromFlags.TagTimeout, "tag-timeout", config.TagTimeout, "delay after which a silent tag is reported offline")
+	flag.Parse()
+
+	if configFile != "" {
+		content, err := os.ReadFile(configFile)
+		if err != nil {
+			return config, err
+		}
+		if err = yaml.Unmarshal(content, &config); err != nil {
+			return config, fmt.Errorf("error parsing %s: %w", configFile, err)
+		}
+	}
+
+	if err := applyEnv(&config); err != nil {
+		return config, err
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "url":
+			config.Broker.Url = fromFlags.Broker.Url
+		case "client-id":
+			config.Broker.ClientId = fromFlags.Broker.ClientId
+		case "username":
+			config.Broker.Username = fromFlags.Broker.Username
+		case "password":
+			config.Broker.Password = fromFlags.Broker.Password
+		case "ca-file":
+			config.Broker.CaFile = fromFlags.Broker.CaFile
+		case "cert-file":
+			config.Broker.CertFile = fromFlags.Broker.CertFile
+		case "key-file":
+			config.Broker.KeyFile = fromFlags.Broker.KeyFile
+		case "insecure":
+			config.Broker.Insecure = fromFlags.Broker.Insecure
+		case "input":
+			config.Input = fromFlags.Input
+		case "format":
+			config.Format = fromFlags.Format
+		case "gateway":
+			config.Gateway = fromFlags.Gateway
+		case "topic-prefix":
+			config.TopicPrefix = fromFlags.TopicPrefix
+		case "discovery-prefix":
+			config.DiscoveryPrefix = fromFlags.DiscoveryPrefix
+		case "device-discovery":
+			config.DeviceDiscovery = fromFlags.DeviceDiscovery
+		case "change-only":
+			config.ChangeOnly = fromFlags.ChangeOnly
+		case "min-interval":
+			config.MinInterval = fromFlags.MinInterval
+		case "output":
+			config.Output = fromFlags.Output
+		case "metrics":
+			config.MetricsAddress = fromFlags.MetricsAddress
+		case "heartbeat":
+			config.HeartbeatInterval = fromFlags.HeartbeatInterval
+		case "state-file":
+			config.StateFile = fromFlags.StateFile
+		case "log-level":
+			config.LogLevel = fromFlags.LogLevel
+		case "quiet":
+			config.Quiet = fromFlags.Quiet
+		case "max-age":
+			config.MaxAge = fromFlags.MaxAge
+		case "tag-timeout":
+			config.TagTimeout = fromFlags.TagTimeout
+		}
+	})
+	return config, config.Validate()
+}
+
+// applyEnv overrides the configuration with the POWERTAG_* environment variables.
+func applyEnv(config *Config) error {
+	vars := map[string]*string{
+		"POWERTAG_MQTT_URL":         &config.Broker.Url,
+		"POWERTAG_MQTT_CLIENT_ID":   &config.Broker.ClientId,
+		"POWERTAG_MQTT_USERNAME":    &config.Broker.Username,
+		"POWERTAG_MQTT_PASSWORD":    &config.Broker.Password,
+		"POWERTAG_MQTT_CA_FILE":     &config.Broker.CaFile,
+		"POWERTAG_MQTT_CERT_FILE":   &config.Broker.CertFile,
+		"POWERTAG_MQTT_KEY_FILE":    &config.Broker.KeyFile,
+		"POWERTAG_INPUT":            &config.Input,
+		"POWERTAG_FORMAT":           &config.Format,
+		"POWERTAG_TOPIC_PREFIX":     &config.TopicPrefix,
+		"POWERTAG_DISCOVERY_PREFIX": &config.DiscoveryPrefix,
+		"POWERTAG_GATEWAY":          &config.Gateway,
+	}
+	for name, value := range vars {
+		if v, ok := os.LookupEnv(name); ok {
+			*value = v
+		}
+	}
+	if v, ok := os.LookupEnv("POWERTAG_MQTT_INSECURE"); ok {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid POWERTAG_MQTT_INSECURE: %w", err)
+		}
+		config.Broker.Insecure = insecure
+	}
+	return nil
+}
+
+func (config Config) Validate() error {
+	if config.TopicPrefix == "" || config.DiscoveryPrefix == "" {
+		return fmt.Errorf("the topic and discovery prefixes must not be empty")
+	}
+	if err := checkFormat(config.Format); err != nil {
+		return err
+	}
+	// The tags are checked every tenth of the timeout, never with a zero one
+	if config.TagTimeout < time.Second {
+		return fmt.Errorf("tag_timeout must be at least 1s, got %s", config.TagTimeout)
+	}
+	if err := checkOutput(config.Output); err != nil {
+		return err
+	}
+	if err := config.Influx.Validate(); err != nil {
+		return err
+	}
+	if err := config.Tariff.validate(); err != nil {
+		return err
+	}
+	if err := validateVirtualTags(config.VirtualTags); err != nil {
+		return err
+	}
+	for key, m := range config.Measures {
+		if err := m.validate(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package powertag2mqtt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateTagTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		timeout time.Duration
+		valid   bool
+	}{
+		{DefaultTagTimeout, true},
+		{time.Second, true},
+		{time.Millisecond, false},
+		{0, false},
+		{-time.Minute, false},
+	} {
+		config := DefaultConfig()
+		config.TagTimeout = tt.timeout
+		if err := config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("tag_timeout %s: Validate() = %v, want valid %v", tt.timeout, err, tt.valid)
+		}
+	}
+}
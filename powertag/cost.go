@@ -0,0 +1,141 @@
+package powertag2mqtt
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"energy-center/home-assistant"
+	"energy-center/tariff"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultTempoTopic is the topic of the Tempo color of the day published by teleinfo2mqtt.
+const DefaultTempoTopic = "teleinfo/STGE_tempo_today"
+
+// TariffConfig holds the electricity prices the daily cost of every circuit is
+// computed from. Costs are disabled when Option is empty.
+type TariffConfig struct {
+	tariff.Config `yaml:",inline"`
+	// TempoTopic is the topic the color of the day is read from, as published by teleinfo2mqtt.
+	TempoTopic string `yaml:"tempo_topic"`
+}
+
+func (c TariffConfig) enabled() bool {
+	return c.Option != ""
+}
+
+func (c TariffConfig) validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	return c.Config.Validate()
+}
+
+// costs accumulates the daily cost of every circuit from its energy index.
+type costs struct {
+	tariff     *tariff.Tariff
+	tempoTopic string
+
+	// lastEnergy, day and cost are only used by handleLine
+	lastEnergy map[string]float64
+	day        map[string]time.Time
+	cost       map[string]float64
+}
+
+// newCosts expects a validated configuration.
+func newCosts(config TariffConfig) *costs {
+	t, _ := tariff.New(config.Config)
+	if config.TempoTopic == "" {
+		config.TempoTopic = DefaultTempoTopic
+	}
+	return &costs{
+		tariff:     t,
+		tempoTopic: config.TempoTopic,
+		lastEnergy: map[string]float64{},
+		day:        map[string]time.Time{},
+		cost:       map[string]float64{},
+	}
+}
+
+// add accounts the energy consumed by a tag since its previous report and returns
+// the cost of the day. The energy index is in Wh.
+func (c *costs) add(id string, energy float64, at time.Time) float64 {
+	year, month, day := at.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, at.Location())
+	if !c.day[id].Equal(today) {
+		c.day[id] = today
+		c.cost[id] = 0
+	}
+	if last, known := c.lastEnergy[id]; known && energy >= last {
+		c.cost[id] += c.tariff.Cost(energy-last, at)
+	}
+	c.lastEnergy[id] = energy
+	return c.cost[id]
+}
+
+type costPayload struct {
+	Cost      float64 `json:"cost"`
+	LastReset string  `json:"last_reset"`
+}
+
+func (b *bridge) costTopic(id string) string {
+	return b.tagTopic(id) + "/cost"
+}
+
+// updateCost accounts the energy reported by a tag, publishing its cost of the day
+// unless the report is throttled.
+func (b *bridge) updateCost(id string, fields map[string]string, at time.Time, publish bool) {
+	raw, ok := fields["energy"]
+	if !ok {
+		return
+	}
+	energy, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return
+	}
+	cost := b.costs.add(id, energy, at)
+	if !publish {
+		return
+	}
+	payload, _ := json.Marshal(costPayload{
+		Cost:      math.Round(cost*100) / 100,
+		LastReset: b.costs.day[id].Format(time.RFC3339),
+	})
+	b.publish(b.costTopic(id), b.config.Publish.Instantaneous, payload)
+}
+
+// costConfigurationItem returns the discovery configuration of the cost sensor of a tag.
+func (b *bridge) costConfigurationItem(id string, device homeassistant.Device, availability []homeassistant.Availability) homeassistant.ConfigurationItem {
+	return homeassistant.ConfigurationItem{
+		Name:                      "Cost today",
+		UniqueId:                  objectId(id) + "_cost",
+		StateTopic:                b.costTopic(id),
+		ValueTemplate:             "{{ value_json.cost }}",
+		LastResetValueTemplate:    "{{ value_json.last_reset }}",
+		DeviceClass:               "monetary",
+		StateClass:                "total",
+		UnitOfMeasurement:         homeassistant.Unit(b.costs.tariff.Currency()),
+		Icon:                      "mdi:cash",
+		SuggestedDisplayPrecision: homeassistant.Precision(2),
+		Availability:              availability,
+		AvailabilityMode:          homeassistant.AvailabilityAll,
+		Device:                    device,
+	}
+}
+
+// listenTempo follows the Tempo color of the day published by teleinfo2mqtt.
+func (b *bridge) listenTempo() error {
+	if b.costs.tariff.Option() != tariff.OptionTempo {
+		return nil
+	}
+	return b.subscribe(b.costs.tempoTopic, func(client mqtt.Client, msg mqtt.Message) {
+		color := strings.ToLower(strings.TrimSpace(string(msg.Payload())))
+		if color != b.costs.tariff.Day() && b.costs.tariff.SetDay(color) {
+			log.Infof("tempo color of the day is %s", color)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package powertag2mqtt
+
+import (
+	"sort"
+	"strings"
+
+	"energy-center/home-assistant"
+	log "github.com/sirupsen/logrus"
+)
+
+type measure struct {
+	key         string
+	name        string
+	unit        homeassistant.Unit
+	deviceClass string
+	stateClass  string
+	diagnostic  bool
+}
+
+// measures are the measures announced to Home Assistant when a tag reports them.
+var measures = map[string]measure{}
+
+func init() {
+	for _, phase := range []string{"1", "2", "3"} {
+		declare(measure{"current_p" + phase, "Current phase " + phase, homeassistant.A, "current", "measurement", false})
+		declare(measure{"voltage_p" + phase, "Voltage phase " + phase, homeassistant.V, "voltage", "measurement", false})
+		declare(measure{"power_p" + phase, "Power phase " + phase, homeassistant.W, "power", "measurement", false})
+	}
+	declare(measure{"power", "Power", homeassistant.W, "power", "measurement", false})
+	declare(measure{"energy", "Energy", homeassistant.Wh, "energy", "total_increasing", false})
+
+	// Link quality and alarms, when powertagd reports them
+	declare(measure{"rssi", "RSSI", homeassistant.DBm, "signal_strength", "measurement", true})
+	declare(measure{"lqi", "Link quality", "", "", "measurement", true})
+}
+
+func declare(m measure) {
+	measures[m.key] = m
+}
+
+// lookupMeasure returns the description of a measure. Alarm fields, whose names
+// depend on the tag model, are announced as diagnostic text sensors.
+func lookupMeasure(key string) (measure, bool) {
+	if m, known := measures[key]; known {
+		return m, true
+	}
+	if strings.HasPrefix(key, "alarm") {
+		name := strings.ToUpper(key[:1]) + strings.Replace(key[1:], "_", " ", -1)
+		return measure{key: key, name: name, diagnostic: true}, true
+	}
+	return measure{}, false
+}
+
+const Manufacturer = "Schneider Electric"
+
+// objectId returns the prefix of the Home Assistant identifiers of a tag,
+// e.g. powertag2mqtt_0x42 or powertag2mqtt_garage_0x42 for a tag of the garage gateway.
+func objectId(id string) string {
+	return ProgNameMqtt + "_" + strings.Replace(id, "/", "_", -1)
+}
+
+// discoveryOptions returns the settings of the publication of the discovery configuration.
+func (b *bridge) discoveryOptions() homeassistant.Options {
+	return homeassistant.Options{
+		Prefix: b.config.DiscoveryPrefix,
+		Origin: homeassistant.NewOrigin(ProgNameMqtt, Version),
+	}
+}
+
+// gatewayDevice is the device of the bridge, which the tags are reached through.
+func (b *bridge) gatewayDevice() homeassistant.Device {
+	return homeassistant.Device{
+		Identifiers: []string{b.config.Broker.ClientId},
+		Name:        "PowerTag gateway",
+		Model:       ProgNameMqtt,
+	}
+}
+
+// gatewayConfigurationItem returns the discovery configuration of the status of the bridge.
+// It has no availability as it reports it.
+func (b *bridge) gatewayConfigurationItem() homeassistant.ConfigurationItem {
+	return homeassistant.ConfigurationItem{
+		Name:           "Status",
+		UniqueId:       b.config.Broker.ClientId + "_status",
+		StateTopic:     b.availabilityTopic(),
+		EntityCategory: homeassistant.Diagnostic,
+		Device:         b.gatewayDevice(),
+	}
+}
+
+// configurationItems returns the discovery configuration of the given measures of a tag.
+// Unknown measures are ignored. It must be called with b.mu held.
+func (b *bridge) configurationItems(id string, keys []string) []homeassistant.ConfigurationItem {
+	device := homeassistant.Device{
+		Identifiers: []string{objectId(id)},
+		Name:        objectId(id),
+		ViaDevice:   b.config.Broker.ClientId,
+	}
+	if _, virtual := b.config.VirtualTags[id]; virtual {
+		device.Model = "Virtual tag"
+	} else {
+		device.Manufacturer = Manufacturer
+		device.Model = b.models[id]
+	}
+	// Home Assistant prefixes entity names with the device name,
+	// e.g. "Kitchen oven Power"
+	if tag, ok := b.config.Tags[id]; ok {
+		if tag.Name != "" {
+			device.Name = tag.Name
+		}
+		device.SuggestedArea = tag.Area
+	}
+	availability := []homeassistant.Availability{
+		homeassistant.LastWill(b.availabilityTopic()),
+		homeassistant.LastWill(b.tagAvailabilityTopic(id)),
+	}
+	var items []homeassistant.ConfigurationItem
+	for _, key := range keys {
+		m, known := lookupMeasure(key)
+		if !known {
+			continue
+		}
+		item := homeassistant.ConfigurationItem{
+			Name:              m.name,
+			UniqueId:          objectId(id) + "_" + m.key,
+			StateTopic:        b.tagTopic(id) + "/" + m.key,
+			DeviceClass:       m.deviceClass,
+			StateClass:        m.stateClass,
+			UnitOfMeasurement: b.unit(m),
+			Availability:      availability,
+			AvailabilityMode:  homeassistant.AvailabilityAll,
+			Device:            device,
+		}
+		if m.diagnostic {
+			item.EntityCategory = homeassistant.Diagnostic
+		}
+		if c, ok := b.config.Measures[m.key]; ok && c.Precision != nil {
+			item.SuggestedDisplayPrecision = c.Precision
+		}
+		if !b.publishesPerKey() {
+			item.StateTopic = b.tagTopic(id)
+			item.ValueTemplate = "{{ value_json." + m.key + " }}"
+		}
+		// The JSON payload of the tag, with its timestamp and link quality,
+		// is attached to the power sensor
+		if key == "power" && b.publishesJson() {
+			item.JsonAttributesTopic = b.tagTopic(id)
+		}
+		items = append(items, item)
+		if key == "energy" && b.costs != nil {
+			items = append(items, b.costConfigurationItem(id, device, availability))
+		}
+	}
+	return items
+}
+
+// listenHaStatus republishes the configuration of every known tag when Home
+// Assistant announces it is online, as it may have lost them while restarting.
+func (b *bridge) listenHaStatus() {
+	homeassistant.OnHaOnline(b.client, b.discoveryOptions(), func() {
+		log.Info("Home Assistant is online, republishing discovery")
+		b.publishDiscovery()
+	})
+}
+
+// publishDiscovery publishes the configuration of the gateway and of every known tag.
+func (b *bridge) publishDiscovery() {
+	if _, err := homeassistant.SendConfigurationToHa(b.client, b.discoveryOptions(), []homeassistant.ConfigurationItem{b.gatewayConfigurationItem()}); err != nil {
+		log.Errorf("error publishing the discovery configuration of the gateway: %s", err)
+	}
+	var configurations []tagConfiguration
+	b.mu.Lock()
+	for id := range b.powertagConfigSent {
+		configurations = append(configurations, b.tagConfiguration(id, b.sentKeys(id)))
+	}
+	if len(b.removedTags) > 0 {
+		for id, keys := range b.removedTags {
+			log.Infof("removing the discovery configuration of filtered out tag %s", id)
+			configurations = append(configurations, tagConfiguration{id: id, items: b.configurationItems(id, keys), remove: true})
+		}
+		b.removedTags = map[string][]string{}
+		b.saveRegistry()
+	}
+	b.mu.Unlock()
+	b.sendTagConfigurations(configurations...)
+}
+
+// sentKeys returns the measures of a tag announced to Home Assistant.
+// It must be called with b.mu held.
+func (b *bridge) sentKeys(id string) []string {
+	var keys []string
+	for key := range b.powertagConfigSent[id] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tagConfiguration is the discovery configuration of a tag, built with b.mu held
+// and sent once it is released, as sending waits for the broker.
+type tagConfiguration struct {
+	id    string
+	items []homeassistant.ConfigurationItem
+	// remove deletes the tag from Home Assistant, whichever the discovery mode it
+	// was announced with.
+	remove bool
+}
+
+// tagConfiguration returns the configuration announcing the given measures of a
+// tag. A device-based payload lists every measure announced so far, as it
+// replaces the previous one. It must be called with b.mu held.
+func (b *bridge) tagConfiguration(id string, keys []string) tagConfiguration {
+	if b.config.DeviceDiscovery {
+		keys = b.sentKeys(id)
+	}
+	return tagConfiguration{id: id, items: b.configurationItems(id, keys)}
+}
+
+// sendTagConfigurations publishes discovery configurations. It must be called
+// without b.mu held, the lines and the tag availability not waiting for the broker.
+func (b *bridge) sendTagConfigurations(configurations ...tagConfiguration) {
+	for _, c := range configurations {
+		var err error
+		switch {
+		case c.remove:
+			homeassistant.RemoveConfigurationFromHa(b.client, b.discoveryOptions(), c.items)
+			homeassistant.RemoveDeviceConfigurationFromHa(b.client, b.discoveryOptions(), objectId(c.id))
+		case b.config.DeviceDiscovery:
+			err = homeassistant.SendDeviceConfigurationToHa(b.client, b.discoveryOptions(), objectId(c.id), c.items)
+		default:
+			_, err = homeassistant.SendConfigurationToHa(b.client, b.discoveryOptions(), c.items)
+		}
+		if err != nil {
+			log.Errorf("error publishing the discovery configuration of %s: %s", c.id, err)
+		}
+	}
+}
@@ -3,11 +3,25 @@ module powertag2mqtt
 go 1.17
 
 require (
+	energy-center/home-assistant v0.0.0
+	energy-center/influx v0.0.0
+	energy-center/mqttclient v0.0.0
+	energy-center/tariff v0.0.0
 	github.com/eclipse/paho.mqtt.golang v1.4.2
+	github.com/sirupsen/logrus v1.9.3
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/gorilla/websocket v1.4.2 // indirect
 	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+)
+
+replace (
+	energy-center/home-assistant => ../home-assistant
+	energy-center/influx => ../influx
+	energy-center/mqttclient => ../mqttclient
+	energy-center/tariff => ../tariff
 )
@@ -0,0 +1,73 @@
+package powertag2mqtt
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const DefaultHeartbeatInterval = 1 * time.Minute
+
+// HealthReport is the body of the health endpoint and of the heartbeat messages.
+type HealthReport struct {
+	Healthy       bool    `json:"healthy"`
+	MqttConnected bool    `json:"mqtt_connected"`
+	LinesParsed   uint64  `json:"lines_parsed"`
+	ParseErrors   uint64  `json:"parse_errors"`
+	LastLineAge   float64 `json:"last_line_age_seconds"`
+	TagsOnline    int     `json:"tags_online"`
+	Time          string  `json:"time"`
+}
+
+// health reports the state of the powertagd → bridge → broker chain. It is healthy
+// when the broker is connected and a line was received within the tag timeout.
+func (b *bridge) health() HealthReport {
+	report := HealthReport{
+		MqttConnected: b.client.IsConnectionOpen(),
+		LastLineAge:   -1,
+		Time:          time.Now().UTC().Format(time.RFC3339),
+	}
+	report.LinesParsed = atomic.LoadUint64(&stats.linesParsed)
+	report.ParseErrors = atomic.LoadUint64(&stats.parseErrors)
+	stats.mu.Lock()
+	if !stats.lastLine.IsZero() {
+		report.LastLineAge = time.Since(stats.lastLine).Seconds()
+	}
+	stats.mu.Unlock()
+	b.mu.Lock()
+	for _, online := range b.online {
+		if online {
+			report.TagsOnline++
+		}
+	}
+	b.mu.Unlock()
+	report.Healthy = report.MqttConnected && report.LastLineAge >= 0 && report.LastLineAge < b.config.TagTimeout.Seconds()
+	return report
+}
+
+func (b *bridge) heartbeatTopic() string {
+	return b.config.TopicPrefix + "/heartbeat"
+}
+
+// heartbeat periodically publishes the health report.
+func (b *bridge) heartbeat() {
+	for range time.Tick(b.config.HeartbeatInterval) {
+		payload, _ := json.Marshal(b.health())
+		b.client.Publish(b.heartbeatTopic(), 0, false, payload)
+	}
+}
+
+// serveHealth answers the health report, with a 503 status when unhealthy.
+func (b *bridge) serveHealth(w http.ResponseWriter, r *http.Request) {
+	report := b.health()
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Debugf("error writing health report: %s", err)
+	}
+}
@@ -0,0 +1,15 @@
+package powertag2mqtt
+
+import (
+	"time"
+
+	"energy-center/influx"
+)
+
+// InfluxConfig configures the optional InfluxDB output, written by batches of
+// BatchSize lines, and every FlushInterval.
+type InfluxConfig struct {
+	influx.Config `yaml:",inline"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
@@ -0,0 +1,145 @@
+package powertag2mqtt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	tcpInput  = "tcp://"
+	udpInput  = "udp://"
+	mqttInput = "mqtt://"
+)
+
+// MqttInputQueueSize bounds the payloads of a MQTT input waiting for the bridge.
+const MqttInputQueueSize = 1000
+
+// Formats of the powertagd lines. Auto accepts both, JSON lines starting with '{'.
+const (
+	FormatAuto = "auto"
+	FormatLine = "line"
+	FormatJson = "json"
+)
+
+func checkFormat(format string) error {
+	switch format {
+	case FormatAuto, FormatLine, FormatJson:
+		return nil
+	}
+	return fmt.Errorf("unsupported format '%s', expected auto, line or json", format)
+}
+
+func isJsonLine(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " \t"), "{")
+}
+
+// checkInput validates the -input flag before anything is started.
+func checkInput(input string) error {
+	switch {
+	case input == "stdin":
+		stat, _ := os.Stdin.Stat()
+		if stat.Mode()&os.ModeCharDevice != 0 {
+			return fmt.Errorf("no data on stdin")
+		}
+	case strings.HasPrefix(input, tcpInput), strings.HasPrefix(input, udpInput), strings.HasPrefix(input, mqttInput):
+	default:
+		return fmt.Errorf("unsupported input '%s'", input)
+	}
+	return nil
+}
+
+// startInput reads powertagd lines from the configured input and sends them to lines.
+// The channel is closed when a stdin input reaches end of file or fails, b.inputErr
+// holding the error.
+func startInput(input string, b *bridge, lines chan<- string) error {
+	switch {
+	case input == "stdin":
+		go func() {
+			b.inputErr = scanLines(os.Stdin, lines)
+			close(lines)
+		}()
+	case strings.HasPrefix(input, tcpInput):
+		listener, err := net.Listen("tcp", strings.TrimPrefix(input, tcpInput))
+		if err != nil {
+			return err
+		}
+		go acceptTcp(listener, lines)
+	case strings.HasPrefix(input, udpInput):
+		conn, err := net.ListenPacket("udp", strings.TrimPrefix(input, udpInput))
+		if err != nil {
+			return err
+		}
+		go readUdp(conn, lines)
+	case strings.HasPrefix(input, mqttInput):
+		topic := strings.TrimPrefix(input, mqttInput)
+		// The paho router must not wait for the bridge, which publishes on the same
+		// client: the payloads are queued, and dropped when the queue is full
+		payloads := make(chan string, MqttInputQueueSize)
+		go func() {
+			for payload := range payloads {
+				splitLines(payload, lines)
+			}
+		}()
+		return b.subscribe(topic, func(client mqtt.Client, msg mqtt.Message) {
+			select {
+			case payloads <- string(msg.Payload()):
+			default:
+				log.Warnf("input queue full, dropping a message of %s", msg.Topic())
+			}
+		})
+	}
+	return nil
+}
+
+func scanLines(r io.Reader, lines chan<- string) error {
+	lnscan := bufio.NewScanner(r)
+	for lnscan.Scan() {
+		lines <- lnscan.Text()
+	}
+	return lnscan.Err()
+}
+
+func splitLines(payload string, lines chan<- string) {
+	for _, line := range strings.Split(payload, "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			lines <- line
+		}
+	}
+}
+
+func acceptTcp(listener net.Listener, lines chan<- string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Errorf("error accepting connection: %s", err)
+			continue
+		}
+		log.Infof("powertagd connected from %s", conn.RemoteAddr())
+		go func() {
+			defer conn.Close()
+			if err := scanLines(conn, lines); err != nil {
+				log.Warnf("error reading from %s: %s", conn.RemoteAddr(), err)
+			}
+			log.Infof("powertagd disconnected from %s", conn.RemoteAddr())
+		}()
+	}
+}
+
+func readUdp(conn net.PacketConn, lines chan<- string) {
+	buffer := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			log.Errorf("error reading datagram: %s", err)
+			continue
+		}
+		splitLines(string(buffer[:n]), lines)
+	}
+}
@@ -0,0 +1,46 @@
+package powertag2mqtt
+
+import (
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// inputMessage is a message received on the input topic.
+type inputMessage struct {
+	mqtt.Message
+	topic, payload string
+}
+
+func (m inputMessage) Topic() string   { return m.topic }
+func (m inputMessage) Payload() []byte { return []byte(m.payload) }
+
+func TestMqttInputDoesNotBlock(t *testing.T) {
+	client := &mockClient{}
+	b := newBridge(client, DefaultConfig())
+	lines := make(chan string)
+	if err := startInput("mqtt://powertagd/lines", b, lines); err != nil {
+		t.Fatal(err)
+	}
+	handler := client.handlers["powertagd/lines"]
+
+	// The bridge reads no line while the callbacks run, as when it waits for the broker
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < MqttInputQueueSize+10; i++ {
+			handler(client, inputMessage{topic: "powertagd/lines", payload: "power,id=0x42 value=1\npower,id=0x43 value=2"})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the MQTT callback waits for the bridge")
+	}
+	for _, want := range []string{"power,id=0x42 value=1", "power,id=0x43 value=2"} {
+		if line := <-lines; line != want {
+			t.Errorf("line = %q, want %q", line, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package jsonformat parses the JSON lines written by the newer powertagd builds,
+// one object per line. Both a flat object and an object holding the tags and
+// fields apart are accepted:
+//
+//	{"id":"0x42","type":"A9MEM1540","power":12,"energy":123456,"timestamp":1676400000}
+//	{"measurement":"powertag","tags":{"id":"0x42"},"fields":{"power":12},"timestamp":1676400000}
+//
+// In a flat object, id, type and gateway are tags and the other members are fields.
+package jsonformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"powertag2mqtt/lineprotocol"
+)
+
+// flatTags are the members of a flat object which are tags.
+var flatTags = map[string]bool{"id": true, "type": true, "gateway": true}
+
+// Parse parses a single JSON line. As for the line protocol, field values are
+// returned as strings, numbers keeping the text they were written with.
+func Parse(line string) (lineprotocol.Point, error) {
+	point := lineprotocol.Point{Measurement: "powertag", Tags: map[string]string{}, Fields: map[string]string{}}
+	decoder := json.NewDecoder(bytes.NewBufferString(line))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return point, err
+	}
+
+	if m, ok := object["measurement"]; ok {
+		if point.Measurement, ok = m.(string); !ok {
+			return point, fmt.Errorf("measurement is not a string")
+		}
+		delete(object, "measurement")
+	}
+	if ts, ok := object["timestamp"]; ok {
+		number, ok := ts.(json.Number)
+		if !ok {
+			return point, fmt.Errorf("timestamp is not a number")
+		}
+		var err error
+		if point.Timestamp, err = strconv.ParseInt(number.String(), 10, 64); err != nil {
+			return point, fmt.Errorf("invalid timestamp '%s'", number)
+		}
+		delete(object, "timestamp")
+	}
+
+	tags, fields := map[string]interface{}{}, object
+	if f, structured := object["fields"]; structured {
+		var ok bool
+		if fields, ok = f.(map[string]interface{}); !ok {
+			return point, fmt.Errorf("fields is not an object")
+		}
+		if t, exist := object["tags"]; exist {
+			if tags, ok = t.(map[string]interface{}); !ok {
+				return point, fmt.Errorf("tags is not an object")
+			}
+		}
+	} else {
+		for key := range flatTags {
+			if v, exist := object[key]; exist {
+				tags[key] = v
+				delete(object, key)
+			}
+		}
+	}
+
+	for key, v := range tags {
+		value, ok := v.(string)
+		if !ok {
+			return point, fmt.Errorf("tag '%s' is not a string", key)
+		}
+		point.Tags[key] = value
+	}
+	for key, v := range fields {
+		value, err := fieldValue(v)
+		if err != nil {
+			return point, fmt.Errorf("invalid field '%s': %w", key, err)
+		}
+		point.Fields[key] = value
+	}
+	if len(point.Fields) == 0 {
+		return point, fmt.Errorf("no fields")
+	}
+	return point, nil
+}
+
+func fieldValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case json.Number:
+		return value.String(), nil
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
@@ -0,0 +1,62 @@
+package jsonformat
+
+import (
+	"reflect"
+	"testing"
+
+	"powertag2mqtt/lineprotocol"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want lineprotocol.Point
+	}{
+		{
+			name: "flat",
+			line: `{"id":"0x42","type":"A9MEM1540","power":12,"current_p1":0.6,"alarm":"none","timestamp":1676400000}`,
+			want: lineprotocol.Point{
+				Measurement: "powertag",
+				Tags:        map[string]string{"id": "0x42", "type": "A9MEM1540"},
+				Fields:      map[string]string{"power": "12", "current_p1": "0.6", "alarm": "none"},
+				Timestamp:   1676400000,
+			},
+		},
+		{
+			name: "structured",
+			line: `{"measurement":"powertag","tags":{"id":"0x42"},"fields":{"power":12.0,"ok":true}}`,
+			want: lineprotocol.Point{
+				Measurement: "powertag",
+				Tags:        map[string]string{"id": "0x42"},
+				Fields:      map[string]string{"power": "12.0", "ok": "true"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", tt.line, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, line := range []string{
+		`{"id":"0x42"`,
+		`{"id":"0x42"}`,
+		`{"id":42,"power":12}`,
+		`{"id":"0x42","power":12,"timestamp":"yesterday"}`,
+		`{"id":"0x42","power":[12]}`,
+		`{"tags":{"id":"0x42"},"fields":12}`,
+	} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) returned no error", line)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Package lineprotocol parses the InfluxDB line protocol written by powertagd.
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+// https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/
+package lineprotocol
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is a parsed line.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	// Fields holds the field values as strings: quotes of string values and
+	// type suffixes of integers are removed.
+	Fields map[string]string
+	// Timestamp is the raw timestamp of the line, 0 when the line has none.
+	Timestamp int64
+}
+
+// Time returns the timestamp of the point, false when the line has none.
+// The precision of the timestamp (s, ms, µs or ns) is guessed from its magnitude.
+func (p Point) Time() (time.Time, bool) {
+	ts := p.Timestamp
+	switch {
+	case ts == 0:
+		return time.Time{}, false
+	case ts < 1e11:
+		return time.Unix(ts, 0), true
+	case ts < 1e14:
+		return time.UnixMilli(ts), true
+	case ts < 1e17:
+		return time.UnixMicro(ts), true
+	}
+	return time.Unix(0, ts), true
+}
+
+// Parse parses a single line.
+func Parse(line string) (Point, error) {
+	p := parser{line: strings.TrimRight(line, "\r\n")}
+	point := Point{Tags: map[string]string{}, Fields: map[string]string{}}
+
+	var err error
+	if point.Measurement, err = p.measurement(); err != nil {
+		return point, err
+	}
+	for p.peek() == ',' {
+		p.pos++
+		key, value, err := p.pair(true)
+		if err != nil {
+			return point, fmt.Errorf("invalid tag: %w", err)
+		}
+		point.Tags[key] = value
+	}
+	if p.peek() != ' ' {
+		return point, p.errorf("expected a space before fields")
+	}
+	p.skipSpaces()
+	for {
+		key, value, err := p.pair(false)
+		if err != nil {
+			return point, fmt.Errorf("invalid field: %w", err)
+		}
+		point.Fields[key] = value
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	p.skipSpaces()
+	if p.done() {
+		return point, nil
+	}
+	ts := p.line[p.pos:]
+	if point.Timestamp, err = strconv.ParseInt(ts, 10, 64); err != nil {
+		return point, p.errorf("invalid timestamp '%s'", ts)
+	}
+	return point, nil
+}
+
+type parser struct {
+	line string
+	pos  int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.line)
+}
+
+func (p *parser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.line[p.pos]
+}
+
+func (p *parser) skipSpaces() {
+	for p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%s at column %d", fmt.Sprintf(format, a...), p.pos+1)
+}
+
+// token reads until an unescaped delimiter, unescaping backslash sequences.
+func (p *parser) token(delimiters string) string {
+	var b strings.Builder
+	for !p.done() {
+		c := p.line[p.pos]
+		if c == '\\' && p.pos+1 < len(p.line) && strings.IndexByte(delimiters+"\\", p.line[p.pos+1]) >= 0 {
+			b.WriteByte(p.line[p.pos+1])
+			p.pos += 2
+			continue
+		}
+		if strings.IndexByte(delimiters, c) >= 0 {
+			break
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	return b.String()
+}
+
+func (p *parser) measurement() (string, error) {
+	m := p.token(", ")
+	if m == "" {
+		return "", p.errorf("missing measurement")
+	}
+	return m, nil
+}
+
+// pair reads a key=value pair of a tag set or a field set.
+func (p *parser) pair(tag bool) (string, string, error) {
+	key := p.token(",= ")
+	if key == "" {
+		return "", "", p.errorf("missing key")
+	}
+	if p.peek() != '=' {
+		return "", "", p.errorf("missing '=' after key '%s'", key)
+	}
+	p.pos++
+	if tag {
+		value := p.token(",= ")
+		if value == "" {
+			return "", "", p.errorf("missing value of tag '%s'", key)
+		}
+		return key, value, nil
+	}
+	value, err := p.fieldValue()
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+func (p *parser) fieldValue() (string, error) {
+	if p.peek() == '"' {
+		return p.stringValue()
+	}
+	start := p.pos
+	value := p.token(", ")
+	switch {
+	case value == "":
+		return "", p.errorf("missing field value")
+	case isBoolean(value):
+		return value, nil
+	}
+	var err error
+	number := value[:len(value)-1]
+	switch value[len(value)-1] {
+	case 'i':
+		_, err = strconv.ParseInt(number, 10, 64)
+	case 'u':
+		_, err = strconv.ParseUint(number, 10, 64)
+	default:
+		number = value
+		_, err = strconv.ParseFloat(number, 64)
+	}
+	if err != nil {
+		p.pos = start
+		return "", p.errorf("invalid field value '%s'", value)
+	}
+	return number, nil
+}
+
+func (p *parser) stringValue() (string, error) {
+	start := p.pos
+	p.pos++
+	var b strings.Builder
+	for !p.done() {
+		c := p.line[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.line) && (p.line[p.pos+1] == '"' || p.line[p.pos+1] == '\\'):
+			b.WriteByte(p.line[p.pos+1])
+			p.pos += 2
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	p.pos = start
+	return "", p.errorf("unterminated string value")
+}
+
+func isBoolean(v string) bool {
+	switch v {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return true
+	}
+	return false
+}
+
+// String formats the point as a line. Integer field values are written as
+// integers, other numbers as floats, booleans as is and the rest as strings.
+func (p Point) String() string {
+	var b strings.Builder
+	b.WriteString(escape(p.Measurement, ", "))
+	for _, key := range sortedKeys(p.Tags) {
+		b.WriteString("," + escape(key, ",= ") + "=" + escape(p.Tags[key], ",= "))
+	}
+	for i, key := range sortedKeys(p.Fields) {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(escape(key, ",= ") + "=" + formatField(p.Fields[key]))
+	}
+	if p.Timestamp != 0 {
+		b.WriteString(" " + strconv.FormatInt(p.Timestamp, 10))
+	}
+	return b.String()
+}
+
+func formatField(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return value + "i"
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil || isBoolean(value) {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func escape(s string, special string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(special+"\\", s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,128 @@
+package lineprotocol
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want Point
+	}{
+		{
+			name: "single phase",
+			line: "powertag,id=0x1234abcd current_p1=0.6,voltage_p1=231.5,power_p1=120i,energy=123456i 1676400000000000000",
+			want: Point{
+				Measurement: "powertag",
+				Tags:        map[string]string{"id": "0x1234abcd"},
+				Fields:      map[string]string{"current_p1": "0.6", "voltage_p1": "231.5", "power_p1": "120", "energy": "123456"},
+				Timestamp:   1676400000000000000,
+			},
+		},
+		{
+			name: "three phase",
+			line: "powertag,id=0x42,type=A9MEM1540 power_p1=10i,power_p2=20i,power_p3=-30i 1676400000000000000",
+			want: Point{
+				Measurement: "powertag",
+				Tags:        map[string]string{"id": "0x42", "type": "A9MEM1540"},
+				Fields:      map[string]string{"power_p1": "10", "power_p2": "20", "power_p3": "-30"},
+				Timestamp:   1676400000000000000,
+			},
+		},
+		{
+			name: "without timestamp",
+			line: "powertag,id=0x42 power=12.5\r\n",
+			want: Point{
+				Measurement: "powertag",
+				Tags:        map[string]string{"id": "0x42"},
+				Fields:      map[string]string{"power": "12.5"},
+			},
+		},
+		{
+			name: "escaped characters",
+			line: `powertag,id=0x42,name=Kitchen\ oven\,\ left\=1 state="on \"duty\"",ok=true,count=3u`,
+			want: Point{
+				Measurement: "powertag",
+				Tags:        map[string]string{"id": "0x42", "name": "Kitchen oven, left=1"},
+				Fields:      map[string]string{"state": `on "duty"`, "ok": "true", "count": "3"},
+			},
+		},
+		{
+			name: "no tags",
+			line: "gateway rssi=-70i",
+			want: Point{
+				Measurement: "gateway",
+				Tags:        map[string]string{},
+				Fields:      map[string]string{"rssi": "-70"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", tt.line, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		err  string
+	}{
+		{"", "missing measurement"},
+		{"powertag,id=0x42", "expected a space before fields"},
+		{"powertag,id power=1", "missing '=' after key 'id'"},
+		{"powertag,id= power=1", "missing value of tag 'id'"},
+		{"powertag,id=0x42 power", "missing '=' after key 'power'"},
+		{"powertag,id=0x42 power=", "missing field value"},
+		{"powertag,id=0x42 power=abc", "invalid field value 'abc'"},
+		{"powertag,id=0x42 power=1.5i", "invalid field value '1.5i'"},
+		{`powertag,id=0x42 state="on`, "unterminated string value"},
+		{"powertag,id=0x42 power=1 yesterday", "invalid timestamp 'yesterday'"},
+		{"powertag,id=0x42 =1", "missing key"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.line)
+		if err == nil {
+			t.Errorf("Parse(%q) returned no error, want %q", tt.line, tt.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%q) returned error %q, want %q", tt.line, err, tt.err)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	want := time.Date(2023, 2, 14, 18, 40, 0, 0, time.UTC)
+	for _, ts := range []int64{want.Unix(), want.UnixMilli(), want.UnixMicro(), want.UnixNano()} {
+		got, ok := Point{Timestamp: ts}.Time()
+		if !ok || !got.Equal(want) {
+			t.Errorf("Point{Timestamp: %d}.Time() = %s, %t, want %s", ts, got, ok, want)
+		}
+	}
+	if _, ok := (Point{}).Time(); ok {
+		t.Errorf("Point{}.Time() returned a timestamp")
+	}
+}
+
+func TestString(t *testing.T) {
+	line := `powertag,id=0x42,name=Kitchen\ oven alarm="low \"voltage\"",current_p1=0.6,ok=true,power=12i 1676400000000000000`
+	point, err := Parse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := point.String(); got != line {
+		t.Errorf("String() = %s, want %s", got, line)
+	}
+}
@@ -0,0 +1,34 @@
+package powertag2mqtt
+
+import (
+	stdlog "log"
+	"os"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+// setupLogging configures the leveled logger and routes the mqtt library logs to it.
+// Quiet mode only keeps warnings and errors, without timestamps as the supervisor
+// (e.g. systemd) already adds them.
+func setupLogging(level string, quiet bool) error {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if quiet && lvl > log.WarnLevel {
+		lvl = log.WarnLevel
+	}
+	log.SetLevel(lvl)
+	log.SetOutput(os.Stderr)
+	log.SetFormatter(&log.TextFormatter{DisableTimestamp: quiet})
+
+	mqtt.ERROR = stdlog.New(log.StandardLogger().WriterLevel(log.ErrorLevel), "", 0)
+	mqtt.CRITICAL = stdlog.New(log.StandardLogger().WriterLevel(log.ErrorLevel), "", 0)
+	mqtt.WARN = stdlog.New(log.StandardLogger().WriterLevel(log.WarnLevel), "", 0)
+	// The mqtt library debug logs are very verbose, only enable them at trace level
+	if lvl >= log.TraceLevel {
+		mqtt.DEBUG = stdlog.New(log.StandardLogger().WriterLevel(log.TraceLevel), "", 0)
+	}
+	return nil
+}
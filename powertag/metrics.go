@@ -0,0 +1,75 @@
+package powertag2mqtt
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metrics are the bridge counters exposed in the Prometheus text format.
+type metrics struct {
+	linesParsed uint64
+	parseErrors uint64
+	publishes   uint64
+
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+	lastLine time.Time
+}
+
+var stats = metrics{lastSeen: map[string]time.Time{}}
+
+func (m *metrics) lineParsed() {
+	atomic.AddUint64(&m.linesParsed, 1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastLine = time.Now()
+}
+
+func (m *metrics) parseError() {
+	atomic.AddUint64(&m.parseErrors, 1)
+}
+
+func (m *metrics) published() {
+	atomic.AddUint64(&m.publishes, 1)
+}
+
+func (m *metrics) tagSeen(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSeen[id] = time.Now()
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	counter := func(name, help string, value uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	counter("powertag_lines_parsed_total", "Lines parsed successfully.", atomic.LoadUint64(&m.linesParsed))
+	counter("powertag_parse_errors_total", "Lines which could not be parsed.", atomic.LoadUint64(&m.parseErrors))
+	counter("powertag_publishes_total", "MQTT messages published.", atomic.LoadUint64(&m.publishes))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]string, 0, len(m.lastSeen))
+	for id := range m.lastSeen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	fmt.Fprintf(w, "# HELP powertag_tags_seen Tags which reported since the bridge started.\n# TYPE powertag_tags_seen gauge\npowertag_tags_seen %d\n", len(ids))
+	fmt.Fprintf(w, "# HELP powertag_last_seen_timestamp_seconds Time of the last report of a tag.\n# TYPE powertag_last_seen_timestamp_seconds gauge\n")
+	for _, id := range ids {
+		fmt.Fprintf(w, "powertag_last_seen_timestamp_seconds{id=%q} %d\n", id, m.lastSeen[id].Unix())
+	}
+}
+
+// serveMetrics exposes the metrics on /metrics and the health report on /health.
+func (b *bridge) serveMetrics(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", &stats)
+	mux.HandleFunc("/health", b.serveHealth)
+	return http.ListenAndServe(address, mux)
+}
@@ -0,0 +1,72 @@
+package powertag2mqtt
+
+import (
+	"fmt"
+	"strconv"
+
+	"energy-center/home-assistant"
+)
+
+// MeasureConfig holds the rounding and unit conversion of a measure.
+type MeasureConfig struct {
+	// Precision is the number of decimals kept, values are not rounded when unset.
+	Precision *int `yaml:"precision"`
+	// Unit converts powers to W or kW and energies to Wh or kWh.
+	Unit string `yaml:"unit"`
+}
+
+// scales of the units a measure may be converted to, relative to the unit reported by powertagd
+var scales = map[homeassistant.Unit]map[homeassistant.Unit]float64{
+	homeassistant.W:  {homeassistant.W: 1, homeassistant.KW: 0.001},
+	homeassistant.Wh: {homeassistant.Wh: 1, homeassistant.KWh: 0.001},
+}
+
+func (c MeasureConfig) validate(key string) error {
+	if c.Unit == "" {
+		return nil
+	}
+	m, known := measures[key]
+	if !known {
+		return fmt.Errorf("unit conversion of unknown measure %s", key)
+	}
+	if _, ok := scales[m.unit][homeassistant.Unit(c.Unit)]; !ok {
+		return fmt.Errorf("measure %s in %s cannot be converted to %s", key, m.unit, c.Unit)
+	}
+	return nil
+}
+
+// unit returns the unit the measure is published in.
+func (b *bridge) unit(m measure) homeassistant.Unit {
+	if c, ok := b.config.Measures[m.key]; ok && c.Unit != "" {
+		return homeassistant.Unit(c.Unit)
+	}
+	return m.unit
+}
+
+// normalize rounds and converts the measures as configured.
+func (b *bridge) normalize(values map[string]string) map[string]string {
+	if len(b.config.Measures) == 0 {
+		return values
+	}
+	normalized := make(map[string]string, len(values))
+	for k, v := range values {
+		normalized[k] = v
+		c, ok := b.config.Measures[k]
+		if !ok {
+			continue
+		}
+		num, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			continue
+		}
+		if c.Unit != "" {
+			num *= scales[measures[k].unit][homeassistant.Unit(c.Unit)]
+		}
+		precision := -1
+		if c.Precision != nil {
+			precision = *c.Precision
+		}
+		normalized[k] = strconv.FormatFloat(num, 'f', precision, 64)
+	}
+	return normalized
+}
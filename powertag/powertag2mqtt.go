@@ -1,78 +1,69 @@
-package main
+package powertag2mqtt
 
 import (
-	"bufio"
-	"encoding/json"
-	"flag"
+	"energy-center/home-assistant"
+	"energy-center/mqttclient"
 	"fmt"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
-	"log"
+	log "github.com/sirupsen/logrus"
 	"os"
-	"strings"
-	"time"
+	"os/signal"
+	"syscall"
 )
 
 const ProgNameMqtt string = "powertag2mqtt"
 
-func main() {
-	var url string
+// Version is set when building, with -ldflags "-X powertag2mqtt.Version=..."
+var Version = "dev"
 
-	flag.StringVar(&url, "url", "192.168.0.20:1883", "mqtt server")
-	flag.Parse()
+// Main runs powertag2mqtt with its own MQTT connection, configured by the command
+// line, the environment and the configuration file.
+func Main() {
+	config, err := loadConfig()
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
 
-	stat, _ := os.Stdin.Stat()
-	if stat.Mode()&os.ModeCharDevice != 0 {
-		fmt.Fprintf(os.Stderr, "%s: no data on stdin\n", ProgNameMqtt)
+	if err := checkInput(config.Input); err != nil {
+		log.Error(err)
 		fmt.Fprintf(os.Stderr, "%s expects data to be piped to stdin, i.e.:\n", ProgNameMqtt)
-		fmt.Fprintf(os.Stderr, "    powertagd | powertag2influx\n")
-		os.Exit(2)
+		fmt.Fprintf(os.Stderr, "    powertagd | powertag2mqtt\n")
+		fmt.Fprintf(os.Stderr, "or to be given a network or mqtt input with -input\n")
+		os.Exit(ExitBadInput)
 	}
 
-	mqtt.DEBUG = log.New(os.Stdout, "", 0)
-	mqtt.ERROR = log.New(os.Stdout, "", 0)
-	opts := mqtt.NewClientOptions().AddBroker(url).SetClientID(ProgNameMqtt)
-	opts.SetKeepAlive(60 * time.Second)
-	opts.SetPingTimeout(1 * time.Second)
-
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		panic(token.Error())
+	if err := setupLogging(config.LogLevel, config.Quiet); err != nil {
+		log.Error(err)
+		os.Exit(1)
 	}
 
-	fmt.Printf("%s: connected to %s\n", ProgNameMqtt, url)
-
-	lnscan := bufio.NewScanner(os.Stdin)
-	for lnscan.Scan() {
-		line := lnscan.Text()
-		if strings.HasPrefix(line, "powertag,") {
-			sanitized := strings.Replace(line, "powertag,", "", -1)
-			splitted := strings.Split(sanitized, " ")
-			if len(splitted) == 3 {
-				tags := asMap(splitted[0])
-				measures := asMap(splitted[1])
-				// ts := splitted[2]
-
-				_, idExist := tags["id"]
-				if idExist {
-					jsonStr, _ := json.Marshal(measures)
-
-					token := client.Publish("powertag/"+tags["id"], 0, false, jsonStr)
-					token.Wait()
-				}
-
-			}
-		}
+	var service *Service
+	client, err := mqttclient.New(config.Broker, mqttclient.Options{
+		Will:         &mqttclient.Will{Topic: config.TopicPrefix + "/availability", Payload: homeassistant.PayloadNotAvailable, Retained: true},
+		ConnectRetry: true,
+		OnConnect: func(mqtt.Client) {
+			service.OnConnect()
+		},
+		Logger: log.StandardLogger(),
+	})
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
 	}
-}
-
-func asMap(inputString string) map[string]string {
-	m := make(map[string]string)
-
-	entry := strings.Split(inputString, ",")
-	for _, s := range entry {
-		split := strings.Split(s, "=")
-		m[split[0]] = split[1]
+	service, err = NewService(client, config)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	// Retries until the broker is reachable
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
 	}
 
-	return m
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
 }
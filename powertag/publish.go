@@ -0,0 +1,111 @@
+package powertag2mqtt
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const (
+	OutputJson   = "json"
+	OutputPerKey = "per-key"
+	OutputBoth   = "both"
+)
+
+// PublishPolicy is the QoS and retain flag used for a class of topics.
+type PublishPolicy struct {
+	QoS    byte `yaml:"qos"`
+	Retain bool `yaml:"retain"`
+}
+
+// PublishConfig holds the publish policy of every class of topics.
+type PublishConfig struct {
+	// Json applies to the JSON payload holding every measure of a tag.
+	Json PublishPolicy `yaml:"json"`
+	// Energy applies to the energy indices topics.
+	Energy PublishPolicy `yaml:"energy"`
+	// Instantaneous applies to the other measures topics: power, current, voltage...
+	Instantaneous PublishPolicy `yaml:"instantaneous"`
+}
+
+func defaultPublishConfig() PublishConfig {
+	return PublishConfig{
+		Energy: PublishPolicy{Retain: true},
+	}
+}
+
+// measurePolicy returns the policy applying to the topic of a measure.
+func (p PublishConfig) measurePolicy(key string) PublishPolicy {
+	if m, known := measures[key]; (known && m.deviceClass == "energy") || strings.HasPrefix(key, "energy") {
+		return p.Energy
+	}
+	return p.Instantaneous
+}
+
+const DefaultBacklogSize = 1000
+const PublishTimeout = 10 * time.Second
+
+// queuedMessage is a message kept in the backlog while the broker is unreachable.
+type queuedMessage struct {
+	topic   string
+	policy  PublishPolicy
+	payload interface{}
+}
+
+// publish sends a message, queuing it in the backlog when the broker is unreachable.
+func (b *bridge) publish(topic string, policy PublishPolicy, payload interface{}) {
+	if !b.client.IsConnectionOpen() {
+		b.enqueue(queuedMessage{topic, policy, payload})
+		return
+	}
+	token := b.client.Publish(topic, policy.QoS, policy.Retain, payload)
+	if !token.WaitTimeout(PublishTimeout) || token.Error() != nil {
+		b.enqueue(queuedMessage{topic, policy, payload})
+		return
+	}
+	stats.published()
+}
+
+// enqueue adds a message to the backlog, dropping the oldest one when it is full.
+func (b *bridge) enqueue(msg queuedMessage) {
+	b.backlogMu.Lock()
+	defer b.backlogMu.Unlock()
+	if b.config.BacklogSize <= 0 {
+		return
+	}
+	if len(b.backlog) >= b.config.BacklogSize {
+		b.backlog = b.backlog[1:]
+	}
+	b.backlog = append(b.backlog, msg)
+}
+
+// flushBacklog publishes the messages queued during an outage, in order.
+func (b *bridge) flushBacklog() {
+	b.backlogMu.Lock()
+	backlog := b.backlog
+	b.backlog = nil
+	b.backlogMu.Unlock()
+	if len(backlog) > 0 {
+		log.Infof("publishing %d messages queued while disconnected", len(backlog))
+	}
+	for _, msg := range backlog {
+		b.publish(msg.topic, msg.policy, msg.payload)
+	}
+}
+
+func checkOutput(output string) error {
+	switch output {
+	case OutputJson, OutputPerKey, OutputBoth:
+		return nil
+	}
+	return fmt.Errorf("unsupported output '%s', expected %s, %s or %s", output, OutputJson, OutputPerKey, OutputBoth)
+}
+
+func (b *bridge) publishesJson() bool {
+	return b.config.Output != OutputPerKey
+}
+
+func (b *bridge) publishesPerKey() bool {
+	return b.config.Output != OutputJson
+}
@@ -0,0 +1,82 @@
+package powertag2mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sort"
+)
+
+// registryFile is the content of the state file listing the known tags.
+type registryFile struct {
+	// Tags holds the measures reported by every known tag
+	Tags map[string][]string `json:"tags"`
+	// Models holds the model of the tags whose type powertagd reported
+	Models map[string]string `json:"models,omitempty"`
+}
+
+// loadRegistry restores the tags known before a restart, so that their
+// discovery configuration and availability are published at connection.
+// Restored tags are offline until they report again.
+func (b *bridge) loadRegistry() error {
+	if b.config.StateFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(b.config.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var registry registryFile
+	if err = json.Unmarshal(content, &registry); err != nil {
+		return fmt.Errorf("error parsing %s: %w", b.config.StateFile, err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, keys := range registry.Tags {
+		if !b.config.Filter.allows(id) {
+			b.removedTags[id] = keys
+			continue
+		}
+		sent := map[string]bool{}
+		for _, key := range keys {
+			sent[key] = true
+		}
+		b.powertagConfigSent[id] = sent
+		b.online[id] = false
+		if model, ok := registry.Models[id]; ok {
+			b.models[id] = model
+		}
+	}
+	return nil
+}
+
+// saveRegistry writes the known tags to the state file, must be called with b.mu held.
+func (b *bridge) saveRegistry() {
+	if b.config.StateFile == "" {
+		return
+	}
+	registry := registryFile{Tags: map[string][]string{}, Models: b.models}
+	for id, sent := range b.powertagConfigSent {
+		keys := make([]string, 0, len(sent))
+		for key := range sent {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		registry.Tags[id] = keys
+	}
+	content, err := json.MarshalIndent(registry, "", "  ")
+	if err == nil {
+		// Write then rename so that a crash never leaves a truncated file
+		tmp := b.config.StateFile + ".tmp"
+		if err = os.WriteFile(tmp, content, 0644); err == nil {
+			err = os.Rename(tmp, b.config.StateFile)
+		}
+	}
+	if err != nil {
+		log.Errorf("error saving tag registry: %s", err)
+	}
+}
@@ -0,0 +1,69 @@
+package powertag2mqtt
+
+import (
+	"os"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+// Service is a PowerTag bridge publishing to a MQTT connection it does not own,
+// either the one of powertag2mqtt or the one shared by the energy-center daemon.
+type Service struct {
+	b *bridge
+}
+
+// NewService creates the bridge and restores its registry. The lines are read once
+// Run is called, OnConnect must be called on every connection. The client must
+// restore the subscriptions on reconnection, as a mqttclient.Client does.
+func NewService(client mqtt.Client, config Config) (*Service, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkInput(config.Input); err != nil {
+		return nil, err
+	}
+	b := newBridge(client, config)
+	if err := b.loadRegistry(); err != nil {
+		log.Error(err)
+	}
+	b.listenHaStatus()
+	return &Service{b}, nil
+}
+
+// OnConnect restores the availability and discovery after a (re)connection.
+func (s *Service) OnConnect() {
+	s.b.onConnect()
+}
+
+// Run handles the powertagd lines until the input ends or a signal is received,
+// and returns the exit code of the bridge.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	b := s.b
+	if b.costs != nil {
+		if err := b.listenTempo(); err != nil {
+			log.Error(err)
+		}
+	}
+
+	lines := make(chan string)
+	if err := startInput(b.config.Input, b, lines); err != nil {
+		log.Error(err)
+		return ExitBadInput
+	}
+
+	go b.watchTags()
+
+	if b.config.MetricsAddress != "" {
+		go func() {
+			log.Errorf("metrics endpoint stopped: %s", b.serveMetrics(b.config.MetricsAddress))
+		}()
+	}
+	if b.config.HeartbeatInterval > 0 {
+		go b.heartbeat()
+	}
+
+	code := b.run(lines, signals)
+	b.shutdown()
+	return code
+}
@@ -0,0 +1,53 @@
+package powertag2mqtt
+
+import (
+	"os"
+	"time"
+
+	"energy-center/home-assistant"
+	log "github.com/sirupsen/logrus"
+)
+
+// Exit codes, so that the supervisor can tell why the bridge stopped.
+const (
+	ExitOk          = 0
+	ExitBadInput    = 2
+	ExitInputClosed = 3
+	ExitInputError  = 4
+)
+
+// ShutdownTimeout bounds the delivery of the offline availability on shutdown.
+const ShutdownTimeout = 5 * time.Second
+
+// run handles the lines until the input ends or a signal is received,
+// and returns the exit code of the bridge.
+func (b *bridge) run(lines <-chan string, signals <-chan os.Signal) int {
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				if b.inputErr != nil {
+					log.Errorf("error reading input: %s", b.inputErr)
+					return ExitInputError
+				}
+				log.Warn("input closed, powertagd exited")
+				return ExitInputClosed
+			}
+			b.handleLine(line)
+		case sig := <-signals:
+			log.Infof("received %s, stopping", sig)
+			return ExitOk
+		}
+	}
+}
+
+// shutdown reports the bridge offline and flushes InfluxDB. The connection is
+// left to its owner, which disconnects cleanly so that the Last Will is not triggered.
+func (b *bridge) shutdown() {
+	if b.client.IsConnectionOpen() {
+		b.client.Publish(b.availabilityTopic(), 0, true, homeassistant.PayloadNotAvailable).WaitTimeout(ShutdownTimeout)
+	}
+	if b.influx != nil {
+		b.influx.Flush()
+	}
+}
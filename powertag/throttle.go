@@ -0,0 +1,36 @@
+package powertag2mqtt
+
+import (
+	"time"
+)
+
+// throttled reports whether the report of a tag must be dropped because the
+// previous one was published less than the minimum interval ago.
+func (b *bridge) throttled(id string) bool {
+	interval := b.config.MinInterval
+	if tag, ok := b.config.Tags[id]; ok && tag.MinInterval != 0 {
+		interval = tag.MinInterval
+	}
+	if interval <= 0 {
+		return false
+	}
+	return time.Since(b.lastPublished[id]) < interval
+}
+
+// changedMeasures returns the measures which must be published, only those
+// whose value changed since the previous publish when change only is enabled.
+func (b *bridge) changedMeasures(id string, measures map[string]string) map[string]string {
+	previous, exist := b.lastValues[id]
+	if !exist {
+		previous = map[string]string{}
+		b.lastValues[id] = previous
+	}
+	changed := map[string]string{}
+	for k, v := range measures {
+		if !b.config.ChangeOnly || previous[k] != v {
+			changed[k] = v
+		}
+		previous[k] = v
+	}
+	return changed
+}
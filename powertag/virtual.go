@@ -0,0 +1,89 @@
+package powertag2mqtt
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// GridTopic is the grid power topic fakeSungrowMeter and the regulator listen to.
+const GridTopic = "powerinfo/grid"
+
+// VirtualTagConfig declares a virtual tag, whose measures are the sum of those of
+// physical tags, e.g. the whole house from the PowerTags of the three mains phases.
+// Its name and area are set in Tags like those of a physical tag.
+type VirtualTagConfig struct {
+	Tags []string `yaml:"tags"`
+	// Grid publishes the power of the virtual tag to powerinfo/grid.
+	Grid bool `yaml:"grid"`
+}
+
+// summedMeasures are the measures of a virtual tag, as the others cannot be summed.
+var summedMeasures = []string{"power", "power_p1", "power_p2", "power_p3", "energy"}
+
+func validateVirtualTags(virtual map[string]VirtualTagConfig) error {
+	grid := ""
+	for id, v := range virtual {
+		if len(v.Tags) == 0 {
+			return fmt.Errorf("virtual tag %s has no tags", id)
+		}
+		if v.Grid {
+			if grid != "" {
+				return fmt.Errorf("virtual tags %s and %s both publish to %s", grid, id, GridTopic)
+			}
+			grid = id
+		}
+	}
+	return nil
+}
+
+// aggregate records the fields of a tag and publishes the virtual tags it is a member of.
+func (b *bridge) aggregate(id string, fields map[string]string, timestamp time.Time) {
+	if len(b.config.VirtualTags) == 0 {
+		return
+	}
+	b.memberValues[id] = fields
+	for virtualId, v := range b.config.VirtualTags {
+		if !contains(v.Tags, id) {
+			continue
+		}
+		sum := b.sum(v.Tags)
+		if len(sum) == 0 {
+			continue
+		}
+		b.handleTag(virtualId, sum, timestamp)
+		if power, ok := sum["power"]; v.Grid && ok {
+			b.publish(GridTopic, b.config.Publish.Instantaneous, power)
+		}
+	}
+}
+
+// sum returns the measures reported by every one of the tags, summed.
+// It is empty until all the tags have reported.
+func (b *bridge) sum(tags []string) map[string]string {
+	sum := map[string]string{}
+	for _, key := range summedMeasures {
+		total, complete := 0.0, true
+		for _, id := range tags {
+			value, err := strconv.ParseFloat(b.memberValues[id][key], 64)
+			if err != nil {
+				complete = false
+				break
+			}
+			total += value
+		}
+		if complete {
+			sum[key] = strconv.FormatFloat(total, 'f', -1, 64)
+		}
+	}
+	return sum
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,3 @@
+module energy-center/regulation
+
+go 1.17
@@ -0,0 +1,98 @@
+// Package regulation holds the regulators shared by the energy-center services
+// which adjust a load to the grid power and the PV production, e.g. the solar router.
+package regulation
+
+import (
+	"math"
+	"time"
+)
+
+// RegulationInput is the state of the installation a regulator decides from.
+type RegulationInput struct {
+	// Time is when the input was measured.
+	Time time.Time
+	// GridPower is the power exchanged with the grid, in W, positive when drawn
+	// and negative when exported, as published on powerinfo/grid.
+	GridPower float64
+	// PvPower is the power produced by the solar inverters, in W, as published on
+	// powerinfo/pv_power, known when HasPv.
+	PvPower float64
+	HasPv   bool
+	// HousePower is the power consumed by the house without the regulated load,
+	// in W, known when HasHouse.
+	HousePower float64
+	HasHouse   bool
+}
+
+// Regulator computes the power setpoint of a load from the state of the installation.
+type Regulator interface {
+	// Regulate returns the power the load must draw, in W.
+	Regulate(input RegulationInput) float64
+	// Reset forgets the state, e.g. when the input is stale or the load was stopped.
+	Reset()
+}
+
+// Surplus is a regulator diverting the exported power to a load, keeping the
+// grid power at Target. Every call adds Gain times the distance to the target
+// to the setpoint, within [0, Max]. A Gain below 1 damps the oscillations caused
+// by the delay of the meter.
+type Surplus struct {
+	// Target is the grid power kept, in W, e.g. -50 to always export a little.
+	Target float64
+	Gain   float64
+	// Max is the power of the load, in W.
+	Max float64
+
+	setpoint float64
+}
+
+// Regulate returns the new setpoint, the input grid power including the previous one.
+func (s *Surplus) Regulate(input RegulationInput) float64 {
+	s.setpoint += s.Gain * (s.Target - input.GridPower)
+	if s.setpoint < 0 {
+		s.setpoint = 0
+	}
+	if s.setpoint > s.Max {
+		s.setpoint = s.Max
+	}
+	return s.setpoint
+}
+
+func (s *Surplus) Reset() {
+	s.setpoint = 0
+}
+
+// Reserve is a regulator reserving a share of the PV production for the house,
+// and giving the load what is left: the production less Share of it and Power,
+// and less the house consumption, within [0, Max]. The house consumption is the
+// grid power and production less the previous setpoint when not in the input.
+// The load is off while the production is unknown.
+type Reserve struct {
+	// Share is the fraction of the production reserved for the house, in [0, 1].
+	Share float64
+	// Power is reserved for the house on top of the share, in W.
+	Power float64
+	// Max is the power of the load, in W.
+	Max float64
+
+	setpoint float64
+}
+
+// Regulate returns the new setpoint, the input grid power including the previous one.
+func (r *Reserve) Regulate(input RegulationInput) float64 {
+	if !input.HasPv {
+		r.setpoint = 0
+		return 0
+	}
+	house := input.GridPower + input.PvPower - r.setpoint
+	if input.HasHouse {
+		house = input.HousePower
+	}
+	available := math.Min(input.PvPower*(1-r.Share)-r.Power, input.PvPower-house)
+	r.setpoint = math.Max(0, math.Min(available, r.Max))
+	return r.setpoint
+}
+
+func (r *Reserve) Reset() {
+	r.setpoint = 0
+}
@@ -0,0 +1,61 @@
+package regulation
+
+import "testing"
+
+func TestSurplus(t *testing.T) {
+	s := &Surplus{Target: -50, Gain: 0.5, Max: 2000}
+	// Exporting 1050 W with the load off, then with the load at each setpoint
+	grid := -1050.0
+	var setpoints []float64
+	for i := 0; i < 4; i++ {
+		setpoint := s.Regulate(RegulationInput{GridPower: grid})
+		grid = -1050 + setpoint
+		setpoints = append(setpoints, setpoint)
+	}
+	for i, want := range []float64{500, 750, 875, 937.5} {
+		if setpoints[i] != want {
+			t.Errorf("setpoint %d = %v, want %v", i, setpoints[i], want)
+		}
+	}
+
+	if got := s.Regulate(RegulationInput{GridPower: -10000}); got != 2000 {
+		t.Errorf("large export: got %v, want the maximum", got)
+	}
+	if got := s.Regulate(RegulationInput{GridPower: 10000}); got != 0 {
+		t.Errorf("large import: got %v, want 0", got)
+	}
+	s.Regulate(RegulationInput{GridPower: -1000})
+	s.Reset()
+	if got := s.Regulate(RegulationInput{GridPower: -50}); got != 0 {
+		t.Errorf("after reset: got %v, want 0", got)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	r := &Reserve{Share: 0.2, Power: 100, Max: 7400}
+	if got := r.Regulate(RegulationInput{GridPower: -3000}); got != 0 {
+		t.Errorf("without production: got %v, want 0", got)
+	}
+	// 5000 W produced, 1000 W consumed by the house: 3900 W left after the reserve
+	input := RegulationInput{GridPower: -4000, PvPower: 5000, HasPv: true}
+	if got := r.Regulate(input); got != 3900 {
+		t.Errorf("reserve: got %v, want 3900", got)
+	}
+	// The load at 3900 W, the house now consuming 2000 W
+	input.GridPower = -4000 + 3900 + 1000
+	if got := r.Regulate(input); got != 3000 {
+		t.Errorf("house consumption above the reserve: got %v, want 3000", got)
+	}
+	input.HousePower, input.HasHouse = 500, true
+	if got := r.Regulate(input); got != 3900 {
+		t.Errorf("measured house consumption: got %v, want 3900", got)
+	}
+	input.HousePower = 6000
+	if got := r.Regulate(input); got != 0 {
+		t.Errorf("house consumption above the production: got %v, want 0", got)
+	}
+	input.PvPower, input.HousePower = 12000, 0
+	if got := r.Regulate(input); got != 7400 {
+		t.Errorf("large production: got %v, want the maximum", got)
+	}
+}
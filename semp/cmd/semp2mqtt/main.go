@@ -0,0 +1,7 @@
+package main
+
+import "semp2mqtt"
+
+func main() {
+	semp2mqtt.Main()
+}
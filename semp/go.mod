@@ -0,0 +1,21 @@
+module semp2mqtt
+
+go 1.17
+
+require (
+	energy-center/curtailment v0.0.0
+	energy-center/mqttclient v0.0.0
+	github.com/eclipse/paho.mqtt.golang v1.4.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/gorilla/websocket v1.4.2 // indirect
+	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+)
+
+replace (
+	energy-center/curtailment => ../curtailment
+	energy-center/mqttclient => ../mqttclient
+)
@@ -0,0 +1,131 @@
+package semp2mqtt
+
+import (
+	"encoding/xml"
+	"text/template"
+)
+
+// Namespace is the XML namespace of the SEMP messages.
+const Namespace = "http://www.sma.de/communication/schema/SEMP/v1"
+
+// Device2EM is the message polled by the Home Manager, describing the devices.
+type Device2EM struct {
+	XMLName         xml.Name          `xml:"http://www.sma.de/communication/schema/SEMP/v1 Device2EM"`
+	DeviceInfo      []DeviceInfo      `xml:"DeviceInfo,omitempty"`
+	DeviceStatus    []DeviceStatus    `xml:"DeviceStatus,omitempty"`
+	PlanningRequest []PlanningRequest `xml:"PlanningRequest,omitempty"`
+}
+
+// DeviceInfo is the static description of a device.
+type DeviceInfo struct {
+	Identification  Identification  `xml:"Identification"`
+	Characteristics Characteristics `xml:"Characteristics"`
+	Capabilities    Capabilities    `xml:"Capabilities"`
+}
+
+type Identification struct {
+	DeviceId     string `xml:"DeviceId"`
+	DeviceName   string `xml:"DeviceName"`
+	DeviceType   string `xml:"DeviceType"`
+	DeviceSerial string `xml:"DeviceSerial"`
+	DeviceVendor string `xml:"DeviceVendor"`
+}
+
+// Characteristics are the powers of a device, in W.
+type Characteristics struct {
+	MinPowerConsumption int `xml:"MinPowerConsumption,omitempty"`
+	MaxPowerConsumption int `xml:"MaxPowerConsumption"`
+}
+
+type Capabilities struct {
+	// CurrentPowerMethod is Measurement, or Estimation when the power is the
+	// recommended one.
+	CurrentPowerMethod   string `xml:"CurrentPower>Method"`
+	AbsoluteTimestamps   bool   `xml:"Timestamps>AbsoluteTimestamps"`
+	InterruptionsAllowed bool   `xml:"Interruptions>InterruptionsAllowed"`
+	// OptionalEnergy lets the Home Manager schedule the device on the surplus only.
+	OptionalEnergy bool `xml:"Requests>OptionalEnergy"`
+}
+
+// DeviceStatus is the current state of a device.
+type DeviceStatus struct {
+	DeviceId          string `xml:"DeviceId"`
+	EMSignalsAccepted bool   `xml:"EMSignalsAccepted"`
+	// Status is On, Off or Offline.
+	Status    string    `xml:"Status"`
+	PowerInfo PowerInfo `xml:"PowerConsumption>PowerInfo"`
+}
+
+// PowerInfo is the power of a device, in W, Timestamp being relative to now.
+type PowerInfo struct {
+	AveragePower      int `xml:"AveragePower"`
+	Timestamp         int `xml:"Timestamp"`
+	AveragingInterval int `xml:"AveragingInterval"`
+}
+
+// PlanningRequest asks the Home Manager for energy.
+type PlanningRequest struct {
+	Timeframe []Timeframe `xml:"Timeframe"`
+}
+
+// Timeframe is an energy request, in Wh, between two times in seconds from now.
+type Timeframe struct {
+	DeviceId            string `xml:"DeviceId"`
+	EarliestStart       int    `xml:"EarliestStart"`
+	LatestEnd           int    `xml:"LatestEnd"`
+	MinEnergy           int    `xml:"MinEnergy"`
+	MaxEnergy           int    `xml:"MaxEnergy"`
+	MaxPowerConsumption int    `xml:"MaxPowerConsumption,omitempty"`
+	MinPowerConsumption int    `xml:"MinPowerConsumption,omitempty"`
+}
+
+// EM2Device is the message posted by the Home Manager to control the devices.
+type EM2Device struct {
+	XMLName       xml.Name        `xml:"http://www.sma.de/communication/schema/SEMP/v1 EM2Device"`
+	DeviceControl []DeviceControl `xml:"DeviceControl"`
+}
+
+// DeviceControl switches a device, at the recommended power in W when on.
+type DeviceControl struct {
+	DeviceId                    string `xml:"DeviceId"`
+	On                          bool   `xml:"On"`
+	RecommendedPowerConsumption int    `xml:"RecommendedPowerConsumption"`
+	Timestamp                   int    `xml:"Timestamp"`
+}
+
+// GatewayType is the UPnP device type the Home Manager discovers.
+const GatewayType = "urn:schemas-simple-energy-management-protocol:device:Gateway:1"
+
+// description is the UPnP description of the gateway, pointing the Home Manager
+// to the SEMP base url. encoding/xml does not write the semp prefix it expects.
+var description = template.Must(template.New("description").Parse(`<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <specVersion>
+    <major>1</major>
+    <minor>0</minor>
+  </specVersion>
+  <device>
+    <deviceType>` + GatewayType + `</deviceType>
+    <friendlyName>{{html .Name}}</friendlyName>
+    <manufacturer>energy-center</manufacturer>
+    <modelName>semp2mqtt</modelName>
+    <UDN>uuid:{{.Uuid}}</UDN>
+    <serviceList>
+      <service>
+        <serviceType>urn:schemas-simple-energy-management-protocol:service:NULL:1:service:NULL:1</serviceType>
+        <serviceId>urn:schemas-simple-energy-management-protocol:serviceId:NULL:serviceId:NULL</serviceId>
+        <SCPDURL>/XD/NULL.xml</SCPDURL>
+        <controlURL>/UD/?0</controlURL>
+        <eventSubURL></eventSubURL>
+      </service>
+    </serviceList>
+    <semp:X_SEMPSERVICE xmlns:semp="urn:schemas-simple-energy-management-protocol:service-1-0">
+      <semp:server>{{html .Url}}</semp:server>
+      <semp:basePath>` + BasePath + `</semp:basePath>
+      <semp:transport>HTTP/Pull</semp:transport>
+      <semp:exchangeFormat>XML</semp:exchangeFormat>
+      <semp:wsVersion>1.1.5</semp:wsVersion>
+    </semp:X_SEMPSERVICE>
+  </device>
+</root>
+`))
@@ -0,0 +1,183 @@
+// Package semp2mqtt emulates a SEMP (Simple Energy Management Protocol) gateway,
+// announcing the EV chargers to a SMA Sunny Home Manager as controllable loads and
+// publishing the power it recommends for every charger to a MQTT budget topic, as
+// batterycoordinator does for its EV budget.
+package semp2mqtt
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
+
+	"energy-center/curtailment"
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+const ProgNameMqtt string = "semp2mqtt"
+
+// BasePath is the path of the SEMP messages on the HTTP server.
+const BasePath = "/semp"
+
+// StaleTimeout is the delay after which a device without power measure is reported offline.
+const StaleTimeout = 1 * time.Minute
+
+// Device types
+const (
+	EVCharger = "EVCharger"
+)
+
+// deviceId is the SEMP id of a device: F-<vendor id>-<serial>-<sub device>, in hexadecimal.
+var deviceId = regexp.MustCompile(`^F-[0-9A-Fa-f]{8}-[0-9A-Fa-f]{12}-[0-9A-Fa-f]{2}$`)
+
+// Device is a load announced to the Home Manager.
+type Device struct {
+	// Id is the SEMP id of the device, e.g. F-00000001-000000000001-00, unique on the network.
+	Id     string `yaml:"id"`
+	Name   string `yaml:"name"`
+	Type   string `yaml:"type"`
+	Vendor string `yaml:"vendor"`
+	Serial string `yaml:"serial"`
+	// MinPower and MaxPower bound the recommended power, in W.
+	MinPower float64 `yaml:"min_power"`
+	MaxPower float64 `yaml:"max_power"`
+	// MaxEnergy is the optional energy requested to the Home Manager for the next
+	// 24 hours, in Wh, to be charged from the surplus. No energy is requested when 0.
+	MaxEnergy float64 `yaml:"max_energy"`
+	// PowerTopic is the measured power of the device, in W, optional.
+	PowerTopic string `yaml:"power_topic"`
+	// BudgetTopic receives the power the device may consume, in W.
+	BudgetTopic string `yaml:"budget_topic"`
+}
+
+func (d Device) validate() error {
+	if !deviceId.MatchString(d.Id) {
+		return fmt.Errorf("invalid device id '%s', expected e.g. F-00000001-000000000001-00", d.Id)
+	}
+	if d.MaxPower <= 0 || d.MinPower < 0 || d.MinPower > d.MaxPower {
+		return fmt.Errorf("device %s: max_power must be positive and above min_power", d.Id)
+	}
+	if d.BudgetTopic == "" {
+		return fmt.Errorf("device %s: no budget_topic", d.Id)
+	}
+	return nil
+}
+
+// Settings are the settings of the gateway, from the configuration file of
+// semp2mqtt or the semp section of the energy-center configuration file.
+type Settings struct {
+	// Mqtt is the broker connection of semp2mqtt, ignored by the daemon.
+	Mqtt mqttclient.Config `yaml:"mqtt"`
+	// Listen is the address of the SEMP HTTP server.
+	Listen string `yaml:"listen"`
+	// Url is the base url the Home Manager reaches the server at, e.g.
+	// http://192.168.0.21:9765, from the first IPv4 address of the host when empty.
+	Url string `yaml:"url"`
+	// Uuid identifies the gateway on the network, derived from the host name when empty.
+	Uuid string `yaml:"uuid"`
+	// Name is the name of the gateway in Sunny Portal.
+	Name    string   `yaml:"name"`
+	Devices []Device `yaml:"devices"`
+	// ControlTimeout is the delay after which the budgets are withdrawn when the
+	// Home Manager stops sending its recommendations.
+	ControlTimeout time.Duration `yaml:"control_timeout"`
+	// Interval is the delay between two publications of the budgets.
+	Interval time.Duration `yaml:"interval"`
+	// Curtailment caps the total of the budgets during the demand response events
+	// of the grid operator or an aggregator.
+	Curtailment curtailment.Config `yaml:"curtailment"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Mqtt:   mqttclient.Config{Url: "192.168.0.20:1883", ClientId: ProgNameMqtt},
+		Listen: ":9765",
+		Name:   "energy-center",
+		Devices: []Device{{
+			Id:          "F-00000001-000000000001-00",
+			Name:        "EV charger",
+			Type:        EVCharger,
+			Vendor:      "energy-center",
+			Serial:      "1",
+			MinPower:    1380,
+			MaxPower:    7400,
+			MaxEnergy:   20000,
+			BudgetTopic: ProgNameMqtt + "/ev_budget",
+		}},
+		ControlTimeout: 5 * time.Minute,
+		Interval:       10 * time.Second,
+	}
+}
+
+func (s Settings) Validate() error {
+	if len(s.Devices) == 0 {
+		return fmt.Errorf("no device configured")
+	}
+	ids := map[string]bool{}
+	for _, d := range s.Devices {
+		if err := d.validate(); err != nil {
+			return err
+		}
+		if ids[d.Id] {
+			return fmt.Errorf("duplicate device id %s", d.Id)
+		}
+		ids[d.Id] = true
+	}
+	if s.ControlTimeout <= 0 || s.Interval <= 0 {
+		return fmt.Errorf("control_timeout and interval must be positive")
+	}
+	return nil
+}
+
+// LoadSettings reads the settings from a YAML file, over the defaults.
+func LoadSettings(path string) (Settings, error) {
+	settings := DefaultSettings()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return settings, err
+	}
+	if err = yaml.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Main runs the gateway with its own MQTT connection, configured by a YAML file.
+func Main() {
+	var path string
+	flag.StringVar(&path, "config", "/etc/semp2mqtt.yaml", "YAML configuration file")
+	flag.Parse()
+
+	settings, err := LoadSettings(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	mqtt.ERROR = log.New(os.Stdout, "", 0)
+	client, err := mqttclient.New(settings.Mqtt, mqttclient.Options{ConnectRetry: true})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	service, err := NewService(client, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
@@ -0,0 +1,342 @@
+package semp2mqtt
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"energy-center/curtailment"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Service is the gateway, on a MQTT connection it does not own, either the one of
+// semp2mqtt or the one shared by the energy-center daemon.
+type Service struct {
+	client      mqtt.Client
+	settings    Settings
+	server      *http.Server
+	ssdp        *ssdp
+	curtailment *curtailment.Signal
+
+	mu     sync.Mutex
+	states map[string]*state
+}
+
+// state is what the gateway knows of a device.
+type state struct {
+	power     float64
+	powerTime time.Time
+	// on and recommended are the last control of the Home Manager.
+	on          bool
+	recommended float64
+	controlTime time.Time
+}
+
+// NewService serves the SEMP messages, announces the gateway and subscribes to the
+// powers of the devices. The client must restore the subscriptions on reconnection,
+// as a mqttclient.Client does.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	s := newService(client, settings)
+	listener, err := net.Listen("tcp", settings.Listen)
+	if err != nil {
+		return nil, err
+	}
+	if s.settings.Url == "" {
+		if s.settings.Url, err = localUrl(listener.Addr().(*net.TCPAddr).Port); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	if s.settings.Uuid == "" {
+		s.settings.Uuid = hostUuid()
+	}
+	if s.ssdp, err = newSsdp(s.settings.Uuid, s.settings.Url+"/description.xml"); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	s.server = &http.Server{Handler: s.handler()}
+	go func() {
+		if err := s.server.Serve(listener); err != http.ErrServerClosed {
+			fmt.Printf("%s: %s\n", ProgNameMqtt, err)
+		}
+	}()
+	go s.ssdp.serve()
+	s.ssdp.notify(true)
+	fmt.Printf("%s: announcing %d device(s) at %s\n", ProgNameMqtt, len(settings.Devices), s.settings.Url)
+	return s, nil
+}
+
+// newService creates the gateway and subscribes to the powers of the devices.
+func newService(client mqtt.Client, settings Settings) *Service {
+	s := &Service{client: client, settings: settings, states: map[string]*state{}}
+	s.curtailment = curtailment.New(settings.Curtailment, func(format string, args ...interface{}) {
+		fmt.Printf("%s: %s\n", ProgNameMqtt, fmt.Sprintf(format, args...))
+	})
+	if settings.Curtailment.Topic != "" {
+		client.Subscribe(settings.Curtailment.Topic, 1, func(client mqtt.Client, msg mqtt.Message) {
+			if err := s.curtailment.Receive(msg.Payload(), time.Now()); err != nil {
+				fmt.Printf("%s: ignoring %s: %s\n", ProgNameMqtt, msg.Topic(), err)
+			}
+		})
+	}
+	for _, d := range settings.Devices {
+		st := &state{}
+		s.states[d.Id] = st
+		if d.PowerTopic == "" {
+			continue
+		}
+		client.Subscribe(d.PowerTopic, 0, func(client mqtt.Client, msg mqtt.Message) {
+			v, err := strconv.ParseFloat(string(msg.Payload()), 64)
+			if err != nil {
+				fmt.Printf("%s: ignoring %s: %s\n", ProgNameMqtt, msg.Topic(), err)
+				return
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			st.power, st.powerTime = v, time.Now()
+		})
+	}
+	return s
+}
+
+// localUrl returns the url of the server on the first IPv4 address of the host.
+func localUrl(port int) (string, error) {
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	for _, address := range addresses {
+		if ip, ok := address.(*net.IPNet); ok && !ip.IP.IsLoopback() && ip.IP.To4() != nil {
+			return fmt.Sprintf("http://%s:%d", ip.IP, port), nil
+		}
+	}
+	return "", fmt.Errorf("no IPv4 address to announce, set the url")
+}
+
+// hostUuid derives the uuid of the gateway from the host name, for the Home
+// Manager to find the same gateway after a restart.
+func hostUuid() string {
+	host, _ := os.Hostname()
+	h := md5.Sum([]byte(ProgNameMqtt + "/" + host))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// budget returns the power a device may consume, none when the Home Manager
+// switched it off or stopped controlling it.
+func (s *Service) budget(d Device, now time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.states[d.Id]
+	if !st.on || now.Sub(st.controlTime) > s.settings.ControlTimeout {
+		return 0
+	}
+	return st.recommended
+}
+
+// budgets returns the budgets of the devices, their total capped by a curtailment
+// shared in the order of the devices, those not given their min power being stopped.
+func (s *Service) budgets(now time.Time) []float64 {
+	limit, curtailed := s.curtailment.Limit(now)
+	budgets := make([]float64, len(s.settings.Devices))
+	for i, d := range s.settings.Devices {
+		budget := s.budget(d, now)
+		if curtailed {
+			if budget = math.Min(budget, limit); budget < d.MinPower {
+				budget = 0
+			}
+			limit -= budget
+		}
+		budgets[i] = budget
+	}
+	return budgets
+}
+
+// control applies the recommendation of the Home Manager for a device, bounded by
+// its powers, and publishes its budget.
+func (s *Service) control(c DeviceControl, now time.Time) error {
+	var device *Device
+	index := 0
+	for i := range s.settings.Devices {
+		if s.settings.Devices[i].Id == c.DeviceId {
+			device, index = &s.settings.Devices[i], i
+		}
+	}
+	if device == nil {
+		return fmt.Errorf("unknown device %s", c.DeviceId)
+	}
+	recommended := float64(c.RecommendedPowerConsumption)
+	if recommended <= 0 {
+		recommended = device.MaxPower
+	}
+	recommended = math.Max(device.MinPower, math.Min(recommended, device.MaxPower))
+	s.mu.Lock()
+	st := s.states[device.Id]
+	st.on, st.recommended, st.controlTime = c.On, recommended, now
+	s.mu.Unlock()
+	s.publish(device.BudgetTopic, s.budgets(now)[index])
+	return nil
+}
+
+// device2EM returns the description, status and energy requests of the devices,
+// or of one device when id is not empty.
+func (s *Service) device2EM(id string, now time.Time) Device2EM {
+	var m Device2EM
+	requests := PlanningRequest{}
+	budgets := s.budgets(now)
+	for i, d := range s.settings.Devices {
+		if id != "" && d.Id != id {
+			continue
+		}
+		s.mu.Lock()
+		st := *s.states[d.Id]
+		s.mu.Unlock()
+		status := DeviceStatus{DeviceId: d.Id, EMSignalsAccepted: true, Status: "Off",
+			PowerInfo: PowerInfo{AveragingInterval: 60}}
+		method := "Measurement"
+		if d.PowerTopic == "" {
+			// Without measure, the device is assumed to follow its budget
+			method = "Estimation"
+			status.PowerInfo.AveragePower = int(budgets[i])
+		} else if now.Sub(st.powerTime) > StaleTimeout {
+			status.Status = "Offline"
+		} else {
+			status.PowerInfo.AveragePower = int(math.Max(st.power, 0))
+		}
+		if status.Status != "Offline" && status.PowerInfo.AveragePower > 0 {
+			status.Status = "On"
+		}
+		m.DeviceInfo = append(m.DeviceInfo, DeviceInfo{
+			Identification: Identification{DeviceId: d.Id, DeviceName: d.Name, DeviceType: d.Type, DeviceSerial: d.Serial, DeviceVendor: d.Vendor},
+			Characteristics: Characteristics{
+				MinPowerConsumption: int(d.MinPower),
+				MaxPowerConsumption: int(d.MaxPower),
+			},
+			Capabilities: Capabilities{CurrentPowerMethod: method, InterruptionsAllowed: true, OptionalEnergy: true},
+		})
+		m.DeviceStatus = append(m.DeviceStatus, status)
+		if d.MaxEnergy > 0 {
+			requests.Timeframe = append(requests.Timeframe, Timeframe{
+				DeviceId:            d.Id,
+				LatestEnd:           int((24 * time.Hour).Seconds()),
+				MaxEnergy:           int(d.MaxEnergy),
+				MaxPowerConsumption: int(d.MaxPower),
+				MinPowerConsumption: int(d.MinPower),
+			})
+		}
+	}
+	if len(requests.Timeframe) > 0 {
+		m.PlanningRequest = []PlanningRequest{requests}
+	}
+	return m
+}
+
+// handler returns the HTTP server of the gateway:
+//
+//	GET  /description.xml                     the UPnP description
+//	GET  /semp/                               every device
+//	GET  /semp/DeviceInfo?DeviceId=...        the description of the devices
+//	GET  /semp/DeviceStatus?DeviceId=...      their status
+//	GET  /semp/PlanningRequest?DeviceId=...   their energy requests
+//	POST /semp/                               the controls of the Home Manager
+func (s *Service) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/description.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		if err := description.Execute(w, s.settings); err != nil {
+			fmt.Printf("%s: error writing the description: %s\n", ProgNameMqtt, err)
+		}
+	})
+	mux.HandleFunc(BasePath+"/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			s.handleControl(w, r)
+			return
+		}
+		m := s.device2EM(r.URL.Query().Get("DeviceId"), time.Now())
+		switch r.URL.Path {
+		case BasePath + "/":
+		case BasePath + "/DeviceInfo":
+			m.DeviceStatus, m.PlanningRequest = nil, nil
+		case BasePath + "/DeviceStatus":
+			m.DeviceInfo, m.PlanningRequest = nil, nil
+		case BasePath + "/PlanningRequest":
+			m.DeviceInfo, m.DeviceStatus = nil, nil
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		writeXml(w, m)
+	})
+	return mux
+}
+
+func (s *Service) handleControl(w http.ResponseWriter, r *http.Request) {
+	var m EM2Device
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<16))
+	if err == nil {
+		err = xml.Unmarshal(body, &m)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	for _, c := range m.DeviceControl {
+		if err := s.control(c, now); err != nil {
+			fmt.Printf("%s: ignoring a control: %s\n", ProgNameMqtt, err)
+		}
+	}
+}
+
+func writeXml(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(body); err != nil {
+		fmt.Printf("%s: error writing a response: %s\n", ProgNameMqtt, err)
+	}
+}
+
+// OnConnect has nothing to restore, the budgets are sent again every interval.
+func (s *Service) OnConnect() {
+}
+
+// Run publishes the budgets every interval and announces the gateway until a signal
+// is received, and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	ticker := time.NewTicker(s.settings.Interval)
+	defer ticker.Stop()
+	announce := time.NewTicker(AnnounceInterval)
+	defer announce.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for i, budget := range s.budgets(now) {
+				s.publish(s.settings.Devices[i].BudgetTopic, budget)
+			}
+		case <-announce.C:
+			s.ssdp.notify(true)
+		case sig := <-signals:
+			fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+			for _, d := range s.settings.Devices {
+				s.publish(d.BudgetTopic, 0)
+			}
+			s.ssdp.close()
+			s.server.Close()
+			return 0
+		}
+	}
+}
+
+func (s *Service) publish(topic string, power float64) {
+	s.client.Publish(topic, 0, false, strconv.FormatFloat(power, 'f', 0, 64))
+}
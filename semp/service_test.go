@@ -0,0 +1,206 @@
+package semp2mqtt
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeClient records the publications and delivers messages to the subscriptions.
+type fakeClient struct {
+	mqtt.Client
+	mu        sync.Mutex
+	handlers  map[string]mqtt.MessageHandler
+	published map[string]string
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{handlers: map[string]mqtt.MessageHandler{}, published: map[string]string{}}
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, handler mqtt.MessageHandler) mqtt.Token {
+	c.handlers[topic] = handler
+	return nil
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published[topic] = payload.(string)
+	return nil
+}
+
+func (c *fakeClient) deliver(topic, payload string) {
+	c.handlers[topic](c, message{topic: topic, payload: payload})
+}
+
+type message struct {
+	mqtt.Message
+	topic, payload string
+}
+
+func (m message) Topic() string   { return m.topic }
+func (m message) Payload() []byte { return []byte(m.payload) }
+
+func testService(t *testing.T) (*Service, *fakeClient) {
+	settings := DefaultSettings()
+	settings.Devices = append(settings.Devices, Device{
+		Id: "F-00000001-000000000002-00", Name: "Garage", Type: EVCharger,
+		MinPower: 4140, MaxPower: 11000, PowerTopic: "garage/power", BudgetTopic: "garage/budget",
+	})
+	if err := settings.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	client := newFakeClient()
+	return newService(client, settings), client
+}
+
+func TestDevice2EM(t *testing.T) {
+	s, client := testService(t)
+	client.deliver("garage/power", "7200")
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/semp/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var m Device2EM
+	if err = xml.NewDecoder(resp.Body).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.DeviceInfo) != 2 || m.DeviceInfo[1].Characteristics.MaxPowerConsumption != 11000 ||
+		m.DeviceInfo[0].Capabilities.CurrentPowerMethod != "Estimation" || m.DeviceInfo[1].Capabilities.CurrentPowerMethod != "Measurement" {
+		t.Errorf("DeviceInfo = %+v, want both devices, measured or estimated", m.DeviceInfo)
+	}
+	if len(m.DeviceStatus) != 2 || m.DeviceStatus[0].Status != "Off" ||
+		m.DeviceStatus[1].Status != "On" || m.DeviceStatus[1].PowerInfo.AveragePower != 7200 {
+		t.Errorf("DeviceStatus = %+v, want the first off and the second at its measured power", m.DeviceStatus)
+	}
+	if len(m.PlanningRequest) != 1 || len(m.PlanningRequest[0].Timeframe) != 1 ||
+		m.PlanningRequest[0].Timeframe[0].MaxEnergy != 20000 || m.PlanningRequest[0].Timeframe[0].MinEnergy != 0 {
+		t.Errorf("PlanningRequest = %+v, want the optional energy of the first device", m.PlanningRequest)
+	}
+
+	resp, err = http.Get(server.URL + "/semp/DeviceStatus?DeviceId=F-00000001-000000000002-00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	m = Device2EM{}
+	if err = xml.NewDecoder(resp.Body).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.DeviceInfo) != 0 || len(m.DeviceStatus) != 1 || m.DeviceStatus[0].DeviceId != "F-00000001-000000000002-00" {
+		t.Errorf("DeviceStatus of one device = %+v", m)
+	}
+}
+
+func TestControl(t *testing.T) {
+	s, client := testService(t)
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	control := `<?xml version="1.0" encoding="UTF-8"?>
+<EM2Device xmlns="http://www.sma.de/communication/schema/SEMP/v1">
+  <DeviceControl>
+    <DeviceId>F-00000001-000000000001-00</DeviceId>
+    <On>true</On>
+    <RecommendedPowerConsumption>3000</RecommendedPowerConsumption>
+    <Timestamp>0</Timestamp>
+  </DeviceControl>
+  <DeviceControl>
+    <DeviceId>F-00000001-000000000002-00</DeviceId>
+    <On>true</On>
+    <RecommendedPowerConsumption>2000</RecommendedPowerConsumption>
+    <Timestamp>0</Timestamp>
+  </DeviceControl>
+</EM2Device>`
+	resp, err := http.Post(server.URL+"/semp/", "application/xml", strings.NewReader(control))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %s", resp.Status)
+	}
+	if got := client.published["semp2mqtt/ev_budget"]; got != "3000" {
+		t.Errorf("budget = %s, want the recommended 3000", got)
+	}
+	if got := client.published["garage/budget"]; got != "4140" {
+		t.Errorf("budget = %s, want the min power 4140", got)
+	}
+
+	d := s.settings.Devices[0]
+	now := time.Now()
+	if got := s.budget(d, now.Add(s.settings.ControlTimeout+time.Second)); got != 0 {
+		t.Errorf("budget after the control timeout = %v, want 0", got)
+	}
+	s.control(DeviceControl{DeviceId: d.Id, On: false, RecommendedPowerConsumption: 3000}, now)
+	if got := client.published["semp2mqtt/ev_budget"]; got != "0" {
+		t.Errorf("budget when off = %s, want 0", got)
+	}
+	if err := s.control(DeviceControl{DeviceId: "F-00000001-000000000009-00", On: true}, now); err == nil {
+		t.Error("control of an unknown device succeeded")
+	}
+}
+
+func TestDescription(t *testing.T) {
+	s, _ := testService(t)
+	s.settings.Url, s.settings.Uuid = "http://192.168.0.21:9765", "1234"
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/description.xml", nil))
+	for _, want := range []string{"<UDN>uuid:1234</UDN>", "<semp:server>http://192.168.0.21:9765</semp:server>", "<semp:basePath>/semp</semp:basePath>"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("description has no %s:\n%s", want, w.Body.String())
+		}
+	}
+}
+
+func TestSsdpResponses(t *testing.T) {
+	s := &ssdp{uuid: "1234", location: "http://192.168.0.21:9765/description.xml"}
+	search := func(st string) [][]byte {
+		return s.responses([]byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\n" +
+			"MAN: \"ssdp:discover\"\r\nMX: 3\r\nST: " + st + "\r\n\r\n"))
+	}
+	if got := search("ssdp:all"); len(got) != 3 {
+		t.Errorf("ssdp:all responses = %d, want 3", len(got))
+	}
+	got := search(GatewayType)
+	if len(got) != 1 || !strings.Contains(string(got[0]), "USN: uuid:1234::"+GatewayType+"\r\n") ||
+		!strings.Contains(string(got[0]), "LOCATION: http://192.168.0.21:9765/description.xml\r\n") {
+		t.Errorf("gateway responses = %q", got)
+	}
+	if got := search("urn:schemas-upnp-org:device:MediaRenderer:1"); len(got) != 0 {
+		t.Errorf("responses to another device type = %q", got)
+	}
+}
+
+func TestCurtailment(t *testing.T) {
+	s, _ := testService(t)
+	now := time.Now()
+	for _, id := range []string{"F-00000001-000000000001-00", "F-00000001-000000000002-00"} {
+		s.control(DeviceControl{DeviceId: id, On: true, RecommendedPowerConsumption: 3000}, now)
+	}
+	if got := s.budgets(now); got[0] != 3000 || got[1] != 4140 {
+		t.Fatalf("budgets = %v, want the recommendations", got)
+	}
+	s.curtailment.Receive([]byte(`{"id": "a", "limit": 5000, "duration": 60}`), now)
+	if got := s.budgets(now); got[0] != 3000 || got[1] != 0 {
+		t.Errorf("budgets capped at 5000 W = %v, want the second device stopped below its min power", got)
+	}
+	s.curtailment.Receive([]byte(`{"id": "a", "limit": 2000, "duration": 60}`), now)
+	if got := s.budgets(now); got[0] != 2000 || got[1] != 0 {
+		t.Errorf("budgets capped at 2000 W = %v, want the first device reduced", got)
+	}
+	if got := s.budgets(now.Add(time.Minute)); got[0] != 3000 || got[1] != 4140 {
+		t.Errorf("budgets once the curtailment ended = %v, want the recommendations", got)
+	}
+}
@@ -0,0 +1,114 @@
+package semp2mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SSDP discovery of the gateway by the Home Manager.
+const (
+	SsdpAddress = "239.255.255.250:1900"
+	// AnnounceInterval is the delay between two alive notifications, well below
+	// their max-age.
+	AnnounceInterval = 5 * time.Minute
+	maxAge           = 1800
+	server           = "Linux/1.0 UPnP/1.0 semp2mqtt/1.0"
+)
+
+// ssdp answers the searches of the Home Manager and announces the gateway.
+type ssdp struct {
+	uuid     string
+	location string
+	conn     *net.UDPConn
+	group    *net.UDPAddr
+}
+
+func newSsdp(uuid, location string) (*ssdp, error) {
+	group, err := net.ResolveUDPAddr("udp4", SsdpAddress)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, fmt.Errorf("error joining the SSDP group: %w", err)
+	}
+	return &ssdp{uuid: uuid, location: location, conn: conn, group: group}, nil
+}
+
+// targets are the notification types of the gateway.
+func (s *ssdp) targets() []string {
+	return []string{"upnp:rootdevice", "uuid:" + s.uuid, GatewayType}
+}
+
+// usn is the unique service name of the gateway for a notification type.
+func (s *ssdp) usn(target string) string {
+	if target == "uuid:"+s.uuid {
+		return target
+	}
+	return "uuid:" + s.uuid + "::" + target
+}
+
+// serve answers the M-SEARCH requests until the connection is closed.
+func (s *ssdp) serve() {
+	buffer := make([]byte, 2048)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		for _, response := range s.responses(buffer[:n]) {
+			if _, err := s.conn.WriteToUDP(response, from); err != nil {
+				fmt.Printf("%s: error answering %s: %s\n", ProgNameMqtt, from, err)
+			}
+		}
+	}
+}
+
+// responses returns the answers to a SSDP request, none unless it searches the gateway.
+func (s *ssdp) responses(request []byte) [][]byte {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(request)))
+	if err != nil || req.Method != "M-SEARCH" || req.Header.Get("Man") != `"ssdp:discover"` {
+		return nil
+	}
+	st := req.Header.Get("St")
+	var responses [][]byte
+	for _, target := range s.targets() {
+		if st == "ssdp:all" || st == target {
+			responses = append(responses, []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\n"+
+				"CACHE-CONTROL: max-age=%d\r\nEXT:\r\nLOCATION: %s\r\nSERVER: %s\r\nST: %s\r\nUSN: %s\r\n\r\n",
+				maxAge, s.location, server, target, s.usn(target))))
+		}
+	}
+	return responses
+}
+
+// notify sends an alive or byebye notification for every notification type.
+func (s *ssdp) notify(alive bool) {
+	for _, target := range s.targets() {
+		lines := []string{
+			"NOTIFY * HTTP/1.1",
+			"HOST: " + SsdpAddress,
+			"NT: " + target,
+			"USN: " + s.usn(target),
+		}
+		if alive {
+			lines = append(lines, "NTS: ssdp:alive", fmt.Sprintf("CACHE-CONTROL: max-age=%d", maxAge),
+				"LOCATION: "+s.location, "SERVER: "+server)
+		} else {
+			lines = append(lines, "NTS: ssdp:byebye")
+		}
+		if _, err := s.conn.WriteToUDP([]byte(strings.Join(lines, "\r\n")+"\r\n\r\n"), s.group); err != nil {
+			fmt.Printf("%s: error announcing the gateway: %s\n", ProgNameMqtt, err)
+		}
+	}
+}
+
+func (s *ssdp) close() {
+	s.notify(false)
+	s.conn.Close()
+}
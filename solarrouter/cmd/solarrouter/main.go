@@ -0,0 +1,7 @@
+package main
+
+import "solarrouter"
+
+func main() {
+	solarrouter.Main()
+}
@@ -0,0 +1,65 @@
+package solarrouter
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Output modes
+const (
+	// Dimmer drives the load power continuously, e.g. a Shelly Dimmer or a triac module.
+	Dimmer = "dimmer"
+	// Relay switches the load in burst mode: on for a share of every period.
+	Relay = "relay"
+)
+
+// Output is the device driving the load, through MQTT commands.
+type Output struct {
+	// Mode is dimmer or relay.
+	Mode string `yaml:"mode"`
+	// CommandTopic receives the commands, e.g. shellies/<id>/relay/0/command.
+	CommandTopic string `yaml:"command_topic"`
+	// DimmerPayload is the command of a dimmer, %d being replaced by the level in percent.
+	DimmerPayload string `yaml:"dimmer_payload"`
+	// OnPayload switches a relay on.
+	OnPayload string `yaml:"on_payload"`
+	// OffPayload switches the load off, in both modes.
+	OffPayload string `yaml:"off_payload"`
+}
+
+func (o Output) validate() error {
+	if o.Mode != Dimmer && o.Mode != Relay {
+		return fmt.Errorf("unsupported output mode '%s', expected %s or %s", o.Mode, Dimmer, Relay)
+	}
+	if o.CommandTopic == "" {
+		return fmt.Errorf("output without command topic")
+	}
+	if o.Mode == Dimmer && o.DimmerPayload == "" {
+		return fmt.Errorf("dimmer output without dimmer payload")
+	}
+	return nil
+}
+
+// payload returns the command of a dimmer level or relay state, in percent.
+func (o Output) payload(level int) string {
+	switch {
+	case level == 0:
+		return o.OffPayload
+	case o.Mode == Relay:
+		return o.OnPayload
+	}
+	return fmt.Sprintf(o.DimmerPayload, level)
+}
+
+// level returns the output level, in percent, for a duty cycle between 0 and 1.
+// A relay in burst mode is on during the first duty share of the period.
+func (o Output) level(duty float64, elapsed, period time.Duration) int {
+	if o.Mode == Dimmer {
+		return int(math.Round(duty * 100))
+	}
+	if elapsed < time.Duration(duty*float64(period)) {
+		return 100
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package solarrouter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelayBurst(t *testing.T) {
+	relay := Output{Mode: Relay, OnPayload: "on", OffPayload: "off"}
+	period := 5 * time.Minute
+	for _, tt := range []struct {
+		duty    float64
+		elapsed time.Duration
+		want    int
+	}{
+		{0, 0, 0},
+		{0.4, 0, 100},
+		{0.4, 119 * time.Second, 100},
+		{0.4, 120 * time.Second, 0},
+		{1, 299 * time.Second, 100},
+	} {
+		if got := relay.level(tt.duty, tt.elapsed, period); got != tt.want {
+			t.Errorf("duty %v after %s: got %d, want %d", tt.duty, tt.elapsed, got, tt.want)
+		}
+	}
+	if relay.payload(100) != "on" || relay.payload(0) != "off" {
+		t.Errorf("relay payloads: got %s and %s", relay.payload(100), relay.payload(0))
+	}
+}
+
+func TestDimmer(t *testing.T) {
+	dimmer := Output{Mode: Dimmer, DimmerPayload: `{"turn":"on","brightness":%d}`, OffPayload: `{"turn":"off"}`}
+	if got := dimmer.level(0.426, time.Minute, 5*time.Minute); got != 43 {
+		t.Errorf("dimmer level: got %d, want 43", got)
+	}
+	if got := dimmer.payload(43); got != `{"turn":"on","brightness":43}` {
+		t.Errorf("dimmer payload: got %s", got)
+	}
+	if got := dimmer.payload(0); got != `{"turn":"off"}` {
+		t.Errorf("dimmer off payload: got %s", got)
+	}
+}
@@ -0,0 +1,313 @@
+// Package solarrouter diverts the exported solar power to a resistive load, e.g.
+// a water heater, through a dimmer or a relay driven by MQTT (Shelly, Sonoff...).
+package solarrouter
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"energy-center/mqttclient"
+	"energy-center/regulation"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+const ProgNameMqtt string = "solarrouter"
+
+// StaleTimeout is the delay without grid power after which the load is switched off.
+const StaleTimeout = 1 * time.Minute
+
+// ShutdownTimeout bounds the delivery of the off command on shutdown.
+const ShutdownTimeout = 5 * time.Second
+
+// tick is the resolution of the burst mode.
+const tick = 1 * time.Second
+
+// Regulators
+const (
+	// Surplus follows the grid power, keeping it at the target.
+	Surplus = "surplus"
+	// Reserve gives the load the PV production left once a share of it is
+	// reserved for the house.
+	Reserve = "reserve"
+)
+
+// ReserveSettings are the reservation of the reserve regulator.
+type ReserveSettings struct {
+	// Share is the fraction of the production reserved for the house, in [0, 1].
+	Share float64 `yaml:"share"`
+	// Power is reserved for the house on top of the share, in W.
+	Power float64 `yaml:"power"`
+}
+
+// Settings are the settings of the router, from the configuration file of solarrouter
+// or the solarrouter section of the energy-center configuration file.
+type Settings struct {
+	// Mqtt is the broker connection of solarrouter, ignored by the daemon.
+	Mqtt mqttclient.Config `yaml:"mqtt"`
+	// GridTopic is the grid power, in W, positive when drawn.
+	GridTopic string `yaml:"grid_topic"`
+	// PvTopic is the PV production, in W, needed by the reserve regulator.
+	PvTopic string `yaml:"pv_topic"`
+	// HouseTopic is the house consumption without the load, in W, optional.
+	HouseTopic string `yaml:"house_topic"`
+	// Regulator is surplus or reserve.
+	Regulator string          `yaml:"regulator"`
+	Reserve   ReserveSettings `yaml:"reserve"`
+	// Target is the grid power the router keeps, in W, e.g. -50 to always export a little.
+	Target float64 `yaml:"target"`
+	// Gain is the share of the distance to the target corrected at every step.
+	Gain float64 `yaml:"gain"`
+	// MaxPower is the power of the load when fully on, in W.
+	MaxPower float64 `yaml:"max_power"`
+	// Interval is the delay between two adjustments of a dimmer.
+	Interval time.Duration `yaml:"interval"`
+	// Period is the burst period of a relay, adjusted once per period.
+	Period time.Duration `yaml:"period"`
+	Output Output        `yaml:"output"`
+	// TopicPrefix is the root of the topics of the router state.
+	TopicPrefix string `yaml:"topic_prefix"`
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Mqtt:        mqttclient.Config{Url: "192.168.0.20:1883", ClientId: ProgNameMqtt},
+		GridTopic:   "powerinfo/grid",
+		Regulator:   Surplus,
+		Target:      -50,
+		Gain:        0.5,
+		Interval:    5 * time.Second,
+		Period:      5 * time.Minute,
+		Output:      Output{Mode: Relay},
+		TopicPrefix: ProgNameMqtt,
+	}
+}
+
+func (s Settings) Validate() error {
+	if s.MaxPower <= 0 {
+		return fmt.Errorf("max_power must be the power of the load")
+	}
+	if s.Gain <= 0 || s.Gain > 1 {
+		return fmt.Errorf("gain must be in ]0, 1]")
+	}
+	switch s.Regulator {
+	case Surplus:
+	case Reserve:
+		if s.PvTopic == "" {
+			return fmt.Errorf("the reserve regulator needs the pv_topic")
+		}
+		if s.Reserve.Share < 0 || s.Reserve.Share > 1 || s.Reserve.Power < 0 {
+			return fmt.Errorf("reserve share must be in [0, 1] and power positive")
+		}
+	default:
+		return fmt.Errorf("unsupported regulator '%s', expected %s or %s", s.Regulator, Surplus, Reserve)
+	}
+	if s.Interval < tick || s.Period < tick {
+		return fmt.Errorf("interval and period must be at least %s", tick)
+	}
+	return s.Output.validate()
+}
+
+// step returns the delay between two regulations.
+func (s Settings) step() time.Duration {
+	if s.Output.Mode == Relay {
+		return s.Period
+	}
+	return s.Interval
+}
+
+// LoadSettings reads the settings from a YAML file, over the defaults.
+func LoadSettings(path string) (Settings, error) {
+	settings := DefaultSettings()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return settings, err
+	}
+	if err = yaml.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Main runs the router with its own MQTT connection, configured by a YAML file.
+func Main() {
+	var path string
+	flag.StringVar(&path, "config", "/etc/solarrouter.yaml", "YAML configuration file")
+	flag.Parse()
+
+	settings, err := LoadSettings(path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	mqtt.ERROR = log.New(os.Stdout, "", 0)
+	var service *Service
+	client, err := mqttclient.New(settings.Mqtt, mqttclient.Options{
+		ConnectRetry: true,
+		OnConnect: func(client mqtt.Client) {
+			service.OnConnect()
+		},
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	service, err = NewService(client, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
+
+// Service is the router, on a MQTT connection it does not own, either the one of
+// solarrouter or the one shared by the energy-center daemon.
+type Service struct {
+	client    mqtt.Client
+	settings  Settings
+	regulator regulation.Regulator
+
+	mu sync.Mutex
+	// The grid power samples received since the last regulation
+	gridSum   float64
+	gridCount int
+	gridTime  time.Time
+	// The last PV production and house consumption
+	pv        float64
+	pvTime    time.Time
+	house     float64
+	houseTime time.Time
+
+	duty     float64
+	stepTime time.Time
+	level    int
+}
+
+// NewService subscribes to the grid power and the production. The client must restore the subscriptions
+// on reconnection, as a mqttclient.Client does.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Service{
+		client:    client,
+		settings:  settings,
+		regulator: &regulation.Surplus{Target: settings.Target, Gain: settings.Gain, Max: settings.MaxPower},
+		level:     -1,
+	}
+	if settings.Regulator == Reserve {
+		s.regulator = &regulation.Reserve{Share: settings.Reserve.Share, Power: settings.Reserve.Power, Max: settings.MaxPower}
+	}
+	client.Subscribe(settings.GridTopic, 0, s.onGridPower)
+	if settings.PvTopic != "" {
+		client.Subscribe(settings.PvTopic, 0, s.listen(func(v float64) { s.pv, s.pvTime = v, time.Now() }))
+	}
+	if settings.HouseTopic != "" {
+		client.Subscribe(settings.HouseTopic, 0, s.listen(func(v float64) { s.house, s.houseTime = v, time.Now() }))
+	}
+	return s, nil
+}
+
+// listen returns a handler updating the service with the value of a topic.
+func (s *Service) listen(update func(v float64)) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		v, err := strconv.ParseFloat(string(msg.Payload()), 64)
+		if err != nil {
+			fmt.Printf("%s: ignoring %s: %s\n", ProgNameMqtt, msg.Topic(), err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		update(v)
+	}
+}
+
+func (s *Service) onGridPower(client mqtt.Client, msg mqtt.Message) {
+	v, err := strconv.ParseFloat(string(msg.Payload()), 64)
+	if err != nil {
+		fmt.Printf("%s: ignoring %s: %s\n", ProgNameMqtt, msg.Topic(), err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gridSum += v
+	s.gridCount++
+	s.gridTime = time.Now()
+}
+
+// OnConnect sends the output command again, the device may have missed it.
+func (s *Service) OnConnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.level >= 0 {
+		s.command(s.level)
+	}
+}
+
+// Run regulates the load until a signal is received, switches it off and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.update(now)
+		case sig := <-signals:
+			fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+			s.mu.Lock()
+			s.client.Publish(s.settings.Output.CommandTopic, 0, false, s.settings.Output.OffPayload).WaitTimeout(ShutdownTimeout)
+			s.mu.Unlock()
+			return 0
+		}
+	}
+}
+
+// update regulates once per step, from the average grid power since the previous
+// step, and switches a relay according to its burst.
+func (s *Service) update(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.stepTime) >= s.settings.step() {
+		if s.gridCount == 0 || now.Sub(s.gridTime) > StaleTimeout {
+			s.regulator.Reset()
+			s.duty = 0
+		} else {
+			input := regulation.RegulationInput{Time: now, GridPower: s.gridSum / float64(s.gridCount)}
+			if !s.pvTime.IsZero() && now.Sub(s.pvTime) <= StaleTimeout {
+				input.PvPower, input.HasPv = s.pv, true
+			}
+			if !s.houseTime.IsZero() && now.Sub(s.houseTime) <= StaleTimeout {
+				input.HousePower, input.HasHouse = s.house, true
+			}
+			s.duty = s.regulator.Regulate(input) / s.settings.MaxPower
+		}
+		s.gridSum, s.gridCount = 0, 0
+		s.stepTime = now
+		s.client.Publish(s.settings.TopicPrefix+"/power", 0, false, strconv.FormatFloat(s.duty*s.settings.MaxPower, 'f', 0, 64))
+		s.client.Publish(s.settings.TopicPrefix+"/duty", 0, false, strconv.FormatFloat(s.duty*100, 'f', 0, 64))
+	}
+	if level := s.settings.Output.level(s.duty, now.Sub(s.stepTime), s.settings.Period); level != s.level {
+		s.level = level
+		s.command(level)
+	}
+}
+
+func (s *Service) command(level int) {
+	s.client.Publish(s.settings.Output.CommandTopic, 0, false, s.settings.Output.payload(level))
+}
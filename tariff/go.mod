@@ -0,0 +1,3 @@
+module energy-center/tariff
+
+go 1.17
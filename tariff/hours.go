@@ -0,0 +1,50 @@
+package tariff
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Hours is a period of the day, in minutes since midnight. It may span midnight.
+type Hours struct {
+	From, To int
+}
+
+// Contains reports whether the period contains the time of the day of at.
+func (h Hours) Contains(at time.Time) bool {
+	minute := at.Hour()*60 + at.Minute()
+	if h.From <= h.To {
+		return minute >= h.From && minute < h.To
+	}
+	return minute >= h.From || minute < h.To
+}
+
+// ParseHours parses a period of the day, e.g. 22:00-06:00.
+func ParseHours(period string) (Hours, error) {
+	bounds := strings.Split(period, "-")
+	if len(bounds) != 2 {
+		return Hours{}, fmt.Errorf("invalid hours '%s', expected e.g. 22:00-06:00", period)
+	}
+	var h [2]int
+	for i, bound := range bounds {
+		t, err := time.Parse("15:04", strings.TrimSpace(bound))
+		if err != nil {
+			return Hours{}, fmt.Errorf("invalid hours '%s': %w", period, err)
+		}
+		h[i] = t.Hour()*60 + t.Minute()
+	}
+	return Hours{h[0], h[1]}, nil
+}
+
+func parseAllHours(periods []string) ([]Hours, error) {
+	var parsed []Hours
+	for _, period := range periods {
+		h, err := ParseHours(period)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, h)
+	}
+	return parsed, nil
+}
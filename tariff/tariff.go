@@ -0,0 +1,248 @@
+// Package tariff computes the price of the electricity at any time of the day for
+// the options of the French offers (base, HP/HC, Tempo, EJP) and custom price
+// curves, for the services accounting costs or scheduling loads.
+package tariff
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Tariff options
+const (
+	OptionBase  = "base"
+	OptionHpHc  = "hphc"
+	OptionTempo = "tempo"
+	OptionEjp   = "ejp"
+	OptionCurve = "curve"
+)
+
+// Days of the Tempo and EJP options, announced by the supplier and reported by
+// the Linky, e.g. on teleinfo/STGE_tempo_today.
+const (
+	Blue      = "bleu"
+	White     = "blanc"
+	Red       = "rouge"
+	EjpNormal = "normal"
+	EjpPeak   = "pointe"
+)
+
+const (
+	DefaultCurrency     = "EUR"
+	DefaultOffPeakHours = "22:00-06:00"
+	// DefaultEjpPeakHours are the 18 hours of the EJP peak days.
+	DefaultEjpPeakHours = "07:00-01:00"
+)
+
+// Config holds the electricity prices, per kWh.
+type Config struct {
+	// Option is base, hphc, tempo, ejp or curve.
+	Option   string `yaml:"option"`
+	Currency string `yaml:"currency"`
+	// Base is the price of the base option, and of the hours of the curve option
+	// no curve period covers.
+	Base float64 `yaml:"base"`
+	// Peak and OffPeak are the prices of the hphc option.
+	Peak    float64 `yaml:"peak"`
+	OffPeak float64 `yaml:"off_peak"`
+	// OffPeakHours are the off-peak periods of the hphc and tempo options, e.g. "22:00-06:00".
+	OffPeakHours []string `yaml:"off_peak_hours"`
+	// Tempo holds the peak and off-peak prices of the tempo option, by color: bleu, blanc and rouge.
+	Tempo map[string]PeakPrices `yaml:"tempo"`
+	// Ejp holds the prices of the ejp option.
+	Ejp EjpPrices `yaml:"ejp"`
+	// Curve holds the periods of the curve option, e.g. those of a dynamic offer.
+	Curve []CurvePrice `yaml:"curve"`
+}
+
+// PeakPrices are the prices of a Tempo color.
+type PeakPrices struct {
+	Peak    float64 `yaml:"peak"`
+	OffPeak float64 `yaml:"off_peak"`
+}
+
+// EjpPrices are the prices of the EJP option: Peak during the peak hours of the
+// peak days, Normal otherwise.
+type EjpPrices struct {
+	Normal    float64 `yaml:"normal"`
+	Peak      float64 `yaml:"peak"`
+	PeakHours string  `yaml:"peak_hours"`
+}
+
+// CurvePrice is the price of a period of the day, e.g. "08:00-12:00".
+type CurvePrice struct {
+	Hours string  `yaml:"hours"`
+	Price float64 `yaml:"price"`
+	// Name names the period in the reports, the hours when empty.
+	Name string `yaml:"name"`
+}
+
+// Validate checks the option and its prices.
+func (c Config) Validate() error {
+	switch c.Option {
+	case OptionBase, OptionHpHc:
+	case OptionTempo:
+		for _, color := range []string{Blue, White, Red} {
+			if _, ok := c.Tempo[color]; !ok {
+				return fmt.Errorf("missing tempo price of %s days", color)
+			}
+		}
+	case OptionEjp:
+		if c.Ejp.PeakHours != "" {
+			if _, err := ParseHours(c.Ejp.PeakHours); err != nil {
+				return err
+			}
+		}
+	case OptionCurve:
+		if len(c.Curve) == 0 {
+			return fmt.Errorf("the curve option needs periods")
+		}
+		for _, p := range c.Curve {
+			if _, err := ParseHours(p.Hours); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported tariff option '%s', expected base, hphc, tempo, ejp or curve", c.Option)
+	}
+	_, err := parseAllHours(c.OffPeakHours)
+	return err
+}
+
+// Tariff gives the price of the kWh at any time. The Tempo and EJP prices depend
+// on the day, set with SetDay.
+type Tariff struct {
+	config  Config
+	offPeak []Hours
+	ejpPeak Hours
+	curve   []Hours
+
+	mu  sync.Mutex
+	day string
+}
+
+// New validates the configuration and applies its defaults.
+func New(config Config) (*Tariff, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.Currency == "" {
+		config.Currency = DefaultCurrency
+	}
+	if len(config.OffPeakHours) == 0 {
+		config.OffPeakHours = []string{DefaultOffPeakHours}
+	}
+	if config.Ejp.PeakHours == "" {
+		config.Ejp.PeakHours = DefaultEjpPeakHours
+	}
+	t := &Tariff{config: config}
+	t.offPeak, _ = parseAllHours(config.OffPeakHours)
+	t.ejpPeak, _ = ParseHours(config.Ejp.PeakHours)
+	for _, p := range config.Curve {
+		h, _ := ParseHours(p.Hours)
+		t.curve = append(t.curve, h)
+	}
+	return t, nil
+}
+
+// Option returns the tariff option.
+func (t *Tariff) Option() string {
+	return t.config.Option
+}
+
+// Currency returns the currency of the prices.
+func (t *Tariff) Currency() string {
+	return t.config.Currency
+}
+
+// SetDay sets the Tempo color or the EJP day, and reports whether it is known.
+// Until it is set, days are assumed blue or normal as most of them are.
+func (t *Tariff) SetDay(day string) bool {
+	switch t.config.Option {
+	case OptionTempo:
+		if _, known := t.config.Tempo[day]; !known {
+			return false
+		}
+	case OptionEjp:
+		if day != EjpNormal && day != EjpPeak {
+			return false
+		}
+	default:
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.day = day
+	return true
+}
+
+// Day returns the Tempo color or the EJP day set last, empty if none.
+func (t *Tariff) Day() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.day
+}
+
+func (t *Tariff) isOffPeak(at time.Time) bool {
+	for _, h := range t.offPeak {
+		if h.Contains(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// Price returns the price of a kWh consumed at the given time.
+func (t *Tariff) Price(at time.Time) float64 {
+	price, _ := t.price(at)
+	return price
+}
+
+// Period returns the name of the tariff period at the given time, e.g. hc, hp_rouge
+// or pointe, to account the consumption by period.
+func (t *Tariff) Period(at time.Time) string {
+	_, period := t.price(at)
+	return period
+}
+
+// Cost returns the cost of energy Wh consumed at the given time.
+func (t *Tariff) Cost(energy float64, at time.Time) float64 {
+	return energy / 1000 * t.Price(at)
+}
+
+func (t *Tariff) price(at time.Time) (float64, string) {
+	switch t.config.Option {
+	case OptionHpHc:
+		if t.isOffPeak(at) {
+			return t.config.OffPeak, "hc"
+		}
+		return t.config.Peak, "hp"
+	case OptionTempo:
+		color := t.Day()
+		if color == "" {
+			color = Blue
+		}
+		prices := t.config.Tempo[color]
+		if t.isOffPeak(at) {
+			return prices.OffPeak, "hc_" + color
+		}
+		return prices.Peak, "hp_" + color
+	case OptionEjp:
+		if t.Day() == EjpPeak && t.ejpPeak.Contains(at) {
+			return t.config.Ejp.Peak, EjpPeak
+		}
+		return t.config.Ejp.Normal, EjpNormal
+	case OptionCurve:
+		for i, h := range t.curve {
+			if h.Contains(at) {
+				p := t.config.Curve[i]
+				if p.Name != "" {
+					return p.Price, p.Name
+				}
+				return p.Price, p.Hours
+			}
+		}
+	}
+	return t.config.Base, OptionBase
+}
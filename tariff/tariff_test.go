@@ -0,0 +1,112 @@
+package tariff
+
+import (
+	"testing"
+	"time"
+)
+
+func at(hour, minute int) time.Time {
+	return time.Date(2024, 1, 15, hour, minute, 0, 0, time.UTC)
+}
+
+func TestHpHc(t *testing.T) {
+	tr, err := New(Config{Option: OptionHpHc, Peak: 0.27, OffPeak: 0.2, OffPeakHours: []string{"22:00-06:00", "12:30-14:30"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		at     time.Time
+		price  float64
+		period string
+	}{
+		{at(23, 0), 0.2, "hc"},
+		{at(5, 59), 0.2, "hc"},
+		{at(6, 0), 0.27, "hp"},
+		{at(13, 0), 0.2, "hc"},
+		{at(14, 30), 0.27, "hp"},
+	} {
+		if p := tr.Price(c.at); p != c.price {
+			t.Errorf("price at %s = %v, want %v", c.at.Format("15:04"), p, c.price)
+		}
+		if p := tr.Period(c.at); p != c.period {
+			t.Errorf("period at %s = %s, want %s", c.at.Format("15:04"), p, c.period)
+		}
+	}
+	if c := tr.Cost(2000, at(10, 0)); c != 0.54 {
+		t.Errorf("cost = %v, want 0.54", c)
+	}
+}
+
+func TestTempo(t *testing.T) {
+	tr, err := New(Config{Option: OptionTempo, Tempo: map[string]PeakPrices{
+		Blue:  {Peak: 0.16, OffPeak: 0.13},
+		White: {Peak: 0.19, OffPeak: 0.15},
+		Red:   {Peak: 0.76, OffPeak: 0.16},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := tr.Price(at(10, 0)); p != 0.16 {
+		t.Errorf("unknown color: price = %v, want the blue peak price", p)
+	}
+	if tr.SetDay("violet") {
+		t.Error("unknown color accepted")
+	}
+	if !tr.SetDay(Red) {
+		t.Fatal("red refused")
+	}
+	if p := tr.Period(at(10, 0)); p != "hp_rouge" {
+		t.Errorf("period = %s, want hp_rouge", p)
+	}
+	if p := tr.Price(at(23, 0)); p != 0.16 {
+		t.Errorf("red off-peak price = %v, want 0.16", p)
+	}
+}
+
+func TestEjp(t *testing.T) {
+	tr, err := New(Config{Option: OptionEjp, Ejp: EjpPrices{Normal: 0.17, Peak: 1.1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := tr.Price(at(10, 0)); p != 0.17 {
+		t.Errorf("normal day: price = %v, want 0.17", p)
+	}
+	tr.SetDay(EjpPeak)
+	for hour, want := range map[int]float64{6: 0.17, 7: 1.1, 0: 1.1, 1: 0.17} {
+		if p := tr.Price(at(hour, 0)); p != want {
+			t.Errorf("peak day at %d:00: price = %v, want %v", hour, p, want)
+		}
+	}
+}
+
+func TestCurve(t *testing.T) {
+	tr, err := New(Config{Option: OptionCurve, Base: 0.25, Curve: []CurvePrice{
+		{Hours: "02:00-06:00", Price: 0.1, Name: "night"},
+		{Hours: "17:00-20:00", Price: 0.4},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, n := tr.Price(at(3, 0)), tr.Period(at(3, 0)); p != 0.1 || n != "night" {
+		t.Errorf("at 03:00: %v %s, want 0.1 night", p, n)
+	}
+	if p, n := tr.Price(at(18, 0)), tr.Period(at(18, 0)); p != 0.4 || n != "17:00-20:00" {
+		t.Errorf("at 18:00: %v %s, want 0.4 17:00-20:00", p, n)
+	}
+	if p, n := tr.Price(at(12, 0)), tr.Period(at(12, 0)); p != 0.25 || n != OptionBase {
+		t.Errorf("at 12:00: %v %s, want the base price", p, n)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []Config{
+		{Option: "flat"},
+		{Option: OptionTempo, Tempo: map[string]PeakPrices{Blue: {}}},
+		{Option: OptionHpHc, OffPeakHours: []string{"22h-6h"}},
+		{Option: OptionCurve},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v: no error", c)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package teleinfo2mqtt
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"energy-center/alerting"
+	"energy-center/home-assistant"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const AvailabilityTopic = "teleinfo/availability"
+const DefaultExitAfter = 30 * time.Minute
+
+// ShutdownTimeout bounds the delivery of the offline availability on shutdown.
+const ShutdownTimeout = 5 * time.Second
+
+// availability reports whether Teleinfo frames are flowing. The bridge is
+// marked offline after WatchdogTimeout without frames, and the service stops
+// once exitAfter has elapsed without any frame, expired being closed.
+type availability struct {
+	client    mqtt.Client
+	alerter   *alerting.Alerter
+	mu        sync.Mutex
+	online    bool
+	exitAfter time.Duration
+	watchdog  *time.Timer
+	deadline  *time.Timer
+	expired   chan struct{}
+	expire    sync.Once
+}
+
+func newAvailability(exitAfter time.Duration, alerter *alerting.Alerter) *availability {
+	a := &availability{exitAfter: exitAfter, alerter: alerter, expired: make(chan struct{})}
+	a.watchdog = time.AfterFunc(WatchdogTimeout, a.silenceDetected)
+	a.deadline = time.AfterFunc(exitAfter, a.deadlineReached)
+	return a
+}
+
+func (a *availability) deadlineReached() {
+	a.alerter.Raise("teleinfo_deadline", alerting.Critical, "no Teleinfo frame for %s, stopping", a.exitAfter)
+	a.expire.Do(func() { close(a.expired) })
+}
+
+// frameReceived resets the timers and reports the bridge online if needed.
+func (a *availability) frameReceived() {
+	a.watchdog.Reset(WatchdogTimeout)
+	a.deadline.Reset(a.exitAfter)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.online {
+		a.online = true
+		a.publish()
+		a.alerter.Resolve("stale_frames", "Teleinfo frames received again")
+	}
+}
+
+func (a *availability) silenceDetected() {
+	fmt.Printf("%s: no Teleinfo frame for %s, reporting offline\n", ProgNameMqtt, WatchdogTimeout)
+	a.alerter.Raise("stale_frames", alerting.Warning, "no Teleinfo frame for %s, check the meter link", WatchdogTimeout)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.online = false
+	a.publish()
+}
+
+// stop stops the timers once the service stopped.
+func (a *availability) stop() {
+	a.watchdog.Stop()
+	a.deadline.Stop()
+}
+
+// republish sends the current state again, e.g. after a reconnection to the broker
+// which got the Last Will published.
+func (a *availability) republish() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.publish()
+}
+
+func (a *availability) publish() {
+	payload := homeassistant.PayloadNotAvailable
+	if a.online {
+		payload = homeassistant.PayloadAvailable
+	}
+	a.client.Publish(AvailabilityTopic, 0, true, payload)
+}
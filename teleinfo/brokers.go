@@ -0,0 +1,137 @@
+package teleinfo2mqtt
+
+import (
+	"time"
+
+	"energy-center/home-assistant"
+	"energy-center/mqttclient"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// brokers fans publications and subscriptions out to several MQTT brokers.
+// Every client handles its own reconnection, so that the bridge keeps
+// publishing as long as one of the brokers is reachable.
+type brokers []mqtt.Client
+
+func (b brokers) IsConnected() bool {
+	for _, c := range b {
+		if c.IsConnected() {
+			return true
+		}
+	}
+	return false
+}
+
+func (b brokers) IsConnectionOpen() bool {
+	for _, c := range b {
+		if c.IsConnectionOpen() {
+			return true
+		}
+	}
+	return false
+}
+
+// Connect connects every broker; the returned token completes as soon as one is connected.
+func (b brokers) Connect() mqtt.Token {
+	return b.collect(true, func(c mqtt.Client) mqtt.Token { return c.Connect() })
+}
+
+func (b brokers) Disconnect(quiesce uint) {
+	for _, c := range b {
+		c.Disconnect(quiesce)
+	}
+}
+
+func (b brokers) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	return b.collect(false, func(c mqtt.Client) mqtt.Token { return c.Publish(topic, qos, retained, payload) })
+}
+
+func (b brokers) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	return b.collect(false, func(c mqtt.Client) mqtt.Token { return c.Subscribe(topic, qos, callback) })
+}
+
+func (b brokers) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	return b.collect(false, func(c mqtt.Client) mqtt.Token { return c.SubscribeMultiple(filters, callback) })
+}
+
+func (b brokers) Unsubscribe(topics ...string) mqtt.Token {
+	return b.collect(false, func(c mqtt.Client) mqtt.Token { return c.Unsubscribe(topics...) })
+}
+
+func (b brokers) AddRoute(topic string, callback mqtt.MessageHandler) {
+	for _, c := range b {
+		c.AddRoute(topic, callback)
+	}
+}
+
+func (b brokers) OptionsReader() mqtt.ClientOptionsReader {
+	return b[0].OptionsReader()
+}
+
+func (b brokers) collect(first bool, operation func(mqtt.Client) mqtt.Token) mqtt.Token {
+	t := &brokersToken{done: make(chan struct{})}
+	results := make(chan error, len(b))
+	for _, c := range b {
+		token := operation(c)
+		go func() {
+			token.Wait()
+			results <- token.Error()
+		}()
+	}
+	go func() {
+		var errs []error
+		for range b {
+			err := <-results
+			if err == nil && first {
+				break
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		// Operations only fail when no broker succeeded
+		if len(errs) == len(b) {
+			t.err = errs[0]
+		}
+		close(t.done)
+	}()
+	return t
+}
+
+// brokersToken completes once the operation is done on the brokers.
+type brokersToken struct {
+	done chan struct{}
+	err  error
+}
+
+func (t *brokersToken) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *brokersToken) WaitTimeout(d time.Duration) bool {
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func (t *brokersToken) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *brokersToken) Error() error {
+	<-t.done
+	return t.err
+}
+
+// newBrokerClient creates the client of a single broker.
+func newBrokerClient(config mqttclient.Config, retry bool, onConnect func(mqtt.Client)) (mqtt.Client, error) {
+	return mqttclient.New(config, mqttclient.Options{
+		Will:         &mqttclient.Will{Topic: AvailabilityTopic, Payload: homeassistant.PayloadNotAvailable, Retained: true},
+		ConnectRetry: retry,
+		OnConnect:    onConnect,
+	})
+}
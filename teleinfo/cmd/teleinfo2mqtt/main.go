@@ -0,0 +1,7 @@
+package main
+
+import "teleinfo2mqtt"
+
+func main() {
+	teleinfo2mqtt.Main()
+}
@@ -0,0 +1,61 @@
+package teleinfo2mqtt
+
+import (
+	"os"
+
+	"energy-center/alerting"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings read from the optional YAML configuration file.
+type Config struct {
+	// Labels selects the labels published to MQTT.
+	Labels LabelFilter `yaml:"labels"`
+	// Discovery selects, among published labels, those announced to Home Assistant.
+	Discovery LabelFilter `yaml:"discovery"`
+	// Transforms are applied, per label, after unit normalization.
+	Transforms map[string]Transform `yaml:"transforms"`
+	// Subscription configures the contracted power usage sensors.
+	Subscription SubscriptionAlert `yaml:"subscription"`
+	// Statistics configures the optional per-minute aggregates.
+	Statistics Statistics `yaml:"statistics"`
+	// Alerting sends the alerts, e.g. when the frames stop.
+	Alerting alerting.Config `yaml:"alerting"`
+}
+
+// LabelFilter is an allowlist/denylist of Teleinfo labels.
+// An empty Include list allows every label not listed in Exclude.
+type LabelFilter struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+func (f LabelFilter) allows(label string) bool {
+	for _, l := range f.Exclude {
+		if l == label {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, l := range f.Include {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+func loadConfig(path string) (Config, error) {
+	var config Config
+	if path == "" {
+		return config, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	err = yaml.Unmarshal(content, &config)
+	return config, err
+}
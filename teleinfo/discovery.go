@@ -0,0 +1,118 @@
+package teleinfo2mqtt
+
+import (
+	"fmt"
+	"sync"
+
+	"energy-center/home-assistant"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"teleinfo2mqtt/teleinfo"
+)
+
+// discoveryOptions holds the discovery prefix, set from the command line.
+var discoveryOptions = homeassistant.Options{Origin: homeassistant.NewOrigin(ProgNameMqtt, Version)}
+
+// sentConfigs tracks the keys for which a discovery configuration was published.
+type sentConfigs struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+var configSent = sentConfigs{keys: map[string]bool{}}
+
+// markSent records key as sent and reports whether it had to be sent.
+func (s *sentConfigs) markSent(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[key] {
+		return false
+	}
+	s.keys[key] = true
+	return true
+}
+
+// reset forgets every sent configuration so that they are published again with the next frame.
+func (s *sentConfigs) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = map[string]bool{}
+}
+
+// listenHaStatus republishes the discovery configurations when Home Assistant
+// announces it is online, as it may have lost them while restarting.
+func listenHaStatus(client mqtt.Client) {
+	homeassistant.OnHaOnline(client, discoveryOptions, func() {
+		fmt.Printf("%s: Home Assistant is online, republishing discovery\n", ProgNameMqtt)
+		configSent.reset()
+	})
+}
+
+// sendConfiguration publishes the discovery configuration of the items, logging
+// those which could not be published.
+func sendConfiguration(client mqtt.Client, items []homeassistant.ConfigurationItem) {
+	if _, err := homeassistant.SendConfigurationToHa(client, discoveryOptions, items); err != nil {
+		fmt.Printf("%s: error publishing discovery: %s\n", ProgNameMqtt, err)
+	}
+}
+
+// meterDevice returns the device of the meter which sent the frame.
+func meterDevice(frame teleinfo.Frame) homeassistant.Device {
+	device := homeassistant.Device{
+		Identifiers:  []string{meterId(frame)},
+		Name:         ProgNameMqtt,
+		Manufacturer: "Enedis",
+		Model:        "Teleinfo " + frame.Mode(),
+	}
+	// Only reported by the meters in standard mode
+	if version, ok := frame.GetStringField("VTIC"); ok {
+		device.SwVersion = version
+	}
+	return device
+}
+
+// meterId returns the meter address found in the frame, used as device identifier.
+func meterId(frame teleinfo.Frame) string {
+	if id, ok := frame.GetStringField("ADSC"); ok {
+		return id
+	}
+	if id, ok := frame.GetStringField("ADCO"); ok {
+		return id
+	}
+	return "unknown"
+}
+
+func configurationItem(key string, label teleinfo.Label, device homeassistant.Device, units unitOptions) homeassistant.ConfigurationItem {
+	item := homeassistant.ConfigurationItem{
+		Name:                label.Description + " (" + label.Name + ")",
+		UniqueId:            ProgNameMqtt + "_" + device.Identifiers[0] + "_" + key,
+		StateTopic:          "teleinfo/" + key,
+		UnitOfMeasurement:   units.unit(label),
+		AvailabilityTopic:   AvailabilityTopic,
+		PayloadAvailable:    homeassistant.PayloadAvailable,
+		PayloadNotAvailable: homeassistant.PayloadNotAvailable,
+		Device:              device,
+	}
+	if label.Diagnostic {
+		item.EntityCategory = homeassistant.Diagnostic
+	}
+	switch label.Kind {
+	case teleinfo.KindEnergy:
+		item.DeviceClass = "energy"
+		item.StateClass = "total_increasing"
+	case teleinfo.KindReactiveEnergy:
+		item.StateClass = "total_increasing"
+	case teleinfo.KindApparentPower:
+		item.DeviceClass = "apparent_power"
+		item.StateClass = "measurement"
+	case teleinfo.KindActivePower:
+		item.DeviceClass = "power"
+		item.StateClass = "measurement"
+	case teleinfo.KindCurrent:
+		item.DeviceClass = "current"
+		item.StateClass = "measurement"
+	case teleinfo.KindVoltage:
+		item.DeviceClass = "voltage"
+		item.StateClass = "measurement"
+	}
+	return item
+}
@@ -0,0 +1,78 @@
+package teleinfo2mqtt
+
+import (
+	"fmt"
+	"strconv"
+
+	"energy-center/home-assistant"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"teleinfo2mqtt/teleinfo"
+)
+
+// event is a value decoded from the STGE status register.
+type event struct {
+	key    string
+	name   string
+	binary bool
+	// deviceClass only applies to binary events
+	deviceClass string
+	value       func(teleinfo.Status) string
+}
+
+func onOff(b bool) string {
+	if b {
+		return homeassistant.PayloadOn
+	}
+	return homeassistant.PayloadOff
+}
+
+var events = []event{
+	{"cutoff", "Organe de coupure", false, "", func(s teleinfo.Status) string { return s.CutOff.String() }},
+	{"overvoltage", "Surtension", true, "problem", func(s teleinfo.Status) string { return onOff(s.Overvoltage) }},
+	{"overload", "Dépassement de la puissance de référence", true, "problem", func(s teleinfo.Status) string { return onOff(s.Overload) }},
+	{"dry_contact", "Contact sec", true, "opening", func(s teleinfo.Status) string { return onOff(s.DryContactOpen) }},
+	{"terminal_cover", "Cache-bornes", true, "opening", func(s teleinfo.Status) string { return onOff(s.TerminalCoverOpen) }},
+	{"tempo_today", "Couleur Tempo du jour", false, "", func(s teleinfo.Status) string { return s.TempoToday.String() }},
+	{"tempo_tomorrow", "Couleur Tempo du lendemain", false, "", func(s teleinfo.Status) string { return s.TempoTomorrow.String() }},
+	{"mobile_peak_notice", "Préavis pointe mobile", false, "", func(s teleinfo.Status) string { return strconv.Itoa(int(s.MobilePeakNotice)) }},
+	{"mobile_peak", "Pointe mobile", false, "", func(s teleinfo.Status) string { return strconv.Itoa(int(s.MobilePeak)) }},
+}
+
+// publishEvents publishes the events embedded in the STGE status register as
+// teleinfo/STGE_<event> topics, announced as diagnostic entities.
+func publishEvents(client mqtt.Client, frame teleinfo.Frame, device homeassistant.Device, discovery bool) {
+	stge, ok := frame.GetStringField("STGE")
+	if !ok {
+		return
+	}
+	status, err := teleinfo.DecodeStatus(stge)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, e := range events {
+		topic := "teleinfo/STGE_" + e.key
+		if discovery && configSent.markSent("STGE_"+e.key) {
+			sendEventConfiguration(client, e, topic, device)
+		}
+		client.Publish(topic, 0, false, e.value(status)).Wait()
+	}
+}
+
+func sendEventConfiguration(client mqtt.Client, e event, topic string, device homeassistant.Device) {
+	item := homeassistant.ConfigurationItem{
+		Name:                e.name,
+		UniqueId:            ProgNameMqtt + "_" + device.Identifiers[0] + "_STGE_" + e.key,
+		StateTopic:          topic,
+		AvailabilityTopic:   AvailabilityTopic,
+		PayloadAvailable:    homeassistant.PayloadAvailable,
+		PayloadNotAvailable: homeassistant.PayloadNotAvailable,
+		EntityCategory:      homeassistant.Diagnostic,
+		Device:              device,
+	}
+	if e.binary {
+		item.Component = homeassistant.BinarySensor
+		item.DeviceClass = e.deviceClass
+	}
+	sendConfiguration(client, []homeassistant.ConfigurationItem{item})
+}
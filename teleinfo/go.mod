@@ -3,8 +3,12 @@ module teleinfo2mqtt
 go 1.17
 
 require (
+	energy-center/alerting v0.0.0
+	energy-center/home-assistant v0.0.0
+	energy-center/mqttclient v0.0.0
 	github.com/eclipse/paho.mqtt.golang v1.4.2
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -13,3 +17,9 @@ require (
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
 	golang.org/x/sys v0.0.0-20210423082822-04245dca01da // indirect
 )
+
+replace (
+	energy-center/alerting => ../alerting
+	energy-center/home-assistant => ../home-assistant
+	energy-center/mqttclient => ../mqttclient
+)
@@ -0,0 +1,100 @@
+package teleinfo2mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"teleinfo2mqtt/teleinfo"
+)
+
+const HealthRateWindow = 1 * time.Minute
+const HealthMaxFrameAge = 10 * time.Second
+
+// health gathers the reading statistics exposed by the HTTP endpoint.
+type health struct {
+	mu             sync.Mutex
+	frames         uint64
+	errors         uint64
+	checksumErrors uint64
+	lastFrame      time.Time
+
+	windowStart     time.Time
+	windowFrames    uint64
+	windowChecksums uint64
+	frameRate       float64
+	checksumRate    float64
+}
+
+var stats = health{windowStart: time.Now()}
+
+// HealthReport is the body returned by the health endpoint.
+type HealthReport struct {
+	Healthy           bool    `json:"healthy"`
+	MqttConnected     bool    `json:"mqtt_connected"`
+	Frames            uint64  `json:"frames"`
+	Errors            uint64  `json:"errors"`
+	ChecksumErrors    uint64  `json:"checksum_errors"`
+	FrameRate         float64 `json:"frame_rate"`
+	ChecksumErrorRate float64 `json:"checksum_error_rate"`
+	LastFrameAge      float64 `json:"last_frame_age_seconds"`
+}
+
+// record accounts for the result of a frame read.
+func (h *health) record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if err == nil {
+		h.frames++
+		h.windowFrames++
+		h.lastFrame = now
+	} else {
+		h.errors++
+		if errors.Is(err, teleinfo.ErrChecksum) {
+			h.checksumErrors++
+			h.windowChecksums++
+		}
+	}
+	if elapsed := now.Sub(h.windowStart); elapsed >= HealthRateWindow {
+		h.frameRate = float64(h.windowFrames) / elapsed.Seconds()
+		h.checksumRate = float64(h.windowChecksums) / elapsed.Seconds()
+		h.windowStart, h.windowFrames, h.windowChecksums = now, 0, 0
+	}
+}
+
+func (h *health) report(client mqtt.Client) HealthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	report := HealthReport{
+		MqttConnected:     client.IsConnectionOpen(),
+		Frames:            h.frames,
+		Errors:            h.errors,
+		ChecksumErrors:    h.checksumErrors,
+		FrameRate:         h.frameRate,
+		ChecksumErrorRate: h.checksumRate,
+		LastFrameAge:      -1,
+	}
+	if !h.lastFrame.IsZero() {
+		report.LastFrameAge = time.Since(h.lastFrame).Seconds()
+	}
+	report.Healthy = report.MqttConnected && report.LastFrameAge >= 0 && report.LastFrameAge < HealthMaxFrameAge.Seconds()
+	return report
+}
+
+// serveHealth exposes the health report on /health, answering 503 when unhealthy.
+func serveHealth(address string, client mqtt.Client) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		report := stats.report(client)
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+	return http.ListenAndServe(address, mux)
+}
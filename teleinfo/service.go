@@ -0,0 +1,101 @@
+package teleinfo2mqtt
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"energy-center/alerting"
+	"energy-center/home-assistant"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"teleinfo2mqtt/teleinfo"
+)
+
+// Service is a Teleinfo bridge publishing to a MQTT connection it does not own,
+// either the one of teleinfo2mqtt or the one shared by the energy-center daemon.
+type Service struct {
+	client    mqtt.Client
+	settings  Settings
+	port      io.ReadCloser
+	available *availability
+}
+
+// NewService opens the Teleinfo source, detecting its mode if needed. The frames
+// are published once Run is called, OnConnect must be called on every connection.
+// The client must restore the subscriptions on reconnection, as a mqttclient.Client does.
+func NewService(client mqtt.Client, settings Settings) (*Service, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	discoveryOptions.Prefix = settings.DiscoveryPrefix
+	if settings.Mode == "auto" {
+		detected, err := teleinfo.DetectMode(settings.Port, ModeDetectionTimeout)
+		if err != nil {
+			return nil, err
+		}
+		settings.Mode = detected
+		fmt.Printf("%s: detected %s mode\n", ProgNameMqtt, settings.Mode)
+	}
+	port, err := teleinfo.Open(settings.Port, settings.Mode)
+	if err != nil {
+		return nil, err
+	}
+	alerter, err := alerting.New(settings.Alerting, client, ProgNameMqtt)
+	if err != nil {
+		port.Close()
+		return nil, err
+	}
+	available := newAvailability(settings.ExitAfter, alerter)
+	available.client = client
+	listenHaStatus(client)
+	return &Service{client: client, settings: settings, port: port, available: available}, nil
+}
+
+// OnConnect restores the availability after a (re)connection.
+func (s *Service) OnConnect() {
+	s.available.republish()
+}
+
+// ExitNoFrame is the exit code of Run when no frame was received for ExitAfter.
+const ExitNoFrame = 4
+
+// Run publishes the frames until a signal is received, or until no frame was
+// received for ExitAfter, and returns the exit code.
+func (s *Service) Run(signals <-chan os.Signal) int {
+	if s.settings.HealthAddress != "" {
+		go func() {
+			fmt.Printf("%s: health endpoint stopped: %s\n", ProgNameMqtt, serveHealth(s.settings.HealthAddress, s.client))
+		}()
+	}
+
+	units := unitOptions{energyInKwh: s.settings.EnergyInKwh, powerInKw: s.settings.PowerInKw}
+	mode := s.settings.Mode
+	// Read Teleinfo frames and send them into mqtt, until the port is closed
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		handleFrame(done, teleinfo.NewReader(s.port, &mode), s.client, s.available, units, s.settings.Config)
+	}()
+
+	code := 0
+	select {
+	case sig := <-signals:
+		fmt.Printf("%s: received %s, stopping\n", ProgNameMqtt, sig)
+	case <-s.available.expired:
+		fmt.Printf("%s: no Teleinfo frame received for %s, stopping\n", ProgNameMqtt, s.settings.ExitAfter)
+		code = ExitNoFrame
+	}
+	s.available.stop()
+	s.client.Publish(AvailabilityTopic, 0, true, homeassistant.PayloadNotAvailable).WaitTimeout(ShutdownTimeout)
+	s.available.alerter.Flush(ShutdownTimeout)
+	close(done)
+	s.port.Close()
+	select {
+	case <-stopped:
+	case <-time.After(ShutdownTimeout):
+		fmt.Printf("%s: Teleinfo reader still blocked after closing the port\n", ProgNameMqtt)
+	}
+	return code
+}
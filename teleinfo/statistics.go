@@ -0,0 +1,108 @@
+package teleinfo2mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"teleinfo2mqtt/teleinfo"
+)
+
+const StatisticsTopic = "teleinfo/statistics"
+
+var defaultStatisticsLabels = []string{"SINSTS", "PAPP", "URMS1", "URMS2", "URMS3"}
+
+// Statistics configures the per-minute aggregates topic.
+type Statistics struct {
+	Enabled bool `yaml:"enabled"`
+	// Labels are the numeric labels aggregated, apparent power and voltages by default.
+	Labels []string `yaml:"labels"`
+}
+
+func (s Statistics) labels() []string {
+	if len(s.Labels) == 0 {
+		return defaultStatisticsLabels
+	}
+	return s.Labels
+}
+
+// Aggregate summarizes the values of a label over a minute.
+type Aggregate struct {
+	Avg     float64 `json:"avg"`
+	Min     uint    `json:"min"`
+	Max     uint    `json:"max"`
+	Samples int     `json:"samples"`
+}
+
+// StatisticsReport is the payload published on StatisticsTopic.
+type StatisticsReport struct {
+	Start  time.Time            `json:"start"`
+	Labels map[string]Aggregate `json:"labels"`
+}
+
+type accumulator struct {
+	sum   uint64
+	count int
+	min   uint
+	max   uint
+}
+
+func (a *accumulator) add(v uint) {
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if v > a.max {
+		a.max = v
+	}
+	a.sum += uint64(v)
+	a.count++
+}
+
+// minuteStatistics accumulates frame values until the end of the current minute.
+type minuteStatistics struct {
+	start        time.Time
+	accumulators map[string]*accumulator
+}
+
+var minuteStats = minuteStatistics{}
+
+// add accounts for frame, publishing the aggregates of the previous minute when a new one begins.
+func (m *minuteStatistics) add(client mqtt.Client, frame teleinfo.Frame, config Statistics) {
+	minute := time.Now().Truncate(time.Minute)
+	if !minute.Equal(m.start) {
+		if len(m.accumulators) > 0 {
+			m.publish(client)
+		}
+		m.start = minute
+		m.accumulators = map[string]*accumulator{}
+	}
+	for _, label := range config.labels() {
+		if v, ok := frame.GetUIntField(label); ok {
+			acc, exist := m.accumulators[label]
+			if !exist {
+				acc = &accumulator{}
+				m.accumulators[label] = acc
+			}
+			acc.add(v)
+		}
+	}
+}
+
+func (m *minuteStatistics) publish(client mqtt.Client) {
+	report := StatisticsReport{Start: m.start, Labels: map[string]Aggregate{}}
+	for label, acc := range m.accumulators {
+		report.Labels[label] = Aggregate{
+			Avg:     float64(acc.sum) / float64(acc.count),
+			Min:     acc.min,
+			Max:     acc.max,
+			Samples: acc.count,
+		}
+	}
+	payload, err := json.Marshal(report)
+	if err != nil {
+		fmt.Printf("Error marshalling statistics: %s\n", err)
+		return
+	}
+	client.Publish(StatisticsTopic, 0, false, payload).Wait()
+}
@@ -0,0 +1,91 @@
+package teleinfo2mqtt
+
+import (
+	"strconv"
+
+	"energy-center/home-assistant"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"teleinfo2mqtt/teleinfo"
+)
+
+const DefaultSubscriptionThreshold = 90.0
+
+// SubscriptionAlert configures the sensors tracking the contracted power.
+type SubscriptionAlert struct {
+	// Disabled turns off the subscription sensors.
+	Disabled bool `yaml:"disabled"`
+	// Threshold is the usage percentage above which the alert trips.
+	Threshold float64 `yaml:"threshold"`
+}
+
+func (s SubscriptionAlert) threshold() float64 {
+	if s.Threshold == 0 {
+		return DefaultSubscriptionThreshold
+	}
+	return s.Threshold
+}
+
+// subscriptionUsage returns the live apparent power as a percentage of the contracted power.
+// The contracted power is read from PREF (kVA) in standard mode and derived from ISOUSC (A) in historic mode.
+func subscriptionUsage(frame teleinfo.Frame) (float64, bool) {
+	var contracted uint
+	if pref, ok := frame.GetUIntField("PREF"); ok {
+		contracted = pref * 1000
+	} else if isousc, ok := frame.GetUIntField("ISOUSC"); ok {
+		contracted = isousc * 200
+	}
+	if contracted == 0 {
+		return 0, false
+	}
+	apparent, ok := frame.GetUIntField("SINSTS")
+	if !ok {
+		apparent, ok = frame.GetUIntField("PAPP")
+	}
+	if !ok {
+		return 0, false
+	}
+	return float64(apparent) * 100 / float64(contracted), true
+}
+
+func publishSubscription(client mqtt.Client, frame teleinfo.Frame, device homeassistant.Device, alert SubscriptionAlert) {
+	usage, ok := subscriptionUsage(frame)
+	if !ok {
+		return
+	}
+	if configSent.markSent("subscription_usage") {
+		sendSubscriptionConfiguration(client, device)
+	}
+	exceeded := homeassistant.PayloadOff
+	if usage >= alert.threshold() {
+		exceeded = homeassistant.PayloadOn
+	}
+	client.Publish("teleinfo/subscription_usage", 0, false, strconv.FormatFloat(usage, 'f', 1, 64)).Wait()
+	client.Publish("teleinfo/subscription_exceeded", 0, false, exceeded).Wait()
+}
+
+func sendSubscriptionConfiguration(client mqtt.Client, device homeassistant.Device) {
+	prefix := ProgNameMqtt + "_" + device.Identifiers[0] + "_"
+	sendConfiguration(client, []homeassistant.ConfigurationItem{{
+		Name:                "Utilisation de la puissance souscrite",
+		UniqueId:            prefix + "subscription_usage",
+		StateTopic:          "teleinfo/subscription_usage",
+		StateClass:          "measurement",
+		UnitOfMeasurement:   homeassistant.Percent,
+		AvailabilityTopic:   AvailabilityTopic,
+		PayloadAvailable:    homeassistant.PayloadAvailable,
+		PayloadNotAvailable: homeassistant.PayloadNotAvailable,
+		Device:              device,
+	}})
+
+	sendConfiguration(client, []homeassistant.ConfigurationItem{{
+		Component:           homeassistant.BinarySensor,
+		Name:                "Dépassement de la puissance souscrite",
+		UniqueId:            prefix + "subscription_exceeded",
+		StateTopic:          "teleinfo/subscription_exceeded",
+		DeviceClass:         "problem",
+		AvailabilityTopic:   AvailabilityTopic,
+		PayloadAvailable:    homeassistant.PayloadAvailable,
+		PayloadNotAvailable: homeassistant.PayloadNotAvailable,
+		Device:              device,
+	}})
+}
@@ -0,0 +1,47 @@
+package teleinfo2mqtt
+
+import (
+	"strconv"
+	"testing"
+)
+
+// testFrame is a decoded frame holding fields.
+type testFrame map[string]string
+
+func (f testFrame) Type() string             { return f["OPTARIF"] }
+func (f testFrame) Mode() string             { return "" }
+func (f testFrame) AsMap() map[string]string { return f }
+
+func (f testFrame) GetStringField(n string) (string, bool) {
+	v, ok := f[n]
+	return v, ok
+}
+
+func (f testFrame) GetUIntField(n string) (uint, bool) {
+	v, err := strconv.ParseUint(f[n], 10, 32)
+	return uint(v), err == nil
+}
+
+func TestSubscriptionUsage(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame testFrame
+		want  float64
+		ok    bool
+	}{
+		{"standard", testFrame{"PREF": "06", "SINSTS": "01500"}, 25, true},
+		{"standard over the contract", testFrame{"PREF": "09", "SINSTS": "09900"}, 110, true},
+		// 30 A at 200 VA per A
+		{"historic", testFrame{"ISOUSC": "30", "PAPP": "03000"}, 50, true},
+		{"PREF first", testFrame{"PREF": "12", "ISOUSC": "30", "SINSTS": "03000"}, 25, true},
+		{"no contracted power", testFrame{"SINSTS": "01500"}, 0, false},
+		{"zero contracted power", testFrame{"PREF": "00", "SINSTS": "01500"}, 0, false},
+		{"no apparent power", testFrame{"PREF": "06"}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := subscriptionUsage(tt.frame)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: subscriptionUsage = %v %v, want %v %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
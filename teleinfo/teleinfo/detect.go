@@ -0,0 +1,83 @@
+package teleinfo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+var modes = []string{"historic", "standard"}
+
+// probeRetryDelay spaces the reads of a probe after an error, e.g. io.EOF on a
+// serial port timing out or a network source reconnecting.
+const probeRetryDelay = 100 * time.Millisecond
+
+// DetectMode probes source at 1200 baud (historic) then 9600 baud (standard)
+// and returns the first mode for which a frame with valid checksums is read.
+// Raw network sources have no baud rate to change: frames are decoded in both
+// modes instead. timeout bounds the time spent probing each mode.
+func DetectMode(source string, timeout time.Duration) (string, error) {
+	if isRawNetworkSource(source) {
+		port, err := Open(source, "")
+		if err != nil {
+			return "", err
+		}
+		defer port.Close()
+		if mode, found := probe(port, modes, timeout*time.Duration(len(modes))); found {
+			return mode, nil
+		}
+	} else {
+		for _, mode := range modes {
+			port, err := open(source, mode, 100*time.Millisecond)
+			if err != nil {
+				return "", err
+			}
+			_, found := probe(port, []string{mode}, timeout)
+			port.Close()
+			if found {
+				return mode, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no valid Teleinfo frame read on %s in historic nor standard mode", source)
+}
+
+// probe reads raw frames from port until one decodes in one of the candidate modes.
+// The port is closed on timeout to unblock any pending read.
+func probe(port io.ReadCloser, candidates []string, timeout time.Duration) (string, bool) {
+	result := make(chan string, 1)
+	go func() {
+		defer close(result)
+		buffer := bufio.NewReader(port)
+		deadline := time.Now().Add(timeout)
+		for time.Now().Before(deadline) {
+			rawFrame, err := readRawFrame(buffer)
+			if errors.Is(err, os.ErrClosed) || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				time.Sleep(probeRetryDelay)
+				continue
+			}
+			for _, mode := range candidates {
+				frame, err := decodeFrame(rawFrame, mode)
+				// Garbage read at the wrong baud rate may decode as an empty frame
+				if err == nil && len(frame.AsMap()) > 0 {
+					result <- mode
+					return
+				}
+			}
+		}
+	}()
+	select {
+	case mode, found := <-result:
+		return mode, found
+	case <-time.After(timeout):
+		port.Close()
+		return "", false
+	}
+}
@@ -0,0 +1,98 @@
+package teleinfo
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const historicFrame = "\x02" +
+	"\nADCO 031762120162 6\r" +
+	"\nOPTARIF BASE 0\r" +
+	"\nISOUSC 30 9\r" +
+	"\nBASE 002565285 ,\r" +
+	"\nPTEC TH.. $\r" +
+	"\nIINST 002 Y\r" +
+	"\nPAPP 00420 '\r" +
+	"\x03"
+
+const standardFrame = "\x02" +
+	"\nADSC\t041234567890\t>\r" +
+	"\nNGTF\t      TEMPO     \tF\r" +
+	"\nEAST\t012345678\t3\r" +
+	"\nSINSTS\t00420\tL\r" +
+	"\nDATE\tE240115120000\t\t.\r" +
+	"\nSTGE\t003A4301\tA\r" +
+	"\x03"
+
+// serveFrames serves a raw TCP Teleinfo bridge sending frame every 50 ms.
+func serveFrames(t *testing.T, frame string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					if _, err := conn.Write([]byte(frame)); err != nil {
+						return
+					}
+					time.Sleep(50 * time.Millisecond)
+				}
+			}()
+		}
+	}()
+	return tcpScheme + listener.Addr().String()
+}
+
+func TestDetectMode(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		want  string
+	}{
+		{"historic", historicFrame, "historic"},
+		{"standard", standardFrame, "standard"},
+		{"bad checksum", strings.Replace(standardFrame, "00420\tL", "00421\tL", 1), ""},
+		{"garbage", "\x02\x7f\x1b\x03", ""},
+	}
+	for _, tt := range tests {
+		mode, err := DetectMode(serveFrames(t, tt.frame), 300*time.Millisecond)
+		if mode != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("%s: DetectMode = %q, %v, want %q", tt.name, mode, err, tt.want)
+		}
+	}
+}
+
+// eofReader is a source at its end, e.g. a closed bridge, counting the reads.
+type eofReader struct {
+	reads int32
+}
+
+func (r *eofReader) Read([]byte) (int, error) {
+	atomic.AddInt32(&r.reads, 1)
+	return 0, io.EOF
+}
+
+func (r *eofReader) Close() error { return nil }
+
+func TestProbeEOF(t *testing.T) {
+	r := &eofReader{}
+	if mode, found := probe(r, modes, 500*time.Millisecond); found {
+		t.Errorf("probe found %s at the end of the source", mode)
+	}
+	// The probe waits between the reads rather than spinning
+	if reads := atomic.LoadInt32(&r.reads); reads > 10 {
+		t.Errorf("%d reads in 500ms", reads)
+	}
+}
@@ -2,10 +2,14 @@ package teleinfo
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strconv"
 )
 
+// ErrChecksum is wrapped by decoding errors caused by a checksum mismatch.
+var ErrChecksum = errors.New("error decoding frame, invalid checksum")
+
 // Frame holds a single Teleinfo frame.
 type Frame interface {
 	// Type returns the type of frame (see `OPTARIF` field)
@@ -96,7 +100,7 @@ func decodeStandardFrame(rawFrame []byte) (Frame, error) {
 		readChecksum := byte(trail[0])
 		expectedChecksum := standardChecksum(name, timestamp, value)
 		if readChecksum != expectedChecksum {
-			return nil, fmt.Errorf("error decoding frame, invalid checksum (field: '%s', value: '%s' read: '%c', expected: '%c')", name, value, readChecksum, expectedChecksum)
+			return nil, fmt.Errorf("%w (field: '%s', value: '%s' read: '%c', expected: '%c')", ErrChecksum, name, value, readChecksum, expectedChecksum)
 		}
 		info[string(name)] = string(value)
 	}
@@ -125,7 +129,7 @@ func decodeHistoricFrame(rawFrame []byte) (Frame, error) {
 		readChecksum := byte(trail[0])
 		expectedChecksum := historicChecksum(name, value)
 		if readChecksum != expectedChecksum {
-			return nil, fmt.Errorf("error decoding frame, invalid checksum (field: '%s', value: '%s', read: '%c', expected: '%c')", name, value, readChecksum, expectedChecksum)
+			return nil, fmt.Errorf("%w (field: '%s', value: '%s', read: '%c', expected: '%c')", ErrChecksum, name, value, readChecksum, expectedChecksum)
 		}
 		info[string(name)] = string(value)
 	}
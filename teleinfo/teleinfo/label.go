@@ -0,0 +1,128 @@
+package teleinfo
+
+// Kind describes the physical quantity carried by a Teleinfo label.
+type Kind int
+
+const (
+	// KindText is used for labels carrying identifiers, codes or messages.
+	KindText Kind = iota
+	// KindEnergy is used for active energy indices, in Wh.
+	KindEnergy
+	// KindApparentPower is used for apparent powers, in VA.
+	KindApparentPower
+	// KindActivePower is used for active powers, in W.
+	KindActivePower
+	// KindCurrent is used for currents, in A.
+	KindCurrent
+	// KindVoltage is used for voltages, in V.
+	KindVoltage
+	// KindReactiveEnergy is used for reactive energy indices, in varh.
+	KindReactiveEnergy
+)
+
+// Label describes a known Teleinfo label.
+type Label struct {
+	Name        string
+	Description string
+	Kind        Kind
+	// Diagnostic labels report the meter state rather than a measure.
+	Diagnostic bool
+}
+
+var labels = map[string]Label{}
+
+func register(kind Kind, description string, names ...string) {
+	for _, name := range names {
+		labels[name] = Label{Name: name, Description: description, Kind: kind}
+	}
+}
+
+func diagnostic(names ...string) {
+	for _, name := range names {
+		l := labels[name]
+		l.Diagnostic = true
+		labels[name] = l
+	}
+}
+
+func init() {
+	// Historic mode
+	register(KindText, "Adresse du compteur", "ADCO")
+	register(KindText, "Option tarifaire", "OPTARIF")
+	register(KindCurrent, "Intensité souscrite", "ISOUSC")
+	register(KindEnergy, "Index Base", "BASE")
+	register(KindEnergy, "Index Heures Creuses", "HCHC")
+	register(KindEnergy, "Index Heures Pleines", "HCHP")
+	register(KindEnergy, "Index EJP Heures Normales", "EJPHN")
+	register(KindEnergy, "Index EJP Heures de Pointe Mobile", "EJPHPM")
+	register(KindEnergy, "Index Tempo Heures Creuses Jours Bleus", "BBRHCJB")
+	register(KindEnergy, "Index Tempo Heures Pleines Jours Bleus", "BBRHPJB")
+	register(KindEnergy, "Index Tempo Heures Creuses Jours Blancs", "BBRHCJW")
+	register(KindEnergy, "Index Tempo Heures Pleines Jours Blancs", "BBRHPJW")
+	register(KindEnergy, "Index Tempo Heures Creuses Jours Rouges", "BBRHCJR")
+	register(KindEnergy, "Index Tempo Heures Pleines Jours Rouges", "BBRHPJR")
+	register(KindText, "Préavis Début EJP", "PEJP")
+	register(KindText, "Période Tarifaire en cours", "PTEC")
+	register(KindText, "Couleur du lendemain", "DEMAIN")
+	register(KindCurrent, "Intensité Instantanée", "IINST", "IINST1", "IINST2", "IINST3")
+	register(KindCurrent, "Avertissement de Dépassement De Puissance Souscrite", "ADPS")
+	register(KindCurrent, "Intensité maximale appelée", "IMAX", "IMAX1", "IMAX2", "IMAX3")
+	register(KindActivePower, "Puissance maximale triphasée atteinte", "PMAX")
+	register(KindApparentPower, "Puissance apparente", "PAPP")
+	register(KindText, "Horaire Heures Pleines Heures Creuses", "HHPHC")
+	register(KindText, "Mot d'état du compteur", "MOTDETAT")
+	register(KindText, "Présence des potentiels", "PPOT")
+	register(KindCurrent, "Avertissement de Dépassement d'intensité de réglage", "ADIR1", "ADIR2", "ADIR3")
+
+	// Standard mode
+	register(KindText, "Adresse Secondaire du Compteur", "ADSC")
+	register(KindText, "Version de la TIC", "VTIC")
+	register(KindText, "Date et heure courante", "DATE")
+	register(KindText, "Nom du calendrier tarifaire fournisseur", "NGTF")
+	register(KindText, "Libellé tarif fournisseur en cours", "LTARF")
+	register(KindEnergy, "Energie active soutirée totale", "EAST")
+	register(KindEnergy, "Energie active soutirée Fournisseur",
+		"EASF01", "EASF02", "EASF03", "EASF04", "EASF05", "EASF06", "EASF07", "EASF08", "EASF09", "EASF10")
+	register(KindEnergy, "Energie active soutirée Distributeur", "EASD01", "EASD02", "EASD03", "EASD04")
+	register(KindEnergy, "Energie active injectée totale", "EAIT")
+	register(KindReactiveEnergy, "Energie réactive Q1 totale", "ERQ1")
+	register(KindReactiveEnergy, "Energie réactive Q2 totale", "ERQ2")
+	register(KindReactiveEnergy, "Energie réactive Q3 totale", "ERQ3")
+	register(KindReactiveEnergy, "Energie réactive Q4 totale", "ERQ4")
+	register(KindCurrent, "Courant efficace", "IRMS1", "IRMS2", "IRMS3")
+	register(KindVoltage, "Tension efficace", "URMS1", "URMS2", "URMS3")
+	register(KindVoltage, "Tension moyenne", "UMOY1", "UMOY2", "UMOY3")
+	register(KindText, "Puissance app. de référence", "PREF")
+	register(KindText, "Puissance app. de coupure", "PCOUP")
+	register(KindApparentPower, "Puissance app. instantanée soutirée", "SINSTS", "SINSTS1", "SINSTS2", "SINSTS3")
+	register(KindApparentPower, "Puissance app. max. soutirée n", "SMAXSN", "SMAXSN1", "SMAXSN2", "SMAXSN3")
+	register(KindApparentPower, "Puissance app. max. soutirée n-1", "SMAXSN-1", "SMAXSN1-1", "SMAXSN2-1", "SMAXSN3-1")
+	register(KindApparentPower, "Puissance app. instantanée injectée", "SINSTI")
+	register(KindApparentPower, "Puissance app. max. injectée n", "SMAXIN")
+	register(KindApparentPower, "Puissance app. max. injectée n-1", "SMAXIN-1")
+	register(KindActivePower, "Point n de la courbe de charge active soutirée", "CCASN")
+	register(KindActivePower, "Point n-1 de la courbe de charge active soutirée", "CCASN-1")
+	register(KindActivePower, "Point n de la courbe de charge active injectée", "CCAIN")
+	register(KindActivePower, "Point n-1 de la courbe de charge active injectée", "CCAIN-1")
+	register(KindText, "Registre de Statuts", "STGE")
+	register(KindText, "Message court", "MSG1")
+	register(KindText, "Message ultra court", "MSG2")
+	register(KindText, "PRM", "PRM")
+	register(KindText, "Relais", "RELAIS")
+	register(KindText, "Numéro de l'index tarifaire en cours", "NTARF")
+	register(KindText, "Numéro du jour en cours calendrier fournisseur", "NJOURF")
+	register(KindText, "Numéro du prochain jour calendrier fournisseur", "NJOURF+1")
+	register(KindText, "Profil du prochain jour calendrier fournisseur", "PJOURF+1")
+	register(KindText, "Profil du prochain jour de pointe", "PPOINTE")
+	register(KindText, "Début Pointe Mobile", "DPM1", "DPM2", "DPM3")
+	register(KindText, "Fin Pointe Mobile", "FPM1", "FPM2", "FPM3")
+
+	diagnostic("MOTDETAT", "PPOT", "ADPS", "ADIR1", "ADIR2", "ADIR3", "VTIC", "STGE", "MSG1", "MSG2", "RELAIS",
+		"DPM1", "DPM2", "DPM3", "FPM1", "FPM2", "FPM3")
+}
+
+// LookupLabel returns the description of a known label.
+func LookupLabel(name string) (Label, bool) {
+	l, ok := labels[name]
+	return l, ok
+}
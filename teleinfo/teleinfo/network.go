@@ -0,0 +1,246 @@
+package teleinfo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tcpScheme     = "tcp://"
+	rfc2217Scheme = "rfc2217://"
+
+	dialTimeout    = 10 * time.Second
+	reconnectDelay = 1 * time.Second
+)
+
+// Telnet and RFC2217 (Telnet Com Port Control Option) codes
+const (
+	telnetSE   byte = 240
+	telnetSB   byte = 250
+	telnetWILL byte = 251
+	telnetWONT byte = 252
+	telnetDO   byte = 253
+	telnetDONT byte = 254
+	telnetIAC  byte = 255
+
+	telnetBinary   byte = 0
+	telnetSGA      byte = 3
+	telnetComPort  byte = 44
+	comSetBaudRate byte = 1
+	comSetDataSize byte = 2
+	comSetParity   byte = 3
+	comSetStopSize byte = 4
+	comParityEven  byte = 3
+	comStopSize1   byte = 1
+)
+
+// Open opens a Teleinfo source, either a local serial device or a network
+// bridge given as tcp://host:port (raw socket) or rfc2217://host:port.
+func Open(source string, mode string) (io.ReadCloser, error) {
+	return open(source, mode, 0)
+}
+
+func open(source string, mode string, readTimeout time.Duration) (io.ReadCloser, error) {
+	switch {
+	case strings.HasPrefix(source, tcpScheme):
+		address := strings.TrimPrefix(source, tcpScheme)
+		return newNetPort(func() (io.ReadCloser, error) {
+			return net.DialTimeout("tcp", address, dialTimeout)
+		})
+	case strings.HasPrefix(source, rfc2217Scheme):
+		address := strings.TrimPrefix(source, rfc2217Scheme)
+		return newNetPort(func() (io.ReadCloser, error) {
+			return dialRfc2217(address, baudRate(mode))
+		})
+	}
+	return openPort(source, mode, readTimeout)
+}
+
+func isRawNetworkSource(source string) bool {
+	return strings.HasPrefix(source, tcpScheme)
+}
+
+func baudRate(mode string) uint32 {
+	if mode == "standard" {
+		return 9600
+	}
+	return 1200
+}
+
+// netPort is a network connection which is transparently re-established
+// when the remote end closes it.
+type netPort struct {
+	dial   func() (io.ReadCloser, error)
+	mu     sync.Mutex
+	conn   io.ReadCloser
+	closed bool
+}
+
+func newNetPort(dial func() (io.ReadCloser, error)) (*netPort, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	return &netPort{dial: dial, conn: conn}, nil
+}
+
+func (p *netPort) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	conn := p.conn
+	p.mu.Unlock()
+
+	n, err := conn.Read(b)
+	if err == nil || n > 0 {
+		return n, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, err
+	}
+	fmt.Printf("Teleinfo connection lost (%s), reconnecting\n", err)
+	conn.Close()
+	time.Sleep(reconnectDelay)
+	if p.conn, err = p.dial(); err != nil {
+		// Keep a closed connection so that the next Read retries to dial
+		p.conn = closedConn{}
+		return 0, fmt.Errorf("error reconnecting Teleinfo source: %w", err)
+	}
+	return 0, nil
+}
+
+func (p *netPort) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return p.conn.Close()
+}
+
+type closedConn struct{}
+
+func (closedConn) Read([]byte) (int, error) { return 0, io.EOF }
+func (closedConn) Close() error             { return nil }
+
+// rfc2217Conn configures the remote serial port and strips Telnet commands from the data stream.
+type rfc2217Conn struct {
+	conn   net.Conn
+	buffer *bufio.Reader
+}
+
+func dialRfc2217(address string, baud uint32) (*rfc2217Conn, error) {
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &rfc2217Conn{conn: conn, buffer: bufio.NewReader(conn)}
+
+	baudBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(baudBytes, baud)
+	negotiation := []byte{
+		telnetIAC, telnetWILL, telnetComPort,
+		telnetIAC, telnetWILL, telnetBinary,
+		telnetIAC, telnetDO, telnetBinary,
+	}
+	negotiation = append(negotiation, c.subnegotiation(comSetBaudRate, baudBytes...)...)
+	negotiation = append(negotiation, c.subnegotiation(comSetDataSize, 7)...)
+	negotiation = append(negotiation, c.subnegotiation(comSetParity, comParityEven)...)
+	negotiation = append(negotiation, c.subnegotiation(comSetStopSize, comStopSize1)...)
+	if _, err = conn.Write(negotiation); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error negotiating RFC2217 port settings: %w", err)
+	}
+	return c, nil
+}
+
+func (c *rfc2217Conn) subnegotiation(command byte, value ...byte) []byte {
+	res := []byte{telnetIAC, telnetSB, telnetComPort, command}
+	for _, b := range value {
+		res = append(res, b)
+		if b == telnetIAC {
+			res = append(res, telnetIAC)
+		}
+	}
+	return append(res, telnetIAC, telnetSE)
+}
+
+func (c *rfc2217Conn) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if n > 0 && c.buffer.Buffered() == 0 {
+			break
+		}
+		b, err := c.buffer.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if b != telnetIAC {
+			p[n] = b
+			n++
+			continue
+		}
+		if err = c.handleCommand(p, &n); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (c *rfc2217Conn) handleCommand(p []byte, n *int) error {
+	command, err := c.buffer.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch command {
+	case telnetIAC:
+		p[*n] = telnetIAC
+		*n++
+	case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+		option, err := c.buffer.ReadByte()
+		if err != nil {
+			return err
+		}
+		c.answer(command, option)
+	case telnetSB:
+		// Port settings notifications from the server are not used
+		for {
+			b, err := c.buffer.ReadByte()
+			if err != nil {
+				return err
+			}
+			if b == telnetIAC {
+				if b, err = c.buffer.ReadByte(); err != nil {
+					return err
+				}
+				if b == telnetSE {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// answer refuses every option this client does not implement.
+func (c *rfc2217Conn) answer(command byte, option byte) {
+	switch command {
+	case telnetDO:
+		if option != telnetComPort && option != telnetBinary {
+			c.conn.Write([]byte{telnetIAC, telnetWONT, option})
+		}
+	case telnetWILL:
+		if option != telnetBinary && option != telnetSGA {
+			c.conn.Write([]byte{telnetIAC, telnetDONT, option})
+		}
+	}
+}
+
+func (c *rfc2217Conn) Close() error {
+	return c.conn.Close()
+}
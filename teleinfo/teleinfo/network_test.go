@@ -0,0 +1,141 @@
+package teleinfo
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// testRfc2217 returns a client connection reading from the returned server end.
+func testRfc2217(t *testing.T) (*rfc2217Conn, net.Conn) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return &rfc2217Conn{conn: client, buffer: bufio.NewReader(client)}, server
+}
+
+// readAll reads n bytes of data from c.
+func readAll(t *testing.T, c *rfc2217Conn, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c, data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRfc2217Negotiation(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	want := []byte{
+		telnetIAC, telnetWILL, telnetComPort,
+		telnetIAC, telnetWILL, telnetBinary,
+		telnetIAC, telnetDO, telnetBinary,
+		telnetIAC, telnetSB, telnetComPort, comSetBaudRate, 0, 0, 0x25, 0x80, telnetIAC, telnetSE,
+		telnetIAC, telnetSB, telnetComPort, comSetDataSize, 7, telnetIAC, telnetSE,
+		telnetIAC, telnetSB, telnetComPort, comSetParity, comParityEven, telnetIAC, telnetSE,
+		telnetIAC, telnetSB, telnetComPort, comSetStopSize, comStopSize1, telnetIAC, telnetSE,
+	}
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		negotiation := make([]byte, len(want))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _ := io.ReadFull(conn, negotiation)
+		received <- negotiation[:n]
+	}()
+
+	c, err := dialRfc2217(listener.Addr().String(), 9600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := <-received; !bytes.Equal(got, want) {
+		t.Errorf("negotiation = % x, want % x", got, want)
+	}
+}
+
+func TestRfc2217SubnegotiationEscaping(t *testing.T) {
+	c := &rfc2217Conn{}
+	got := c.subnegotiation(comSetBaudRate, 0, 0, telnetIAC, 1)
+	want := []byte{telnetIAC, telnetSB, telnetComPort, comSetBaudRate, 0, 0, telnetIAC, telnetIAC, 1, telnetIAC, telnetSE}
+	if !bytes.Equal(got, want) {
+		t.Errorf("subnegotiation = % x, want % x", got, want)
+	}
+}
+
+func TestRfc2217Read(t *testing.T) {
+	tests := []struct {
+		name string
+		// writes are sent one after the other, as separate reads of the client
+		writes [][]byte
+		want   []byte
+	}{
+		{"data", [][]byte{[]byte("\x02PAPP\x03")}, []byte("\x02PAPP\x03")},
+		{"escaped IAC", [][]byte{{'a', telnetIAC, telnetIAC, 'b'}}, []byte{'a', telnetIAC, 'b'}},
+		{"escaped IAC split", [][]byte{{'a', telnetIAC}, {telnetIAC, 'b'}}, []byte{'a', telnetIAC, 'b'}},
+		{"subnegotiation", [][]byte{
+			{'a', telnetIAC, telnetSB, telnetComPort, 101, 0, 0, 0x25, 0x80, telnetIAC, telnetSE, 'b'},
+		}, []byte("ab")},
+		{"subnegotiation split", [][]byte{
+			{'a', telnetIAC, telnetSB, telnetComPort, 101, 0, 0},
+			{0x25, 0x80, telnetIAC},
+			{telnetSE, 'b'},
+		}, []byte("ab")},
+		{"subnegotiation with escaped IAC", [][]byte{
+			{telnetIAC, telnetSB, telnetComPort, 101, 0, telnetIAC, telnetIAC, 0, telnetIAC, telnetSE, 'a'},
+		}, []byte("a")},
+		{"accepted options", [][]byte{
+			{telnetIAC, telnetDO, telnetComPort, telnetIAC, telnetWILL, telnetBinary, telnetIAC, telnetWILL, telnetSGA, 'a'},
+		}, []byte("a")},
+	}
+	for _, tt := range tests {
+		c, server := testRfc2217(t)
+		go func(writes [][]byte) {
+			for _, w := range writes {
+				server.Write(w)
+			}
+		}(tt.writes)
+		if got := readAll(t, c, len(tt.want)); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: read % x, want % x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRfc2217Answers(t *testing.T) {
+	tests := []struct {
+		name    string
+		command []byte
+		answer  []byte
+	}{
+		{"DO unknown option", []byte{telnetIAC, telnetDO, 24}, []byte{telnetIAC, telnetWONT, 24}},
+		{"WILL unknown option", []byte{telnetIAC, telnetWILL, 1}, []byte{telnetIAC, telnetDONT, 1}},
+	}
+	for _, tt := range tests {
+		c, server := testRfc2217(t)
+		answers := make(chan []byte, 1)
+		go func(command []byte) {
+			server.Write(append(command, 'a'))
+			answer := make([]byte, 3)
+			server.SetReadDeadline(time.Now().Add(time.Second))
+			n, _ := io.ReadFull(server, answer)
+			answers <- answer[:n]
+		}(tt.command)
+		readAll(t, c, 1)
+		if got := <-answers; !bytes.Equal(got, tt.answer) {
+			t.Errorf("%s: answer % x, want % x", tt.name, got, tt.answer)
+		}
+	}
+}
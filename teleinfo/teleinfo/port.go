@@ -1,14 +1,23 @@
 package teleinfo
 
-import "github.com/tarm/serial"
+import (
+	"time"
+
+	"github.com/tarm/serial"
+)
 
 func OpenPort(serialDevice string, mode string) (*serial.Port, error) {
+	return openPort(serialDevice, mode, 0)
+}
+
+func openPort(serialDevice string, mode string, readTimeout time.Duration) (*serial.Port, error) {
 	cfg := &serial.Config{
-		Name:     serialDevice,
-		Baud:     1200,
-		Size:     7,
-		Parity:   serial.ParityEven,
-		StopBits: serial.Stop1,
+		Name:        serialDevice,
+		Baud:        1200,
+		Size:        7,
+		Parity:      serial.ParityEven,
+		StopBits:    serial.Stop1,
+		ReadTimeout: readTimeout,
 	}
 	if mode == "standard" {
 		cfg.Baud = 9600
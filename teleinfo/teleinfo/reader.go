@@ -56,7 +56,15 @@ func (t *reader) ReadFrame() (Frame, error) {
 	if err != nil {
 		return nil, err
 	}
-	if t.mode != nil && *t.mode == "standard" {
+	mode := "historic"
+	if t.mode != nil {
+		mode = *t.mode
+	}
+	return decodeFrame(rawFrame, mode)
+}
+
+func decodeFrame(rawFrame []byte, mode string) (Frame, error) {
+	if mode == "standard" {
 		return decodeStandardFrame(rawFrame)
 	}
 	return decodeHistoricFrame(rawFrame)
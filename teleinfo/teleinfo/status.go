@@ -0,0 +1,104 @@
+package teleinfo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// CutOff is the state of the meter cut-off device (organe de coupure).
+type CutOff uint
+
+const (
+	CutOffClosed CutOff = iota
+	CutOffOverload
+	CutOffOvervoltage
+	CutOffLoadShedding
+	CutOffRemoteOrder
+	CutOffOverheatingOverCurrent
+	CutOffOverheating
+)
+
+func (c CutOff) String() string {
+	switch c {
+	case CutOffClosed:
+		return "fermé"
+	case CutOffOverload:
+		return "ouvert sur surpuissance"
+	case CutOffOvervoltage:
+		return "ouvert sur surtension"
+	case CutOffLoadShedding:
+		return "ouvert sur délestage"
+	case CutOffRemoteOrder:
+		return "ouvert sur ordre CPL ou Euridis"
+	case CutOffOverheatingOverCurrent:
+		return "ouvert sur surchauffe avec I > Imax"
+	case CutOffOverheating:
+		return "ouvert sur surchauffe avec I < Imax"
+	}
+	return "inconnu"
+}
+
+// TempoColor is a Tempo day color announced by the meter.
+type TempoColor uint
+
+func (c TempoColor) String() string {
+	switch c {
+	case 1:
+		return "bleu"
+	case 2:
+		return "blanc"
+	case 3:
+		return "rouge"
+	}
+	return "pas d'annonce"
+}
+
+// Status holds the decoded STGE status register of a standard mode frame.
+// https://www.enedis.fr/sites/default/files/Enedis-NOI-CPT_54E.pdf - Version 3 - 01/06/2018 - Page 23/38
+type Status struct {
+	DryContactOpen    bool
+	CutOff            CutOff
+	TerminalCoverOpen bool
+	Overvoltage       bool
+	Overload          bool
+	Producer          bool
+	NegativeEnergy    bool
+	SupplierIndex     uint
+	DistributorIndex  uint
+	ClockDegraded     bool
+	StandardTic       bool
+	TempoToday        TempoColor
+	TempoTomorrow     TempoColor
+	// MobilePeakNotice is the announced mobile peak (1 to 3), 0 when none is announced.
+	MobilePeakNotice uint
+	// MobilePeak is the mobile peak in progress (1 to 3), 0 when none.
+	MobilePeak uint
+}
+
+// DecodeStatus decodes the hexadecimal value of the STGE label.
+func DecodeStatus(stge string) (Status, error) {
+	v, err := strconv.ParseUint(stge, 16, 32)
+	if err != nil {
+		return Status{}, fmt.Errorf("error decoding STGE '%s': %w", stge, err)
+	}
+	bits := func(offset, length uint) uint {
+		return uint(v>>offset) & (1<<length - 1)
+	}
+	return Status{
+		DryContactOpen:    bits(0, 1) == 1,
+		CutOff:            CutOff(bits(1, 3)),
+		TerminalCoverOpen: bits(4, 1) == 1,
+		Overvoltage:       bits(6, 1) == 1,
+		Overload:          bits(7, 1) == 1,
+		Producer:          bits(8, 1) == 1,
+		NegativeEnergy:    bits(9, 1) == 1,
+		SupplierIndex:     bits(10, 4) + 1,
+		DistributorIndex:  bits(14, 2) + 1,
+		ClockDegraded:     bits(16, 1) == 1,
+		StandardTic:       bits(17, 1) == 1,
+		TempoToday:        TempoColor(bits(24, 2)),
+		TempoTomorrow:     TempoColor(bits(26, 2)),
+		MobilePeakNotice:  bits(28, 2),
+		MobilePeak:        bits(30, 2),
+	}, nil
+}
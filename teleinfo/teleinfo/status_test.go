@@ -0,0 +1,77 @@
+package teleinfo
+
+import "testing"
+
+// The bits of STGE are described in Enedis-NOI-CPT_54E, page 23/38.
+func TestDecodeStatus(t *testing.T) {
+	base := Status{SupplierIndex: 1, DistributorIndex: 1}
+	with := func(change func(s *Status)) Status {
+		s := base
+		change(&s)
+		return s
+	}
+	tests := []struct {
+		name string
+		stge string
+		want Status
+	}{
+		{"nothing", "00000000", base},
+		// Bit 0: dry contact
+		{"dry contact open", "00000001", with(func(s *Status) { s.DryContactOpen = true })},
+		// Bits 1 to 3: cut-off device
+		{"cut off on overload", "00000002", with(func(s *Status) { s.CutOff = CutOffOverload })},
+		{"cut off on overvoltage", "00000004", with(func(s *Status) { s.CutOff = CutOffOvervoltage })},
+		{"cut off on load shedding", "00000006", with(func(s *Status) { s.CutOff = CutOffLoadShedding })},
+		{"cut off by remote order", "00000008", with(func(s *Status) { s.CutOff = CutOffRemoteOrder })},
+		{"cut off on overheating", "0000000C", with(func(s *Status) { s.CutOff = CutOffOverheating })},
+		// Bit 4: terminal cover, bit 6: overvoltage, bit 7: reference power exceeded
+		{"terminal cover open", "00000010", with(func(s *Status) { s.TerminalCoverOpen = true })},
+		{"overvoltage", "00000040", with(func(s *Status) { s.Overvoltage = true })},
+		{"overload", "00000080", with(func(s *Status) { s.Overload = true })},
+		// Bit 8: producer, bit 9: negative active energy
+		{"producer injecting", "00000300", with(func(s *Status) { s.Producer, s.NegativeEnergy = true, true })},
+		// Bits 10 to 13: supplier index, 14 and 15: distributor index
+		{"indexes", "0000C400", with(func(s *Status) { s.SupplierIndex, s.DistributorIndex = 2, 4 })},
+		{"last supplier index", "00002400", with(func(s *Status) { s.SupplierIndex = 10 })},
+		// Bit 16: degraded clock, bit 17: standard TIC
+		{"degraded clock", "00010000", with(func(s *Status) { s.ClockDegraded = true })},
+		{"standard TIC", "00020000", with(func(s *Status) { s.StandardTic = true })},
+		// Bits 24 and 25: Tempo color of the day, 26 and 27: of the next day
+		{"blue day", "01000000", with(func(s *Status) { s.TempoToday = 1 })},
+		{"white days", "0A000000", with(func(s *Status) { s.TempoToday, s.TempoTomorrow = 2, 2 })},
+		{"red day then blue day", "07000000", with(func(s *Status) { s.TempoToday, s.TempoTomorrow = 3, 1 })},
+		// Bits 28 and 29: mobile peak notice, 30 and 31: mobile peak in progress
+		{"mobile peaks", "E0000000", with(func(s *Status) { s.MobilePeakNotice, s.MobilePeak = 2, 3 })},
+		{"standard meter on a red day", "033A4001", with(func(s *Status) {
+			s.DryContactOpen, s.DistributorIndex, s.StandardTic, s.TempoToday = true, 2, true, 3
+		})},
+	}
+	for _, tt := range tests {
+		got, err := DecodeStatus(tt.stge)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: DecodeStatus(%s) = %+v, want %+v", tt.name, tt.stge, got, tt.want)
+		}
+	}
+
+	if _, err := DecodeStatus("0x3A"); err == nil {
+		t.Error("no error decoding an invalid STGE")
+	}
+}
+
+func TestStatusStrings(t *testing.T) {
+	if got := CutOffOvervoltage.String(); got != "ouvert sur surtension" {
+		t.Errorf("CutOffOvervoltage = %s", got)
+	}
+	if got := CutOff(7).String(); got != "inconnu" {
+		t.Errorf("CutOff(7) = %s", got)
+	}
+	for color, want := range []string{"pas d'annonce", "bleu", "blanc", "rouge"} {
+		if got := TempoColor(color).String(); got != want {
+			t.Errorf("TempoColor(%d) = %s, want %s", color, got, want)
+		}
+	}
+}
@@ -1,83 +1,194 @@
-package main
+package teleinfo2mqtt
 
 import (
+	"energy-center/home-assistant"
+	"energy-center/mqttclient"
+	"errors"
 	"flag"
 	"fmt"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"log"
+	"net"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"teleinfo2mqtt/teleinfo"
 	"time"
 )
 
 const ProgNameMqtt string = "teleinfo2mqtt"
-const WatchdogTimeout = 1 * time.Minute
 
-func watchdogFired() {
-	log.Fatal("Watchdog fired, killing process")
-	os.Exit(4)
+// Version is set when building, with -ldflags "-X teleinfo2mqtt.Version=..."
+var Version = "dev"
+
+const WatchdogTimeout = 1 * time.Minute
+const ModeDetectionTimeout = 10 * time.Second
+
+// Settings are the settings of the bridge, from the command line of teleinfo2mqtt
+// or the teleinfo section of the energy-center configuration file.
+type Settings struct {
+	// Port is the serial port, or tcp://host:port / rfc2217://host:port for a network bridge.
+	Port string `yaml:"port"`
+	// Mode is the Teleinfo mode: standard, historic or auto.
+	Mode string `yaml:"mode"`
+	// EnergyInKwh and PowerInKw select the kWh/kvarh and kW/kVA units.
+	EnergyInKwh bool `yaml:"kwh"`
+	PowerInKw   bool `yaml:"kw"`
+	// ExitAfter is the delay without frame after which the service stops, and
+	// teleinfo2mqtt exits.
+	ExitAfter time.Duration `yaml:"exit_after"`
+	// HealthAddress is the address of the health HTTP endpoint, disabled when empty.
+	HealthAddress string `yaml:"http"`
+	// DiscoveryPrefix is the root of the Home Assistant discovery topics.
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+	Config          `yaml:",inline"`
 }
 
-func main() {
-	var url string
-	var serialDevice string
-	var mode string
+func DefaultSettings() Settings {
+	return Settings{
+		Port:            "/dev/serial/by-id/usb-1a86_USB2.0-Serial-if00-port0",
+		Mode:            "auto",
+		ExitAfter:       DefaultExitAfter,
+		DiscoveryPrefix: homeassistant.DefaultDiscoveryPrefix,
+	}
+}
 
-	flag.StringVar(&url, "url", "192.168.0.20:1883", "mqtt server")
-	flag.StringVar(&serialDevice, "port", "/dev/serial/by-id/usb-1a86_USB2.0-Serial-if00-port0", "serial port")
-	flag.StringVar(&mode, "mode", "standard", "Teleinfo mode standard or historic")
+// Main runs teleinfo2mqtt with its own MQTT connection, configured by the command line.
+func Main() {
+	broker := mqttclient.Config{ClientId: ProgNameMqtt}
+	var secondaryUrl string
+	var configFile string
+	settings := DefaultSettings()
+
+	flag.StringVar(&broker.Url, "url", "192.168.0.20:1883", "mqtt server, e.g. tcp://host:1883 or ssl://host:8883")
+	flag.StringVar(&secondaryUrl, "url2", "", "optional secondary mqtt server, published to simultaneously")
+	flag.StringVar(&broker.Username, "username", "", "mqtt username")
+	flag.StringVar(&broker.Password, "password", "", "mqtt password")
+	flag.StringVar(&broker.CaFile, "ca-file", "", "PEM certificate authorities trusted for TLS")
+	flag.StringVar(&settings.Port, "port", settings.Port, "serial port, or tcp://host:port / rfc2217://host:port for a network bridge")
+	flag.StringVar(&settings.Mode, "mode", settings.Mode, "Teleinfo mode standard, historic or auto")
+	flag.BoolVar(&settings.EnergyInKwh, "kwh", false, "publish energy indices in kWh/kvarh instead of Wh/varh")
+	flag.BoolVar(&settings.PowerInKw, "kw", false, "publish powers in kW/kVA instead of W/VA")
+	flag.StringVar(&configFile, "config", "", "optional YAML configuration file")
+	flag.DurationVar(&settings.ExitAfter, "exit-after", settings.ExitAfter, "exit when no frame was received for this duration")
+	flag.StringVar(&settings.DiscoveryPrefix, "discovery-prefix", settings.DiscoveryPrefix, "root of the Home Assistant discovery topics")
+	flag.StringVar(&settings.HealthAddress, "http", "", "address of the health HTTP endpoint, e.g. :8081 (disabled when empty)")
 
 	flag.Parse()
 
-	if mode != "historic" && mode != "standard" {
+	if err := settings.Validate(); err != nil {
+		fmt.Println(err)
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	port, err := teleinfo.OpenPort(serialDevice, mode)
+	config, err := loadConfig(configFile)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	defer port.Close()
+	settings.Config = config
 
 	mqtt.ERROR = log.New(os.Stdout, "", 0)
-	opts := mqtt.NewClientOptions().AddBroker(url).SetClientID(ProgNameMqtt)
-	opts.SetKeepAlive(60 * time.Second)
-	opts.SetPingTimeout(1 * time.Second)
-
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		panic(token.Error())
+	var service *Service
+	onConnect := func(client mqtt.Client) {
+		service.OnConnect()
 	}
 
-	fmt.Printf("%s: connected to %s\n", ProgNameMqtt, url)
+	var client mqtt.Client
+	if secondaryUrl == "" {
+		client, err = newBrokerClient(broker, false, onConnect)
+	} else {
+		// Retry in the background so that the bridge starts with a single broker reachable
+		secondary := broker
+		secondary.Url = secondaryUrl
+		var primaryClient, secondaryClient mqtt.Client
+		primaryClient, err = newBrokerClient(broker, true, onConnect)
+		if err == nil {
+			secondaryClient, err = newBrokerClient(secondary, true, onConnect)
+		}
+		client = brokers{primaryClient, secondaryClient}
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-	watchdog := time.AfterFunc(WatchdogTimeout, watchdogFired)
+	service, err = NewService(client, settings)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-	// Read Teleinfo frames and send them into mqtt
-	go handleFrame(teleinfo.NewReader(port, &mode), client, watchdog)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		panic(token.Error())
+	}
 
-	<-(chan int)(nil) //trick to wait for ever
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	code := service.Run(signals)
+	client.Disconnect(250)
+	os.Exit(code)
+}
 
-	fmt.Printf("%s: Reached end of app, should not happens\n", ProgNameMqtt)
+func (s Settings) Validate() error {
+	if s.Mode != "historic" && s.Mode != "standard" && s.Mode != "auto" {
+		return fmt.Errorf("unsupported mode '%s', expected standard, historic or auto", s.Mode)
+	}
+	return nil
 }
 
-func handleFrame(reader teleinfo.Reader, client mqtt.Client, watchdog *time.Timer) {
+// handleFrame publishes the frames read until done is closed or the port is
+// closed, every read failing at once afterwards.
+func handleFrame(done <-chan struct{}, reader teleinfo.Reader, client mqtt.Client, available *availability, units unitOptions, config Config) {
 	fmt.Printf("handleFrame\n")
 	for {
 		frame, err := reader.ReadFrame()
+		if err != nil && (errors.Is(err, os.ErrClosed) || errors.Is(err, net.ErrClosed)) {
+			return
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+		stats.record(err)
 		if err != nil {
 			fmt.Printf("Error reading Teleinfo frame: %s\n", err)
 			continue
 		}
+		device := meterDevice(frame)
+		var configs []homeassistant.ConfigurationItem
 		for k, v := range frame.AsMap() {
+			if !config.Labels.allows(k) {
+				continue
+			}
 			key := strings.Replace(k, "+", "p", -1)
 			value := strings.TrimSpace(strings.Replace(v, "\t", " ", -1))
+			label, known := teleinfo.LookupLabel(k)
+			if known {
+				value = units.normalize(label, value)
+			}
+			if transform, ok := config.Transforms[k]; ok {
+				value = transform.apply(value)
+			}
+			if known && config.Discovery.allows(k) && configSent.markSent(key) {
+				configs = append(configs, configurationItem(key, label, device, units))
+			}
 			token := client.Publish("teleinfo/"+key, 0, false, value)
 			token.Wait()
-			watchdog.Reset(WatchdogTimeout)
+		}
+		available.frameReceived()
+		sendConfiguration(client, configs)
+		if !config.Subscription.Disabled {
+			publishSubscription(client, frame, device, config.Subscription)
+		}
+		if config.Labels.allows("STGE") {
+			publishEvents(client, frame, device, config.Discovery.allows("STGE"))
+		}
+		if config.Statistics.Enabled {
+			minuteStats.add(client, frame, config.Statistics)
 		}
 	}
 }
@@ -0,0 +1,34 @@
+package teleinfo2mqtt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Transform describes how the value of a label is rewritten before being published.
+type Transform struct {
+	// Map replaces values found in the map, e.g. PTEC codes by friendly strings.
+	Map map[string]string `yaml:"map"`
+	// StripLeadingZeros removes the zero padding of numeric values.
+	StripLeadingZeros bool `yaml:"strip_leading_zeros"`
+	// Scale multiplies numeric values, when not zero.
+	Scale float64 `yaml:"scale"`
+}
+
+func (t Transform) apply(value string) string {
+	if mapped, ok := t.Map[value]; ok {
+		value = mapped
+	}
+	if t.StripLeadingZeros {
+		value = strings.TrimLeft(value, "0")
+		if value == "" || strings.HasPrefix(value, ".") {
+			value = "0" + value
+		}
+	}
+	if t.Scale != 0 {
+		if num, err := strconv.ParseFloat(value, 64); err == nil {
+			value = strconv.FormatFloat(num*t.Scale, 'f', -1, 64)
+		}
+	}
+	return value
+}
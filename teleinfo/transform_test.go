@@ -0,0 +1,28 @@
+package teleinfo2mqtt
+
+import "testing"
+
+func TestTransformApply(t *testing.T) {
+	ptec := map[string]string{"HP..": "Heures pleines", "HC..": "Heures creuses"}
+	tests := []struct {
+		name      string
+		transform Transform
+		value     string
+		want      string
+	}{
+		{"none", Transform{}, "000420", "000420"},
+		{"mapped", Transform{Map: ptec}, "HC..", "Heures creuses"},
+		{"not mapped", Transform{Map: ptec}, "TH..", "TH.."},
+		{"leading zeros", Transform{StripLeadingZeros: true}, "002565285", "2565285"},
+		{"zero", Transform{StripLeadingZeros: true}, "00000", "0"},
+		{"decimal", Transform{StripLeadingZeros: true}, "000.5", "0.5"},
+		{"scale", Transform{Scale: 0.001}, "002565285", "2565.285"},
+		{"scale after map", Transform{Map: map[string]string{"A": "2"}, Scale: 10}, "A", "20"},
+		{"scale of a text", Transform{Scale: 10}, "TH..", "TH.."},
+	}
+	for _, tt := range tests {
+		if got := tt.transform.apply(tt.value); got != tt.want {
+			t.Errorf("%s: apply(%q) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package teleinfo2mqtt
+
+import (
+	"energy-center/home-assistant"
+	"strconv"
+	"teleinfo2mqtt/teleinfo"
+)
+
+// unitOptions selects the units used when publishing values.
+type unitOptions struct {
+	energyInKwh bool
+	powerInKw   bool
+}
+
+// normalize converts a raw frame value to the configured unit.
+// Values which are not numeric or do not need conversion are returned as is.
+func (o unitOptions) normalize(label teleinfo.Label, value string) string {
+	var scaled bool
+	switch label.Kind {
+	case teleinfo.KindEnergy, teleinfo.KindReactiveEnergy:
+		scaled = o.energyInKwh
+	case teleinfo.KindApparentPower, teleinfo.KindActivePower:
+		scaled = o.powerInKw
+	}
+	if !scaled {
+		return value
+	}
+	num, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return value
+	}
+	return strconv.FormatFloat(float64(num)/1000, 'f', 3, 64)
+}
+
+// unit returns the unit announced in the discovery configuration of label.
+func (o unitOptions) unit(label teleinfo.Label) homeassistant.Unit {
+	switch label.Kind {
+	case teleinfo.KindEnergy:
+		if o.energyInKwh {
+			return homeassistant.KWh
+		}
+		return homeassistant.Wh
+	case teleinfo.KindReactiveEnergy:
+		if o.energyInKwh {
+			return homeassistant.KVArh
+		}
+		return homeassistant.VArh
+	case teleinfo.KindApparentPower:
+		if o.powerInKw {
+			return homeassistant.KVA
+		}
+		return homeassistant.VA
+	case teleinfo.KindActivePower:
+		if o.powerInKw {
+			return homeassistant.KW
+		}
+		return homeassistant.W
+	case teleinfo.KindCurrent:
+		return homeassistant.A
+	case teleinfo.KindVoltage:
+		return homeassistant.V
+	}
+	return homeassistant.None
+}
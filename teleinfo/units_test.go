@@ -0,0 +1,43 @@
+package teleinfo2mqtt
+
+import (
+	"testing"
+
+	"energy-center/home-assistant"
+	"teleinfo2mqtt/teleinfo"
+)
+
+func TestNormalize(t *testing.T) {
+	kilo := unitOptions{energyInKwh: true, powerInKw: true}
+	tests := []struct {
+		name    string
+		options unitOptions
+		label   string
+		value   string
+		want    string
+		unit    homeassistant.Unit
+	}{
+		{"energy in Wh", unitOptions{}, "EAST", "012345678", "012345678", homeassistant.Wh},
+		{"energy in kWh", kilo, "EAST", "012345678", "12345.678", homeassistant.KWh},
+		{"historic index in kWh", kilo, "BASE", "002565285", "2565.285", homeassistant.KWh},
+		{"reactive energy in kVArh", kilo, "ERQ1", "000001500", "1.500", homeassistant.KVArh},
+		{"apparent power in VA", unitOptions{}, "SINSTS", "00420", "00420", homeassistant.VA},
+		{"apparent power in kVA", kilo, "SINSTS", "00420", "0.420", homeassistant.KVA},
+		{"energy only in kWh", unitOptions{energyInKwh: true}, "SINSTS", "00420", "00420", homeassistant.VA},
+		{"current", kilo, "IRMS1", "002", "002", homeassistant.A},
+		{"text", kilo, "NGTF", "TEMPO", "TEMPO", homeassistant.None},
+		{"invalid number", kilo, "EAST", "0123A5678", "0123A5678", homeassistant.KWh},
+	}
+	for _, tt := range tests {
+		label, ok := teleinfo.LookupLabel(tt.label)
+		if !ok {
+			t.Fatalf("%s: unknown label %s", tt.name, tt.label)
+		}
+		if got := tt.options.normalize(label, tt.value); got != tt.want {
+			t.Errorf("%s: normalize(%s) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+		if got := tt.options.unit(label); got != tt.unit {
+			t.Errorf("%s: unit = %q, want %q", tt.name, got, tt.unit)
+		}
+	}
+}